@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+const apiKeyUsage = "usage: byfood [flags] apikey create NAME ROLE|list|revoke NAME|generate"
+
+// runAPIKey implements the apikey subcommand, which manages the API keys
+// stored in the database. generate prints a key and its hash for the config
+// file without storing anything. Keys are only ever shown when created.
+// ROLE is one of models.Roles.
+func runAPIKey(ctx context.Context, cfg models.AppConfig, db *gorm.DB, args []string, w io.Writer) error {
+	switch {
+	case len(args) == 1 && args[0] == "generate":
+		key := auth.GenerateAPIKey()
+		_, _ = fmt.Fprintf(w, "Key:  %s\nHash: %s\n", key, auth.HashAPIKey(key))
+		return nil
+	case len(args) == 3 && args[0] == "create":
+		if !slices.Contains(models.Roles, args[2]) {
+			return fmt.Errorf("role %q must be one of %s", args[2], strings.Join(models.Roles, ", "))
+		}
+	case len(args) == 2 && args[0] == "revoke", len(args) == 1 && args[0] == "list":
+	default:
+		return errors.New(apiKeyUsage)
+	}
+	if err := checkSchema(db, cfg.AutoMigrate); err != nil {
+		return err
+	}
+	keys := repository.NewGormAPIKeyRepository(db)
+
+	switch args[0] {
+	case "create":
+		key := auth.GenerateAPIKey()
+		err := keys.Create(ctx, &models.APIKey{Name: args[1], Hash: auth.HashAPIKey(key), Role: args[2]})
+		if errors.Is(err, repository.ErrDuplicate) {
+			return fmt.Errorf("an API key named %q already exists", args[1])
+		}
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "Created %s API key %s. Store it now, it cannot be shown again:\n%s\n", args[2], args[1], key)
+	case "revoke":
+		err := keys.Delete(ctx, args[1])
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("no API key is named %q", args[1])
+		}
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "Revoked API key %s\n", args[1])
+	case "list":
+		list, err := keys.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, k := range list {
+			_, _ = fmt.Fprintf(w, "%s  %s  created %s\n", k.Name, k.Role, k.CreatedAt.Format("2006-01-02 15:04:05Z07:00"))
+		}
+	}
+	return nil
+}
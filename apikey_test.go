@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/repository"
+	"github.com/burhangltekin/byfood/utils"
+)
+
+func TestRunCommandAPIKey(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.LogLevel = "error"
+	cfg.AutoMigrate = true
+	cfg.Database.DSN = filepath.Join(t.TempDir(), "books.db")
+
+	var out bytes.Buffer
+	require.Equal(t, exitOK, runCommand(cfg, []string{"apikey", "create", "ci", "editor"}, &out), out.String())
+	key := regexp.MustCompile(`bfk_\S+`).FindString(out.String())
+	require.NotEmpty(t, key, out.String())
+
+	// The created key is accepted by the server.
+	db, err := utils.OpenDB(cfg)
+	require.NoError(t, err)
+	a, err := auth.New(cfg.Auth, repository.NewGormAPIKeyRepository(db))
+	require.NoError(t, err)
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(auth.APIKeyHeader, key)
+	p, err := a.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", p.Subject)
+	assert.Equal(t, []string{"editor"}, p.Roles)
+	require.NoError(t, utils.CloseDB(db))
+
+	steps := []struct {
+		args         []string
+		expectCode   int
+		expectOutput string
+	}{
+		{args: []string{"apikey", "create", "ci", "admin"}, expectCode: exitError, expectOutput: `an API key named "ci" already exists`},
+		{args: []string{"apikey", "create", "other", "owner"}, expectCode: exitError, expectOutput: `role "owner" must be one of reader, editor, admin`},
+		{args: []string{"apikey", "list"}, expectCode: exitOK, expectOutput: "ci  editor  created "},
+		{args: []string{"apikey", "revoke", "ci"}, expectCode: exitOK, expectOutput: "Revoked API key ci"},
+		{args: []string{"apikey", "revoke", "ci"}, expectCode: exitError, expectOutput: `no API key is named "ci"`},
+		{args: []string{"apikey", "generate"}, expectCode: exitOK, expectOutput: "Hash: "},
+		{args: []string{"apikey", "create", "ci"}, expectCode: exitError, expectOutput: apiKeyUsage},
+	}
+	for _, step := range steps {
+		out.Reset()
+		code := runCommand(cfg, step.args, &out)
+		assert.Equal(t, step.expectCode, code, step.args)
+		assert.Contains(t, out.String(), step.expectOutput, step.args)
+	}
+}
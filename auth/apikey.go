@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// apiKeyPrefix marks API keys generated by GenerateAPIKey so that they are
+// easy to recognise, for instance by secret scanners.
+const apiKeyPrefix = "bfk_"
+
+// GenerateAPIKey returns a new random API key with 256 bits of entropy.
+func GenerateAPIKey() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// HashAPIKey returns the digest API keys are stored and looked up by: the
+// hex-encoded SHA-256 of the key. A fast hash is enough since keys are
+// random rather than chosen by people.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
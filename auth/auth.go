@@ -0,0 +1,126 @@
+// Package auth authenticates API requests by API key or JWT bearer token.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// APIKeyHeader carries the API key of a request.
+const APIKeyHeader = "X-API-Key"
+
+// Methods by which a Principal was authenticated.
+const (
+	MethodAPIKey = "apiKey"
+	MethodJWT    = "jwt"
+)
+
+// ErrNoCredentials is returned by Authenticate for requests that carry
+// neither an API key nor a bearer token.
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrInvalidCredentials is returned by Authenticate for requests whose
+// credentials are not accepted.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrInvalidToken is returned, wrapped with the reason, for bearer tokens
+// that are not accepted. It is an ErrInvalidCredentials.
+var ErrInvalidToken = fmt.Errorf("%w: invalid bearer token", ErrInvalidCredentials)
+
+// Principal is who a request was made by: the name of its API key or the
+// subject of its token, together with the roles it was given.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Method  string   `json:"method"`
+	Roles   []string `json:"roles"`
+}
+
+// KeyStore looks up the API keys stored outside the config file by their
+// hash, failing with repository.ErrNotFound for unknown keys.
+type KeyStore interface {
+	FindByHash(ctx context.Context, hash string) (models.APIKey, error)
+}
+
+// Authenticator checks the credentials of requests against the configured
+// API keys and token keys.
+type Authenticator struct {
+	keys  map[string]models.APIKeyConfig
+	store KeyStore
+	jwt   *JWTVerifier
+}
+
+// New returns an Authenticator accepting the API keys of cfg and those in
+// store, which may be nil, and the bearer tokens selected by cfg.JWT. It
+// fails if the JWKS file cannot be loaded.
+func New(cfg models.AuthConfig, store KeyStore) (*Authenticator, error) {
+	a := &Authenticator{keys: map[string]models.APIKeyConfig{}, store: store}
+	for _, k := range cfg.APIKeys {
+		a.keys[strings.ToLower(k.Hash)] = k
+	}
+	if cfg.JWT.HMACSecret != "" || cfg.JWT.JWKSFile != "" {
+		v, err := NewJWTVerifier(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = v
+	}
+	return a, nil
+}
+
+// Authenticate returns who r was made by. A request may carry an API key in
+// the X-API-Key header or a token in an Authorization header using the
+// Bearer scheme, but not both. It fails with ErrNoCredentials for requests
+// without either and with an ErrInvalidCredentials for credentials that are
+// not accepted; other errors mean that the credentials could not be checked.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	authorization := r.Header.Get("Authorization")
+	switch {
+	case key != "" && authorization != "":
+		return Principal{}, fmt.Errorf("%w: send either an API key or a bearer token", ErrInvalidCredentials)
+	case key != "":
+		return a.authenticateKey(r.Context(), key)
+	case authorization != "":
+		scheme, token, _ := strings.Cut(authorization, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return Principal{}, fmt.Errorf("%w: unsupported authorization scheme %q", ErrInvalidCredentials, scheme)
+		}
+		return a.authenticateToken(strings.TrimSpace(token))
+	default:
+		return Principal{}, ErrNoCredentials
+	}
+}
+
+func (a *Authenticator) authenticateKey(ctx context.Context, key string) (Principal, error) {
+	hash := HashAPIKey(key)
+	if k, ok := a.keys[hash]; ok {
+		return Principal{Subject: k.Name, Method: MethodAPIKey, Roles: []string{k.Role}}, nil
+	}
+	if a.store != nil {
+		k, err := a.store.FindByHash(ctx, hash)
+		if err == nil {
+			return Principal{Subject: k.Name, Method: MethodAPIKey, Roles: []string{k.Role}}, nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return Principal{}, fmt.Errorf("failed to look up API key: %w", err)
+		}
+	}
+	return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+}
+
+func (a *Authenticator) authenticateToken(token string) (Principal, error) {
+	if a.jwt == nil {
+		return Principal{}, fmt.Errorf("%w: bearer tokens are not accepted", ErrInvalidToken)
+	}
+	claims, err := a.jwt.Verify(token)
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Subject: claims.Subject, Method: MethodJWT, Roles: claims.Roles}, nil
+}
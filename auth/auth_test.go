@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// brokenKeyStore fails every lookup.
+type brokenKeyStore struct{}
+
+func (brokenKeyStore) FindByHash(context.Context, string) (models.APIKey, error) {
+	return models.APIKey{}, errors.New("database is closed")
+}
+
+func TestAuthenticate(t *testing.T) {
+	store := repository.NewMemoryAPIKeyRepository(models.APIKey{Name: "stored", Hash: HashAPIKey("db-key"), Role: models.RoleAdmin})
+	a, err := New(models.AuthConfig{
+		APIKeys: []models.APIKeyConfig{{Name: "ci", Hash: HashAPIKey("config-key"), Role: models.RoleEditor}},
+		JWT:     models.JWTConfig{HMACSecret: testSecret},
+	}, store)
+	require.NoError(t, err)
+	token, err := SignHS256(map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"reader"}}, []byte(testSecret))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		headers         map[string]string
+		expectPrincipal Principal
+		expectError     error
+	}{
+		{name: "config key", headers: map[string]string{"X-API-Key": "config-key"}, expectPrincipal: Principal{Subject: "ci", Method: MethodAPIKey, Roles: []string{"editor"}}},
+		{name: "stored key", headers: map[string]string{"X-API-Key": "db-key"}, expectPrincipal: Principal{Subject: "stored", Method: MethodAPIKey, Roles: []string{"admin"}}},
+		{name: "bearer token", headers: map[string]string{"Authorization": "Bearer " + token}, expectPrincipal: Principal{Subject: "alice", Method: MethodJWT, Roles: []string{"reader"}}},
+		{name: "lower case scheme", headers: map[string]string{"Authorization": "bearer " + token}, expectPrincipal: Principal{Subject: "alice", Method: MethodJWT, Roles: []string{"reader"}}},
+		{name: "no credentials", expectError: ErrNoCredentials},
+		{name: "unknown key", headers: map[string]string{"X-API-Key": "guess"}, expectError: ErrInvalidCredentials},
+		{name: "invalid token", headers: map[string]string{"Authorization": "Bearer abc"}, expectError: ErrInvalidToken},
+		{name: "basic auth", headers: map[string]string{"Authorization": "Basic YTpi"}, expectError: ErrInvalidCredentials},
+		{name: "both", headers: map[string]string{"X-API-Key": "config-key", "Authorization": "Bearer " + token}, expectError: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			p, err := a.Authenticate(req)
+			if tt.expectError != nil {
+				assert.ErrorIs(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectPrincipal, p)
+		})
+	}
+}
+
+func TestAuthenticateWithoutTokens(t *testing.T) {
+	a, err := New(models.AuthConfig{}, brokenKeyStore{})
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer abc")
+	_, err = a.Authenticate(req)
+	assert.ErrorContains(t, err, "bearer tokens are not accepted")
+
+	// A failing key store is not mistaken for an unknown key.
+	req, _ = http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(APIKeyHeader, "key")
+	_, err = a.Authenticate(req)
+	assert.ErrorContains(t, err, "database is closed")
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key := GenerateAPIKey()
+	assert.Regexp(t, `^bfk_[A-Za-z0-9_-]{43}$`, key)
+	assert.NotEqual(t, key, GenerateAPIKey())
+	assert.Len(t, HashAPIKey(key), 64)
+}
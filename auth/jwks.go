@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys.
+const minRSABits = 2048
+
+// JWK is an RSA public key of a JSON Web Key Set, named by its key ID.
+type JWK struct {
+	ID  string
+	Key *rsa.PublicKey
+}
+
+// jsonWebKey is a key as written in a JWKS document (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS reads the RSA signing keys of the JSON Web Key Set at path. Keys
+// of other types or meant for encryption or other algorithms are skipped.
+// It fails if no usable key remains or two keys share an ID.
+func LoadJWKS(path string) ([]JWK, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	keys, err := ParseJWKS(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ParseJWKS parses the RSA signing keys of a JSON Web Key Set as LoadJWKS
+// does.
+func ParseJWKS(b []byte) ([]JWK, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("malformed JWKS: %w", err)
+	}
+	var keys []JWK
+	seen := map[string]bool{}
+	for i, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != RS256) {
+			continue
+		}
+		if seen[k.Kid] {
+			return nil, fmt.Errorf("key %d: duplicate key ID %q", i, k.Kid)
+		}
+		seen[k.Kid] = true
+		pub, err := rsaPublicKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		keys = append(keys, JWK{ID: k.Kid, Key: pub})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no RSA signing keys")
+	}
+	return keys, nil
+}
+
+func rsaPublicKey(k jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("malformed modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("malformed exponent")
+	}
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if pub.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key has %d bits, at least %d are required", pub.N.BitLen(), minRSABits)
+	}
+	if pub.E < 3 || pub.E%2 == 0 {
+		return nil, errors.New("invalid exponent")
+	}
+	return pub, nil
+}
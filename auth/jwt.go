@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// Signing algorithms of the tokens that are accepted.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// clockSkew is how far the clocks of token issuers may be off from ours.
+const clockSkew = time.Minute
+
+// NumericDate is a JWT time: seconds since the Unix epoch.
+type NumericDate int64
+
+// NewNumericDate returns t as a NumericDate.
+func NewNumericDate(t time.Time) NumericDate {
+	return NumericDate(t.Unix())
+}
+
+// Time returns d as a time.
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+// UnmarshalJSON accepts fractional seconds, which RFC 7519 allows.
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	var f float64
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("invalid date %s", b)
+	}
+	*d = NumericDate(f)
+	return nil
+}
+
+// Audience is the aud claim, which may be written as a single string or as
+// an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	list, err := stringOrList(b)
+	if err != nil {
+		return fmt.Errorf("invalid audience %s", b)
+	}
+	*a = list
+	return nil
+}
+
+// stringOrList decodes a JSON string or array of strings.
+func stringOrList(b []byte) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		return []string{single}, nil
+	}
+	var list []string
+	err := json.Unmarshal(b, &list)
+	return list, err
+}
+
+// Claims are the registered claims of a token that are checked, the email
+// of user sessions, and the roles read from the configured roles claim.
+type Claims struct {
+	Issuer    string      `json:"iss,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Email     string      `json:"email,omitempty"`
+	Audience  Audience    `json:"aud,omitempty"`
+	ExpiresAt NumericDate `json:"exp,omitempty"`
+	NotBefore NumericDate `json:"nbf,omitempty"`
+	IssuedAt  NumericDate `json:"iat,omitempty"`
+	Roles     []string    `json:"-"`
+}
+
+// defaultRolesClaim is the claim roles are read from unless configured
+// otherwise.
+const defaultRolesClaim = "roles"
+
+// header is the JOSE header of a token.
+type header struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid,omitempty"`
+	Typ  string   `json:"typ,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+// JWTVerifier checks the signature and claims of JWT bearer tokens.
+type JWTVerifier struct {
+	secret     []byte
+	keys       []JWK
+	issuer     string
+	audience   string
+	rolesClaim string
+	now        func() time.Time
+}
+
+// NewJWTVerifier returns a verifier for the tokens selected by cfg, loading
+// the keys of its JWKS file if one is set.
+func NewJWTVerifier(cfg models.JWTConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		secret:     []byte(cfg.HMACSecret),
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		rolesClaim: cfg.RolesClaim,
+		now:        time.Now,
+	}
+	if v.rolesClaim == "" {
+		v.rolesClaim = defaultRolesClaim
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+	}
+	return v, nil
+}
+
+// Verify returns the claims of token if it is signed by one of the keys of
+// v and is currently valid. Tokens must expire; their issuer and audience
+// must match those configured. It fails with an ErrInvalidToken.
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return claims, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	if len(h.Crit) > 0 {
+		return claims, fmt.Errorf("%w: unsupported critical header %q", ErrInvalidToken, h.Crit[0])
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], sig); err != nil {
+		return claims, err
+	}
+	var all map[string]json.RawMessage
+	if decodeSegment(parts[1], &claims) != nil || decodeSegment(parts[1], &all) != nil {
+		return claims, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if raw, ok := all[v.rolesClaim]; ok {
+		roles, err := stringOrList(raw)
+		if err != nil {
+			return claims, fmt.Errorf("%w: claim %s must list role names", ErrInvalidToken, v.rolesClaim)
+		}
+		claims.Roles = roles
+	}
+	return claims, v.checkClaims(claims)
+}
+
+// verifySignature checks sig over signed with the key for the algorithm of
+// the token. Each algorithm has its own keys, so a token cannot have an RSA
+// public key used as its HMAC secret.
+func (v *JWTVerifier) verifySignature(h header, signed string, sig []byte) error {
+	switch h.Alg {
+	case HS256:
+		if len(v.secret) == 0 {
+			break
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+		return nil
+	case RS256:
+		if len(v.keys) == 0 {
+			break
+		}
+		digest := sha256.Sum256([]byte(signed))
+		for _, k := range v.keys {
+			if h.Kid != "" && k.ID != h.Kid {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(k.Key, crypto.SHA256, digest[:], sig) == nil {
+				return nil
+			}
+		}
+		if h.Kid != "" && !slices.ContainsFunc(v.keys, func(k JWK) bool { return k.ID == h.Kid }) {
+			return fmt.Errorf("%w: unknown key %q", ErrInvalidToken, h.Kid)
+		}
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+	return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Alg)
+}
+
+func (v *JWTVerifier) checkClaims(c Claims) error {
+	now := v.now()
+	switch {
+	case c.ExpiresAt == 0:
+		return fmt.Errorf("%w: token has no expiry", ErrInvalidToken)
+	case now.After(c.ExpiresAt.Time().Add(clockSkew)):
+		return fmt.Errorf("%w: token has expired", ErrInvalidToken)
+	case c.NotBefore != 0 && now.Add(clockSkew).Before(c.NotBefore.Time()):
+		return fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	case c.IssuedAt != 0 && now.Add(clockSkew).Before(c.IssuedAt.Time()):
+		return fmt.Errorf("%w: token was issued in the future", ErrInvalidToken)
+	case v.issuer != "" && c.Issuer != v.issuer:
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.Issuer)
+	case v.audience != "" && !slices.Contains(c.Audience, v.audience):
+		return fmt.Errorf("%w: token is not meant for this audience", ErrInvalidToken)
+	case c.Subject == "":
+		return fmt.Errorf("%w: token has no subject", ErrInvalidToken)
+	}
+	return nil
+}
+
+// SignHS256 returns a token carrying claims signed with secret.
+func SignHS256(claims any, secret []byte) (string, error) {
+	signed, err := signingInput(HS256, claims)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// signingInput encodes the header and claims of a token signed with alg.
+func signingInput(alg string, claims any) (string, error) {
+	h, err := json.Marshal(header{Alg: alg, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c), nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token.
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
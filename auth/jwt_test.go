@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+var testSecret = strings.Repeat("s", 32)
+
+// signRS256 returns a token carrying claims signed with key, naming kid in
+// its header.
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims any) string {
+	t.Helper()
+	h, err := json.Marshal(header{Alg: RS256, Kid: kid, Typ: "JWT"})
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// writeJWKS writes a JWKS holding the public keys of keys, by key ID, and
+// returns its path.
+func writeJWKS(t *testing.T, keys map[string]*rsa.PrivateKey) string {
+	t.Helper()
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, k := range keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kty: "RSA", Kid: kid, Use: "sig", Alg: RS256,
+			N: base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		})
+	}
+	b, err := json.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+	return path
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	v, err := NewJWTVerifier(models.JWTConfig{
+		HMACSecret: testSecret,
+		JWKSFile:   writeJWKS(t, map[string]*rsa.PrivateKey{"k1": rsaKey}),
+		Issuer:     "https://issuer.example",
+		Audience:   "byfood",
+	})
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+	v.now = func() time.Time { return now }
+
+	valid := Claims{
+		Issuer:    "https://issuer.example",
+		Subject:   "alice",
+		Audience:  Audience{"byfood"},
+		ExpiresAt: NewNumericDate(now.Add(time.Hour)),
+		IssuedAt:  NewNumericDate(now),
+	}
+	with := func(mutate func(c *Claims)) Claims {
+		c := valid
+		mutate(&c)
+		return c
+	}
+	hs256 := func(claims any) string {
+		token, err := SignHS256(claims, []byte(testSecret))
+		require.NoError(t, err)
+		return token
+	}
+	// The HMAC secret of an algorithm confusion attack is the public key.
+	confused, err := SignHS256(valid, rsaKey.N.Bytes())
+	require.NoError(t, err)
+	unsigned := strings.Join(strings.Split(hs256(valid), ".")[:2], ".") + "."
+	unsigned = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + unsigned[strings.Index(unsigned, "."):]
+	tampered := hs256(valid)
+	tampered = tampered[:len(tampered)-2] + "AA"
+
+	tests := []struct {
+		name        string
+		token       string
+		expectError string
+	}{
+		{name: "HS256", token: hs256(valid)},
+		{name: "RS256", token: signRS256(t, rsaKey, "k1", valid)},
+		{name: "RS256 without key ID", token: signRS256(t, rsaKey, "", valid)},
+		{name: "audience list", token: hs256(with(func(c *Claims) { c.Audience = Audience{"other", "byfood"} }))},
+		{name: "audience string", token: hs256(map[string]any{"iss": valid.Issuer, "sub": "alice", "aud": "byfood", "exp": 1_700_003_600.5})},
+		{name: "expired within clock skew", token: hs256(with(func(c *Claims) { c.ExpiresAt = NewNumericDate(now.Add(-30 * time.Second)) }))},
+		{name: "expired", token: hs256(with(func(c *Claims) { c.ExpiresAt = NewNumericDate(now.Add(-2 * time.Minute)) })), expectError: "token has expired"},
+		{name: "no expiry", token: hs256(with(func(c *Claims) { c.ExpiresAt = 0 })), expectError: "token has no expiry"},
+		{name: "not yet valid", token: hs256(with(func(c *Claims) { c.NotBefore = NewNumericDate(now.Add(time.Hour)) })), expectError: "not valid yet"},
+		{name: "issued in the future", token: hs256(with(func(c *Claims) { c.IssuedAt = NewNumericDate(now.Add(time.Hour)) })), expectError: "issued in the future"},
+		{name: "wrong issuer", token: hs256(with(func(c *Claims) { c.Issuer = "https://evil.example" })), expectError: `unexpected issuer "https://evil.example"`},
+		{name: "wrong audience", token: hs256(with(func(c *Claims) { c.Audience = Audience{"other"} })), expectError: "not meant for this audience"},
+		{name: "no subject", token: hs256(with(func(c *Claims) { c.Subject = "" })), expectError: "token has no subject"},
+		{name: "wrong secret", token: func() string { tk, _ := SignHS256(valid, []byte("other")); return tk }(), expectError: "signature mismatch"},
+		{name: "tampered signature", token: tampered, expectError: "signature mismatch"},
+		{name: "other RSA key", token: signRS256(t, otherKey, "k1", valid), expectError: "signature mismatch"},
+		{name: "unknown key ID", token: signRS256(t, rsaKey, "k2", valid), expectError: `unknown key "k2"`},
+		{name: "algorithm confusion", token: confused, expectError: "signature mismatch"},
+		{name: "alg none", token: unsigned, expectError: `unsupported algorithm "none"`},
+		{name: "two segments", token: "a.b", expectError: "malformed token"},
+		{name: "garbage header", token: "!!.e30.", expectError: "malformed header"},
+		{name: "critical header", token: base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","crit":["b64"]}`)) + ".e30.", expectError: `unsupported critical header "b64"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(tt.token)
+			if tt.expectError != "" {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "alice", claims.Subject)
+		})
+	}
+}
+
+func TestJWTVerifierAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	claims := Claims{Subject: "alice", ExpiresAt: NewNumericDate(time.Now().Add(time.Hour))}
+
+	// Without an HMAC secret, HS256 tokens are refused whatever their key.
+	rsaOnly, err := NewJWTVerifier(models.JWTConfig{JWKSFile: writeJWKS(t, map[string]*rsa.PrivateKey{"k1": rsaKey})})
+	require.NoError(t, err)
+	token, err := SignHS256(claims, nil)
+	require.NoError(t, err)
+	_, err = rsaOnly.Verify(token)
+	assert.ErrorContains(t, err, `unsupported algorithm "HS256"`)
+
+	hmacOnly, err := NewJWTVerifier(models.JWTConfig{HMACSecret: testSecret})
+	require.NoError(t, err)
+	_, err = hmacOnly.Verify(signRS256(t, rsaKey, "k1", claims))
+	assert.ErrorContains(t, err, `unsupported algorithm "RS256"`)
+}
+
+func TestJWTVerifierRoles(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name        string
+		rolesClaim  string
+		claims      map[string]any
+		expectRoles []string
+		expectError string
+	}{
+		{name: "array", claims: map[string]any{"roles": []string{"reader", "editor"}}, expectRoles: []string{"reader", "editor"}},
+		{name: "string", claims: map[string]any{"roles": "admin"}, expectRoles: []string{"admin"}},
+		{name: "missing", claims: map[string]any{}},
+		{name: "custom claim", rolesClaim: "https://byfood.example/roles", claims: map[string]any{"roles": "admin", "https://byfood.example/roles": []string{"editor"}}, expectRoles: []string{"editor"}},
+		{name: "not strings", claims: map[string]any{"roles": []int{1}}, expectError: "claim roles must list role names"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewJWTVerifier(models.JWTConfig{HMACSecret: testSecret, RolesClaim: tt.rolesClaim})
+			require.NoError(t, err)
+			tt.claims["sub"] = "alice"
+			tt.claims["exp"] = exp
+			token, err := SignHS256(tt.claims, []byte(testSecret))
+			require.NoError(t, err)
+
+			claims, err := v.Verify(token)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectRoles, claims.Roles)
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	smallN := base64.RawURLEncoding.EncodeToString(small.N.Bytes())
+
+	tests := []struct {
+		name        string
+		jwks        string
+		expectKeys  int
+		expectError string
+	}{
+		{name: "signing key", jwks: `{"keys":[{"kty":"RSA","kid":"a","n":"` + n + `","e":"AQAB"}]}`, expectKeys: 1},
+		{
+			name: "other keys skipped",
+			jwks: `{"keys":[{"kty":"EC","kid":"ec"},{"kty":"RSA","kid":"enc","use":"enc","n":"` + n + `","e":"AQAB"},` +
+				`{"kty":"RSA","kid":"ps","alg":"PS256","n":"` + n + `","e":"AQAB"},{"kty":"RSA","kid":"a","use":"sig","n":"` + n + `","e":"AQAB"}]}`,
+			expectKeys: 1,
+		},
+		{name: "no keys", jwks: `{"keys":[]}`, expectError: "no RSA signing keys"},
+		{name: "malformed", jwks: `{"keys":`, expectError: "malformed JWKS"},
+		{name: "duplicate key ID", jwks: `{"keys":[{"kty":"RSA","kid":"a","n":"` + n + `","e":"AQAB"},{"kty":"RSA","kid":"a","n":"` + n + `","e":"AQAB"}]}`, expectError: `duplicate key ID "a"`},
+		{name: "small key", jwks: `{"keys":[{"kty":"RSA","n":"` + smallN + `","e":"AQAB"}]}`, expectError: "RSA key has 1024 bits"},
+		{name: "bad modulus", jwks: `{"keys":[{"kty":"RSA","n":"!","e":"AQAB"}]}`, expectError: "malformed modulus"},
+		{name: "even exponent", jwks: `{"keys":[{"kty":"RSA","n":"` + n + `","e":"Ag"}]}`, expectError: "invalid exponent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseJWKS([]byte(tt.jwks))
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, keys, tt.expectKeys)
+		})
+	}
+}
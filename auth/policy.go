@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// Permission allows an action on a kind of resource.
+type Permission string
+
+// Permissions required by the API.
+const (
+	BooksRead     Permission = "books:read"
+	BooksWrite    Permission = "books:write"
+	BooksDelete   Permission = "books:delete"
+	AuthorsRead   Permission = "authors:read"
+	AuthorsWrite  Permission = "authors:write"
+	AuthorsDelete Permission = "authors:delete"
+	TrashPurge    Permission = "trash:purge"
+	ConfigRead    Permission = "config:read"
+)
+
+// policy lists the permissions each role is granted in addition to those
+// of the roles before it in models.Roles.
+var policy = map[string][]Permission{
+	models.RoleReader: {BooksRead, AuthorsRead},
+	models.RoleEditor: {BooksWrite, AuthorsWrite},
+	models.RoleAdmin:  {BooksDelete, AuthorsDelete, TrashPurge, ConfigRead},
+}
+
+// Grants reports whether role has permission p. Unknown roles have no
+// permissions.
+func Grants(role string, p Permission) bool {
+	if !slices.Contains(models.Roles, role) {
+		return false
+	}
+	for _, r := range models.Roles {
+		if slices.Contains(policy[r], p) {
+			return true
+		}
+		if r == role {
+			return false
+		}
+	}
+	return false
+}
+
+// Can reports whether any of the roles of the principal has permission p.
+func (pr Principal) Can(p Permission) bool {
+	return slices.ContainsFunc(pr.Roles, func(role string) bool { return Grants(role, p) })
+}
+
+// MissingPermission describes why a request lacking permission p was
+// refused, naming the least privileged role granted p.
+func MissingPermission(p Permission) string {
+	for _, r := range models.Roles {
+		if Grants(r, p) {
+			return fmt.Sprintf("Missing permission %s, which requires the %s role", p, r)
+		}
+	}
+	return fmt.Sprintf("Missing permission %s", p)
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal of a request.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Allowed reports whether the request of ctx has permission p. Requests
+// without a principal are allowed: they only reach a handler when
+// authentication is disabled or the route admits anonymous requests.
+func Allowed(ctx context.Context, p Permission) bool {
+	pr, ok := FromContext(ctx)
+	return !ok || pr.Can(p)
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestGrants(t *testing.T) {
+	tests := []struct {
+		permission Permission
+		reader     bool
+		editor     bool
+		admin      bool
+	}{
+		{permission: BooksRead, reader: true, editor: true, admin: true},
+		{permission: AuthorsRead, reader: true, editor: true, admin: true},
+		{permission: BooksWrite, editor: true, admin: true},
+		{permission: AuthorsWrite, editor: true, admin: true},
+		{permission: BooksDelete, admin: true},
+		{permission: AuthorsDelete, admin: true},
+		{permission: TrashPurge, admin: true},
+		{permission: ConfigRead, admin: true},
+		{permission: "books:burn"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.reader, Grants(models.RoleReader, tt.permission), "reader %s", tt.permission)
+		assert.Equal(t, tt.editor, Grants(models.RoleEditor, tt.permission), "editor %s", tt.permission)
+		assert.Equal(t, tt.admin, Grants(models.RoleAdmin, tt.permission), "admin %s", tt.permission)
+		assert.False(t, Grants("owner", tt.permission), "unknown role %s", tt.permission)
+		assert.False(t, Grants("", tt.permission), "no role %s", tt.permission)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, Allowed(ctx, BooksDelete), "requests without a principal are not checked")
+
+	editor := NewContext(ctx, Principal{Subject: "ci", Roles: []string{"reader", models.RoleEditor}})
+	assert.True(t, Allowed(editor, BooksWrite))
+	assert.False(t, Allowed(editor, BooksDelete))
+
+	none := NewContext(ctx, Principal{Subject: "alice"})
+	assert.False(t, Allowed(none, BooksRead))
+
+	assert.Equal(t, "Missing permission books:delete, which requires the admin role", MissingPermission(BooksDelete))
+	assert.Equal(t, "Missing permission books:burn", MissingPermission("books:burn"))
+}
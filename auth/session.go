@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// refreshTokenPrefix marks refresh tokens, as apiKeyPrefix marks API keys.
+const refreshTokenPrefix = "bfr_"
+
+// GenerateRefreshToken returns a new random refresh token with 256 bits of
+// entropy. Being as random as API keys, refresh tokens are stored by the
+// same digest, HashAPIKey.
+func GenerateRefreshToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return refreshTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// TokenIssuer signs the access tokens of user sessions with the HS256
+// secret of a JWTConfig, with the claims the JWTVerifier of the same config
+// requires, so that they are accepted as bearer tokens.
+type TokenIssuer struct {
+	secret     []byte
+	issuer     string
+	audience   string
+	rolesClaim string
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+// NewTokenIssuer returns an issuer of access tokens that are valid for ttl.
+func NewTokenIssuer(cfg models.JWTConfig, ttl time.Duration) *TokenIssuer {
+	i := &TokenIssuer{
+		secret:     []byte(cfg.HMACSecret),
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		rolesClaim: cfg.RolesClaim,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+	if i.rolesClaim == "" {
+		i.rolesClaim = defaultRolesClaim
+	}
+	return i
+}
+
+// TTL returns how long the issued tokens are valid.
+func (i *TokenIssuer) TTL() time.Duration {
+	return i.ttl
+}
+
+// UserSubject returns the subject of the access tokens of a user. Unlike
+// the email, the ID never changes.
+func UserSubject(id uint) string {
+	return "user:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// Issue returns an access token for user with the user's role. Its subject
+// is UserSubject and the email is carried in the email claim.
+func (i *TokenIssuer) Issue(user models.User) (string, error) {
+	now := i.now()
+	claims := map[string]any{
+		"sub":        UserSubject(user.ID),
+		"email":      user.Email,
+		"iat":        NewNumericDate(now),
+		"exp":        NewNumericDate(now.Add(i.ttl)),
+		i.rolesClaim: []string{user.Role},
+	}
+	if i.issuer != "" {
+		claims["iss"] = i.issuer
+	}
+	if i.audience != "" {
+		claims["aud"] = i.audience
+	}
+	return SignHS256(claims, i.secret)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"), hash)
+
+	other, err := HashPassword("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "hashes are salted")
+
+	ok, err := CheckPassword(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = CheckPassword(hash, "Correct horse battery staple")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Hashes made with other parameters are still checked with their own.
+	weaker := "$argon2id$v=19$m=8,t=1,p=1$c2FsdHNhbHQ$" + strings.Repeat("A", 43)
+	ok, err = CheckPassword(weaker, "password")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, malformed := range []string{
+		"",
+		"plaintext",
+		"$2a$10$abcdefghijklmnopqrstuv",
+		"$argon2i$v=19$m=8,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=16$m=8,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=8,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=8,t=1,p=1$!!$a2V5",
+		"$argon2id$v=19$m=8,t=1,p=1$c2FsdA$",
+	} {
+		_, err := CheckPassword(malformed, "password")
+		assert.ErrorIs(t, err, ErrMalformedHash, malformed)
+	}
+}
+
+func TestTokenIssuer(t *testing.T) {
+	cfg := models.JWTConfig{HMACSecret: testSecret, Issuer: "byfood", Audience: "api", RolesClaim: "groups"}
+	issuer := NewTokenIssuer(cfg, 15*time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	issuer.now = func() time.Time { return now }
+
+	token, err := issuer.Issue(models.User{ID: 7, Email: "ada@example.com", Role: models.RoleEditor})
+	require.NoError(t, err)
+
+	v, err := NewJWTVerifier(cfg)
+	require.NoError(t, err)
+	v.now = func() time.Time { return now.Add(14 * time.Minute) }
+	claims, err := v.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user:7", claims.Subject)
+	assert.Equal(t, "ada@example.com", claims.Email)
+	assert.Equal(t, []string{models.RoleEditor}, claims.Roles)
+	assert.Equal(t, NewNumericDate(now.Add(15*time.Minute)), claims.ExpiresAt)
+
+	v.now = func() time.Time { return now.Add(17 * time.Minute) }
+	_, err = v.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	otherCfg := cfg
+	otherCfg.HMACSecret = strings.Repeat("o", 32)
+	other := NewTokenIssuer(otherCfg, time.Hour)
+	other.now = issuer.now
+	token, err = other.Issue(models.User{ID: 7, Email: "ada@example.com"})
+	require.NoError(t, err)
+	_, err = v.Verify(token)
+	assert.ErrorContains(t, err, "signature mismatch")
+
+	assert.True(t, strings.HasPrefix(GenerateRefreshToken(), "bfr_"))
+	assert.NotEqual(t, GenerateRefreshToken(), GenerateRefreshToken())
+}
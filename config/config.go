@@ -0,0 +1,286 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+var apiVersionPattern = regexp.MustCompile(`^v[1-9][0-9]*$`)
+
+// apiKeyHashPattern matches the hex-encoded SHA-256 digests API keys are
+// configured by.
+var apiKeyHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// minHMACSecretLength is the shortest HS256 secret accepted, matching the
+// size of the SHA-256 output as RFC 7518 requires.
+const minHMACSecretLength = 32
+
+// databaseDrivers lists the supported values of database.driver.
+var databaseDrivers = []string{"sqlite", "postgres", "mysql"}
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// Defaults returns the configuration used for every value that is not set by
+// the config file, the environment or the command line.
+func Defaults() models.AppConfig {
+	return models.AppConfig{
+		LogLevel:         "info",
+		EnableReqLogging: true,
+		AutoMigrate:      true,
+		CORSOrigins:      []string{"http://localhost:3000"},
+		APIVersion:       "v1",
+		ShutdownTimeout:  10,
+		TrashRetention:   30,
+		ListenAddr:       ":8080",
+		Database: models.DatabaseConfig{
+			Driver:          "sqlite",
+			DSN:             "books.db",
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 300,
+		},
+		Auth: models.AuthConfig{
+			JWT: models.JWTConfig{RolesClaim: "roles"},
+			Users: models.UsersConfig{
+				Registration:    true,
+				AccessTokenTTL:  900,
+				RefreshTokenTTL: 14,
+				MaxFailedLogins: 5,
+				LockoutDuration: 900,
+			},
+		},
+		RateLimit: models.RateLimitConfig{
+			Enabled: true,
+			Read:    models.RateLimit{RequestsPerMinute: 300, Burst: 60},
+			Write:   models.RateLimit{RequestsPerMinute: 60, Burst: 20},
+			Admin:   models.RateLimit{RequestsPerMinute: 30, Burst: 10},
+			Auth:    models.RateLimit{RequestsPerMinute: 10, Burst: 5},
+		},
+	}
+}
+
+// Load reads the YAML configuration file at path on top of Defaults. Keys
+// that do not map to a field of models.AppConfig are rejected so that typos
+// do not go unnoticed.
+func Load(path string) (models.AppConfig, error) {
+	config := Defaults()
+	err := loadFile(path, &config)
+	return config, err
+}
+
+func loadFile(path string, config *models.AppConfig) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil {
+			log.Printf("Warning: failed to close config file: %v", cerr)
+		}
+	}()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks every field of config and reports all problems at once.
+func Validate(config models.AppConfig) error {
+	var errs []error
+	if _, err := ParseLogLevel(config.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if !apiVersionPattern.MatchString(config.APIVersion) {
+		errs = append(errs, fmt.Errorf("apiVersion %q must look like v1, v2, ...", config.APIVersion))
+	}
+	if config.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdownTimeout must be a positive number of seconds, got %d", config.ShutdownTimeout))
+	}
+	if config.TrashRetention < 0 {
+		errs = append(errs, fmt.Errorf("trashRetentionDays must not be negative, got %d", config.TrashRetention))
+	}
+	if err := validateCORSOrigins(config.CORSOrigins); err != nil {
+		errs = append(errs, err)
+	}
+	if _, _, err := net.SplitHostPort(config.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listenAddr %q must be host:port: %w", config.ListenAddr, err))
+	}
+	for _, proxy := range config.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("trustedProxies: %q is neither an IP address nor a CIDR range", proxy))
+			}
+		}
+	}
+	errs = append(errs, validateDatabase(config.Database)...)
+	errs = append(errs, validateAuth(config.Auth)...)
+	errs = append(errs, validateRateLimit(config.RateLimit)...)
+	if config.TLS.Enabled {
+		files := []struct{ name, path string }{
+			{"tls.certFile", config.TLS.CertFile},
+			{"tls.keyFile", config.TLS.KeyFile},
+		}
+		for _, f := range files {
+			name, path := f.name, f.path
+			if path == "" {
+				errs = append(errs, fmt.Errorf("%s is required when TLS is enabled", name))
+			} else if _, err := os.Stat(path); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseLogLevel converts a configured log level name to a slog.Level.
+func ParseLogLevel(level string) (slog.Level, error) {
+	l, ok := logLevels[strings.ToLower(level)]
+	if !ok {
+		return 0, fmt.Errorf("logLevel %q must be one of debug, info, warn, error", level)
+	}
+	return l, nil
+}
+
+func validateDatabase(db models.DatabaseConfig) []error {
+	var errs []error
+	if !slices.Contains(databaseDrivers, db.Driver) {
+		errs = append(errs, fmt.Errorf("database.driver %q is not supported (expected one of %s)",
+			db.Driver, strings.Join(databaseDrivers, ", ")))
+	}
+	if db.DSN == "" {
+		errs = append(errs, errors.New("database.dsn must not be empty"))
+	}
+	pool := []struct {
+		name  string
+		value int
+	}{
+		{"database.maxOpenConns", db.MaxOpenConns},
+		{"database.maxIdleConns", db.MaxIdleConns},
+		{"database.connMaxLifetime", db.ConnMaxLifetime},
+	}
+	for _, p := range pool {
+		if p.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", p.name, p.value))
+		}
+	}
+	if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("database.maxIdleConns (%d) must not exceed database.maxOpenConns (%d)",
+			db.MaxIdleConns, db.MaxOpenConns))
+	}
+	return errs
+}
+
+func validateAuth(a models.AuthConfig) []error {
+	var errs []error
+	names := map[string]bool{}
+	for i, k := range a.APIKeys {
+		if k.Name == "" {
+			errs = append(errs, fmt.Errorf("auth.apiKeys[%d].name must not be empty", i))
+		} else if names[k.Name] {
+			errs = append(errs, fmt.Errorf("auth.apiKeys[%d].name %q is used by another key", i, k.Name))
+		}
+		names[k.Name] = true
+		if !apiKeyHashPattern.MatchString(k.Hash) {
+			errs = append(errs, fmt.Errorf("auth.apiKeys[%d].hash must be the hex-encoded SHA-256 of the key", i))
+		}
+		if !slices.Contains(models.Roles, k.Role) {
+			errs = append(errs, fmt.Errorf("auth.apiKeys[%d].role %q must be one of %s", i, k.Role, strings.Join(models.Roles, ", ")))
+		}
+	}
+	if s := a.JWT.HMACSecret; s != "" && len(s) < minHMACSecretLength {
+		errs = append(errs, fmt.Errorf("auth.jwt.hmacSecret must be at least %d bytes, got %d", minHMACSecretLength, len(s)))
+	}
+	if a.JWT.RolesClaim == "" {
+		errs = append(errs, errors.New("auth.jwt.rolesClaim must not be empty"))
+	}
+	if a.JWT.JWKSFile != "" {
+		if _, err := os.Stat(a.JWT.JWKSFile); err != nil {
+			errs = append(errs, fmt.Errorf("auth.jwt.jwksFile: %w", err))
+		}
+	}
+	return append(errs, validateUsers(a.Users, a.JWT)...)
+}
+
+func validateUsers(u models.UsersConfig, jwt models.JWTConfig) []error {
+	var errs []error
+	if u.Enabled && jwt.HMACSecret == "" {
+		errs = append(errs, errors.New("auth.users.enabled requires auth.jwt.hmacSecret to sign access tokens"))
+	}
+	if u.AccessTokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("auth.users.accessTokenTTL must be a positive number of seconds, got %d", u.AccessTokenTTL))
+	}
+	if u.RefreshTokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("auth.users.refreshTokenTTLDays must be a positive number of days, got %d", u.RefreshTokenTTL))
+	}
+	if u.MaxFailedLogins < 0 {
+		errs = append(errs, fmt.Errorf("auth.users.maxFailedLogins must not be negative, got %d", u.MaxFailedLogins))
+	}
+	if u.MaxFailedLogins > 0 && u.LockoutDuration <= 0 {
+		errs = append(errs, fmt.Errorf("auth.users.lockoutDuration must be a positive number of seconds, got %d", u.LockoutDuration))
+	}
+	return errs
+}
+
+func validateRateLimit(r models.RateLimitConfig) []error {
+	var errs []error
+	groups := []struct {
+		name  string
+		limit models.RateLimit
+	}{
+		{"read", r.Read},
+		{"write", r.Write},
+		{"admin", r.Admin},
+		{"auth", r.Auth},
+	}
+	for _, g := range groups {
+		if g.limit.RequestsPerMinute < 0 {
+			errs = append(errs, fmt.Errorf("rateLimit.%s.requestsPerMinute must not be negative, got %d", g.name, g.limit.RequestsPerMinute))
+		}
+		if g.limit.RequestsPerMinute > 0 && g.limit.Burst < 1 {
+			errs = append(errs, fmt.Errorf("rateLimit.%s.burst must be at least 1, got %d", g.name, g.limit.Burst))
+		}
+	}
+	return errs
+}
+
+// validateCORSOrigins accepts either a single "*" or a list of origins of the
+// form scheme://host[:port].
+func validateCORSOrigins(origins []string) error {
+	if len(origins) == 0 {
+		return errors.New("corsOrigins must list at least one origin")
+	}
+	for _, origin := range origins {
+		if origin == "*" {
+			if len(origins) > 1 {
+				return errors.New(`corsOrigins: "*" cannot be combined with other origins`)
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("corsOrigins: %q is not a valid origin (expected scheme://host[:port])", origin)
+		}
+	}
+	return nil
+}
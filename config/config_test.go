@@ -0,0 +1,292 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func validConfig() models.AppConfig {
+	return Defaults()
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(c *models.AppConfig)
+		expectError string
+	}{
+		{
+			name:   "valid config",
+			mutate: func(c *models.AppConfig) {},
+		},
+		{
+			name:   "wildcard origin",
+			mutate: func(c *models.AppConfig) { c.CORSOrigins = []string{"*"} },
+		},
+		{
+			name:   "upper case log level",
+			mutate: func(c *models.AppConfig) { c.LogLevel = "DEBUG" },
+		},
+		{
+			name:        "unknown log level",
+			mutate:      func(c *models.AppConfig) { c.LogLevel = "verbose" },
+			expectError: `logLevel "verbose"`,
+		},
+		{
+			name:        "malformed api version",
+			mutate:      func(c *models.AppConfig) { c.APIVersion = "1.0" },
+			expectError: `apiVersion "1.0"`,
+		},
+		{
+			name:        "missing api version",
+			mutate:      func(c *models.AppConfig) { c.APIVersion = "" },
+			expectError: `apiVersion ""`,
+		},
+		{
+			name:        "negative trash retention",
+			mutate:      func(c *models.AppConfig) { c.TrashRetention = -1 },
+			expectError: "trashRetentionDays",
+		},
+		{
+			name:        "non-positive shutdown timeout",
+			mutate:      func(c *models.AppConfig) { c.ShutdownTimeout = 0 },
+			expectError: "shutdownTimeout",
+		},
+		{
+			name:        "no cors origins",
+			mutate:      func(c *models.AppConfig) { c.CORSOrigins = nil },
+			expectError: "corsOrigins must list at least one origin",
+		},
+		{
+			name:        "origin with path",
+			mutate:      func(c *models.AppConfig) { c.CORSOrigins = []string{"http://localhost:3000/app"} },
+			expectError: `"http://localhost:3000/app" is not a valid origin`,
+		},
+		{
+			name:        "origin without scheme",
+			mutate:      func(c *models.AppConfig) { c.CORSOrigins = []string{"localhost:3000"} },
+			expectError: "is not a valid origin",
+		},
+		{
+			name:        "malformed listen address",
+			mutate:      func(c *models.AppConfig) { c.ListenAddr = "8080" },
+			expectError: `listenAddr "8080"`,
+		},
+		{
+			name:        "unsupported database driver",
+			mutate:      func(c *models.AppConfig) { c.Database.Driver = "oracle" },
+			expectError: `database.driver "oracle"`,
+		},
+		{
+			name:   "postgres driver",
+			mutate: func(c *models.AppConfig) { c.Database.Driver = "postgres" },
+		},
+		{
+			name:   "unlimited pool",
+			mutate: func(c *models.AppConfig) { c.Database.MaxOpenConns = 0; c.Database.MaxIdleConns = 20 },
+		},
+		{
+			name:        "negative pool size",
+			mutate:      func(c *models.AppConfig) { c.Database.MaxOpenConns = -1 },
+			expectError: "database.maxOpenConns must not be negative",
+		},
+		{
+			name:        "more idle than open connections",
+			mutate:      func(c *models.AppConfig) { c.Database.MaxOpenConns = 2; c.Database.MaxIdleConns = 3 },
+			expectError: "database.maxIdleConns (3) must not exceed database.maxOpenConns (2)",
+		},
+		{
+			name:        "empty dsn",
+			mutate:      func(c *models.AppConfig) { c.Database.DSN = "" },
+			expectError: "database.dsn",
+		},
+		{
+			name:        "tls without certificate",
+			mutate:      func(c *models.AppConfig) { c.TLS.Enabled = true; c.TLS.KeyFile = "config_test.go" },
+			expectError: "tls.certFile is required",
+		},
+		{
+			name: "tls with missing key file",
+			mutate: func(c *models.AppConfig) {
+				c.TLS = models.TLSConfig{Enabled: true, CertFile: "config_test.go", KeyFile: "missing.pem"}
+			},
+			expectError: "tls.keyFile",
+		},
+		{
+			name: "api keys",
+			mutate: func(c *models.AppConfig) {
+				c.Auth.APIKeys = []models.APIKeyConfig{{Name: "ci", Hash: strings.Repeat("ab", 32), Role: models.RoleEditor}}
+			},
+		},
+		{
+			name: "api key without role",
+			mutate: func(c *models.AppConfig) {
+				c.Auth.APIKeys = []models.APIKeyConfig{{Name: "ci", Hash: strings.Repeat("ab", 32)}}
+			},
+			expectError: `auth.apiKeys[0].role "" must be one of reader, editor, admin`,
+		},
+		{
+			name:        "empty roles claim",
+			mutate:      func(c *models.AppConfig) { c.Auth.JWT.RolesClaim = "" },
+			expectError: "auth.jwt.rolesClaim must not be empty",
+		},
+		{
+			name: "api key without name",
+			mutate: func(c *models.AppConfig) {
+				c.Auth.APIKeys = []models.APIKeyConfig{{Hash: strings.Repeat("ab", 32)}}
+			},
+			expectError: "auth.apiKeys[0].name must not be empty",
+		},
+		{
+			name: "duplicate api key name",
+			mutate: func(c *models.AppConfig) {
+				c.Auth.APIKeys = []models.APIKeyConfig{{Name: "ci", Hash: strings.Repeat("ab", 32)}, {Name: "ci", Hash: strings.Repeat("cd", 32)}}
+			},
+			expectError: `auth.apiKeys[1].name "ci" is used by another key`,
+		},
+		{
+			name: "plain text api key",
+			mutate: func(c *models.AppConfig) {
+				c.Auth.APIKeys = []models.APIKeyConfig{{Name: "ci", Hash: "bfk_secret"}}
+			},
+			expectError: "auth.apiKeys[0].hash must be the hex-encoded SHA-256",
+		},
+		{
+			name:        "short hmac secret",
+			mutate:      func(c *models.AppConfig) { c.Auth.JWT.HMACSecret = "secret" },
+			expectError: "auth.jwt.hmacSecret must be at least 32 bytes, got 6",
+		},
+		{
+			name:        "missing jwks file",
+			mutate:      func(c *models.AppConfig) { c.Auth.JWT.JWKSFile = "missing.json" },
+			expectError: "auth.jwt.jwksFile",
+		},
+		{
+			name: "users",
+			mutate: func(c *models.AppConfig) {
+				c.Auth.Users.Enabled = true
+				c.Auth.JWT.HMACSecret = strings.Repeat("s", 32)
+			},
+		},
+		{
+			name:        "users without hmac secret",
+			mutate:      func(c *models.AppConfig) { c.Auth.Users.Enabled = true },
+			expectError: "auth.users.enabled requires auth.jwt.hmacSecret",
+		},
+		{
+			name:        "zero access token ttl",
+			mutate:      func(c *models.AppConfig) { c.Auth.Users.AccessTokenTTL = 0 },
+			expectError: "auth.users.accessTokenTTL must be a positive number of seconds, got 0",
+		},
+		{
+			name:        "negative refresh token ttl",
+			mutate:      func(c *models.AppConfig) { c.Auth.Users.RefreshTokenTTL = -1 },
+			expectError: "auth.users.refreshTokenTTLDays must be a positive number of days, got -1",
+		},
+		{
+			name:        "lockout without duration",
+			mutate:      func(c *models.AppConfig) { c.Auth.Users.LockoutDuration = 0 },
+			expectError: "auth.users.lockoutDuration must be a positive number of seconds, got 0",
+		},
+		{
+			name: "lockout disabled",
+			mutate: func(c *models.AppConfig) {
+				c.Auth.Users.MaxFailedLogins = 0
+				c.Auth.Users.LockoutDuration = 0
+			},
+		},
+		{
+			name:   "trusted proxies",
+			mutate: func(c *models.AppConfig) { c.TrustedProxies = []string{"10.0.0.1", "192.168.0.0/16", "::1"} },
+		},
+		{
+			name:        "invalid trusted proxy",
+			mutate:      func(c *models.AppConfig) { c.TrustedProxies = []string{"10.0.0.0/33"} },
+			expectError: `trustedProxies: "10.0.0.0/33" is neither an IP address nor a CIDR range`,
+		},
+		{
+			name:        "negative rate limit",
+			mutate:      func(c *models.AppConfig) { c.RateLimit.Write.RequestsPerMinute = -1 },
+			expectError: "rateLimit.write.requestsPerMinute must not be negative, got -1",
+		},
+		{
+			name:        "rate limit without burst",
+			mutate:      func(c *models.AppConfig) { c.RateLimit.Auth.Burst = 0 },
+			expectError: "rateLimit.auth.burst must be at least 1, got 0",
+		},
+		{
+			name:   "unlimited group",
+			mutate: func(c *models.AppConfig) { c.RateLimit.Read = models.RateLimit{} },
+		},
+		{
+			name:        "wildcard mixed with origins",
+			mutate:      func(c *models.AppConfig) { c.CORSOrigins = []string{"*", "http://localhost:3000"} },
+			expectError: "cannot be combined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.mutate(&cfg)
+			err := Validate(cfg)
+			if tt.expectError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := validConfig()
+	cfg.LogLevel = "loud"
+	cfg.APIVersion = "latest"
+	err := Validate(cfg)
+	assert.ErrorContains(t, err, "logLevel")
+	assert.ErrorContains(t, err, "apiVersion")
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("warn")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("repository config", func(t *testing.T) {
+		cfg, err := Load("../config.yaml")
+		require.NoError(t, err)
+		assert.NoError(t, Validate(cfg))
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		path := filepath.Join(dir, "unknown.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("logLevel: info\nlogLevle: debug\n"), 0o600))
+		_, err := Load(path)
+		assert.ErrorContains(t, err, "logLevle")
+	})
+
+	t.Run("malformed value", func(t *testing.T) {
+		path := filepath.Join(dir, "malformed.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("shutdownTimeout: soon\n"), 0o600))
+		_, err := Load(path)
+		assert.Error(t, err)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Load(filepath.Join(dir, "missing.yaml"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	path := writeConfig(t, "logLevel: warn\napiVersion: v2\nlistenAddr: \":9000\"\nshutdownTimeout: 30\n")
+
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		assert func(t *testing.T, cfg models.AppConfig, opts Options)
+	}{
+		{
+			name: "file overrides defaults",
+			args: []string{"--config", path},
+			assert: func(t *testing.T, cfg models.AppConfig, opts Options) {
+				assert.Equal(t, "warn", cfg.LogLevel)
+				assert.Equal(t, "v2", cfg.APIVersion)
+				assert.Equal(t, ":9000", cfg.ListenAddr)
+				assert.Equal(t, 30, cfg.ShutdownTimeout)
+			},
+		},
+		{
+			name: "env overrides file",
+			args: []string{"--config", path},
+			env:  map[string]string{"BYFOOD_LOG_LEVEL": "debug", "BYFOOD_SHUTDOWN_TIMEOUT": "5"},
+			assert: func(t *testing.T, cfg models.AppConfig, opts Options) {
+				assert.Equal(t, "debug", cfg.LogLevel)
+				assert.Equal(t, "v2", cfg.APIVersion)
+				assert.Equal(t, 5, cfg.ShutdownTimeout)
+			},
+		},
+		{
+			name: "flags override env",
+			args: []string{"--config", path, "--log-level", "error", "--listen=:7000"},
+			env:  map[string]string{"BYFOOD_LOG_LEVEL": "debug", "BYFOOD_LISTEN_ADDR": ":6000"},
+			assert: func(t *testing.T, cfg models.AppConfig, opts Options) {
+				assert.Equal(t, "error", cfg.LogLevel)
+				assert.Equal(t, ":7000", cfg.ListenAddr)
+			},
+		},
+		{
+			name: "config path from env",
+			env:  map[string]string{"BYFOOD_CONFIG": path},
+			assert: func(t *testing.T, cfg models.AppConfig, opts Options) {
+				assert.Equal(t, path, opts.ConfigPath)
+				assert.Equal(t, "warn", cfg.LogLevel)
+			},
+		},
+		{
+			name: "command after flags",
+			args: []string{"--config", path, "--log-level", "error", "migrate", "to", "3"},
+			assert: func(t *testing.T, cfg models.AppConfig, opts Options) {
+				assert.Equal(t, "error", cfg.LogLevel)
+				assert.Equal(t, []string{"migrate", "to", "3"}, opts.Args)
+			},
+		},
+		{
+			name: "config flag wins over env",
+			args: []string{"--config", path},
+			env:  map[string]string{"BYFOOD_CONFIG": "/does/not/exist.yaml"},
+			assert: func(t *testing.T, cfg models.AppConfig, opts Options) {
+				assert.Equal(t, path, opts.ConfigPath)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, opts, err := Resolve(tt.args, envMap(tt.env))
+			require.NoError(t, err)
+			tt.assert(t, cfg, opts)
+		})
+	}
+}
+
+func TestResolveTypedValues(t *testing.T) {
+	path := writeConfig(t, "autoMigrate: true\n")
+	cfg, _, err := Resolve(
+		[]string{"--config", path, "--auto-migrate=false", "--tls", "--tls-cert", "cert.pem", "--db-dsn", "other.db",
+			"--db-conn-max-lifetime", "60", "--require-if-match", "--trash-retention-days", "0",
+			"--known-authors-only", "--rate-limit=false"},
+		envMap(map[string]string{
+			"BYFOOD_CORS_ORIGINS":       "http://a.example, http://b.example",
+			"BYFOOD_ENABLE_REQ_LOGGING": "false",
+			"BYFOOD_DB_DRIVER":          "postgres",
+			"BYFOOD_DB_MAX_OPEN_CONNS":  "25",
+			"BYFOOD_TRUSTED_PROXIES":    "10.0.0.0/8,::1",
+		}),
+	)
+	require.NoError(t, err)
+	assert.False(t, cfg.AutoMigrate)
+	assert.False(t, cfg.EnableReqLogging)
+	assert.True(t, cfg.TLS.Enabled)
+	assert.Equal(t, "cert.pem", cfg.TLS.CertFile)
+	assert.Equal(t, "other.db", cfg.Database.DSN)
+	assert.Equal(t, "postgres", cfg.Database.Driver)
+	assert.Equal(t, 25, cfg.Database.MaxOpenConns)
+	assert.Equal(t, 5, cfg.Database.MaxIdleConns)
+	assert.Equal(t, 60, cfg.Database.ConnMaxLifetime)
+	assert.True(t, cfg.RequireIfMatch)
+	assert.Zero(t, cfg.TrashRetention)
+	assert.True(t, cfg.KnownAuthorsOnly)
+	assert.Equal(t, []string{"http://a.example", "http://b.example"}, cfg.CORSOrigins)
+	assert.Equal(t, []string{"10.0.0.0/8", "::1"}, cfg.TrustedProxies)
+	assert.False(t, cfg.RateLimit.Enabled)
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		expectError string
+	}{
+		{
+			name:        "explicit config file missing",
+			args:        []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")},
+			expectError: "no such file",
+		},
+		{
+			name:        "invalid env integer",
+			args:        []string{"--config", writeConfig(t, "")},
+			env:         map[string]string{"BYFOOD_SHUTDOWN_TIMEOUT": "soon"},
+			expectError: "BYFOOD_SHUTDOWN_TIMEOUT",
+		},
+		{
+			name:        "invalid flag boolean",
+			args:        []string{"--config", writeConfig(t, ""), "--auto-migrate=maybe"},
+			expectError: "--auto-migrate",
+		},
+		{
+			name:        "unknown flag",
+			args:        []string{"--no-such-flag"},
+			expectError: "no-such-flag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Resolve(tt.args, envMap(tt.env))
+			assert.ErrorContains(t, err, tt.expectError)
+		})
+	}
+}
+
+func TestResolveWithoutDefaultConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg, opts, err := Resolve(nil, envMap(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "config.yaml", opts.ConfigPath)
+	assert.Equal(t, Defaults(), cfg)
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	tests := []struct {
+		dsn    string
+		expect string
+	}{
+		{dsn: "books.db", expect: "books.db"},
+		{dsn: "postgres://app:s3cret@db:5432/books", expect: "postgres://app:REDACTED@db:5432/books"},
+		{dsn: "host=db user=app password=s3cret dbname=books", expect: "host=db user=app password=REDACTED dbname=books"},
+		{dsn: "app:s3cret@tcp(db:3306)/books?parseTime=true", expect: "app:REDACTED@tcp(db:3306)/books?parseTime=true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			cfg := Defaults()
+			cfg.CursorSecret = "cursor-key"
+			cfg.Auth.JWT.HMACSecret = "jwt-s3cret"
+			cfg.Auth.APIKeys = []models.APIKeyConfig{{Name: "ci", Hash: "s3cret-hash"}}
+			cfg.Database.DSN = tt.dsn
+
+			var buf bytes.Buffer
+			require.NoError(t, Print(&buf, cfg))
+			out := buf.String()
+			assert.NotContains(t, out, "s3cret")
+			assert.NotContains(t, out, "cursor-key")
+			assert.Contains(t, out, "cursorSecret: REDACTED")
+			assert.Contains(t, out, "hmacSecret: REDACTED")
+			assert.Contains(t, out, "name: ci")
+			assert.Contains(t, out, tt.expect)
+
+			// The original config is left untouched.
+			assert.Equal(t, tt.dsn, cfg.Database.DSN)
+			assert.Equal(t, "s3cret-hash", cfg.Auth.APIKeys[0].Hash)
+		})
+	}
+}
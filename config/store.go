@@ -0,0 +1,141 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// reloadableFields lists the YAML keys of models.AppConfig that take effect
+// without a restart, with dots separating the keys of nested fields. Changes
+// to any other key are ignored on reload.
+var reloadableFields = []string{
+	"logLevel", "enableReqLogging", "corsOrigins", "requireIfMatch", "knownAuthorsOnly",
+	"auth.anonymousReads", "rateLimit",
+}
+
+// Snapshot is a configuration together with the reload that produced it.
+type Snapshot struct {
+	Config   models.AppConfig
+	Version  uint64
+	Hash     string
+	LoadedAt time.Time
+}
+
+// Store holds the live configuration. Readers get a consistent snapshot
+// without locking; reloads swap the whole snapshot atomically.
+type Store struct {
+	current   atomic.Pointer[Snapshot]
+	mu        sync.Mutex
+	listeners []func(models.AppConfig)
+}
+
+// NewStore returns a store serving config as version 1.
+func NewStore(config models.AppConfig) *Store {
+	s := &Store{}
+	s.current.Store(&Snapshot{Config: config, Version: 1, Hash: Hash(config), LoadedAt: time.Now()})
+	return s
+}
+
+// Snapshot returns the current configuration and its version.
+func (s *Store) Snapshot() Snapshot {
+	return *s.current.Load()
+}
+
+// Config returns the current configuration.
+func (s *Store) Config() models.AppConfig {
+	return s.current.Load().Config
+}
+
+// OnChange registers fn to be called with the new configuration after every
+// reload that changed it.
+func (s *Store) OnChange(fn func(models.AppConfig)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Apply validates next and swaps in its reloadable fields. It returns the
+// resulting snapshot and the keys of non-reloadable fields whose changes were
+// ignored. An invalid configuration is rejected as a whole.
+func (s *Store) Apply(next models.AppConfig) (Snapshot, []string, error) {
+	if err := Validate(next); err != nil {
+		return s.Snapshot(), nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur := s.current.Load()
+	merged, ignored := mergeReloadable(cur.Config, next)
+	for _, key := range ignored {
+		slog.Warn("Ignoring change to non-reloadable config field; restart to apply it", "field", key)
+	}
+	if reflect.DeepEqual(merged, cur.Config) {
+		return *cur, ignored, nil
+	}
+
+	snap := &Snapshot{Config: merged, Version: cur.Version + 1, Hash: Hash(merged), LoadedAt: time.Now()}
+	s.current.Store(snap)
+	for _, fn := range s.listeners {
+		fn(merged)
+	}
+	slog.Info("Config reloaded", "version", snap.Version, "hash", snap.Hash)
+	return *snap, ignored, nil
+}
+
+// Hash fingerprints config. Secrets are redacted first so the hash cannot be
+// used to guess them.
+func Hash(config models.AppConfig) string {
+	b, _ := yaml.Marshal(Redact(config))
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// mergeReloadable copies the reloadable fields of next onto cur and reports
+// the YAML keys of the other fields that differ.
+func mergeReloadable(cur, next models.AppConfig) (models.AppConfig, []string) {
+	merged := cur
+	var ignored []string
+	merge(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(next), "", &ignored)
+	return merged, ignored
+}
+
+// merge copies the reloadable fields of next onto dst, structs whose fields
+// have the YAML keys prefix followed by their tag, and appends the keys of
+// the other fields that differ to ignored. Structs holding reloadable fields
+// are merged field by field.
+func merge(dst, next reflect.Value, prefix string, ignored *[]string) {
+	for i := 0; i < dst.NumField(); i++ {
+		key := prefix + dst.Type().Field(i).Tag.Get("yaml")
+		if reflect.DeepEqual(dst.Field(i).Interface(), next.Field(i).Interface()) {
+			continue
+		}
+		switch {
+		case slices.Contains(reloadableFields, key):
+			dst.Field(i).Set(next.Field(i))
+		case dst.Field(i).Kind() == reflect.Struct && holdsReloadable(key):
+			merge(dst.Field(i), next.Field(i), key+".", ignored)
+		default:
+			*ignored = append(*ignored, key)
+		}
+	}
+}
+
+// holdsReloadable reports whether the field with YAML key has reloadable
+// fields nested in it.
+func holdsReloadable(key string) bool {
+	return slices.ContainsFunc(reloadableFields, func(f string) bool {
+		return strings.HasPrefix(f, key+".")
+	})
+}
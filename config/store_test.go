@@ -0,0 +1,173 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestStoreApply(t *testing.T) {
+	tests := []struct {
+		name          string
+		mutate        func(c *models.AppConfig)
+		expectVersion uint64
+		expectIgnored []string
+		expectError   bool
+		check         func(t *testing.T, c models.AppConfig)
+	}{
+		{
+			name:          "unchanged",
+			mutate:        func(c *models.AppConfig) {},
+			expectVersion: 1,
+		},
+		{
+			name: "reloadable fields",
+			mutate: func(c *models.AppConfig) {
+				c.LogLevel = "debug"
+				c.CORSOrigins = []string{"https://new.example"}
+				c.EnableReqLogging = false
+			},
+			expectVersion: 2,
+			check: func(t *testing.T, c models.AppConfig) {
+				assert.Equal(t, "debug", c.LogLevel)
+				assert.Equal(t, []string{"https://new.example"}, c.CORSOrigins)
+				assert.False(t, c.EnableReqLogging)
+			},
+		},
+		{
+			name: "non-reloadable fields are ignored",
+			mutate: func(c *models.AppConfig) {
+				c.LogLevel = "warn"
+				c.ListenAddr = ":9999"
+				c.Database.DSN = "other.db"
+			},
+			expectVersion: 2,
+			expectIgnored: []string{"listenAddr", "database"},
+			check: func(t *testing.T, c models.AppConfig) {
+				assert.Equal(t, "warn", c.LogLevel)
+				assert.Equal(t, ":8080", c.ListenAddr)
+				assert.Equal(t, "books.db", c.Database.DSN)
+			},
+		},
+		{
+			name: "feature toggles and rate limits",
+			mutate: func(c *models.AppConfig) {
+				c.RequireIfMatch = true
+				c.KnownAuthorsOnly = true
+				c.Auth.AnonymousReads = true
+				c.RateLimit.Read.RequestsPerMinute = 1
+			},
+			expectVersion: 2,
+			check: func(t *testing.T, c models.AppConfig) {
+				assert.True(t, c.RequireIfMatch)
+				assert.True(t, c.KnownAuthorsOnly)
+				assert.True(t, c.Auth.AnonymousReads)
+				assert.Equal(t, 1, c.RateLimit.Read.RequestsPerMinute)
+			},
+		},
+		{
+			name: "nested fields are reloaded one by one",
+			mutate: func(c *models.AppConfig) {
+				c.Auth.AnonymousReads = true
+				c.Auth.Enabled = true
+			},
+			expectVersion: 2,
+			expectIgnored: []string{"auth.enabled"},
+			check: func(t *testing.T, c models.AppConfig) {
+				assert.True(t, c.Auth.AnonymousReads)
+				assert.False(t, c.Auth.Enabled)
+			},
+		},
+		{
+			name:          "only non-reloadable changes keep the version",
+			mutate:        func(c *models.AppConfig) { c.APIVersion = "v2" },
+			expectVersion: 1,
+			expectIgnored: []string{"apiVersion"},
+		},
+		{
+			name:          "invalid config is rejected",
+			mutate:        func(c *models.AppConfig) { c.LogLevel = "chatty" },
+			expectVersion: 1,
+			expectError:   true,
+			check: func(t *testing.T, c models.AppConfig) {
+				assert.Equal(t, "info", c.LogLevel)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore(Defaults())
+			before := store.Snapshot()
+			var notified []models.AppConfig
+			store.OnChange(func(c models.AppConfig) { notified = append(notified, c) })
+
+			next := Defaults()
+			tt.mutate(&next)
+			snap, ignored, err := store.Apply(next)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectIgnored, ignored)
+			assert.Equal(t, tt.expectVersion, snap.Version)
+			assert.Equal(t, snap, store.Snapshot())
+			if tt.expectVersion == before.Version {
+				assert.Equal(t, before.Hash, snap.Hash)
+				assert.Empty(t, notified)
+			} else {
+				assert.NotEqual(t, before.Hash, snap.Hash)
+				assert.Equal(t, []models.AppConfig{snap.Config}, notified)
+			}
+			if tt.check != nil {
+				tt.check(t, store.Config())
+			}
+		})
+	}
+}
+
+func TestHashIgnoresSecrets(t *testing.T) {
+	a, b := Defaults(), Defaults()
+	a.CursorSecret = "one"
+	b.CursorSecret = "two"
+	assert.Equal(t, Hash(a), Hash(b))
+	b.LogLevel = "debug"
+	assert.NotEqual(t, Hash(a), Hash(b))
+}
+
+func TestWatchReloadsOnFileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("logLevel: info\n"), 0o600))
+
+	store := NewStore(Defaults())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, store, path, 10*time.Millisecond, func() (models.AppConfig, error) { return Load(path) })
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Give the watcher time to record the initial digest.
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, os.WriteFile(path, []byte("logLevel: debug\n"), 0o600))
+	assert.Eventually(t, func() bool { return store.Config().LogLevel == "debug" }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(2), store.Snapshot().Version)
+
+	// A broken edit is logged and the running config is kept.
+	require.NoError(t, os.WriteFile(path, []byte("logLevel: [\n"), 0o600))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "debug", store.Config().LogLevel)
+	assert.Equal(t, uint64(2), store.Snapshot().Version)
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// Watch reloads the configuration into store whenever the process receives
+// SIGHUP or the content of the file at path changes, until ctx is done. The
+// file is polled every interval. load re-resolves the full configuration so
+// that environment variables and flags keep their precedence over the file.
+func Watch(ctx context.Context, store *Store, path string, interval time.Duration, load func() (models.AppConfig, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := fileDigest(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("SIGHUP received, reloading config")
+			last = fileDigest(path)
+			Reload(store, load)
+		case <-ticker.C:
+			digest := fileDigest(path)
+			if digest == last {
+				continue
+			}
+			last = digest
+			slog.Info("Config file changed, reloading", "path", path)
+			Reload(store, load)
+		}
+	}
+}
+
+// Reload loads a new configuration and applies it to store, logging instead
+// of failing so that a bad edit never takes the server down.
+func Reload(store *Store, load func() (models.AppConfig, error)) {
+	next, err := load()
+	if err != nil {
+		slog.Error("Config reload failed, keeping current config", "error", err)
+		return
+	}
+	if _, _, err := store.Apply(next); err != nil {
+		slog.Error("Reloaded config is invalid, keeping current config", "error", err)
+	}
+}
+
+// fileDigest hashes the content of path, returning "" if it cannot be read.
+// Content is compared instead of modification times, which editors and
+// config management tools do not update reliably.
+func fileDigest(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return string(h.Sum(nil))
+}
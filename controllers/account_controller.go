@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// AccountOptions tune the account endpoints. Registration lets anyone
+// create an account. Refresh tokens are valid for RefreshTokenTTL. After
+// MaxFailedLogins failed logins in a row an account is locked for
+// LockoutDuration; zero disables lockout.
+type AccountOptions struct {
+	Registration    bool
+	RefreshTokenTTL time.Duration
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+}
+
+// AccountController serves the user account endpoints: registration, and
+// the sessions users log in to. A session is a short-lived access token,
+// issued by tokens, and a refresh token that is exchanged for the next pair
+// and then no longer accepted.
+type AccountController struct {
+	users  repository.UserRepository
+	tokens *auth.TokenIssuer
+	opts   AccountOptions
+	now    func() time.Time
+}
+
+// NewAccountController returns a controller keeping accounts in users.
+func NewAccountController(users repository.UserRepository, tokens *auth.TokenIssuer, opts AccountOptions) *AccountController {
+	return &AccountController{users: users, tokens: tokens, opts: opts, now: time.Now}
+}
+
+// dummyPasswordHash is checked against the passwords of logins for unknown
+// emails, so that they take as long as those for existing accounts.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := auth.HashPassword("not the password of any account")
+	return hash
+})
+
+// Register godoc
+// @Summary      Create an account
+// @Description  Create a user account with the reader role
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        credentials  body      models.Credentials  true  "Email and password of the account"
+// @Success      201  {object}  models.User
+// @Failure      400  {object}  models.Problem
+// @Failure      403  {object}  models.Problem
+// @Failure      409  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Security
+// @Router       /auth/register [post]
+func (ac *AccountController) Register(c *gin.Context) {
+	if !ac.opts.Registration {
+		AbortWithProblem(c, http.StatusForbidden, "Registration is disabled; ask an administrator for an account")
+		return
+	}
+	var input models.Credentials
+	if !bindAccountInput(c, &input) {
+		return
+	}
+	hash, err := auth.HashPassword(input.Password)
+	if err != nil {
+		slog.Error("Error hashing password", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to create account")
+		return
+	}
+	user := models.User{Email: NormalizeEmail(input.Email), PasswordHash: hash, Role: models.RoleReader}
+	err = ac.users.Create(c.Request.Context(), &user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		slog.Info("Duplicate account", "email", user.Email)
+		AbortWithProblem(c, http.StatusConflict, "An account with this email already exists")
+		return
+	}
+	if err != nil {
+		slog.Error("Error creating account", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to create account")
+		return
+	}
+	slog.Info("Registered account", "email", user.Email)
+	c.JSON(http.StatusCreated, user)
+}
+
+// Login godoc
+// @Summary      Log in
+// @Description  Exchange an email and password for an access token and a refresh token
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        credentials  body      models.Credentials  true  "Email and password of the account"
+// @Success      200  {object}  models.TokenResponse
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Security
+// @Router       /auth/login [post]
+func (ac *AccountController) Login(c *gin.Context) {
+	var input models.Credentials
+	if !bindAccountInput(c, &input) {
+		return
+	}
+	ctx := c.Request.Context()
+	email := NormalizeEmail(input.Email)
+	user, err := ac.users.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		_, _ = auth.CheckPassword(dummyPasswordHash(), input.Password)
+		slog.Info("Login failed", "email", email, "reason", "unknown email")
+		invalidLogin(c)
+		return
+	}
+	if err != nil {
+		slog.Error("Error finding account", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	ok, err := auth.CheckPassword(user.PasswordHash, input.Password)
+	if err != nil {
+		slog.Error("Error checking password", "email", email, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+	// Locked accounts get the 401 of a wrong password whatever the password,
+	// so that guessing learns neither that the account exists nor that a
+	// guess was right.
+	if user.LockedUntil != nil && ac.now().Before(*user.LockedUntil) {
+		slog.Info("Login failed", "email", email, "reason", "account locked", "lockedUntil", *user.LockedUntil)
+		invalidLogin(c)
+		return
+	}
+	if !ok {
+		ac.loginFailed(c, user)
+		return
+	}
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := ac.users.Unlock(ctx, user.ID); err != nil {
+			slog.Error("Error resetting failed logins", "email", email, "error", err)
+			AbortWithProblem(c, http.StatusInternalServerError, "Failed to log in")
+			return
+		}
+	}
+	slog.Info("Logged in", "email", email)
+	ac.startSession(c, user)
+}
+
+// loginFailed counts a wrong password for user, locking the account once
+// it has had too many in a row, and answers 401.
+func (ac *AccountController) loginFailed(c *gin.Context, user models.User) {
+	ctx := c.Request.Context()
+	failed, err := ac.users.RecordFailedLogin(ctx, user.ID)
+	if err != nil {
+		slog.Error("Error recording failed login", "email", user.Email, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+	slog.Info("Login failed", "email", user.Email, "reason", "wrong password", "failedLogins", failed)
+	if ac.opts.MaxFailedLogins > 0 && failed >= ac.opts.MaxFailedLogins {
+		until := ac.now().Add(ac.opts.LockoutDuration)
+		if err := ac.users.Lock(ctx, user.ID, until); err != nil {
+			slog.Error("Error locking account", "email", user.Email, "error", err)
+			AbortWithProblem(c, http.StatusInternalServerError, "Failed to log in")
+			return
+		}
+		slog.Warn("Locked account after repeated failed logins", "email", user.Email, "until", until)
+	}
+	invalidLogin(c)
+}
+
+// Refresh godoc
+// @Summary      Refresh a session
+// @Description  Exchange a refresh token, once, for a new access token and refresh token
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body      models.RefreshRequest  true  "Refresh token"
+// @Success      200  {object}  models.TokenResponse
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Security
+// @Router       /auth/refresh [post]
+func (ac *AccountController) Refresh(c *gin.Context) {
+	var input models.RefreshRequest
+	if !bindAccountInput(c, &input) {
+		return
+	}
+	ctx := c.Request.Context()
+	token, ok := ac.useRefreshToken(c, input.RefreshToken)
+	if !ok {
+		return
+	}
+	if token.RevokedAt != nil {
+		// A used token coming back means that it leaked, or that a client
+		// lost the token it was exchanged for. Either way the sessions of
+		// the account can no longer be told apart from the thief's.
+		n, err := ac.users.RevokeRefreshTokens(ctx, token.UserID)
+		if err != nil {
+			slog.Error("Error revoking refresh tokens", "user", token.UserID, "error", err)
+			AbortWithProblem(c, http.StatusInternalServerError, "Failed to refresh session")
+			return
+		}
+		slog.Warn("Refresh token reused; ended all sessions of the account", "user", token.UserID, "revoked", n)
+		AbortWithProblem(c, http.StatusUnauthorized, "Refresh token has already been used")
+		return
+	}
+	if ac.now().After(token.ExpiresAt) {
+		AbortWithProblem(c, http.StatusUnauthorized, "Refresh token has expired; log in again")
+		return
+	}
+	user, err := ac.users.Get(ctx, token.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		invalidRefreshToken(c)
+		return
+	}
+	if err != nil {
+		slog.Error("Error finding account", "user", token.UserID, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to refresh session")
+		return
+	}
+	ac.startSession(c, user)
+}
+
+// Logout godoc
+// @Summary      Log out
+// @Description  Revoke a refresh token, or with all every refresh token of its account. Access tokens stay valid until they expire
+// @Tags         auth
+// @Accept       json
+// @Param        token  body  models.LogoutRequest  true  "Refresh token of the session"
+// @Success      204
+// @Failure      400  {object}  models.Problem
+// @Failure      401  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Security
+// @Router       /auth/logout [post]
+func (ac *AccountController) Logout(c *gin.Context) {
+	var input models.LogoutRequest
+	if !bindAccountInput(c, &input) {
+		return
+	}
+	token, ok := ac.useRefreshToken(c, input.RefreshToken)
+	if !ok {
+		return
+	}
+	if input.All {
+		n, err := ac.users.RevokeRefreshTokens(c.Request.Context(), token.UserID)
+		if err != nil {
+			slog.Error("Error revoking refresh tokens", "user", token.UserID, "error", err)
+			AbortWithProblem(c, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+		slog.Info("Logged out everywhere", "user", token.UserID, "revoked", n)
+	}
+	c.Status(http.StatusNoContent)
+	c.Writer.WriteHeaderNow()
+}
+
+// useRefreshToken revokes the refresh token given by a request and returns
+// it as it was, answering 401 if it is unknown.
+func (ac *AccountController) useRefreshToken(c *gin.Context, raw string) (models.RefreshToken, bool) {
+	token, err := ac.users.UseRefreshToken(c.Request.Context(), auth.HashAPIKey(raw))
+	if errors.Is(err, repository.ErrNotFound) {
+		invalidRefreshToken(c)
+		return token, false
+	}
+	if err != nil {
+		slog.Error("Error using refresh token", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to check refresh token")
+		return token, false
+	}
+	return token, true
+}
+
+// startSession answers with a new access token and refresh token for user,
+// carrying the role the user has now.
+func (ac *AccountController) startSession(c *gin.Context, user models.User) {
+	access, err := ac.tokens.Issue(user)
+	if err != nil {
+		slog.Error("Error issuing access token", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+	refresh := auth.GenerateRefreshToken()
+	err = ac.users.CreateRefreshToken(c.Request.Context(), &models.RefreshToken{
+		UserID:    user.ID,
+		Hash:      auth.HashAPIKey(refresh),
+		ExpiresAt: ac.now().Add(ac.opts.RefreshTokenTTL),
+	})
+	if err != nil {
+		slog.Error("Error storing refresh token", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+	// Tokens must not be kept by caches, as RFC 6749 requires.
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.TokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(ac.tokens.TTL().Seconds()),
+		RefreshToken: refresh,
+	})
+}
+
+// bindAccountInput binds the JSON body of an account request to input,
+// answering 400 if it is invalid.
+func bindAccountInput(c *gin.Context, input any) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		slog.Info("Invalid account request", "error", err)
+		invalidBody(c, err, input)
+		return false
+	}
+	return true
+}
+
+// NormalizeEmail returns the form emails are stored and looked up in, so
+// that an account is found however its email is capitalised.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func invalidLogin(c *gin.Context) {
+	AbortWithProblem(c, http.StatusUnauthorized, "Invalid email or password")
+}
+
+func invalidRefreshToken(c *gin.Context) {
+	AbortWithProblem(c, http.StatusUnauthorized, "Invalid refresh token")
+}
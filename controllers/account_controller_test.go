@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+var testJWTConfig = models.JWTConfig{HMACSecret: strings.Repeat("s", 32), RolesClaim: "roles"}
+
+func newTestAccountController(opts AccountOptions) (*AccountController, *time.Time) {
+	ac := NewAccountController(repository.NewMemoryUserRepository(), auth.NewTokenIssuer(testJWTConfig, 15*time.Minute), opts)
+	now := time.Now()
+	ac.now = func() time.Time { return now }
+	return ac, &now
+}
+
+// login logs in with password and returns the response and its tokens.
+func login(ac *AccountController, email, password string) (*httptest.ResponseRecorder, models.TokenResponse) {
+	w := sendJSON(ac.Login, http.MethodPost, "/api/auth/login", "", `{"email":"`+email+`","password":"`+password+`"}`)
+	var tokens models.TokenResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &tokens)
+	return w, tokens
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	t.Parallel()
+
+	ac, _ := newTestAccountController(AccountOptions{Registration: true, RefreshTokenTTL: time.Hour})
+	register := `{"email":"Ada@Example.com","password":"correct horse battery"}`
+
+	w := sendJSON(ac.Register, http.MethodPost, "/api/auth/register", "", register)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var user models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "ada@example.com", user.Email)
+	assert.Equal(t, models.RoleReader, user.Role)
+	assert.NotContains(t, w.Body.String(), "argon2id")
+
+	w = sendJSON(ac.Register, http.MethodPost, "/api/auth/register", "", register)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = sendJSON(ac.Register, http.MethodPost, "/api/auth/register", "", `{"email":"grace","password":"short"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var problem models.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, []models.FieldError{
+		{Field: "email", Rule: "email", Message: "failed the email rule"},
+		{Field: "password", Rule: "min", Message: "must have at least 12 characters"},
+	}, problem.Errors)
+
+	w, tokens := login(ac, "ADA@example.com", "correct horse battery")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, 900, tokens.ExpiresIn)
+	assert.True(t, strings.HasPrefix(tokens.RefreshToken, "bfr_"))
+
+	// The access token is accepted as a bearer token.
+	v, err := auth.NewJWTVerifier(testJWTConfig)
+	require.NoError(t, err)
+	claims, err := v.Verify(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Regexp(t, `^user:[0-9]+$`, claims.Subject)
+	assert.Equal(t, "ada@example.com", claims.Email)
+	assert.Equal(t, []string{models.RoleReader}, claims.Roles)
+
+	for _, tt := range []struct{ email, password string }{
+		{"ada@example.com", "wrong horse battery"},
+		{"grace@example.com", "correct horse battery"},
+	} {
+		w, _ = login(ac, tt.email, tt.password)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, tt.email)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, "Invalid email or password", problem.Detail, "failures do not tell which accounts exist")
+	}
+}
+
+func TestRegistrationDisabled(t *testing.T) {
+	t.Parallel()
+
+	ac, _ := newTestAccountController(AccountOptions{})
+	w := sendJSON(ac.Register, http.MethodPost, "/api/auth/register", "", `{"email":"ada@example.com","password":"correct horse battery"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestLoginLockout(t *testing.T) {
+	t.Parallel()
+
+	ac, now := newTestAccountController(AccountOptions{
+		Registration:    true,
+		RefreshTokenTTL: time.Hour,
+		MaxFailedLogins: 3,
+		LockoutDuration: 10 * time.Minute,
+	})
+	w := sendJSON(ac.Register, http.MethodPost, "/api/auth/register", "", `{"email":"ada@example.com","password":"correct horse battery"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// Successful logins reset the count of failures.
+	for range 2 {
+		w, _ = login(ac, "ada@example.com", "wrong horse battery")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w, _ = login(ac, "ada@example.com", "correct horse battery")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for range 3 {
+		w, _ = login(ac, "ada@example.com", "wrong horse battery")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	// While locked, even the right password is refused like a wrong one, so
+	// that responses do not tell whether a guess was right.
+	*now = now.Add(time.Minute)
+	w, _ = login(ac, "ada@example.com", "correct horse battery")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+	locked := w.Body.String()
+	w, _ = login(ac, "nobody@example.com", "correct horse battery")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, w.Body.String(), locked, "locked accounts look like unknown emails")
+
+	*now = now.Add(9 * time.Minute)
+	w, _ = login(ac, "ada@example.com", "correct horse battery")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w, _ = login(ac, "ada@example.com", "wrong horse battery")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "the count restarts after a lockout")
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	t.Parallel()
+
+	ac, now := newTestAccountController(AccountOptions{Registration: true, RefreshTokenTTL: time.Hour})
+	w := sendJSON(ac.Register, http.MethodPost, "/api/auth/register", "", `{"email":"ada@example.com","password":"correct horse battery"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	refresh := func(token string) (*httptest.ResponseRecorder, models.TokenResponse) {
+		w := sendJSON(ac.Refresh, http.MethodPost, "/api/auth/refresh", "", `{"refreshToken":"`+token+`"}`)
+		var tokens models.TokenResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &tokens)
+		return w, tokens
+	}
+	logout := func(token string, all bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.LogoutRequest{RefreshToken: token, All: all})
+		return sendJSON(ac.Logout, http.MethodPost, "/api/auth/logout", "", string(body))
+	}
+
+	// Refresh tokens are rotated.
+	_, first := login(ac, "ada@example.com", "correct horse battery")
+	w, second := refresh(first.RefreshToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.NotEmpty(t, second.AccessToken)
+
+	// Using a token twice ends every session of the account.
+	_, other := login(ac, "ada@example.com", "correct horse battery")
+	w, _ = refresh(first.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = refresh(second.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = refresh(other.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w, _ = refresh("bfr_unknown")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	_, session := login(ac, "ada@example.com", "correct horse battery")
+	*now = now.Add(2 * time.Hour)
+	w, _ = refresh(session.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "expired")
+
+	// Logging out revokes the token of the session, or of every session.
+	_, session = login(ac, "ada@example.com", "correct horse battery")
+	_, other = login(ac, "ada@example.com", "correct horse battery")
+	assert.Equal(t, http.StatusNoContent, logout(session.RefreshToken, false).Code)
+	w, other = refresh(other.RefreshToken)
+	require.Equal(t, http.StatusOK, w.Code, "other sessions go on")
+	w, _ = refresh(session.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = refresh(other.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "a token used after logout ends every session")
+
+	_, other = login(ac, "ada@example.com", "correct horse battery")
+
+	_, session = login(ac, "ada@example.com", "correct horse battery")
+	assert.Equal(t, http.StatusNoContent, logout(session.RefreshToken, true).Code)
+	w, _ = refresh(other.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, logout("bfr_unknown", false).Code)
+	assert.Equal(t, http.StatusBadRequest, logout("", false).Code)
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// AdminController serves operational endpoints.
+type AdminController struct {
+	config *config.Store
+	books  repository.BookRepository
+}
+
+// NewAdminController returns a controller reporting on the live config and
+// maintaining books.
+func NewAdminController(store *config.Store, books repository.BookRepository) *AdminController {
+	return &AdminController{config: store, books: books}
+}
+
+// GetConfig godoc
+// @Summary      Show the active configuration
+// @Description  Get the version, hash and redacted content of the configuration currently in effect
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  models.ConfigStatus
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /admin/config [get]
+func (ac *AdminController) GetConfig(c *gin.Context) {
+	snap := ac.config.Snapshot()
+	c.JSON(http.StatusOK, models.ConfigStatus{
+		Version:  snap.Version,
+		Hash:     snap.Hash,
+		LoadedAt: snap.LoadedAt,
+		Config:   config.Redact(snap.Config),
+	})
+}
+
+// PurgeTrash godoc
+// @Summary      Empty the trash
+// @Description  Permanently delete the books that have been in the trash for at least olderThanDays days, or all trashed books when it is omitted
+// @Tags         admin
+// @Produce      json
+// @Param        olderThanDays  query     int  false  "Only purge books trashed at least this many days ago"  minimum(0)
+// @Success      200  {object}  models.PurgeResponse
+// @Failure      400  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /admin/trash [delete]
+func (ac *AdminController) PurgeTrash(c *gin.Context) {
+	before := time.Now()
+	errs := fieldErrors{}
+	if days, ok := parseIntParam(c, "olderThanDays", 0, -1, errs); ok {
+		before = before.AddDate(0, 0, -days)
+	}
+	if len(errs) > 0 {
+		slog.Info("Invalid purge parameters", "fields", errs)
+		invalidRequest(c, "Invalid query parameters", errs)
+		return
+	}
+	n, err := ac.books.PurgeTrash(c.Request.Context(), before)
+	if err != nil {
+		slog.Error("Error purging trash", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to purge trash")
+		return
+	}
+	slog.Info("Purged trash", "purged", n, "before", before)
+	c.JSON(http.StatusOK, models.PurgeResponse{Purged: n})
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+func TestGetConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Defaults()
+	cfg.CursorSecret = "do-not-show"
+	store := config.NewStore(cfg)
+	cfg.LogLevel = "debug"
+	_, _, err := store.Apply(cfg)
+	require.NoError(t, err)
+
+	ac := NewAdminController(store, repository.NewMemoryBookRepository())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/admin/config", nil)
+	ac.GetConfig(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "do-not-show")
+	var status models.ConfigStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, uint64(2), status.Version)
+	assert.Equal(t, store.Snapshot().Hash, status.Hash)
+	assert.Equal(t, "debug", status.Config.LogLevel)
+	assert.Equal(t, "REDACTED", status.Config.CursorSecret)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		query        string
+		repo         repository.BookRepository
+		expectStatus int
+		expectPurged int64
+		expectError  string
+	}{
+		{
+			name:         "purge everything",
+			expectStatus: http.StatusOK,
+			expectPurged: 2,
+		},
+		{
+			name:         "nothing old enough",
+			query:        "?olderThanDays=1",
+			expectStatus: http.StatusOK,
+			expectPurged: 0,
+		},
+		{
+			name:         "zero days",
+			query:        "?olderThanDays=0",
+			expectStatus: http.StatusOK,
+			expectPurged: 2,
+		},
+		{
+			name:         "negative days",
+			query:        "?olderThanDays=-1",
+			expectStatus: http.StatusBadRequest,
+			expectError:  "olderThanDays",
+		},
+		{
+			name:         "not a number",
+			query:        "?olderThanDays=week",
+			expectStatus: http.StatusBadRequest,
+			expectError:  "olderThanDays",
+		},
+		{
+			name:         "db error",
+			repo:         failingRepository{err: errDatabaseClosed},
+			expectStatus: http.StatusInternalServerError,
+			expectError:  "Failed to purge trash",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := tt.repo
+			if repo == nil {
+				mem := repository.NewMemoryBookRepository(
+					models.Book{Title: "A", Author: "X"},
+					models.Book{Title: "B", Author: "X"},
+					models.Book{Title: "C", Author: "X"},
+				)
+				require.NoError(t, mem.Delete(context.Background(), 1, 0))
+				require.NoError(t, mem.Delete(context.Background(), 2, 0))
+				repo = mem
+			}
+			ac := NewAdminController(config.NewStore(config.Defaults()), repo)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodDelete, "/api/admin/trash"+tt.query, nil)
+			ac.PurgeTrash(c)
+
+			assert.Equal(t, tt.expectStatus, w.Code)
+			if tt.expectError != "" {
+				assert.Contains(t, w.Body.String(), tt.expectError)
+				return
+			}
+			var resp models.PurgeResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectPurged, resp.Purged)
+			n, err := repo.Count(context.Background(), repository.BookFilter{})
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// AuthorController serves the author endpoints from an AuthorRepository.
+type AuthorController struct {
+	authors repository.AuthorRepository
+	books   *BookController
+}
+
+// NewAuthorController returns a controller backed by authors. The books of
+// an author are listed by books.
+func NewAuthorController(authors repository.AuthorRepository, books *BookController) *AuthorController {
+	return &AuthorController{authors: authors, books: books}
+}
+
+// GetAuthors godoc
+// @Summary      List authors
+// @Description  Get a page of authors ordered by name
+// @Tags         authors
+// @Produce      json
+// @Param        page      query     int     false  "Page number (1-based)"  minimum(1)  default(1)
+// @Param        pageSize  query     int     false  "Items per page"  minimum(1)  maximum(100)  default(20)
+// @Param        name      query     string  false  "Filter by name substring (case-insensitive)"
+// @Success      200  {object}  models.AuthorListResponse
+// @Failure      400  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /authors [get]
+func (ac *AuthorController) GetAuthors(c *gin.Context) {
+	resp := models.AuthorListResponse{Page: 1, PageSize: defaultPageSize}
+	errs := fieldErrors{}
+	if n, ok := parseIntParam(c, "page", 1, -1, errs); ok {
+		resp.Page = n
+	}
+	if n, ok := parseIntParam(c, "pageSize", 1, maxPageSize, errs); ok {
+		resp.PageSize = n
+	}
+	offset := pageOffset(resp.Page, resp.PageSize, errs)
+	if len(errs) > 0 {
+		slog.Info("Invalid author list parameters", "fields", errs)
+		invalidRequest(c, "Invalid query parameters", errs)
+		return
+	}
+
+	ctx := c.Request.Context()
+	name := strings.TrimSpace(c.Query("name"))
+	total, err := ac.authors.Count(ctx, name)
+	if err != nil {
+		slog.Error("Error counting authors", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to fetch authors")
+		return
+	}
+	resp.Total = total
+	resp.Items, err = ac.authors.List(ctx, repository.AuthorListOptions{
+		Name:   name,
+		Limit:  resp.PageSize,
+		Offset: offset,
+	})
+	if err != nil {
+		slog.Error("Error fetching authors", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to fetch authors")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetAuthor godoc
+// @Summary      Get an author by ID
+// @Description  Get details of an author by their ID
+// @Tags         authors
+// @Produce      json
+// @Param        id   path      int  true  "Author ID"  minimum(1)
+// @Success      200  {object}  models.Author
+// @Failure      400  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /authors/{id} [get]
+func (ac *AuthorController) GetAuthor(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
+		return
+	}
+	author, err := ac.authors.Get(c.Request.Context(), id)
+	if err != nil {
+		slog.Info("Author not found", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusNotFound, "Author not found")
+		return
+	}
+	c.JSON(http.StatusOK, author)
+}
+
+// GetAuthorBooks godoc
+// @Summary      List the books of an author
+// @Description  Get a page of the books crediting an author, with the same paging, sorting and filters as the book listing
+// @Tags         authors
+// @Produce      json
+// @Param        id        path      int     true   "Author ID"  minimum(1)
+// @Param        page      query     int     false  "Page number (1-based)"  minimum(1)  default(1)
+// @Param        pageSize  query     int     false  "Items per page"  minimum(1)  maximum(100)  default(20)
+// @Param        limit     query     int     false  "Maximum number of items (alternative to page/pageSize)"  minimum(1)  maximum(100)
+// @Param        offset    query     int     false  "Number of items to skip (alternative to page/pageSize)"  minimum(0)
+// @Param        cursor    query     string  false  "Opaque cursor from a previous nextCursor/prevCursor (alternative to page/limit/offset)"
+// @Param        sort      query     string  false  "Comma separated sort fields (id, title, author, year); prefix with - for descending"  example(title,-year)
+// @Param        title     query     string  false  "Filter by title substring (case-insensitive)"
+// @Param        yearFrom  query     int     false  "Minimum publication year"  minimum(0)  maximum(2100)
+// @Param        yearTo    query     int     false  "Maximum publication year"  minimum(0)  maximum(2100)
+// @Param        If-None-Match  header  string  false  "ETag of a cached copy of this page"
+// @Success      200  {object}  models.BookListResponse
+// @Success      304  "Not Modified"
+// @Failure      400  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /authors/{id}/books [get]
+func (ac *AuthorController) GetAuthorBooks(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
+		return
+	}
+	author, err := ac.authors.Get(c.Request.Context(), id)
+	if err != nil {
+		slog.Info("Author not found for book listing", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusNotFound, "Author not found")
+		return
+	}
+	ac.books.listBooks(c, repository.BookFilter{AuthorID: author.ID})
+}
+
+// CreateAuthor godoc
+// @Summary      Create a new author
+// @Description  Add an author. Names differing only in case, spaces and periods belong to the same author
+// @Tags         authors
+// @Accept       json
+// @Produce      json
+// @Param        author  body      models.AuthorInput  true  "Author to create"
+// @Success      201   {object}  models.Author
+// @Failure      400   {object}  models.Problem
+// @Failure      409   {object}  models.Problem
+// @Failure      default   {object}  models.Problem  "Problem Details"
+// @Router       /authors [post]
+func (ac *AuthorController) CreateAuthor(c *gin.Context) {
+	var input models.AuthorInput
+	if !bindAuthor(c, &input) {
+		return
+	}
+	author := models.Author{Name: input.Name}
+	err := ac.authors.Create(c.Request.Context(), &author)
+	if errors.Is(err, repository.ErrDuplicate) {
+		slog.Info("Duplicate author", "name", input.Name)
+		duplicateAuthor(c)
+		return
+	}
+	if err != nil {
+		slog.Error("Error creating author", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to create author")
+		return
+	}
+	c.JSON(http.StatusCreated, author)
+}
+
+// UpdateAuthor godoc
+// @Summary      Rename an author
+// @Description  Change the name of an author, which also changes the author of their books
+// @Tags         authors
+// @Accept       json
+// @Produce      json
+// @Param        id      path      int                 true  "Author ID"  minimum(1)
+// @Param        author  body      models.AuthorInput  true  "Author data"
+// @Success      200   {object}  models.Author
+// @Failure      400   {object}  models.Problem
+// @Failure      404   {object}  models.Problem
+// @Failure      409   {object}  models.Problem
+// @Failure      default   {object}  models.Problem  "Problem Details"
+// @Router       /authors/{id} [put]
+func (ac *AuthorController) UpdateAuthor(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
+		return
+	}
+	author, err := ac.authors.Get(c.Request.Context(), id)
+	if err != nil {
+		slog.Info("Author not found for update", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusNotFound, "Author not found")
+		return
+	}
+	var input models.AuthorInput
+	if !bindAuthor(c, &input) {
+		return
+	}
+	author.Name = input.Name
+	err = ac.authors.Update(c.Request.Context(), &author)
+	if errors.Is(err, repository.ErrDuplicate) {
+		slog.Info("Duplicate author on update", "id", id, "name", input.Name)
+		duplicateAuthor(c)
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.Info("Author deleted before update", "id", id)
+		AbortWithProblem(c, http.StatusNotFound, "Author not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Error updating author", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to update author")
+		return
+	}
+	c.JSON(http.StatusOK, author)
+}
+
+// DeleteAuthor godoc
+// @Summary      Delete an author
+// @Description  Delete an author who is not credited on any book, including books in the trash
+// @Tags         authors
+// @Produce      json
+// @Param        id   path      int  true  "Author ID"  minimum(1)
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      409  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /authors/{id} [delete]
+func (ac *AuthorController) DeleteAuthor(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
+		return
+	}
+	err := ac.authors.Delete(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrAuthorInUse) {
+		slog.Info("Author still has books", "id", id)
+		AbortWithProblem(c, http.StatusConflict, "Author still has books")
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.Info("No author found to delete", "id", id)
+		AbortWithProblem(c, http.StatusNotFound, "Author not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Error deleting author", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to delete author")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Author deleted"})
+}
+
+// bindAuthor reads an AuthorInput from the request, answering it when the
+// input is invalid. Names that are blank once trimmed are rejected.
+func bindAuthor(c *gin.Context, input *models.AuthorInput) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		slog.Info("Invalid author input", "error", err)
+		invalidBody(c, err, input)
+		return false
+	}
+	if models.NormalizeAuthorName(input.Name) == "" {
+		slog.Info("Blank author name")
+		errs := fieldErrors{}
+		errs.add("name", "notblank", "must not be blank")
+		invalidRequest(c, "Invalid request body", errs)
+		return false
+	}
+	return true
+}
+
+// duplicateAuthor answers a write that would store an author a second time.
+func duplicateAuthor(c *gin.Context) {
+	AbortWithProblem(c, http.StatusConflict, "An author with this name already exists")
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// sendJSON calls handler with the path ID id and the JSON body, if any.
+func sendJSON(handler gin.HandlerFunc, method, target, id, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	if id != "" {
+		c.Params = gin.Params{{Key: "id", Value: id}}
+	}
+	c.Request, _ = http.NewRequest(method, target, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler(c)
+	return w
+}
+
+func TestAuthorCRUD(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965})
+	ac := NewAuthorController(repo.Authors(), NewBookController(repo, repo.Authors(), BookOptions{}))
+
+	tests := []struct {
+		name         string
+		handler      gin.HandlerFunc
+		method       string
+		target       string
+		id           string
+		body         string
+		expectStatus int
+		expectBody   string
+	}{
+		{"create", ac.CreateAuthor, http.MethodPost, "/api/authors", "", `{"name":" Ursula  K. Le Guin "}`, http.StatusCreated, `"name":"Ursula K. Le Guin"`},
+		{"create duplicate", ac.CreateAuthor, http.MethodPost, "/api/authors", "", `{"name":"ursula k le guin"}`, http.StatusConflict, "An author with this name already exists"},
+		{"create blank", ac.CreateAuthor, http.MethodPost, "/api/authors", "", `{"name":"  "}`, http.StatusBadRequest, `{"field":"name","rule":"notblank","message":"must not be blank"}`},
+		{"create without name", ac.CreateAuthor, http.MethodPost, "/api/authors", "", `{}`, http.StatusBadRequest, "required"},
+		{"list", ac.GetAuthors, http.MethodGet, "/api/authors?pageSize=1", "", "", http.StatusOK, `"total":2`},
+		{"list by name", ac.GetAuthors, http.MethodGet, "/api/authors?name=GUIN", "", "", http.StatusOK, `"total":1`},
+		{"list with invalid page", ac.GetAuthors, http.MethodGet, "/api/authors?page=0", "", "", http.StatusBadRequest, "must be greater than or equal to 1"},
+		{"list beyond maximum offset", ac.GetAuthors, http.MethodGet, "/api/authors?page=4611686018427387905&pageSize=3", "", "", http.StatusBadRequest, "must be less than or equal to 715827883"},
+		{"get", ac.GetAuthor, http.MethodGet, "/api/authors/2", "2", "", http.StatusOK, "Ursula K. Le Guin"},
+		{"get missing", ac.GetAuthor, http.MethodGet, "/api/authors/9", "9", "", http.StatusNotFound, "Author not found"},
+		{"get invalid id", ac.GetAuthor, http.MethodGet, "/api/authors/x", "x", "", http.StatusBadRequest, `{"field":"id","rule":"id"`},
+		{"rename", ac.UpdateAuthor, http.MethodPut, "/api/authors/1", "1", `{"name":"Franklin Herbert"}`, http.StatusOK, "Franklin Herbert"},
+		{"rename to taken name", ac.UpdateAuthor, http.MethodPut, "/api/authors/1", "1", `{"name":"Ursula K Le Guin"}`, http.StatusConflict, "An author with this name already exists"},
+		{"rename missing", ac.UpdateAuthor, http.MethodPut, "/api/authors/9", "9", `{"name":"X"}`, http.StatusNotFound, "Author not found"},
+		{"delete author with books", ac.DeleteAuthor, http.MethodDelete, "/api/authors/1", "1", "", http.StatusConflict, "Author still has books"},
+		{"delete", ac.DeleteAuthor, http.MethodDelete, "/api/authors/2", "2", "", http.StatusOK, "Author deleted"},
+		{"delete missing", ac.DeleteAuthor, http.MethodDelete, "/api/authors/2", "2", "", http.StatusNotFound, "Author not found"},
+	}
+
+	// The cases run in order since each builds on the previous ones.
+	for _, tt := range tests {
+		w := sendJSON(tt.handler, tt.method, tt.target, tt.id, tt.body)
+		assert.Equal(t, tt.expectStatus, w.Code, tt.name)
+		assert.Contains(t, w.Body.String(), tt.expectBody, tt.name)
+	}
+
+	book, err := repo.Get(t.Context(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Franklin Herbert", book.Author)
+	assert.Equal(t, uint(2), book.Version)
+}
+
+func TestGetAuthorBooks(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository(
+		models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965},
+		models.Book{Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937},
+		models.Book{Title: "Dune Messiah", Author: "frank herbert", Year: 1969},
+	)
+	ac := NewAuthorController(repo.Authors(), NewBookController(repo, repo.Authors(), BookOptions{}))
+
+	w := sendJSON(ac.GetAuthorBooks, http.MethodGet, "/api/authors/1/books?sort=-year", "1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp models.BookListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, int64(2), resp.Total)
+	var titles []string
+	for _, b := range resp.Items {
+		titles = append(titles, b.Title)
+	}
+	assert.Equal(t, []string{"Dune Messiah", "Dune"}, titles)
+
+	w = sendJSON(ac.GetAuthorBooks, http.MethodGet, "/api/authors/9/books", "9", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "Author not found")
+}
+
+func TestBookAuthors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name             string
+		knownAuthorsOnly bool
+		body             string
+		expectStatus     int
+		expectAuthors    []models.AuthorRef
+		expectError      string
+	}{
+		{
+			name:          "authors by id and name",
+			body:          `{"title":"Good Omens","authors":[1,{"name":"Neil Gaiman"}],"year":1990}`,
+			expectStatus:  http.StatusCreated,
+			expectAuthors: []models.AuthorRef{{ID: 1, Name: "Terry Pratchett"}, {ID: 2, Name: "Neil Gaiman"}},
+		},
+		{
+			name:          "known author by name",
+			body:          `{"title":"Mort","authors":["terry pratchett"],"year":1987}`,
+			expectStatus:  http.StatusCreated,
+			expectAuthors: []models.AuthorRef{{ID: 1, Name: "Terry Pratchett"}},
+		},
+		{
+			name:             "known author only",
+			knownAuthorsOnly: true,
+			body:             `{"title":"Mort","author":"Terry Pratchett","year":1987}`,
+			expectStatus:     http.StatusCreated,
+			expectAuthors:    []models.AuthorRef{{ID: 1, Name: "Terry Pratchett"}},
+		},
+		{
+			name:             "new author not allowed",
+			knownAuthorsOnly: true,
+			body:             `{"title":"Good Omens","authors":["Terry Pratchett","Neil Gaiman"],"year":1990}`,
+			expectStatus:     http.StatusUnprocessableEntity,
+			expectError:      "Unknown author",
+		},
+		{
+			name:         "unknown author id",
+			body:         `{"title":"Mort","authors":[9],"year":1987}`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "Unknown author",
+		},
+		{
+			name:         "author and authors",
+			body:         `{"title":"Mort","author":"Terry Pratchett","authors":[1],"year":1987}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "excluded_with",
+		},
+		{
+			name:         "blank author reference",
+			body:         `{"title":"Mort","authors":[" "],"year":1987}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "an author must be given by id or name",
+		},
+		{
+			name:         "no authors",
+			body:         `{"title":"Mort","authors":[],"year":1987}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  `{"field":"authors","rule":"min","message":"must have at least 1 items"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := repository.NewMemoryBookRepository(models.Book{Title: "Eric", Author: "Terry Pratchett", Year: 1990})
+			bc := NewBookController(repo, repo.Authors(), BookOptions{KnownAuthorsOnly: tt.knownAuthorsOnly})
+
+			w := sendJSON(bc.CreateBook, http.MethodPost, "/api/books", "", tt.body)
+			assert.Equal(t, tt.expectStatus, w.Code)
+			if tt.expectStatus != http.StatusCreated {
+				assert.Contains(t, w.Body.String(), tt.expectError)
+				return
+			}
+			var book models.Book
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+			assert.Equal(t, tt.expectAuthors, book.Authors)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// errRolledBack aborts the transaction of an atomic bulk request after an
+// operation failed.
+var errRolledBack = errors.New("bulk request rolled back")
+
+// bulkOp is a validated bulk operation. book holds the fields a create or
+// update writes.
+type bulkOp struct {
+	index   int
+	op      string
+	id      uint
+	version uint
+	book    models.Book
+}
+
+// BulkBooks godoc
+// @Summary      Create, update and delete books in bulk
+// @Description  Apply up to 1000 create, update and delete operations in order, on their own or atomically
+// @Tags         books
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.BulkRequest  true  "Operations to apply"
+// @Success      200  {object}  models.BulkResponse
+// @Success      207  {object}  models.BulkResponse
+// @Failure      400  {object}  models.BulkResponse
+// @Failure      403  {object}  models.BulkResponse
+// @Failure      404  {object}  models.BulkResponse
+// @Failure      409  {object}  models.BulkResponse
+// @Failure      412  {object}  models.BulkResponse
+// @Failure      422  {object}  models.BulkResponse
+// @Failure      428  {object}  models.BulkResponse
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /books/bulk [post]
+func (bc *BookController) BulkBooks(c *gin.Context) {
+	var req models.BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Info("Invalid bulk request", "error", err)
+		invalidBody(c, err, req)
+		return
+	}
+
+	ctx := c.Request.Context()
+	ops := make([]bulkOp, len(req.Operations))
+	results := make([]models.BulkResult, len(req.Operations))
+	failed := -1
+	for i, op := range req.Operations {
+		ops[i], results[i] = bc.prepareBulkOp(ctx, i, op)
+		if results[i].Status != 0 && failed < 0 {
+			failed = i
+		}
+	}
+
+	status := http.StatusMultiStatus
+	resp := models.BulkResponse{Atomic: req.Atomic, Results: results}
+	if req.Atomic {
+		var err error
+		if failed < 0 {
+			err = bc.books.Transaction(ctx, func(repo repository.BookRepository) error {
+				for i, op := range ops {
+					results[i] = bc.applyBulkOp(ctx, repo, op)
+					if results[i].Status >= http.StatusMultipleChoices {
+						failed = i
+						return errRolledBack
+					}
+				}
+				return nil
+			})
+		}
+		if err != nil && failed < 0 {
+			slog.Error("Error applying bulk request", "error", err)
+			AbortWithProblem(c, http.StatusInternalServerError, "Failed to apply operations")
+			return
+		}
+		status = http.StatusOK
+		if failed >= 0 {
+			status = results[failed].Status
+			resp.Error = "No operations were applied"
+			for i := range results {
+				if results[i].Status < http.StatusMultipleChoices {
+					results[i] = models.BulkResult{
+						Index:  i,
+						Op:     ops[i].op,
+						Status: http.StatusFailedDependency,
+						Error:  fmt.Sprintf("Not applied because operation %d failed", failed),
+					}
+				}
+			}
+		}
+	} else {
+		for i, op := range ops {
+			if results[i].Status == 0 {
+				results[i] = bc.applyBulkOp(ctx, bc.books, op)
+			}
+		}
+	}
+
+	for _, r := range results {
+		if r.Status < http.StatusMultipleChoices {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	slog.Info("Bulk request handled", "atomic", req.Atomic, "succeeded", resp.Succeeded, "failed", resp.Failed)
+	c.JSON(status, resp)
+}
+
+// prepareBulkOp validates op, the operation at index i. The result has a
+// status only if op was rejected.
+func (bc *BookController) prepareBulkOp(ctx context.Context, i int, op models.BulkOperation) (bulkOp, models.BulkResult) {
+	prepared := bulkOp{index: i, op: op.Op, id: op.ID, version: op.Version}
+	result := models.BulkResult{Index: i, Op: op.Op}
+
+	fields := fieldErrors{}
+	hasBook := len(op.Book) > 0 && string(op.Book) != "null"
+	switch op.Op {
+	case "create":
+		if op.ID != 0 {
+			fields.add("id", "excluded", "must be omitted")
+		}
+		if op.Version != 0 {
+			fields.add("version", "excluded", "must be omitted")
+		}
+	case "update", "delete":
+		if op.ID == 0 {
+			fields.add("id", "required", "is required")
+		}
+	default:
+		fields.add("op", "oneof", "must be create, update or delete")
+	}
+	switch {
+	case op.Op == "delete" && hasBook:
+		fields.add("book", "excluded", "must be omitted")
+	case op.Op != "create" && op.Op != "update":
+	case !hasBook:
+		fields.add("book", "required", "is required")
+	default:
+		var input models.BookInput
+		if err := binding.JSON.BindBody(op.Book, &input); err != nil {
+			for field, fe := range inputFieldErrors(err, input, "book.") {
+				fields[field] = fe
+			}
+		} else {
+			applyInput(&prepared.book, input)
+		}
+	}
+	if len(fields) > 0 {
+		result.Status = http.StatusBadRequest
+		result.Error = "Invalid operation"
+		result.Errors = fields.list()
+		return prepared, result
+	}
+
+	// The route only requires the permission to write books.
+	if op.Op == "delete" && !auth.Allowed(ctx, auth.BooksDelete) {
+		result.Status = http.StatusForbidden
+		result.Error = auth.MissingPermission(auth.BooksDelete)
+		return prepared, result
+	}
+	if bc.requireIfMatch.Load() && op.Op != "create" && op.Version == 0 {
+		result.Status = http.StatusPreconditionRequired
+		result.Error = "version is required"
+		return prepared, result
+	}
+	if op.Op != "delete" {
+		err := bc.lookupAuthors(ctx, &prepared.book)
+		if errors.Is(err, repository.ErrUnknownAuthor) {
+			result.Status = http.StatusUnprocessableEntity
+			result.Error = "Unknown author"
+		} else if err != nil {
+			slog.Error("Error looking up authors", "index", i, "error", err)
+			result.Status = http.StatusInternalServerError
+			result.Error = "Failed to look up authors"
+		}
+	}
+	return prepared, result
+}
+
+// applyBulkOp applies op to repo and reports the outcome.
+func (bc *BookController) applyBulkOp(ctx context.Context, repo repository.BookRepository, op bulkOp) models.BulkResult {
+	result := models.BulkResult{Index: op.index, Op: op.op, Status: http.StatusOK}
+	book := op.book
+	var err error
+	switch op.op {
+	case "create":
+		result.Status = http.StatusCreated
+		err = repo.Create(ctx, &book)
+	case "update":
+		var stored models.Book
+		stored, err = repo.Get(ctx, op.id)
+		if err == nil && op.version != 0 && op.version != stored.Version {
+			err = repository.ErrVersionConflict
+		}
+		if err == nil {
+			book.ID, book.Version, book.CreatedAt = stored.ID, stored.Version, stored.CreatedAt
+			err = repo.Update(ctx, &book)
+		}
+	case "delete":
+		err = repo.Delete(ctx, op.id, op.version)
+	}
+
+	switch {
+	case err == nil:
+		if op.op != "delete" {
+			result.Book = &book
+		}
+		return result
+	case errors.Is(err, repository.ErrNotFound):
+		result.Status, result.Error = http.StatusNotFound, "Book not found"
+	case errors.Is(err, repository.ErrVersionConflict):
+		result.Status, result.Error = http.StatusPreconditionFailed, "Book has been modified"
+	case errors.Is(err, repository.ErrDuplicate):
+		result.Status, result.Error = http.StatusConflict, "A book with this ISBN already exists"
+	case errors.Is(err, repository.ErrUnknownAuthor):
+		result.Status, result.Error = http.StatusUnprocessableEntity, "Unknown author"
+	default:
+		slog.Error("Error applying bulk operation", "index", op.index, "op", op.op, "error", err)
+		result.Status, result.Error = http.StatusInternalServerError, "Failed to "+op.op+" book"
+	}
+	return result
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+func TestBulkBooks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		opts           BookOptions
+		roles          []string
+		body           string
+		expectStatus   int
+		expectError    string
+		expectStatuses []int
+		expectErrors   map[int][]models.FieldError
+		expectTitles   []string
+	}{
+		{
+			name: "best effort",
+			body: `{"operations":[
+				{"op":"create","book":{"title":"Emma","author":"Jane Austen","year":1815}},
+				{"op":"create","book":{"author":"Nobody","year":3000,"genres":["ok",""]}},
+				{"op":"update","id":1,"book":{"title":"Dune (1965)","author":"Frank Herbert","year":1965}},
+				{"op":"delete","id":9},
+				{"op":"delete","id":2,"version":1}
+			]}`,
+			expectStatus:   http.StatusMultiStatus,
+			expectStatuses: []int{http.StatusCreated, http.StatusBadRequest, http.StatusOK, http.StatusNotFound, http.StatusOK},
+			expectErrors: map[int][]models.FieldError{1: {
+				{Field: "book.genres[1]", Rule: "required", Message: "is required"},
+				{Field: "book.title", Rule: "required", Message: "is required"},
+				{Field: "book.year", Rule: "lte", Message: "must be at most 2100"},
+			}},
+			expectTitles: []string{"Dune (1965)", "Emma"},
+		},
+		{
+			name:  "delete without permission",
+			roles: []string{models.RoleEditor},
+			body: `{"operations":[
+				{"op":"create","book":{"title":"Emma","author":"Jane Austen","year":1815}},
+				{"op":"delete","id":2}
+			]}`,
+			expectStatus:   http.StatusMultiStatus,
+			expectError:    "Missing permission books:delete, which requires the admin role",
+			expectStatuses: []int{http.StatusCreated, http.StatusForbidden},
+			expectTitles:   []string{"Dune", "The Hobbit", "Emma"},
+		},
+		{
+			name:           "delete with permission",
+			roles:          []string{models.RoleAdmin},
+			body:           `{"operations":[{"op":"delete","id":2}]}`,
+			expectStatus:   http.StatusMultiStatus,
+			expectStatuses: []int{http.StatusOK},
+			expectTitles:   []string{"Dune"},
+		},
+		{
+			name: "atomic",
+			body: `{"atomic":true,"operations":[
+				{"op":"create","book":{"title":"Emma","authors":[{"name":"Jane Austen"}]}},
+				{"op":"delete","id":1,"version":1}
+			]}`,
+			expectStatus:   http.StatusOK,
+			expectStatuses: []int{http.StatusCreated, http.StatusOK},
+			expectTitles:   []string{"The Hobbit", "Emma"},
+		},
+		{
+			name: "atomic with failing operation",
+			body: `{"atomic":true,"operations":[
+				{"op":"create","book":{"title":"Emma","author":"Jane Austen","isbn":"0-306-40615-2"}},
+				{"op":"create","book":{"title":"Persuasion","author":"Jane Austen","isbn":"978-0-306-40615-7"}},
+				{"op":"delete","id":1}
+			]}`,
+			expectStatus:   http.StatusConflict,
+			expectError:    "No operations were applied",
+			expectStatuses: []int{http.StatusFailedDependency, http.StatusConflict, http.StatusFailedDependency},
+			expectTitles:   []string{"Dune", "The Hobbit"},
+		},
+		{
+			name: "atomic with invalid operations",
+			body: `{"atomic":true,"operations":[
+				{"op":"delete","id":1},
+				{"op":"rename","id":2},
+				{"op":"update","book":{"title":"Dune","author":"Frank Herbert","year":"1965"}}
+			]}`,
+			expectStatus:   http.StatusBadRequest,
+			expectError:    "No operations were applied",
+			expectStatuses: []int{http.StatusFailedDependency, http.StatusBadRequest, http.StatusBadRequest},
+			expectErrors: map[int][]models.FieldError{
+				1: {{Field: "op", Rule: "oneof", Message: "must be create, update or delete"}},
+				2: {
+					{Field: "book.year", Rule: "type", Message: "must be int"},
+					{Field: "id", Rule: "required", Message: "is required"},
+				},
+			},
+			expectTitles: []string{"Dune", "The Hobbit"},
+		},
+		{
+			name: "version conflict",
+			body: `{"operations":[
+				{"op":"update","id":1,"version":2,"book":{"title":"Dune","author":"Frank Herbert"}},
+				{"op":"delete","id":2,"book":{"title":"The Hobbit"}}
+			]}`,
+			expectStatus:   http.StatusMultiStatus,
+			expectStatuses: []int{http.StatusPreconditionFailed, http.StatusBadRequest},
+			expectErrors:   map[int][]models.FieldError{1: {{Field: "book", Rule: "excluded", Message: "must be omitted"}}},
+			expectTitles:   []string{"Dune", "The Hobbit"},
+		},
+		{
+			name: "versions required",
+			opts: BookOptions{RequireIfMatch: true},
+			body: `{"operations":[
+				{"op":"create","book":{"title":"Emma","author":"Jane Austen"}},
+				{"op":"delete","id":1}
+			]}`,
+			expectStatus:   http.StatusMultiStatus,
+			expectStatuses: []int{http.StatusCreated, http.StatusPreconditionRequired},
+			expectTitles:   []string{"Dune", "The Hobbit", "Emma"},
+		},
+		{
+			name:           "known authors only",
+			opts:           BookOptions{KnownAuthorsOnly: true},
+			body:           `{"operations":[{"op":"create","book":{"title":"Emma","author":"Jane Austen"}}]}`,
+			expectStatus:   http.StatusMultiStatus,
+			expectStatuses: []int{http.StatusUnprocessableEntity},
+			expectTitles:   []string{"Dune", "The Hobbit"},
+		},
+		{
+			name:         "no operations",
+			body:         `{"operations":[]}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  `{"field":"operations","rule":"min","message":"must have at least 1 items"}`,
+			expectTitles: []string{"Dune", "The Hobbit"},
+		},
+		{
+			name:         "malformed body",
+			body:         `[{"op":"create"}]`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "Invalid request body: json: cannot unmarshal array",
+			expectTitles: []string{"Dune", "The Hobbit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := repository.NewMemoryBookRepository(
+				models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965},
+				models.Book{Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937},
+			)
+			bc := NewBookController(repo, repo.Authors(), tt.opts)
+
+			handler := bc.BulkBooks
+			if tt.roles != nil {
+				handler = func(c *gin.Context) {
+					c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), auth.Principal{Subject: "ci", Roles: tt.roles}))
+					bc.BulkBooks(c)
+				}
+			}
+			w := sendJSON(handler, http.MethodPost, "/api/books/bulk", "", tt.body)
+			assert.Equal(t, tt.expectStatus, w.Code, w.Body.String())
+			var resp models.BulkResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Contains(t, w.Body.String(), tt.expectError)
+
+			var statuses []int
+			failed := 0
+			for i, r := range resp.Results {
+				assert.Equal(t, i, r.Index)
+				statuses = append(statuses, r.Status)
+				if r.Status >= http.StatusMultipleChoices {
+					failed++
+					assert.NotEmpty(t, r.Error)
+				}
+				assert.Equal(t, tt.expectErrors[i], r.Errors, "errors of operation %d", i)
+			}
+			assert.Equal(t, tt.expectStatuses, statuses)
+			assert.Equal(t, failed, resp.Failed)
+			assert.Equal(t, len(statuses)-failed, resp.Succeeded)
+
+			books, err := repo.List(context.Background(), repository.ListOptions{Sort: []repository.SortField{{Field: "id"}}})
+			require.NoError(t, err)
+			var titles []string
+			for _, b := range books {
+				titles = append(titles, b.Title)
+			}
+			assert.Equal(t, tt.expectTitles, titles)
+		})
+	}
+}
@@ -1,30 +1,219 @@
 package controllers
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"sync/atomic"
 
-	"github.com/burhangltekin/byfood/models"
-	"github.com/burhangltekin/byfood/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
 )
 
+// BookController serves the book endpoints from a BookRepository.
+type BookController struct {
+	books            repository.BookRepository
+	authors          repository.AuthorRepository
+	cursors          cursorSigner
+	requireIfMatch   atomic.Bool
+	knownAuthorsOnly atomic.Bool
+}
+
+// BookOptions configures a BookController.
+type BookOptions struct {
+	// CursorSecret signs pagination cursors; a random key is used when it
+	// is empty.
+	CursorSecret []byte
+	// RequireIfMatch makes writes to existing books send If-Match.
+	RequireIfMatch bool
+	// KnownAuthorsOnly rejects books naming an author that does not exist
+	// yet instead of creating it.
+	KnownAuthorsOnly bool
+}
+
+// NewBookController returns a controller backed by books. authors is used to
+// look up the authors named in writes when opts.KnownAuthorsOnly is set.
+func NewBookController(books repository.BookRepository, authors repository.AuthorRepository, opts BookOptions) *BookController {
+	bc := &BookController{
+		books:   books,
+		authors: authors,
+		cursors: newCursorSigner(opts.CursorSecret),
+	}
+	bc.Reconfigure(opts)
+	return bc
+}
+
+// Reconfigure applies RequireIfMatch and KnownAuthorsOnly of opts to the
+// requests that follow, so that they can change with the configuration. The
+// cursor secret is kept.
+func (bc *BookController) Reconfigure(opts BookOptions) {
+	bc.requireIfMatch.Store(opts.RequireIfMatch)
+	bc.knownAuthorsOnly.Store(opts.KnownAuthorsOnly)
+}
+
 // GetBooks godoc
-// @Summary      List all books
-// @Description  Get all books from the database
+// @Summary      List books
+// @Description  Get a page of books, optionally filtered and sorted
 // @Tags         books
 // @Produce      json
-// @Success      200  {array}  models.Book
-// @Failure      500  {object}  map[string]string
+// @Param        page      query     int     false  "Page number (1-based)"  minimum(1)  default(1)
+// @Param        pageSize  query     int     false  "Items per page"  minimum(1)  maximum(100)  default(20)
+// @Param        limit     query     int     false  "Maximum number of items (alternative to page/pageSize)"  minimum(1)  maximum(100)
+// @Param        offset    query     int     false  "Number of items to skip (alternative to page/pageSize)"  minimum(0)
+// @Param        cursor    query     string  false  "Opaque cursor from a previous nextCursor/prevCursor (alternative to page/limit/offset)"
+// @Param        sort      query     string  false  "Comma separated sort fields (id, title, author, year); prefix with - for descending"  example(title,-year)
+// @Param        author    query     string  false  "Filter by author name, ignoring case, spaces and periods"
+// @Param        title     query     string  false  "Filter by title substring (case-insensitive)"
+// @Param        yearFrom  query     int     false  "Minimum publication year"  minimum(0)  maximum(2100)
+// @Param        yearTo    query     int     false  "Maximum publication year"  minimum(0)  maximum(2100)
+// @Param        If-None-Match  header  string  false  "ETag of a cached copy of this page"
+// @Success      200  {object}  models.BookListResponse
+// @Success      304  "Not Modified"
+// @Failure      400  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
 // @Router       /books [get]
-func GetBooks(c *gin.Context) {
-	var books []models.Book
-	if err := utils.DB.Find(&books).Error; err != nil {
-		log.Printf("Error fetching books: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+func (bc *BookController) GetBooks(c *gin.Context) {
+	bc.listBooks(c, repository.BookFilter{})
+}
+
+// GetTrash godoc
+// @Summary      List trashed books
+// @Description  Get a page of the deleted books that can still be restored, with the same paging, sorting and filters as the book listing
+// @Tags         books
+// @Produce      json
+// @Param        page      query     int     false  "Page number (1-based)"  minimum(1)  default(1)
+// @Param        pageSize  query     int     false  "Items per page"  minimum(1)  maximum(100)  default(20)
+// @Param        limit     query     int     false  "Maximum number of items (alternative to page/pageSize)"  minimum(1)  maximum(100)
+// @Param        offset    query     int     false  "Number of items to skip (alternative to page/pageSize)"  minimum(0)
+// @Param        cursor    query     string  false  "Opaque cursor from a previous nextCursor/prevCursor (alternative to page/limit/offset)"
+// @Param        sort      query     string  false  "Comma separated sort fields (id, title, author, year); prefix with - for descending"  example(title,-year)
+// @Param        author    query     string  false  "Filter by author name, ignoring case, spaces and periods"
+// @Param        title     query     string  false  "Filter by title substring (case-insensitive)"
+// @Param        yearFrom  query     int     false  "Minimum publication year"  minimum(0)  maximum(2100)
+// @Param        yearTo    query     int     false  "Maximum publication year"  minimum(0)  maximum(2100)
+// @Param        If-None-Match  header  string  false  "ETag of a cached copy of this page"
+// @Success      200  {object}  models.BookListResponse
+// @Success      304  "Not Modified"
+// @Failure      400  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /books/trash [get]
+func (bc *BookController) GetTrash(c *gin.Context) {
+	bc.listBooks(c, repository.BookFilter{Trashed: true})
+}
+
+// SearchBooks godoc
+// @Summary      Search books
+// @Description  Full-text search over the title, author and description of the books, ranked by relevance
+// @Tags         books
+// @Produce      json
+// @Param        q         query     string  true   "Search query"  example("dark lord" tolk*)
+// @Param        page      query     int     false  "Page number (1-based)"  minimum(1)  default(1)
+// @Param        pageSize  query     int     false  "Items per page"  minimum(1)  maximum(100)  default(20)
+// @Param        limit     query     int     false  "Maximum number of items (alternative to page/pageSize)"  minimum(1)  maximum(100)
+// @Param        offset    query     int     false  "Number of items to skip (alternative to page/pageSize)"  minimum(0)
+// @Param        author    query     string  false  "Filter by author name, ignoring case, spaces and periods"
+// @Param        title     query     string  false  "Filter by title substring (case-insensitive)"
+// @Param        yearFrom  query     int     false  "Minimum publication year"  minimum(0)  maximum(2100)
+// @Param        yearTo    query     int     false  "Maximum publication year"  minimum(0)  maximum(2100)
+// @Param        If-None-Match  header  string  false  "ETag of a cached copy of this page"
+// @Success      200  {object}  models.SearchResponse
+// @Success      304  "Not Modified"
+// @Failure      400  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /books/search [get]
+func (bc *BookController) SearchBooks(c *gin.Context) {
+	query, fieldErrs := parseBookListQuery(c, bc.cursors, repository.BookFilter{})
+	if _, ok := c.GetQuery("sort"); ok {
+		fieldErrs.add("sort", "excluded", "search results are ordered by relevance")
+	}
+	if _, ok := c.GetQuery("cursor"); ok {
+		fieldErrs.add("cursor", "excluded", "search results cannot be paged by cursor")
+	}
+	search, err := repository.ParseSearchQuery(c.Query("q"))
+	if err != nil {
+		fieldErrs.add("q", "search", err.Error())
+	}
+	if len(fieldErrs) > 0 {
+		slog.Info("Invalid search parameters", "fields", fieldErrs)
+		invalidRequest(c, "Invalid query parameters", fieldErrs)
 		return
 	}
-	c.JSON(http.StatusOK, books)
+
+	result, err := bc.books.Search(c.Request.Context(), repository.SearchOptions{
+		Query:  search,
+		Filter: query.Filter,
+		Limit:  query.PageSize,
+		Offset: query.Offset,
+	})
+	if err != nil {
+		slog.Error("Error searching books", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to search books")
+		return
+	}
+	body, err := json.Marshal(models.SearchResponse{
+		Items:    result.Hits,
+		Total:    result.Total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Windowed: result.Windowed,
+	})
+	if err != nil {
+		slog.Error("Error encoding search results", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to search books")
+		return
+	}
+	if notModified(c, bodyETag(body)) {
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// listBooks answers a listing of the books within scope, which the request
+// can only narrow further.
+func (bc *BookController) listBooks(c *gin.Context, scope repository.BookFilter) {
+	query, fieldErrs := parseBookListQuery(c, bc.cursors, scope)
+	if len(fieldErrs) > 0 {
+		slog.Info("Invalid list parameters", "fields", fieldErrs)
+		invalidRequest(c, "Invalid query parameters", fieldErrs)
+		return
+	}
+
+	ctx := c.Request.Context()
+	total, err := bc.books.Count(ctx, query.Filter)
+	if err != nil {
+		slog.Error("Error counting books", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to fetch books")
+		return
+	}
+	books, err := bc.books.List(ctx, query.listOptions())
+	if err != nil {
+		slog.Error("Error fetching books", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to fetch books")
+		return
+	}
+	resp := models.BookListResponse{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}
+	resp.Items, resp.NextCursor, resp.PrevCursor = query.paginate(bc.cursors, books)
+	body, err := json.Marshal(resp)
+	if err != nil {
+		slog.Error("Error encoding books", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to fetch books")
+		return
+	}
+	if notModified(c, bodyETag(body)) {
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
 // GetBook godoc
@@ -32,17 +221,31 @@ func GetBooks(c *gin.Context) {
 // @Description  Get details of a book by its ID
 // @Tags         books
 // @Produce      json
-// @Param        id   path      int  true  "Book ID"
+// @Param        id             path      int     true   "Book ID"  minimum(1)
+// @Param        If-None-Match  header    string  false  "ETag of a cached copy of the book"
 // @Success      200  {object}  models.Book
-// @Failure      404  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Success      304  "Not Modified"
+// @Failure      400  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
 // @Router       /books/{id} [get]
-func GetBook(c *gin.Context) {
-	id := c.Param("id")
-	var book models.Book
-	if err := utils.DB.First(&book, id).Error; err != nil {
-		log.Printf("Book not found (id=%s): %v", id, err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+func (bc *BookController) GetBook(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
+		return
+	}
+	book, err := bc.books.Get(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.Info("Book not found", "id", id)
+		AbortWithProblem(c, http.StatusNotFound, "Book not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Error fetching book", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to fetch book")
+		return
+	}
+	if notModified(c, bookETag(book)) {
 		return
 	}
 	c.JSON(http.StatusOK, book)
@@ -56,26 +259,40 @@ func GetBook(c *gin.Context) {
 // @Produce      json
 // @Param        book  body      models.BookInput  true  "Book to create"
 // @Success      201   {object}  models.Book
-// @Failure      400   {object}  map[string]string
-// @Failure      500   {object}  map[string]string
+// @Failure      400   {object}  models.Problem
+// @Failure      409   {object}  models.Problem
+// @Failure      422   {object}  models.Problem
+// @Failure      default   {object}  models.Problem  "Problem Details"
 // @Router       /books [post]
-func CreateBook(c *gin.Context) {
+func (bc *BookController) CreateBook(c *gin.Context) {
 	var input models.BookInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("Invalid input: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.Info("Invalid input", "error", err)
+		invalidBody(c, err, input)
 		return
 	}
-	book := models.Book{
-		Title:  input.Title,
-		Author: input.Author,
-		Year:   input.Year,
+	var book models.Book
+	applyInput(&book, input)
+	if !bc.resolveAuthors(c, &book) {
+		return
 	}
-	if err := utils.DB.Create(&book).Error; err != nil {
-		log.Printf("Error creating book: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
+	err := bc.books.Create(c.Request.Context(), &book)
+	if errors.Is(err, repository.ErrUnknownAuthor) {
+		slog.Info("Unknown author", "error", err)
+		unknownAuthor(c)
 		return
 	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		slog.Info("Duplicate ISBN", "isbn", input.ISBN)
+		duplicateISBN(c)
+		return
+	}
+	if err != nil {
+		slog.Error("Error creating book", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to create book")
+		return
+	}
+	c.Header("ETag", bookETag(book))
 	c.JSON(http.StatusCreated, book)
 }
 
@@ -85,60 +302,280 @@ func CreateBook(c *gin.Context) {
 // @Tags         books
 // @Accept       json
 // @Produce      json
-// @Param        id    path      int                true  "Book ID"
-// @Param        book  body      models.BookInput   true  "Book data"
+// @Param        id        path      int                true   "Book ID"  minimum(1)
+// @Param        If-Match  header    string             false  "ETag the update is based on; required when requireIfMatch is set"
+// @Param        book      body      models.BookInput   true   "Book data"
 // @Success      200   {object}  models.Book
-// @Failure      400   {object}  map[string]string
-// @Failure      404   {object}  map[string]string
-// @Failure      500   {object}  map[string]string
+// @Failure      400   {object}  models.Problem
+// @Failure      404   {object}  models.Problem
+// @Failure      409   {object}  models.Problem
+// @Failure      412   {object}  models.Problem
+// @Failure      422   {object}  models.Problem
+// @Failure      428   {object}  models.Problem
+// @Failure      default   {object}  models.Problem  "Problem Details"
 // @Router       /books/{id} [put]
-func UpdateBook(c *gin.Context) {
-	id := c.Param("id")
-	var book models.Book
-	if err := utils.DB.First(&book, id).Error; err != nil {
-		log.Printf("Book not found for update (id=%s): %v", id, err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+func (bc *BookController) UpdateBook(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
+		return
+	}
+	book, err := bc.books.Get(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.Info("Book not found for update", "id", id)
+		AbortWithProblem(c, http.StatusNotFound, "Book not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Error fetching book to update", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to fetch book")
+		return
+	}
+	if !bc.checkIfMatch(c, book) {
+		slog.Info("Precondition failed for update", "id", id)
 		return
 	}
 	var input models.BookInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		log.Printf("Invalid input for update: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.Info("Invalid input for update", "id", id, "error", err)
+		invalidBody(c, err, input)
+		return
+	}
+	applyInput(&book, input)
+	bc.saveBook(c, id, book)
+}
+
+// PatchBook godoc
+// @Summary      Partially update a book
+// @Description  Apply a JSON Merge Patch (RFC 7396, also accepted as plain JSON) or a JSON Patch (RFC 6902) to a book, selected by Content-Type
+// @Tags         books
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int     true   "Book ID"  minimum(1)
+// @Param        If-Match  header    string  false  "ETag the patch is based on; required when requireIfMatch is set"
+// @Param        patch     body      object  true   "Merge patch object or list of JSON Patch operations"
+// @Success      200    {object}  models.Book
+// @Failure      400    {object}  models.Problem
+// @Failure      404    {object}  models.Problem
+// @Failure      409    {object}  models.Problem
+// @Failure      412    {object}  models.Problem
+// @Failure      415    {object}  models.Problem
+// @Failure      422    {object}  models.Problem
+// @Failure      428    {object}  models.Problem
+// @Failure      default    {object}  models.Problem  "Problem Details"
+// @Router       /books/{id} [patch]
+func (bc *BookController) PatchBook(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
 		return
 	}
-	book.Title = input.Title
-	book.Author = input.Author
-	book.Year = input.Year
-	if err := utils.DB.Save(&book).Error; err != nil {
-		log.Printf("Error updating book (id=%s): %v", id, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
+	book, err := bc.books.Get(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.Info("Book not found for patch", "id", id)
+		AbortWithProblem(c, http.StatusNotFound, "Book not found")
 		return
 	}
-	c.JSON(http.StatusOK, book)
+	if err != nil {
+		slog.Error("Error fetching book to patch", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to fetch book")
+		return
+	}
+	if !bc.checkIfMatch(c, book) {
+		slog.Info("Precondition failed for patch", "id", id)
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Info("Failed to read patch", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	book, err = applyBookPatch(book, c.ContentType(), body)
+	if err != nil {
+		slog.Info("Invalid patch", "id", id, "error", err)
+		var invalid validator.ValidationErrors
+		status := http.StatusUnprocessableEntity
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			status = http.StatusUnsupportedMediaType
+		case errors.Is(err, errMalformedPatch):
+			status = http.StatusBadRequest
+		case errors.As(err, &invalid):
+			validationFailed(c, status, "The patched book is invalid", inputFieldErrors(invalid, models.BookInput{}, ""))
+			return
+		}
+		AbortWithProblem(c, status, err.Error())
+		return
+	}
+	bc.saveBook(c, id, book)
 }
 
 // DeleteBook godoc
 // @Summary      Delete a book
-// @Description  Delete a book by ID
+// @Description  Move a book to the trash, from where it can be restored until it is purged
 // @Tags         books
 // @Produce      json
-// @Param        id   path      int  true  "Book ID"
+// @Param        id        path      int     true   "Book ID"  minimum(1)
+// @Param        If-Match  header    string  false  "ETag the deletion is based on; required when requireIfMatch is set"
 // @Success      200  {object}  map[string]string
-// @Failure      404  {object}  map[string]string
-// @Failure      500  {object}  map[string]string
+// @Failure      400  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      412  {object}  models.Problem
+// @Failure      428  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
 // @Router       /books/{id} [delete]
-func DeleteBook(c *gin.Context) {
-	id := c.Param("id")
-	result := utils.DB.Delete(&models.Book{}, id)
-	if result.Error != nil {
-		log.Printf("Error deleting book (id=%s): %v", id, result.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
+func (bc *BookController) DeleteBook(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
+		return
+	}
+	var version uint
+	if bc.requireIfMatch.Load() || c.GetHeader("If-Match") != "" {
+		book, err := bc.books.Get(c.Request.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			slog.Info("No book found to delete", "id", id)
+			AbortWithProblem(c, http.StatusNotFound, "Book not found")
+			return
+		}
+		if err != nil {
+			slog.Error("Error fetching book to delete", "id", id, "error", err)
+			AbortWithProblem(c, http.StatusInternalServerError, "Failed to delete book")
+			return
+		}
+		if !bc.checkIfMatch(c, book) {
+			slog.Info("Precondition failed for delete", "id", id)
+			return
+		}
+		version = book.Version
+	}
+	err := bc.books.Delete(c.Request.Context(), id, version)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		slog.Info("Book changed before delete", "id", id)
+		preconditionFailed(c)
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.Info("No book found to delete", "id", id)
+		AbortWithProblem(c, http.StatusNotFound, "Book not found")
 		return
 	}
-	if result.RowsAffected == 0 {
-		log.Printf("No book found to delete (id=%s)", id)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	if err != nil {
+		slog.Error("Error deleting book", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to delete book")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Book deleted"})
 }
+
+// RestoreBook godoc
+// @Summary      Restore a book
+// @Description  Take a deleted book back out of the trash
+// @Tags         books
+// @Produce      json
+// @Param        id   path      int  true  "Book ID"  minimum(1)
+// @Success      200  {object}  models.Book
+// @Failure      400  {object}  models.Problem
+// @Failure      404  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /books/{id}/restore [post]
+func (bc *BookController) RestoreBook(c *gin.Context) {
+	id, ok := bindID(c)
+	if !ok {
+		return
+	}
+	book, err := bc.books.Restore(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.Info("No trashed book found to restore", "id", id)
+		AbortWithProblem(c, http.StatusNotFound, "Book not found in trash")
+		return
+	}
+	if err != nil {
+		slog.Error("Error restoring book", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to restore book")
+		return
+	}
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, book)
+}
+
+// saveBook stores the changes to book, which must still be at the version it
+// was read at, and answers with the updated book.
+func (bc *BookController) saveBook(c *gin.Context, id uint, book models.Book) {
+	if !bc.resolveAuthors(c, &book) {
+		return
+	}
+	err := bc.books.Update(c.Request.Context(), &book)
+	if errors.Is(err, repository.ErrUnknownAuthor) {
+		slog.Info("Unknown author on update", "id", id, "error", err)
+		unknownAuthor(c)
+		return
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		slog.Info("Book changed before update", "id", id)
+		preconditionFailed(c)
+		return
+	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		slog.Info("Duplicate ISBN on update", "id", id)
+		duplicateISBN(c)
+		return
+	}
+	if err != nil {
+		slog.Error("Error updating book", "id", id, "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to update book")
+		return
+	}
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, book)
+}
+
+// duplicateISBN answers a write that would store an ISBN a second time.
+func duplicateISBN(c *gin.Context) {
+	AbortWithProblem(c, http.StatusConflict, "A book with this ISBN already exists")
+}
+
+// unknownAuthor answers a write crediting an author that does not exist.
+func unknownAuthor(c *gin.Context) {
+	AbortWithProblem(c, http.StatusUnprocessableEntity, "Unknown author")
+}
+
+// resolveAuthors replaces the authors book names by the existing authors of
+// that name when only known authors may be credited. It answers the request
+// and returns false when an author is unknown or cannot be looked up.
+func (bc *BookController) resolveAuthors(c *gin.Context, book *models.Book) bool {
+	err := bc.lookupAuthors(c.Request.Context(), book)
+	if errors.Is(err, repository.ErrUnknownAuthor) {
+		slog.Info("Unknown author", "error", err)
+		unknownAuthor(c)
+		return false
+	}
+	if err != nil {
+		slog.Error("Error looking up authors", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to look up authors")
+		return false
+	}
+	return true
+}
+
+// lookupAuthors does the work of resolveAuthors, failing with
+// repository.ErrUnknownAuthor for an author that does not exist.
+func (bc *BookController) lookupAuthors(ctx context.Context, book *models.Book) error {
+	if !bc.knownAuthorsOnly.Load() {
+		return nil
+	}
+	for i, ref := range book.Authors {
+		if ref.ID != 0 {
+			continue
+		}
+		author, err := bc.authors.FindByName(ctx, ref.Name)
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("%w: %s", repository.ErrUnknownAuthor, ref.Name)
+		}
+		if err != nil {
+			return err
+		}
+		book.Authors[i] = models.AuthorRef{ID: author.ID}
+	}
+	return nil
+}
@@ -1,58 +1,111 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/burhangltekin/byfood/models"
-	"github.com/burhangltekin/byfood/utils"
+	"github.com/burhangltekin/byfood/repository"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 )
 
-func TestGetBooks(t *testing.T) {
+func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// failingRepository is a BookRepository whose every call fails with err.
+type failingRepository struct {
+	err error
+}
+
+func (r failingRepository) List(context.Context, repository.ListOptions) ([]models.Book, error) {
+	return nil, r.err
+}
+
+func (r failingRepository) Count(context.Context, repository.BookFilter) (int64, error) {
+	return 0, r.err
+}
+
+func (r failingRepository) Get(context.Context, uint) (models.Book, error) {
+	return models.Book{}, r.err
+}
+
+func (r failingRepository) Create(context.Context, *models.Book) error { return r.err }
+
+func (r failingRepository) Update(context.Context, *models.Book) error { return r.err }
+
+func (r failingRepository) Delete(context.Context, uint, uint) error { return r.err }
+
+func (r failingRepository) Restore(context.Context, uint) (models.Book, error) {
+	return models.Book{}, r.err
+}
+
+func (r failingRepository) PurgeTrash(context.Context, time.Time) (int64, error) { return 0, r.err }
+
+func (r failingRepository) Search(context.Context, repository.SearchOptions) (repository.SearchResult, error) {
+	return repository.SearchResult{}, r.err
+}
+
+func (r failingRepository) Transaction(context.Context, func(repository.BookRepository) error) error {
+	return r.err
+}
+
+var errDatabaseClosed = errors.New("sql: database is closed")
+
+// failingGetRepository is a BookRepository whose Get fails with err while
+// its other calls succeed.
+type failingGetRepository struct {
+	repository.BookRepository
+	err error
+}
+
+func (r failingGetRepository) Get(context.Context, uint) (models.Book, error) {
+	return models.Book{}, r.err
+}
+
+// comparable returns book without the fields that differ between runs:
+// timestamps and genre IDs.
+func comparable(book models.Book) models.Book {
+	book.CreatedAt, book.UpdatedAt = time.Time{}, time.Time{}
+	var genres []models.Genre
+	for _, g := range book.Genres {
+		genres = append(genres, models.Genre{Name: g.Name})
+	}
+	book.Genres = genres
+	return book
+}
+
+func stringPtr(s string) *string { return &s }
+
+func TestGetBooks(t *testing.T) {
+	t.Parallel()
 
 	tests := []struct {
 		name         string
-		prepare      func()
+		repo         repository.BookRepository
 		expectStatus int
 		expectError  string
 	}{
 		{
-			name: "basic get books",
-			prepare: func() {
-				// Setup valid DB and insert test book
-				db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-				if err != nil {
-					t.Fatalf("failed to connect to in-memory db: %v", err)
-				}
-				if err := db.AutoMigrate(&models.Book{}); err != nil {
-					t.Fatalf("failed to migrate: %v", err)
-				}
-				utils.DB = db
-				testBook := models.Book{Title: "Test Book", Author: "Test Author", Year: 2024}
-				db.Create(&testBook)
-			},
+			name:         "basic get books",
+			repo:         repository.NewMemoryBookRepository(models.Book{Title: "Test Book", Author: "Test Author", Year: 2024}),
 			expectStatus: http.StatusOK,
 			expectError:  "",
 		},
 		{
-			name: "db error",
-			prepare: func() {
-				db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-				if err != nil {
-					t.Fatalf("failed to open db: %v", err)
-				}
-				sqlDB, _ := db.DB()
-				sqlDB.Close()
-				utils.DB = db
-			},
+			name:         "db error",
+			repo:         failingRepository{err: errDatabaseClosed},
 			expectStatus: http.StatusInternalServerError,
 			expectError:  "Failed to fetch books",
 		},
@@ -60,28 +113,32 @@ func TestGetBooks(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.prepare()
+			t.Parallel()
+			bc := NewBookController(tt.repo, nil, BookOptions{})
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 			c.Request, _ = http.NewRequest(http.MethodGet, "/api/books", nil)
-			GetBooks(c)
+			bc.GetBooks(c)
 			if w.Code != tt.expectStatus {
 				t.Errorf("expected status %d, got %d", tt.expectStatus, w.Code)
 			}
 			if tt.expectStatus == http.StatusOK {
-				var books []models.Book
-				if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil {
+				var resp models.BookListResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
 					t.Fatalf("failed to unmarshal response: %v", err)
 				}
-				if len(books) != 1 || books[0].Title != "Test Book" {
-					t.Errorf("expected 1 book with title 'Test Book', got %+v", books)
+				if len(resp.Items) != 1 || resp.Items[0].Title != "Test Book" {
+					t.Errorf("expected 1 book with title 'Test Book', got %+v", resp.Items)
+				}
+				if resp.Total != 1 || resp.Page != 1 || resp.PageSize != 20 {
+					t.Errorf("unexpected paging metadata: %+v", resp)
 				}
 			} else if tt.expectError != "" {
-				var resp map[string]string
+				var resp models.Problem
 				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
 					t.Fatalf("failed to unmarshal error response: %v", err)
 				}
-				if resp["error"] != tt.expectError {
+				if resp.Detail != tt.expectError {
 					t.Errorf("expected error message %q, got %+v", tt.expectError, resp)
 				}
 			}
@@ -89,24 +146,286 @@ func TestGetBooks(t *testing.T) {
 	}
 }
 
-func TestGetBook(t *testing.T) {
-	gin.SetMode(gin.TestMode)
+func TestGetBooksQuery(t *testing.T) {
+	t.Parallel()
+
+	bc := NewBookController(repository.NewMemoryBookRepository(
+		models.Book{Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937},
+		models.Book{Title: "The Silmarillion", Author: "J. R. R. Tolkien", Year: 1977},
+		models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965},
+		models.Book{Title: "Children of Dune", Author: "Frank Herbert", Year: 1976},
+		models.Book{Title: "100% Coverage", Author: "Anon", Year: 2020},
+	), nil, BookOptions{})
+
+	tests := []struct {
+		name         string
+		query        string
+		expectStatus int
+		expectTitles []string
+		expectTotal  int64
+		expectPage   int
+		expectFields []string
+	}{
+		{
+			name:         "first page",
+			query:        "pageSize=2",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"The Hobbit", "The Silmarillion"},
+			expectTotal:  5,
+			expectPage:   1,
+		},
+		{
+			name:         "second page",
+			query:        "page=2&pageSize=2",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"Dune", "Children of Dune"},
+			expectTotal:  5,
+			expectPage:   2,
+		},
+		{
+			name:         "limit and offset",
+			query:        "limit=2&offset=4",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"100% Coverage"},
+			expectTotal:  5,
+			expectPage:   3,
+		},
+		{
+			name:         "multi-field sort",
+			query:        "sort=author,-year",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"100% Coverage", "Children of Dune", "Dune", "The Silmarillion", "The Hobbit"},
+			expectTotal:  5,
+			expectPage:   1,
+		},
+		{
+			name:         "author filter is case-insensitive",
+			query:        "author=frank%20herbert&sort=year",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"Dune", "Children of Dune"},
+			expectTotal:  2,
+			expectPage:   1,
+		},
+		{
+			name:         "title substring filter",
+			query:        "title=dune",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"Dune", "Children of Dune"},
+			expectTotal:  2,
+			expectPage:   1,
+		},
+		{
+			name:         "title filter escapes wildcards",
+			query:        "title=%25",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"100% Coverage"},
+			expectTotal:  1,
+			expectPage:   1,
+		},
+		{
+			name:         "year range",
+			query:        "yearFrom=1960&yearTo=1977&sort=-year",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"The Silmarillion", "Children of Dune", "Dune"},
+			expectTotal:  3,
+			expectPage:   1,
+		},
+		{
+			name:         "invalid paging values",
+			query:        "page=0&pageSize=abc",
+			expectStatus: http.StatusBadRequest,
+			expectFields: []string{"page", "pageSize"},
+		},
+		{
+			name:         "page size above maximum",
+			query:        "pageSize=1000",
+			expectStatus: http.StatusBadRequest,
+			expectFields: []string{"pageSize"},
+		},
+		{
+			name:         "page beyond maximum offset",
+			query:        "page=4611686018427387905&pageSize=3",
+			expectStatus: http.StatusBadRequest,
+			expectFields: []string{"page"},
+		},
+		{
+			name:         "offset above maximum",
+			query:        "limit=3&offset=9223372036854775807",
+			expectStatus: http.StatusBadRequest,
+			expectFields: []string{"offset"},
+		},
+		{
+			name:         "mixed paging styles",
+			query:        "page=1&limit=10",
+			expectStatus: http.StatusBadRequest,
+			expectFields: []string{"page"},
+		},
+		{
+			name:         "unknown sort field",
+			query:        "sort=price",
+			expectStatus: http.StatusBadRequest,
+			expectFields: []string{"sort"},
+		},
+		{
+			name:         "inverted year range",
+			query:        "yearFrom=2000&yearTo=1990",
+			expectStatus: http.StatusBadRequest,
+			expectFields: []string{"yearTo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/api/books?"+tt.query, nil)
+			bc.GetBooks(c)
+			assert.Equal(t, tt.expectStatus, w.Code)
+			if tt.expectStatus == http.StatusOK {
+				var resp models.BookListResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				titles := []string{}
+				for _, b := range resp.Items {
+					titles = append(titles, b.Title)
+				}
+				assert.Equal(t, tt.expectTitles, titles)
+				assert.Equal(t, tt.expectTotal, resp.Total)
+				assert.Equal(t, tt.expectPage, resp.Page)
+			} else {
+				var resp models.Problem
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, ProblemValidation, resp.Type)
+				var fields []string
+				for _, fe := range resp.Errors {
+					fields = append(fields, fe.Field)
+				}
+				assert.Equal(t, tt.expectFields, fields)
+			}
+		})
+	}
+}
+
+func TestGetBooksCursor(t *testing.T) {
+	t.Parallel()
 
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("failed to connect to in-memory db: %v", err)
+	newController := func() (*BookController, *repository.MemoryBookRepository) {
+		repo := repository.NewMemoryBookRepository()
+		for i := 0; i < 10; i++ {
+			_ = repo.Create(context.Background(), &models.Book{Title: fmt.Sprintf("Book %02d", i), Author: "Author", Year: 2000 + i%3})
+		}
+		return NewBookController(repo, nil, BookOptions{}), repo
 	}
-	if err := db.AutoMigrate(&models.Book{}); err != nil {
-		t.Fatalf("failed to migrate: %v", err)
+	bc, _ := newController()
+
+	list := func(t *testing.T, bc *BookController, query string) (int, models.BookListResponse, models.Problem) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books?"+query, nil)
+		bc.GetBooks(c)
+		var resp models.BookListResponse
+		var errResp models.Problem
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		} else {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+		}
+		return w.Code, resp, errResp
 	}
-	utils.DB = db
+
+	for _, sort := range []string{"", "title", "-year,title", "year,-id", "-author,-title"} {
+		t.Run("walk sort="+sort, func(t *testing.T) {
+			t.Parallel()
+			code, expected, _ := list(t, bc, "pageSize=100&sort="+sort)
+			assert.Equal(t, http.StatusOK, code)
+
+			var seen []uint
+			query := "pageSize=3&sort=" + sort
+			var pages []models.BookListResponse
+			for {
+				code, resp, _ := list(t, bc, query)
+				assert.Equal(t, http.StatusOK, code)
+				pages = append(pages, resp)
+				for _, b := range resp.Items {
+					seen = append(seen, b.ID)
+				}
+				if resp.NextCursor == "" {
+					break
+				}
+				query = "pageSize=3&sort=" + sort + "&cursor=" + url.QueryEscape(resp.NextCursor)
+			}
+			assert.Equal(t, 1, pages[0].Page)
+			assert.Zero(t, pages[len(pages)-1].Page)
+			var want []uint
+			for _, b := range expected.Items {
+				want = append(want, b.ID)
+			}
+			assert.Equal(t, want, seen)
+
+			// Walking back from the last page returns the previous pages.
+			last := pages[len(pages)-1]
+			code, prev, _ := list(t, bc, "pageSize=3&sort="+sort+"&cursor="+url.QueryEscape(last.PrevCursor))
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, pages[len(pages)-2].Items, prev.Items)
+		})
+	}
+
+	t.Run("stable under concurrent inserts and deletes", func(t *testing.T) {
+		t.Parallel()
+		bc, repo := newController()
+		ctx := context.Background()
+		_, first, _ := list(t, bc, "pageSize=4&sort=title")
+		assert.Len(t, first.Items, 4)
+
+		// Insert a book that sorts before the cursor and delete one that
+		// sorts after it; the next page must neither repeat nor skip rows.
+		assert.NoError(t, repo.Create(ctx, &models.Book{Title: "Book 00a", Author: "Author", Year: 2001}))
+		assert.NoError(t, repo.Delete(ctx, first.Items[0].ID, 0))
+		assert.NoError(t, repo.Delete(ctx, 6, 0)) // "Book 05"
+
+		_, second, _ := list(t, bc, "pageSize=4&sort=title&cursor="+url.QueryEscape(first.NextCursor))
+		titles := []string{}
+		for _, b := range second.Items {
+			titles = append(titles, b.Title)
+		}
+		assert.Equal(t, []string{"Book 04", "Book 06", "Book 07", "Book 08"}, titles)
+	})
+
+	t.Run("rejects tampered cursor", func(t *testing.T) {
+		t.Parallel()
+		_, first, _ := list(t, bc, "pageSize=2")
+		tampered := "x" + first.NextCursor[1:]
+		code, _, errResp := list(t, bc, "pageSize=2&cursor="+url.QueryEscape(tampered))
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "cursor", errResp.Errors[0].Field)
+	})
+
+	t.Run("rejects cursor for a different sort", func(t *testing.T) {
+		t.Parallel()
+		_, first, _ := list(t, bc, "pageSize=2&sort=title")
+		code, _, errResp := list(t, bc, "pageSize=2&sort=-title&cursor="+url.QueryEscape(first.NextCursor))
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "cursor", errResp.Errors[0].Field)
+	})
+
+	t.Run("rejects cursor combined with page", func(t *testing.T) {
+		t.Parallel()
+		_, first, _ := list(t, bc, "pageSize=2")
+		code, _, errResp := list(t, bc, "page=2&cursor="+url.QueryEscape(first.NextCursor))
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "cursor", errResp.Errors[0].Field)
+	})
+}
+
+func TestGetBook(t *testing.T) {
+	t.Parallel()
 
 	testBook := models.Book{Title: "Test Book", Author: "Test Author", Year: 2024}
-	db.Create(&testBook)
 
 	tests := []struct {
 		name         string
 		id           string
+		repo         repository.BookRepository
 		expectStatus int
 		expectTitle  string
 		expectError  string
@@ -125,15 +444,36 @@ func TestGetBook(t *testing.T) {
 			expectTitle:  "",
 			expectError:  "Book not found",
 		},
+		{
+			name:         "get non-numeric id",
+			id:           "abc",
+			expectStatus: http.StatusBadRequest,
+			expectTitle:  "",
+			expectError:  "Invalid path parameters",
+		},
+		{
+			name:         "db error",
+			id:           "1",
+			repo:         failingRepository{err: errDatabaseClosed},
+			expectStatus: http.StatusInternalServerError,
+			expectTitle:  "",
+			expectError:  "Failed to fetch book",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := tt.repo
+			if repo == nil {
+				repo = repository.NewMemoryBookRepository(testBook)
+			}
+			bc := NewBookController(repo, nil, BookOptions{})
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 			c.Params = gin.Params{{Key: "id", Value: tt.id}}
 			c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+tt.id, nil)
-			GetBook(c)
+			bc.GetBook(c)
 			if w.Code != tt.expectStatus {
 				t.Errorf("expected status %d, got %d", tt.expectStatus, w.Code)
 			}
@@ -146,11 +486,11 @@ func TestGetBook(t *testing.T) {
 					t.Errorf("expected title %q, got %q", tt.expectTitle, book.Title)
 				}
 			} else {
-				var resp map[string]string
+				var resp models.Problem
 				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
 					t.Fatalf("failed to unmarshal error response: %v", err)
 				}
-				if resp["error"] != tt.expectError {
+				if resp.Detail != tt.expectError {
 					t.Errorf("expected error message %q, got %+v", tt.expectError, resp)
 				}
 			}
@@ -159,21 +499,12 @@ func TestGetBook(t *testing.T) {
 }
 
 func TestCreateBook(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("failed to connect to in-memory db: %v", err)
-	}
-	if err := db.AutoMigrate(&models.Book{}); err != nil {
-		t.Fatalf("failed to migrate: %v", err)
-	}
-	utils.DB = db
+	t.Parallel()
 
 	tests := []struct {
 		name         string
 		body         string
-		prepare      func()
+		repo         repository.BookRepository
 		expectStatus int
 		expectTitle  string
 		expectError  string
@@ -181,7 +512,6 @@ func TestCreateBook(t *testing.T) {
 		{
 			name:         "create valid book",
 			body:         `{"title":"New Book","author":"Author","year":2024}`,
-			prepare:      func() {},
 			expectStatus: http.StatusCreated,
 			expectTitle:  "New Book",
 			expectError:  "",
@@ -189,7 +519,6 @@ func TestCreateBook(t *testing.T) {
 		{
 			name:         "missing required field",
 			body:         `{"author":"Author","year":2024}`,
-			prepare:      func() {},
 			expectStatus: http.StatusBadRequest,
 			expectTitle:  "",
 			expectError:  "bad request",
@@ -197,23 +526,39 @@ func TestCreateBook(t *testing.T) {
 		{
 			name:         "invalid year",
 			body:         `{"title":"Book","author":"Author","year":2200}`,
-			prepare:      func() {},
 			expectStatus: http.StatusBadRequest,
 			expectTitle:  "",
 			expectError:  "bad request",
 		},
 		{
-			name: "db create error",
-			body: `{"title":"Book","author":"Author","year":2024}`,
-			prepare: func() {
-				db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-				if err != nil {
-					t.Fatalf("failed to open db: %v", err)
-				}
-				sqlDB, _ := db.DB()
-				sqlDB.Close()
-				utils.DB = db
-			},
+			name:         "invalid isbn checksum",
+			body:         `{"title":"Book","author":"Author","isbn":"0-261-10334-3"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "bad request",
+		},
+		{
+			name:         "unknown language",
+			body:         `{"title":"Book","author":"Author","language":"xx"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "bad request",
+		},
+		{
+			name:         "too many genres",
+			body:         `{"title":"Book","author":"Author","genres":["1","2","3","4","5","6","7","8","9","10","11","12","13","14","15","16","17","18","19","20","21"]}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "bad request",
+		},
+		{
+			name:         "duplicate isbn",
+			body:         `{"title":"Book","author":"Author","isbn":"0261103342"}`,
+			repo:         repository.NewMemoryBookRepository(models.Book{Title: "Hobbit", Author: "Tolkien", ISBN: stringPtr("9780261103344")}),
+			expectStatus: http.StatusConflict,
+			expectError:  "A book with this ISBN already exists",
+		},
+		{
+			name:         "db create error",
+			body:         `{"title":"Book","author":"Author","year":2024}`,
+			repo:         failingRepository{err: errDatabaseClosed},
 			expectStatus: http.StatusInternalServerError,
 			expectTitle:  "",
 			expectError:  "Failed to create book",
@@ -222,23 +567,17 @@ func TestCreateBook(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-
-			db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-			if err != nil {
-				t.Fatalf("failed to connect to in-memory db: %v", err)
-			}
-			if err := db.AutoMigrate(&models.Book{}); err != nil {
-				t.Fatalf("failed to migrate: %v", err)
-			}
-			utils.DB = db
-			if tt.prepare != nil {
-				tt.prepare()
+			t.Parallel()
+			repo := tt.repo
+			if repo == nil {
+				repo = repository.NewMemoryBookRepository()
 			}
+			bc := NewBookController(repo, nil, BookOptions{})
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 			c.Request, _ = http.NewRequest(http.MethodPost, "/api/books", strings.NewReader(tt.body))
 			c.Request.Header.Set("Content-Type", "application/json")
-			CreateBook(c)
+			bc.CreateBook(c)
 			if w.Code != tt.expectStatus {
 				t.Errorf("expected status %d, got %d", tt.expectStatus, w.Code)
 			}
@@ -250,17 +589,20 @@ func TestCreateBook(t *testing.T) {
 				if book.Title != tt.expectTitle {
 					t.Errorf("expected title %q, got %q", tt.expectTitle, book.Title)
 				}
+				if _, err := repo.Get(context.Background(), book.ID); err != nil {
+					t.Errorf("expected created book to be stored: %v", err)
+				}
 			} else {
-				var resp map[string]interface{}
+				var resp models.Problem
 				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
 					t.Fatalf("failed to unmarshal error response: %v", err)
 				}
 				if tt.expectError == "bad request" {
-					if resp["error"] == nil {
+					if resp.Detail == "" {
 						t.Errorf("expected error message, got %+v", resp)
 					}
 				} else if tt.expectError != "" {
-					if resp["error"] != tt.expectError {
+					if resp.Detail != tt.expectError {
 						t.Errorf("expected error message %q, got %+v", tt.expectError, resp)
 					}
 				}
@@ -269,163 +611,613 @@ func TestCreateBook(t *testing.T) {
 	}
 }
 
+func TestBookMetadata(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "Other", Author: "A", ISBN: stringPtr("9780441172719")})
+	bc := NewBookController(repo, nil, BookOptions{})
+	send := func(handler gin.HandlerFunc, method, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Request, _ = http.NewRequest(method, "/api/books/"+id, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler(c)
+		return w
+	}
+
+	w := send(bc.CreateBook, http.MethodPost, "", `{"title":"The Hobbit","author":"J. R. R. Tolkien","year":1937,
+		"isbn":"978-0-261-10334-4","publisher":" Allen & Unwin ","language":"EN","pageCount":310,
+		"description":"There and back again.","genres":["Fantasy"," classic","fantasy"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var book models.Book
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	assert.Equal(t, models.Book{
+		ID: 2, Title: "The Hobbit", Author: "J. R. R. Tolkien", Authors: []models.AuthorRef{{ID: 2, Name: "J. R. R. Tolkien"}},
+		Year: 1937, Version: 1,
+		ISBN: stringPtr("9780261103344"), Publisher: "Allen & Unwin", Language: "en", PageCount: 310,
+		Description: "There and back again.", Genres: []models.Genre{{Name: "classic"}, {Name: "fantasy"}},
+	}, comparable(book))
+	assert.False(t, book.CreatedAt.IsZero())
+	assert.Contains(t, w.Body.String(), `"genres":["classic","fantasy"]`)
+
+	w = send(bc.UpdateBook, http.MethodPut, "2", `{"title":"The Hobbit","author":"J. R. R. Tolkien","isbn":"0441172717"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "A book with this ISBN already exists")
+	w = send(bc.PatchBook, http.MethodPatch, "2", `{"isbn":"9780441172719"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = send(bc.UpdateBook, http.MethodPut, "2", `{"title":"The Hobbit","author":"J. R. R. Tolkien"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "isbn")
+	assert.NotContains(t, w.Body.String(), "genres")
+}
+
 func TestUpdateBook(t *testing.T) {
-	gin.SetMode(gin.TestMode)
+	t.Parallel()
 
 	testBook := models.Book{Title: "Old Title", Author: "Old Author", Year: 2000}
 
 	tests := []struct {
 		name         string
-		prepare      func() (*gin.Context, *httptest.ResponseRecorder)
+		id           string
+		repo         repository.BookRepository
 		requestBody  string
 		expectStatus int
 		expectTitle  string
 		expectError  string
 	}{
 		{
-			name: "update existing book",
-			prepare: func() (*gin.Context, *httptest.ResponseRecorder) {
-				db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-				err := db.AutoMigrate(&models.Book{})
-				if err != nil {
-					return nil, nil
-				}
-				utils.DB = db
-				db.Create(&testBook)
-				w := httptest.NewRecorder()
-				c, _ := gin.CreateTestContext(w)
-				c.Params = gin.Params{{Key: "id", Value: "1"}}
-				return c, w
-			},
+			name:         "update existing book",
+			id:           "1",
 			requestBody:  `{"title":"New Title","author":"New Author","year":2024}`,
 			expectStatus: http.StatusOK,
 			expectTitle:  "New Title",
 			expectError:  "",
 		},
 		{
-			name: "update non-existing book",
-			prepare: func() (*gin.Context, *httptest.ResponseRecorder) {
-				db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-				err := db.AutoMigrate(&models.Book{})
-				if err != nil {
-					return nil, nil
-				}
-				utils.DB = db
-				w := httptest.NewRecorder()
-				c, _ := gin.CreateTestContext(w)
-				c.Params = gin.Params{{Key: "id", Value: "999"}}
-				return c, w
-			},
+			name:         "update non-existing book",
+			id:           "999",
 			requestBody:  `{"title":"New Title","author":"New Author","year":2024}`,
 			expectStatus: http.StatusNotFound,
 			expectTitle:  "",
 			expectError:  "Book not found",
 		},
 		{
-			name: "invalid request body",
-			prepare: func() (*gin.Context, *httptest.ResponseRecorder) {
-				db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-				err := db.AutoMigrate(&models.Book{})
-				if err != nil {
-					return nil, nil
-				}
-				utils.DB = db
-				db.Create(&testBook)
-				w := httptest.NewRecorder()
-				c, _ := gin.CreateTestContext(w)
-				c.Params = gin.Params{{Key: "id", Value: "1"}}
-				return c, w
-			},
+			name:         "invalid request body",
+			id:           "1",
 			requestBody:  `{"title":123,"author":"New Author","year":2024}`,
 			expectStatus: http.StatusBadRequest,
 			expectTitle:  "",
 			expectError:  "bad request",
 		},
+		{
+			name:         "db read error",
+			id:           "1",
+			repo:         failingRepository{err: errDatabaseClosed},
+			requestBody:  `{"title":"New Title","author":"New Author","year":2024}`,
+			expectStatus: http.StatusInternalServerError,
+			expectTitle:  "",
+			expectError:  "Failed to fetch book",
+		},
+		{
+			name:         "db update error",
+			id:           "1",
+			repo:         &updateFailingRepository{MemoryBookRepository: repository.NewMemoryBookRepository(testBook)},
+			requestBody:  `{"title":"New Title","author":"New Author","year":2024}`,
+			expectStatus: http.StatusInternalServerError,
+			expectTitle:  "",
+			expectError:  "Failed to update book",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c, w := tt.prepare()
-			c.Request, _ = http.NewRequest(http.MethodPut, "/api/books/"+c.Params.ByName("id"), strings.NewReader(tt.requestBody))
+			t.Parallel()
+			repo := tt.repo
+			if repo == nil {
+				repo = repository.NewMemoryBookRepository(testBook)
+			}
+			bc := NewBookController(repo, nil, BookOptions{})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			c.Request, _ = http.NewRequest(http.MethodPut, "/api/books/"+tt.id, strings.NewReader(tt.requestBody))
 			c.Request.Header.Set("Content-Type", "application/json")
 
-			UpdateBook(c)
+			bc.UpdateBook(c)
 			assert.Equal(t, tt.expectStatus, w.Code)
 			if tt.expectStatus == http.StatusOK {
 				var book models.Book
 				err := json.Unmarshal(w.Body.Bytes(), &book)
 				assert.NoError(t, err)
 				assert.Equal(t, tt.expectTitle, book.Title)
+				stored, err := repo.Get(context.Background(), book.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectTitle, stored.Title)
 			} else {
-				var resp map[string]interface{}
+				var resp models.Problem
 				err := json.Unmarshal(w.Body.Bytes(), &resp)
 				assert.NoError(t, err)
 				if tt.expectError == "bad request" {
-					assert.NotNil(t, resp["error"])
+					assert.NotEmpty(t, resp.Detail)
 				} else if tt.expectError != "" {
-					assert.Equal(t, tt.expectError, resp["error"])
+					assert.Equal(t, tt.expectError, resp.Detail)
 				} else {
-					assert.Nil(t, resp["error"])
+					assert.Empty(t, resp.Detail)
 				}
 			}
 		})
 	}
 }
 
-func TestDeleteBook(t *testing.T) {
-	gin.SetMode(gin.TestMode)
+// updateFailingRepository serves reads from memory but fails every update.
+type updateFailingRepository struct {
+	*repository.MemoryBookRepository
+}
 
-	testBook := models.Book{Title: "To Delete", Author: "Author", Year: 2020}
+func (r *updateFailingRepository) Update(context.Context, *models.Book) error {
+	return errDatabaseClosed
+}
+
+func TestPatchBook(t *testing.T) {
+	t.Parallel()
+
+	testBook := models.Book{Title: "Old Title", Author: "Old Author", Year: 2000}
+	oldAuthor := []models.AuthorRef{{ID: 1, Name: "Old Author"}}
 
 	tests := []struct {
 		name         string
-		prepare      func() (*gin.Context, *httptest.ResponseRecorder)
+		id           string
+		repo         repository.BookRepository
+		contentType  string
+		requestBody  string
 		expectStatus int
+		expectBook   models.Book
 		expectError  string
 	}{
 		{
-			name: "delete existing book",
-			prepare: func() (*gin.Context, *httptest.ResponseRecorder) {
-				db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-				err := db.AutoMigrate(&models.Book{})
-				if err != nil {
-					return nil, nil
+			name:         "merge patch",
+			id:           "1",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"year":2024}`,
+			expectStatus: http.StatusOK,
+			expectBook:   models.Book{ID: 1, Title: "Old Title", Author: "Old Author", Authors: oldAuthor, Year: 2024, Version: 2},
+		},
+		{
+			name:         "plain json is a merge patch",
+			id:           "1",
+			contentType:  "application/json; charset=utf-8",
+			requestBody:  `{"title":"New Title","year":null}`,
+			expectStatus: http.StatusOK,
+			expectBook:   models.Book{ID: 1, Title: "New Title", Author: "Old Author", Authors: oldAuthor, Year: 0, Version: 2},
+		},
+		{
+			name:         "json patch",
+			id:           "1",
+			contentType:  "application/json-patch+json",
+			requestBody:  `[{"op":"test","path":"/year","value":2000},{"op":"replace","path":"/author","value":"New Author"},{"op":"copy","from":"/author","path":"/title"}]`,
+			expectStatus: http.StatusOK,
+			expectBook: models.Book{ID: 1, Title: "New Author", Author: "New Author",
+				Authors: []models.AuthorRef{{ID: 2, Name: "New Author"}}, Year: 2000, Version: 2},
+		},
+		{
+			name:         "authors",
+			id:           "1",
+			contentType:  "application/json-patch+json",
+			requestBody:  `[{"op":"add","path":"/authors/-","value":"Second Author"}]`,
+			expectStatus: http.StatusOK,
+			expectBook: models.Book{ID: 1, Title: "Old Title", Author: "Old Author, Second Author",
+				Authors: []models.AuthorRef{{ID: 1, Name: "Old Author"}, {ID: 2, Name: "Second Author"}}, Year: 2000, Version: 2},
+		},
+		{
+			name:         "author and authors changed",
+			id:           "1",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"author":"A","authors":["B"]}`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "author and authors cannot both be changed",
+		},
+		{
+			name:         "failed json patch test",
+			id:           "1",
+			contentType:  "application/json-patch+json",
+			requestBody:  `[{"op":"test","path":"/year","value":1999},{"op":"replace","path":"/year","value":2024}]`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "patch cannot be applied",
+		},
+		{
+			name:         "json patch on missing path",
+			id:           "1",
+			contentType:  "application/json-patch+json",
+			requestBody:  `[{"op":"remove","path":"/isbn"}]`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "patch cannot be applied",
+		},
+		{
+			name:         "unknown json patch operation",
+			id:           "1",
+			contentType:  "application/json-patch+json",
+			requestBody:  `[{"op":"rename","path":"/title","value":"x"}]`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "patch cannot be applied",
+		},
+		{
+			name:         "patch result fails validation",
+			id:           "1",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"title":null,"year":3000}`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "The patched book is invalid",
+		},
+		{
+			name:         "unknown field",
+			id:           "1",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"price":12}`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  `unknown field "price"`,
+		},
+		{
+			name:         "invalid isbn",
+			id:           "1",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"isbn":"978-0-261-10334-5"}`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "The patched book is invalid",
+		},
+		{
+			name:         "read-only timestamp",
+			id:           "1",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"createdAt":"2000-01-01T00:00:00Z"}`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "timestamps cannot be changed",
+		},
+		{
+			name:         "metadata",
+			id:           "1",
+			contentType:  "application/json-patch+json",
+			requestBody:  `[{"op":"add","path":"/isbn","value":"0-261-10334-2"},{"op":"add","path":"/genres","value":["Fantasy"]},{"op":"add","path":"/genres/-","value":"classic"}]`,
+			expectStatus: http.StatusOK,
+			expectBook: models.Book{ID: 1, Title: "Old Title", Author: "Old Author", Authors: oldAuthor, Year: 2000, Version: 2,
+				ISBN: stringPtr("9780261103344"), Genres: []models.Genre{{Name: "classic"}, {Name: "fantasy"}}},
+		},
+		{
+			name:         "wrong value type",
+			id:           "1",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"year":"2024"}`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "patch cannot be applied",
+		},
+		{
+			name:         "id cannot change",
+			id:           "1",
+			contentType:  "application/json-patch+json",
+			requestBody:  `[{"op":"replace","path":"/id","value":2}]`,
+			expectStatus: http.StatusUnprocessableEntity,
+			expectError:  "id cannot be changed",
+		},
+		{
+			name:         "malformed merge patch",
+			id:           "1",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"year":`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "malformed patch document",
+		},
+		{
+			name:         "json patch that is not a list",
+			id:           "1",
+			contentType:  "application/json-patch+json",
+			requestBody:  `{"op":"replace"}`,
+			expectStatus: http.StatusBadRequest,
+			expectError:  "malformed patch document",
+		},
+		{
+			name:         "unsupported content type",
+			id:           "1",
+			contentType:  "text/plain",
+			requestBody:  `year=2024`,
+			expectStatus: http.StatusUnsupportedMediaType,
+			expectError:  "unsupported patch media type",
+		},
+		{
+			name:         "patch non-existing book",
+			id:           "999",
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"year":2024}`,
+			expectStatus: http.StatusNotFound,
+			expectError:  "Book not found",
+		},
+		{
+			name:         "db read error",
+			id:           "1",
+			repo:         failingRepository{err: errDatabaseClosed},
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"year":2024}`,
+			expectStatus: http.StatusInternalServerError,
+			expectError:  "Failed to fetch book",
+		},
+		{
+			name:         "db update error",
+			id:           "1",
+			repo:         &updateFailingRepository{MemoryBookRepository: repository.NewMemoryBookRepository(testBook)},
+			contentType:  "application/merge-patch+json",
+			requestBody:  `{"year":2024}`,
+			expectStatus: http.StatusInternalServerError,
+			expectError:  "Failed to update book",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := tt.repo
+			if repo == nil {
+				repo = repository.NewMemoryBookRepository(testBook)
+			}
+			bc := NewBookController(repo, nil, BookOptions{})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			c.Request, _ = http.NewRequest(http.MethodPatch, "/api/books/"+tt.id, strings.NewReader(tt.requestBody))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+
+			bc.PatchBook(c)
+			assert.Equal(t, tt.expectStatus, w.Code)
+			if tt.expectStatus == http.StatusOK {
+				var book models.Book
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+				assert.Equal(t, tt.expectBook, comparable(book))
+				stored, err := repo.Get(context.Background(), book.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectBook, comparable(stored))
+				return
+			}
+			var resp models.Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Contains(t, resp.Detail, tt.expectError)
+			if tt.expectStatus != http.StatusInternalServerError && tt.id == "1" {
+				stored, err := repo.Get(context.Background(), 1)
+				assert.NoError(t, err)
+				assert.Equal(t, "Old Title", stored.Title)
+				assert.Equal(t, 2000, stored.Year)
+			}
+		})
+	}
+}
+
+func TestBookPreconditions(t *testing.T) {
+	t.Parallel()
+
+	type step struct {
+		method       string
+		path         string
+		header       map[string]string
+		body         string
+		expectStatus int
+		expectETag   string
+	}
+	tests := []struct {
+		name           string
+		requireIfMatch bool
+		steps          []step
+	}{
+		{
+			name: "conditional reads",
+			steps: []step{
+				{method: http.MethodGet, path: "/books/1", expectStatus: http.StatusOK, expectETag: `"1"`},
+				{method: http.MethodGet, path: "/books/1", header: map[string]string{"If-None-Match": `"1"`}, expectStatus: http.StatusNotModified, expectETag: `"1"`},
+				{method: http.MethodGet, path: "/books/1", header: map[string]string{"If-None-Match": `"7", W/"1"`}, expectStatus: http.StatusNotModified},
+				{method: http.MethodGet, path: "/books/1", header: map[string]string{"If-None-Match": `"2"`}, expectStatus: http.StatusOK},
+				{method: http.MethodGet, path: "/books/1", header: map[string]string{"If-None-Match": "*"}, expectStatus: http.StatusNotModified},
+			},
+		},
+		{
+			name: "updates check the version",
+			steps: []step{
+				{method: http.MethodPut, path: "/books/1", header: map[string]string{"If-Match": `"1"`}, body: `{"title":"A","author":"B","year":1}`, expectStatus: http.StatusOK, expectETag: `"2"`},
+				{method: http.MethodPut, path: "/books/1", header: map[string]string{"If-Match": `"1"`}, body: `{"title":"C","author":"D","year":2}`, expectStatus: http.StatusPreconditionFailed, expectETag: `"2"`},
+				{method: http.MethodPut, path: "/books/1", header: map[string]string{"If-Match": `W/"2"`}, body: `{"title":"C","author":"D","year":2}`, expectStatus: http.StatusPreconditionFailed},
+				{method: http.MethodPatch, path: "/books/1", header: map[string]string{"If-Match": `"1"`, "Content-Type": "application/merge-patch+json"}, body: `{"year":3}`, expectStatus: http.StatusPreconditionFailed},
+				{method: http.MethodPatch, path: "/books/1", header: map[string]string{"If-Match": `"1", "2"`, "Content-Type": "application/merge-patch+json"}, body: `{"year":3}`, expectStatus: http.StatusOK, expectETag: `"3"`},
+				{method: http.MethodPut, path: "/books/1", body: `{"title":"E","author":"F","year":4}`, expectStatus: http.StatusOK, expectETag: `"4"`},
+				{method: http.MethodDelete, path: "/books/1", header: map[string]string{"If-Match": `"3"`}, expectStatus: http.StatusPreconditionFailed},
+				{method: http.MethodDelete, path: "/books/1", header: map[string]string{"If-Match": "*"}, expectStatus: http.StatusOK},
+				{method: http.MethodDelete, path: "/books/1", header: map[string]string{"If-Match": `"4"`}, expectStatus: http.StatusNotFound},
+			},
+		},
+		{
+			name:           "strict mode requires If-Match",
+			requireIfMatch: true,
+			steps: []step{
+				{method: http.MethodPut, path: "/books/1", body: `{"title":"A","author":"B","year":1}`, expectStatus: http.StatusPreconditionRequired},
+				{method: http.MethodPatch, path: "/books/1", header: map[string]string{"Content-Type": "application/merge-patch+json"}, body: `{"year":3}`, expectStatus: http.StatusPreconditionRequired},
+				{method: http.MethodDelete, path: "/books/1", expectStatus: http.StatusPreconditionRequired},
+				{method: http.MethodPost, path: "/books", body: `{"title":"New","author":"B","year":1}`, expectStatus: http.StatusCreated, expectETag: `"1"`},
+				{method: http.MethodPut, path: "/books/1", header: map[string]string{"If-Match": `"1"`}, body: `{"title":"A","author":"B","year":1}`, expectStatus: http.StatusOK, expectETag: `"2"`},
+				{method: http.MethodDelete, path: "/books/1", header: map[string]string{"If-Match": `"2"`}, expectStatus: http.StatusOK},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			bc := NewBookController(repository.NewMemoryBookRepository(models.Book{Title: "T", Author: "A", Year: 2000}), nil, BookOptions{RequireIfMatch: tt.requireIfMatch})
+			r := gin.New()
+			r.GET("/books/:id", bc.GetBook)
+			r.POST("/books", bc.CreateBook)
+			r.PUT("/books/:id", bc.UpdateBook)
+			r.PATCH("/books/:id", bc.PatchBook)
+			r.DELETE("/books/:id", bc.DeleteBook)
+
+			for i, s := range tt.steps {
+				req, _ := http.NewRequest(s.method, s.path, strings.NewReader(s.body))
+				req.Header.Set("Content-Type", "application/json")
+				for k, v := range s.header {
+					req.Header.Set(k, v)
 				}
-				utils.DB = db
-				db.Create(&testBook)
 				w := httptest.NewRecorder()
-				c, _ := gin.CreateTestContext(w)
-				c.Params = gin.Params{{Key: "id", Value: "1"}}
-				c.Request, _ = http.NewRequest(http.MethodDelete, "/api/books/1", nil)
-				return c, w
-			},
+				r.ServeHTTP(w, req)
+				assert.Equal(t, s.expectStatus, w.Code, "step %d: %s", i, w.Body.String())
+				if s.expectETag != "" {
+					assert.Equal(t, s.expectETag, w.Header().Get("ETag"), "step %d", i)
+				}
+				if s.expectStatus == http.StatusNotModified {
+					assert.Empty(t, w.Body.String(), "step %d", i)
+				}
+			}
+		})
+	}
+}
+
+// TestBookControllerReconfigure checks that reconfigured options apply to
+// the requests that follow.
+func TestBookControllerReconfigure(t *testing.T) {
+	t.Parallel()
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "T", Author: "A", Year: 2000})
+	bc := NewBookController(repo, repo.Authors(), BookOptions{})
+	r := gin.New()
+	r.POST("/books", bc.CreateBook)
+	r.PUT("/books/:id", bc.UpdateBook)
+	send := func(method, path, body string) int {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPut, "/books/1", `{"title":"A","author":"A","year":1}`))
+	assert.Equal(t, http.StatusCreated, send(http.MethodPost, "/books", `{"title":"B","author":"Nobody","year":1}`))
+
+	bc.Reconfigure(BookOptions{RequireIfMatch: true, KnownAuthorsOnly: true})
+	assert.Equal(t, http.StatusPreconditionRequired, send(http.MethodPut, "/books/1", `{"title":"A","author":"A","year":1}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, send(http.MethodPost, "/books", `{"title":"C","author":"Somebody","year":1}`))
+}
+
+func TestGetBooksNotModified(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "T", Author: "A", Year: 2000})
+	bc := NewBookController(repo, nil, BookOptions{})
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books", nil)
+		if ifNoneMatch != "" {
+			c.Request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		bc.GetBooks(c)
+		return w
+	}
+
+	w := get("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+
+	w = get(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	book, err := repo.Get(context.Background(), 1)
+	assert.NoError(t, err)
+	book.Year = 2001
+	assert.NoError(t, repo.Update(context.Background(), &book))
+	w = get(etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+// conflictingRepository serves reads from memory but reports that every
+// write lost a race with another request.
+type conflictingRepository struct {
+	*repository.MemoryBookRepository
+}
+
+func (r *conflictingRepository) Update(context.Context, *models.Book) error {
+	return repository.ErrVersionConflict
+}
+
+func (r *conflictingRepository) Delete(context.Context, uint, uint) error {
+	return repository.ErrVersionConflict
+}
+
+func TestConcurrentWriteConflicts(t *testing.T) {
+	t.Parallel()
+
+	bc := NewBookController(&conflictingRepository{repository.NewMemoryBookRepository(models.Book{Title: "T", Author: "A", Year: 2000})}, nil, BookOptions{})
+	for _, tt := range []struct {
+		method  string
+		body    string
+		handler gin.HandlerFunc
+	}{
+		{method: http.MethodPut, body: `{"title":"A","author":"B","year":1}`, handler: bc.UpdateBook},
+		{method: http.MethodPatch, body: `{"year":1}`, handler: bc.PatchBook},
+		{method: http.MethodDelete, handler: bc.DeleteBook},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: "1"}}
+		c.Request, _ = http.NewRequest(tt.method, "/api/books/1", strings.NewReader(tt.body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("If-Match", `"1"`)
+		tt.handler(c)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, tt.method)
+		assert.Contains(t, w.Body.String(), "Book has been modified", tt.method)
+	}
+}
+
+func TestDeleteBook(t *testing.T) {
+	t.Parallel()
+
+	testBook := models.Book{Title: "To Delete", Author: "Author", Year: 2020}
+
+	tests := []struct {
+		name         string
+		id           string
+		repo         repository.BookRepository
+		expectStatus int
+		expectError  string
+	}{
+		{
+			name:         "delete existing book",
+			id:           "1",
 			expectStatus: http.StatusOK,
 			expectError:  "",
 		},
 		{
-			name: "delete non-existing book",
-			prepare: func() (*gin.Context, *httptest.ResponseRecorder) {
-				db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-				err := db.AutoMigrate(&models.Book{})
-				if err != nil {
-					return nil, nil
-				}
-				utils.DB = db
-				w := httptest.NewRecorder()
-				c, _ := gin.CreateTestContext(w)
-				c.Params = gin.Params{{Key: "id", Value: "999"}}
-				c.Request, _ = http.NewRequest(http.MethodDelete, "/api/books/999", nil)
-				return c, w
-			},
+			name:         "delete non-existing book",
+			id:           "999",
 			expectStatus: http.StatusNotFound,
 			expectError:  "Book not found",
 		},
+		{
+			name:         "db delete error",
+			id:           "1",
+			repo:         failingRepository{err: errDatabaseClosed},
+			expectStatus: http.StatusInternalServerError,
+			expectError:  "Failed to delete book",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c, w := tt.prepare()
-			DeleteBook(c)
+			t.Parallel()
+			repo := tt.repo
+			if repo == nil {
+				repo = repository.NewMemoryBookRepository(testBook)
+			}
+			bc := NewBookController(repo, nil, BookOptions{})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			c.Request, _ = http.NewRequest(http.MethodDelete, "/api/books/"+tt.id, nil)
+			bc.DeleteBook(c)
 			assert.Equal(t, tt.expectStatus, w.Code)
 			if tt.expectStatus == http.StatusOK {
 				var resp map[string]interface{}
@@ -434,12 +1226,246 @@ func TestDeleteBook(t *testing.T) {
 				if len(resp) > 0 {
 					assert.Contains(t, resp, "message")
 				}
+				_, err = repo.Get(context.Background(), 1)
+				assert.ErrorIs(t, err, repository.ErrNotFound)
 			} else {
-				var resp map[string]interface{}
+				var resp models.Problem
 				err := json.Unmarshal(w.Body.Bytes(), &resp)
 				assert.NoError(t, err)
-				assert.Equal(t, tt.expectError, resp["error"])
+				assert.Equal(t, tt.expectError, resp.Detail)
+			}
+		})
+	}
+}
+
+// TestDeleteBookPreconditionReadError checks that a conditional delete is
+// refused rather than made unconditional when the book cannot be read.
+func TestDeleteBookPreconditionReadError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		requireIfMatch bool
+		ifMatch        string
+	}{
+		{name: "if-match sent", ifMatch: `"1"`},
+		{name: "if-match required", requireIfMatch: true, ifMatch: `"1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := repository.NewMemoryBookRepository(models.Book{Title: "T", Author: "A", Year: 2000})
+			bc := NewBookController(failingGetRepository{BookRepository: repo, err: errDatabaseClosed}, nil, BookOptions{RequireIfMatch: tt.requireIfMatch})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "id", Value: "1"}}
+			c.Request, _ = http.NewRequest(http.MethodDelete, "/api/books/1", nil)
+			c.Request.Header.Set("If-Match", tt.ifMatch)
+			bc.DeleteBook(c)
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+			_, err := repo.Get(context.Background(), 1)
+			assert.NoError(t, err, "the book is not deleted")
+		})
+	}
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository(
+		models.Book{Title: "Kept", Author: "Author", Year: 2000},
+		models.Book{Title: "Trashed", Author: "Author", Year: 2001},
+	)
+	bc := NewBookController(repo, nil, BookOptions{})
+	serve := func(handler gin.HandlerFunc, method, id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		if id != "" {
+			c.Params = gin.Params{{Key: "id", Value: id}}
+		}
+		c.Request, _ = http.NewRequest(method, "/api/books", nil)
+		handler(c)
+		return w
+	}
+	listTitles := func(handler gin.HandlerFunc) []string {
+		w := serve(handler, http.MethodGet, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp models.BookListResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		var titles []string
+		for _, b := range resp.Items {
+			titles = append(titles, b.Title)
+		}
+		return titles
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(bc.RestoreBook, http.MethodPost, "2").Code)
+	assert.Equal(t, http.StatusOK, serve(bc.DeleteBook, http.MethodDelete, "2").Code)
+	assert.Equal(t, []string{"Kept"}, listTitles(bc.GetBooks))
+	assert.Equal(t, []string{"Trashed"}, listTitles(bc.GetTrash))
+	assert.Equal(t, http.StatusNotFound, serve(bc.GetBook, http.MethodGet, "2").Code)
+	assert.Equal(t, http.StatusNotFound, serve(bc.DeleteBook, http.MethodDelete, "2").Code)
+
+	w := serve(bc.RestoreBook, http.MethodPost, "2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	var book models.Book
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	assert.Equal(t, "Trashed", book.Title)
+	assert.Nil(t, book.DeletedAt)
+	assert.NotContains(t, w.Body.String(), "deletedAt")
+	assert.Empty(t, listTitles(bc.GetTrash))
+	assert.Equal(t, http.StatusOK, serve(bc.GetBook, http.MethodGet, "2").Code)
+
+	for _, id := range []string{"2", "999"} {
+		w := serve(bc.RestoreBook, http.MethodPost, id)
+		assert.Equal(t, http.StatusNotFound, w.Code, id)
+		assert.Contains(t, w.Body.String(), "Book not found in trash", id)
+	}
+	w = serve(NewBookController(failingRepository{err: errDatabaseClosed}, nil, BookOptions{}).RestoreBook, http.MethodPost, "1")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "Failed to restore book")
+}
+
+// TestTrashCursorScope checks that cursors of the book listing cannot page
+// through the trash and vice versa.
+func TestTrashCursorScope(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository(
+		models.Book{Title: "A", Author: "X"},
+		models.Book{Title: "B", Author: "X"},
+	)
+	bc := NewBookController(repo, nil, BookOptions{})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/books?pageSize=1", nil)
+	bc.GetBooks(c)
+	var resp models.BookListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.NextCursor)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/trash?cursor="+url.QueryEscape(resp.NextCursor), nil)
+	bc.GetTrash(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "cursor")
+}
+
+func TestSearchBooks(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository(
+		models.Book{Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937, Description: "A hobbit is swept into a quest."},
+		models.Book{Title: "The Silmarillion", Author: "J. R. R. Tolkien", Year: 1977},
+		models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965},
+	)
+
+	tests := []struct {
+		name         string
+		repo         repository.BookRepository
+		query        string
+		expectStatus int
+		expectTitles []string
+		expectTotal  int64
+		expectBody   string
+		highlights   map[string]string
+	}{
+		{
+			name:         "ranked hits with highlights",
+			query:        "q=hobbit",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"The Hobbit"},
+			expectTotal:  1,
+			highlights:   map[string]string{"title": "The <mark>Hobbit</mark>", "description": "A <mark>hobbit</mark> is swept into a quest."},
+		},
+		{
+			name:         "typo and paging",
+			query:        "q=tolkein&pageSize=1&page=2",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"The Silmarillion"},
+			expectTotal:  2,
+			expectBody:   `"page":2,"pageSize":1`,
+		},
+		{
+			name:         "filters",
+			query:        "q=tolkien&yearFrom=1950",
+			expectStatus: http.StatusOK,
+			expectTitles: []string{"The Silmarillion"},
+			expectTotal:  1,
+		},
+		{
+			name:         "no hits",
+			query:        `q="frank tolkien"`,
+			expectStatus: http.StatusOK,
+			expectTitles: []string{},
+			expectBody:   `"items":[]`,
+		},
+		{
+			name:         "missing query",
+			query:        "q=%20",
+			expectStatus: http.StatusBadRequest,
+			expectBody:   `{"field":"q","rule":"search","message":"must contain a word"}`,
+		},
+		{
+			name:         "sort",
+			query:        "q=dune&sort=title",
+			expectStatus: http.StatusBadRequest,
+			expectBody:   `{"field":"sort","rule":"excluded","message":"search results are ordered by relevance"}`,
+		},
+		{
+			name:         "page beyond maximum offset",
+			query:        "q=dune&page=4611686018427387905&pageSize=3",
+			expectStatus: http.StatusBadRequest,
+			expectBody:   `{"field":"page","rule":"lte","message":"must be less than or equal to 715827883"}`,
+		},
+		{
+			name:         "cursor",
+			query:        "q=dune&cursor=abc",
+			expectStatus: http.StatusBadRequest,
+			expectBody:   `{"field":"cursor","rule":"excluded","message":"search results cannot be paged by cursor"}`,
+		},
+		{
+			name:         "db error",
+			repo:         failingRepository{err: errDatabaseClosed},
+			query:        "q=dune",
+			expectStatus: http.StatusInternalServerError,
+			expectBody:   "Failed to search books",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := tt.repo
+			if r == nil {
+				r = repo
+			}
+			bc := NewBookController(r, nil, BookOptions{})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/search?"+tt.query, nil)
+
+			bc.SearchBooks(c)
+			assert.Equal(t, tt.expectStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectBody)
+			if tt.expectStatus != http.StatusOK {
+				return
+			}
+			var resp models.SearchResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			titles := []string{}
+			for _, h := range resp.Items {
+				titles = append(titles, h.Title)
+			}
+			assert.Equal(t, tt.expectTitles, titles)
+			assert.Equal(t, tt.expectTotal, resp.Total)
+			if tt.highlights != nil {
+				assert.Equal(t, tt.highlights, resp.Items[0].Highlights)
 			}
+			assert.NotEmpty(t, w.Header().Get("ETag"))
 		})
 	}
 }
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// Export formats.
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+	ExportJSON   = "json"
+)
+
+// exportBatchSize is the number of books read from the repository at a
+// time during an export.
+const exportBatchSize = 500
+
+// exportFormats maps the export formats to their media type and file
+// extension.
+var exportFormats = map[string]struct{ mediaType, ext string }{
+	ExportCSV:    {"text/csv; charset=utf-8", ".csv"},
+	ExportNDJSON: {"application/x-ndjson", ".ndjson"},
+	ExportJSON:   {"application/json; charset=utf-8", ".json"},
+}
+
+// exportColumns is the header of CSV exports. The book fields are named as
+// Import expects them; the others are ignored when the file is imported.
+var exportColumns = []string{"id", "title", "authors", "year", "isbn", "publisher", "language",
+	"pageCount", "description", "genres", "version", "createdAt", "updatedAt"}
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// Format is ExportCSV, ExportNDJSON or ExportJSON.
+	Format string
+	Filter repository.BookFilter
+	// Sort orders the books; it defaults to the ID.
+	Sort []repository.SortField
+}
+
+// bookEncoder writes the books of an export in one format.
+type bookEncoder interface {
+	begin() error
+	encode(book models.Book) error
+	// flush writes out what is buffered at the end of a batch.
+	flush() error
+	end() error
+}
+
+// ExportBooks godoc
+// @Summary      Export books
+// @Description  Stream every book matching the listing filters as a CSV, JSON Lines or JSON array download
+// @Tags         books
+// @Produce      json
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Param        format    query     string  false  "Export format"  Enums(csv, ndjson, json)  default(json)
+// @Param        sort      query     string  false  "Comma separated sort fields (id, title, author, year); prefix with - for descending"  example(title,-year)
+// @Param        author    query     string  false  "Filter by author name, ignoring case, spaces and periods"
+// @Param        title     query     string  false  "Filter by title substring (case-insensitive)"
+// @Param        yearFrom  query     int     false  "Minimum publication year"  minimum(0)  maximum(2100)
+// @Param        yearTo    query     int     false  "Maximum publication year"  minimum(0)  maximum(2100)
+// @Success      200  {array}   models.Book
+// @Failure      400  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /books/export [get]
+func (bc *BookController) ExportBooks(c *gin.Context) {
+	query, fieldErrs := parseBookListQuery(c, bc.cursors, repository.BookFilter{})
+	for _, name := range []string{"page", "pageSize", "limit", "offset", "cursor"} {
+		if _, ok := c.GetQuery(name); ok {
+			fieldErrs.add(name, "excluded", "exports are not paged")
+		}
+	}
+	format := c.DefaultQuery("format", ExportJSON)
+	f, ok := exportFormats[format]
+	if !ok {
+		fieldErrs.add("format", "oneof", "must be csv, ndjson or json")
+	}
+	if len(fieldErrs) > 0 {
+		slog.Info("Invalid export parameters", "fields", fieldErrs)
+		invalidRequest(c, "Invalid query parameters", fieldErrs)
+		return
+	}
+
+	c.Header("Content-Type", f.mediaType)
+	c.Header("Content-Disposition", `attachment; filename="books`+f.ext+`"`)
+	n, err := bc.Export(c.Request.Context(), c.Writer, ExportOptions{Format: format, Filter: query.Filter, Sort: query.Sort})
+	if err != nil && !c.Writer.Written() {
+		slog.Error("Error exporting books", "error", err)
+		c.Writer.Header().Del("Content-Disposition")
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to export books")
+		return
+	}
+	if err != nil {
+		// The status has been sent; the client gets a truncated file.
+		slog.Error("Export interrupted", "format", format, "books", n, "error", err)
+		return
+	}
+	slog.Info("Exported books", "format", format, "books", n)
+}
+
+// Export writes the books within opts.Filter to w, reading them from the
+// repository exportBatchSize at a time so that memory use does not grow
+// with the catalogue. Each batch is flushed to w, and to the client if w
+// is an http.Flusher. Export returns the number of books written; nothing
+// is written if reading the first batch fails.
+func (bc *BookController) Export(ctx context.Context, w io.Writer, opts ExportOptions) (int64, error) {
+	var enc bookEncoder
+	switch opts.Format {
+	case ExportCSV:
+		enc = &csvEncoder{w: csv.NewWriter(w)}
+	case ExportNDJSON:
+		enc = &ndjsonEncoder{enc: json.NewEncoder(w)}
+	case ExportJSON:
+		enc = &jsonEncoder{w: w}
+	default:
+		return 0, fmt.Errorf("unknown export format %q", opts.Format)
+	}
+	list := repository.ListOptions{Filter: opts.Filter, Sort: opts.Sort, Limit: exportBatchSize}
+	if len(list.Sort) == 0 {
+		list.Sort = []repository.SortField{{Field: "id"}}
+	}
+
+	var n int64
+	for {
+		books, err := bc.books.List(ctx, list)
+		if err != nil {
+			return n, err
+		}
+		if list.After == nil {
+			if err := enc.begin(); err != nil {
+				return n, err
+			}
+		}
+		for _, book := range books {
+			if err := enc.encode(book); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if err := enc.flush(); err != nil {
+			return n, err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if len(books) < exportBatchSize {
+			return n, enc.end()
+		}
+		last := books[len(books)-1]
+		list.After = make([]interface{}, len(list.Sort))
+		for i, field := range list.Sort {
+			list.After[i] = repository.SortValue(last, field.Field)
+		}
+	}
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) begin() error { return e.w.Write(exportColumns) }
+
+func (e *csvEncoder) encode(book models.Book) error {
+	authors := make([]string, len(book.Authors))
+	for i, a := range book.Authors {
+		authors[i] = a.Name
+	}
+	genres := make([]string, len(book.Genres))
+	for i, g := range book.Genres {
+		genres[i] = g.Name
+	}
+	isbn := ""
+	if book.ISBN != nil {
+		isbn = *book.ISBN
+	}
+	return e.w.Write([]string{
+		strconv.FormatUint(uint64(book.ID), 10),
+		book.Title,
+		strings.Join(authors, "; "),
+		strconv.Itoa(book.Year),
+		isbn,
+		book.Publisher,
+		book.Language,
+		strconv.Itoa(book.PageCount),
+		book.Description,
+		strings.Join(genres, "; "),
+		strconv.FormatUint(uint64(book.Version), 10),
+		book.CreatedAt.Format(time.RFC3339Nano),
+		book.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) end() error { return e.flush() }
+
+// ndjsonEncoder writes a book per line.
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) begin() error                  { return nil }
+func (e *ndjsonEncoder) encode(book models.Book) error { return e.enc.Encode(book) }
+func (e *ndjsonEncoder) flush() error                  { return nil }
+func (e *ndjsonEncoder) end() error                    { return nil }
+
+// jsonEncoder writes a JSON array with a book per line.
+type jsonEncoder struct {
+	w io.Writer
+	n int
+}
+
+func (e *jsonEncoder) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonEncoder) encode(book models.Book) error {
+	body, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if e.n == 0 {
+		sep = "\n"
+	}
+	e.n++
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(body)
+	return err
+}
+
+func (e *jsonEncoder) flush() error { return nil }
+
+func (e *jsonEncoder) end() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
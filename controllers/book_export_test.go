@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+func TestExportBooks(t *testing.T) {
+	t.Parallel()
+
+	// More books than fit in a batch, so that the export reads several.
+	books := make([]models.Book, 2*exportBatchSize+3)
+	for i := range books {
+		books[i] = models.Book{Title: fmt.Sprintf("Book %04d", i+1), Author: "Author", Year: 1900 + i%100}
+	}
+	books[0].Genres = []models.Genre{{Name: "classic"}, {Name: "romance"}}
+
+	tests := []struct {
+		name              string
+		query             string
+		repo              repository.BookRepository
+		expectStatus      int
+		expectContentType string
+		expectFilename    string
+		expectError       string
+		// expectTitles holds the first titles exported and expectCount the
+		// number of books.
+		expectTitles []string
+		expectCount  int
+	}{
+		{
+			name:              "json by default",
+			expectStatus:      http.StatusOK,
+			expectContentType: "application/json; charset=utf-8",
+			expectFilename:    "books.json",
+			expectTitles:      []string{"Book 0001", "Book 0002"},
+			expectCount:       len(books),
+		},
+		{
+			name:              "csv",
+			query:             "?format=csv",
+			expectStatus:      http.StatusOK,
+			expectContentType: "text/csv; charset=utf-8",
+			expectFilename:    "books.csv",
+			expectTitles:      []string{"Book 0001", "Book 0002"},
+			expectCount:       len(books),
+		},
+		{
+			name:              "ndjson filtered and sorted",
+			query:             "?format=ndjson&yearFrom=1999&sort=-title",
+			expectStatus:      http.StatusOK,
+			expectContentType: "application/x-ndjson",
+			expectFilename:    "books.ndjson",
+			expectTitles:      []string{"Book 1000", "Book 0900"},
+			expectCount:       10,
+		},
+		{
+			name:              "nothing matches",
+			query:             "?title=missing",
+			expectStatus:      http.StatusOK,
+			expectContentType: "application/json; charset=utf-8",
+			expectFilename:    "books.json",
+		},
+		{
+			name:         "invalid parameters",
+			query:        "?format=xlsx&page=2&yearFrom=abc",
+			expectStatus: http.StatusBadRequest,
+			expectError:  "Invalid query parameters",
+		},
+		{
+			name:         "repository failure",
+			query:        "?format=csv",
+			repo:         failingRepository{err: errDatabaseClosed},
+			expectStatus: http.StatusInternalServerError,
+			expectError:  "Failed to export books",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := tt.repo
+			if repo == nil {
+				repo = repository.NewMemoryBookRepository(books...)
+			}
+			bc := NewBookController(repo, nil, BookOptions{})
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/export"+tt.query, nil)
+			bc.ExportBooks(c)
+
+			assert.Equal(t, tt.expectStatus, w.Code)
+			if tt.expectError != "" {
+				assert.Contains(t, w.Body.String(), tt.expectError)
+				assert.Empty(t, w.Header().Get("Content-Disposition"))
+				return
+			}
+			assert.Equal(t, tt.expectContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, `attachment; filename="`+tt.expectFilename+`"`, w.Header().Get("Content-Disposition"))
+
+			var titles []string
+			switch {
+			case strings.HasPrefix(tt.expectContentType, "text/csv"):
+				records, err := csv.NewReader(w.Body).ReadAll()
+				require.NoError(t, err)
+				assert.Equal(t, exportColumns, records[0])
+				assert.Equal(t, "classic; romance", records[1][9])
+				for _, r := range records[1:] {
+					titles = append(titles, r[1])
+				}
+			case tt.expectContentType == "application/x-ndjson":
+				dec := json.NewDecoder(w.Body)
+				for dec.More() {
+					var b models.Book
+					require.NoError(t, dec.Decode(&b))
+					titles = append(titles, b.Title)
+				}
+			default:
+				var got []models.Book
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				for _, b := range got {
+					titles = append(titles, b.Title)
+				}
+			}
+			assert.Len(t, titles, tt.expectCount)
+			if len(tt.expectTitles) > 0 {
+				assert.Equal(t, tt.expectTitles, titles[:len(tt.expectTitles)])
+			}
+		})
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	isbn := "9780441172719"
+	source := repository.NewMemoryBookRepository(
+		models.Book{Title: "Dune", Authors: []models.AuthorRef{{Name: "Frank Herbert"}}, Year: 1965, ISBN: &isbn, PageCount: 412},
+		models.Book{Title: "Good Omens", Authors: []models.AuthorRef{{Name: "Terry Pratchett"}, {Name: "Neil Gaiman"}}, Year: 1990},
+	)
+	var out bytes.Buffer
+	n, err := NewBookController(source, source.Authors(), BookOptions{}).Export(t.Context(), &out, ExportOptions{Format: ExportCSV})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	target := repository.NewMemoryBookRepository()
+	summary, err := NewBookController(target, target.Authors(), BookOptions{}).Import(t.Context(), &out,
+		ImportOptions{Format: ImportCSV, Strategy: ImportSkip}, func(e models.ImportError) { t.Error(e) })
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Created)
+	assert.ElementsMatch(t, []string{"id", "version", "createdAt", "updatedAt"}, summary.IgnoredColumns)
+
+	imported, err := target.List(t.Context(), repository.ListOptions{Sort: []repository.SortField{{Field: "id"}}})
+	require.NoError(t, err)
+	require.Len(t, imported, 2)
+	assert.Equal(t, isbn, *imported[0].ISBN)
+	assert.Equal(t, 412, imported[0].PageCount)
+	assert.Equal(t, "Neil Gaiman", imported[1].Authors[1].Name)
+}
@@ -0,0 +1,652 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// Import formats, and strategies for rows whose ISBN is already taken:
+// ImportSkip leaves the stored book alone, ImportUpsert updates it, taking
+// it out of the trash first.
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+	ImportSkip   = "skip"
+	ImportUpsert = "upsert"
+)
+
+const (
+	// maxImportErrors is the number of problems listed in an import response.
+	maxImportErrors = 100
+	// maxImportLine is the length of the longest NDJSON line accepted.
+	maxImportLine = 1 << 20
+)
+
+// ErrInvalidImport is returned by Import for options or files it cannot
+// read rows from at all.
+var ErrInvalidImport = errors.New("invalid import")
+
+// importFields maps the normalized names of CSV columns to the BookInput
+// fields they fill.
+var importFields = map[string]string{
+	"title":       "title",
+	"author":      "author",
+	"authors":     "authors",
+	"year":        "year",
+	"isbn":        "isbn",
+	"publisher":   "publisher",
+	"language":    "language",
+	"pagecount":   "pageCount",
+	"description": "description",
+	"genres":      "genres",
+}
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	// Format is ImportCSV or ImportNDJSON.
+	Format string
+	// Strategy is ImportSkip, the default, or ImportUpsert.
+	Strategy string
+	// DryRun checks every row, including against the stored books, without
+	// writing anything.
+	DryRun bool
+	// Columns maps CSV header names to BookInput fields with entries such
+	// as "Book Title=title". Other columns fill the field of the same name,
+	// ignoring case, spaces, underscores and hyphens.
+	Columns []string
+}
+
+// importRow is a row of an import file. fields holds the fields the row was
+// rejected for; "" stands for the whole row.
+type importRow struct {
+	line   int
+	record string
+	input  models.BookInput
+	fields fieldErrors
+}
+
+// importRows reads the rows of an import file. next returns io.EOF after
+// the last row.
+type importRows interface {
+	next() (importRow, error)
+}
+
+// importOutcome is what became of a row.
+type importOutcome int
+
+const (
+	importRejected importOutcome = iota
+	importCreated
+	importUpdated
+	importSkipped
+)
+
+// ImportBooks godoc
+// @Summary      Import books
+// @Description  Import books from a CSV file with a header row or from JSON Lines, one BookInput per line
+// @Tags         books
+// @Accept       text/csv
+// @Accept       application/x-ndjson
+// @Produce      json
+// @Produce      text/csv
+// @Param        format    query     string    false  "File format; taken from Content-Type by default"  Enums(csv, ndjson)
+// @Param        strategy  query     string    false  "What to do with rows whose ISBN is taken"  Enums(skip, upsert)  default(skip)
+// @Param        dryRun    query     bool      false  "Check the file without storing anything"
+// @Param        map       query     []string  false  "CSV column mapping as Header=field"  collectionFormat(multi)
+// @Param        file      body      string    true   "CSV or JSON Lines file"
+// @Success      200  {object}  models.ImportResponse
+// @Failure      400  {object}  models.Problem
+// @Failure      415  {object}  models.Problem
+// @Failure      default  {object}  models.Problem  "Problem Details"
+// @Router       /books/import [post]
+func (bc *BookController) ImportBooks(c *gin.Context) {
+	opts := ImportOptions{
+		Format:   c.Query("format"),
+		Strategy: c.DefaultQuery("strategy", ImportSkip),
+		Columns:  c.QueryArray("map"),
+	}
+	fieldErrs := fieldErrors{}
+	if raw, ok := c.GetQuery("dryRun"); ok {
+		dryRun, err := strconv.ParseBool(raw)
+		if err != nil {
+			fieldErrs.add("dryRun", "boolean", "must be true or false")
+		}
+		opts.DryRun = dryRun
+	}
+	switch opts.Format {
+	case ImportCSV, ImportNDJSON:
+	case "":
+		switch c.ContentType() {
+		case "text/csv":
+			opts.Format = ImportCSV
+		case "application/x-ndjson", "application/jsonl":
+			opts.Format = ImportNDJSON
+		default:
+			slog.Info("Unsupported import media type", "contentType", c.ContentType())
+			AbortWithProblem(c, http.StatusUnsupportedMediaType, "Content-Type must be text/csv or application/x-ndjson unless format is given")
+			return
+		}
+	default:
+		fieldErrs.add("format", "oneof", "must be csv or ndjson")
+	}
+	if opts.Strategy != ImportSkip && opts.Strategy != ImportUpsert {
+		fieldErrs.add("strategy", "oneof", "must be skip or upsert")
+	}
+	if len(fieldErrs) > 0 {
+		slog.Info("Invalid import parameters", "fields", fieldErrs)
+		invalidRequest(c, "Invalid query parameters", fieldErrs)
+		return
+	}
+
+	var report *ImportReport
+	if c.NegotiateFormat(gin.MIMEJSON, "text/csv") == "text/csv" {
+		f, err := os.CreateTemp("", "byfood-import-*.csv")
+		if err != nil {
+			slog.Error("Error creating import report", "error", err)
+			AbortWithProblem(c, http.StatusInternalServerError, "Failed to import books")
+			return
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+		report = &ImportReport{w: newReportWriter(f), file: f}
+	}
+	problems := []models.ImportError{}
+	truncated := false
+	summary, err := bc.Import(c.Request.Context(), c.Request.Body, opts, func(e models.ImportError) {
+		if len(problems) < maxImportErrors {
+			problems = append(problems, e)
+		} else {
+			truncated = true
+		}
+		if report != nil {
+			report.Add(e)
+		}
+	})
+	if errors.Is(err, ErrInvalidImport) {
+		slog.Info("Invalid import", "error", err)
+		AbortWithProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Error importing books", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to import books")
+		return
+	}
+	slog.Info("Imported books", "dryRun", summary.DryRun, "rows", summary.Rows, "created", summary.Created,
+		"updated", summary.Updated, "skipped", summary.Skipped, "rejected", summary.Rejected)
+	summary.Errors, summary.ErrorsTruncated = problems, truncated
+	if report == nil {
+		c.JSON(http.StatusOK, summary)
+		return
+	}
+
+	size, err := report.rewind()
+	if err != nil {
+		slog.Error("Error writing import report", "error", err)
+		AbortWithProblem(c, http.StatusInternalServerError, "Failed to write import report")
+		return
+	}
+	c.DataFromReader(http.StatusOK, size, "text/csv", report.file, map[string]string{
+		"Content-Disposition": `attachment; filename="import-errors.csv"`,
+		"X-Import-Dry-Run":    strconv.FormatBool(summary.DryRun),
+		"X-Import-Rows":       strconv.Itoa(summary.Rows),
+		"X-Import-Created":    strconv.Itoa(summary.Created),
+		"X-Import-Updated":    strconv.Itoa(summary.Updated),
+		"X-Import-Skipped":    strconv.Itoa(summary.Skipped),
+		"X-Import-Rejected":   strconv.Itoa(summary.Rejected),
+	})
+}
+
+// Import reads books from r one row at a time and stores each valid row on
+// its own, as CreateBook and UpdateBook would. Every problem with a row is
+// passed to reject, and the summary counts what became of the rows; its
+// Errors are left for the caller to fill. Import fails with
+// ErrInvalidImport if opts or the CSV header are unusable, and stops at the
+// first error reading r or storing a row.
+func (bc *BookController) Import(ctx context.Context, r io.Reader, opts ImportOptions, reject func(models.ImportError)) (models.ImportResponse, error) {
+	summary := models.ImportResponse{DryRun: opts.DryRun}
+	if opts.Strategy == "" {
+		opts.Strategy = ImportSkip
+	}
+	if opts.Strategy != ImportSkip && opts.Strategy != ImportUpsert {
+		return summary, fmt.Errorf("%w: unknown strategy %q", ErrInvalidImport, opts.Strategy)
+	}
+	var rows importRows
+	switch opts.Format {
+	case ImportCSV:
+		csvRows, ignored, err := newCSVRows(r, opts.Columns)
+		if err != nil {
+			return summary, err
+		}
+		rows, summary.IgnoredColumns = csvRows, ignored
+	case ImportNDJSON:
+		rows = newNDJSONRows(r)
+	default:
+		return summary, fmt.Errorf("%w: unknown format %q", ErrInvalidImport, opts.Format)
+	}
+
+	// isbns holds the ISBNs a dry run would have stored so far.
+	isbns := map[string]bool{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		row, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			return summary, nil
+		}
+		if err != nil {
+			return summary, err
+		}
+		summary.Rows++
+		outcome := importRejected
+		if len(row.fields) == 0 {
+			if opts.DryRun {
+				outcome, err = bc.checkRow(ctx, &row, opts.Strategy, isbns)
+			} else {
+				outcome, err = bc.importRow(ctx, &row, opts.Strategy)
+			}
+			if err != nil {
+				return summary, fmt.Errorf("line %d: %w", row.line, err)
+			}
+		}
+		switch outcome {
+		case importCreated:
+			summary.Created++
+		case importUpdated:
+			summary.Updated++
+		case importSkipped:
+			summary.Skipped++
+		default:
+			summary.Rejected++
+			for _, fe := range row.fields.list() {
+				reject(models.ImportError{Line: row.line, Field: fe.Field, Error: fe.Message, Record: row.record})
+			}
+		}
+	}
+}
+
+// importRow stores a valid row. A row that cannot be stored is rejected
+// with the reason in its fields; other errors are returned.
+func (bc *BookController) importRow(ctx context.Context, row *importRow, strategy string) (importOutcome, error) {
+	var book models.Book
+	applyInput(&book, row.input)
+	err := bc.lookupAuthors(ctx, &book)
+	outcome := importCreated
+	if err == nil && strategy == ImportUpsert && book.ISBN != nil {
+		var found bool
+		if found, err = bc.upsertBook(ctx, &book); found {
+			outcome = importUpdated
+		}
+	}
+	if err == nil && outcome == importCreated {
+		err = bc.books.Create(ctx, &book)
+	}
+	return rowOutcome(row, outcome, err, strategy)
+}
+
+// checkRow works out what importRow would do with a valid row by looking up
+// its ISBN and authors, without writing anything. isbns holds the ISBNs of
+// the rows checked so far that would have been stored, which later rows
+// find taken.
+func (bc *BookController) checkRow(ctx context.Context, row *importRow, strategy string, isbns map[string]bool) (importOutcome, error) {
+	var book models.Book
+	applyInput(&book, row.input)
+	err := bc.lookupAuthors(ctx, &book)
+	for _, ref := range book.Authors {
+		if err != nil || ref.ID == 0 {
+			continue
+		}
+		if _, err = bc.authors.Get(ctx, ref.ID); errors.Is(err, repository.ErrNotFound) {
+			err = fmt.Errorf("%w: %d", repository.ErrUnknownAuthor, ref.ID)
+		}
+	}
+	outcome := importCreated
+	if err == nil && book.ISBN != nil {
+		live, trashed := isbns[*book.ISBN], false
+		if !live {
+			live, trashed, err = bc.isbnTaken(ctx, *book.ISBN)
+		}
+		switch {
+		case err != nil:
+		case (live || trashed) && strategy == ImportUpsert:
+			outcome = importUpdated
+		case live || trashed:
+			err = repository.ErrDuplicate
+		}
+		if err == nil {
+			isbns[*book.ISBN] = true
+		}
+	}
+	return rowOutcome(row, outcome, err, strategy)
+}
+
+// upsertBook updates the book with the ISBN of book to it, restoring that
+// book first if it is in the trash, and reports whether there was one.
+func (bc *BookController) upsertBook(ctx context.Context, book *models.Book) (bool, error) {
+	existing, err := bc.bookByISBN(ctx, *book.ISBN, false)
+	if errors.Is(err, repository.ErrNotFound) {
+		existing, err = bc.bookByISBN(ctx, *book.ISBN, true)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, bc.books.Transaction(ctx, func(repo repository.BookRepository) error {
+		if existing.DeletedAt != nil {
+			if existing, err = repo.Restore(ctx, existing.ID); err != nil {
+				return err
+			}
+		}
+		book.ID, book.Version, book.CreatedAt = existing.ID, existing.Version, existing.CreatedAt
+		return repo.Update(ctx, book)
+	})
+}
+
+// bookByISBN returns the live or trashed book with isbn, failing with
+// repository.ErrNotFound when there is none.
+func (bc *BookController) bookByISBN(ctx context.Context, isbn string, trashed bool) (models.Book, error) {
+	books, err := bc.books.List(ctx, repository.ListOptions{
+		Filter: repository.BookFilter{ISBN: isbn, Trashed: trashed},
+		Sort:   []repository.SortField{{Field: "id"}},
+		Limit:  1,
+	})
+	if err != nil {
+		return models.Book{}, err
+	}
+	if len(books) == 0 {
+		return models.Book{}, repository.ErrNotFound
+	}
+	return books[0], nil
+}
+
+// isbnTaken reports whether a live or a trashed book has isbn.
+func (bc *BookController) isbnTaken(ctx context.Context, isbn string) (live, trashed bool, err error) {
+	_, err = bc.bookByISBN(ctx, isbn, false)
+	if err == nil || !errors.Is(err, repository.ErrNotFound) {
+		return err == nil, false, err
+	}
+	_, err = bc.bookByISBN(ctx, isbn, true)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, false, nil
+	}
+	return false, err == nil, err
+}
+
+// rowOutcome returns what became of a row given the error storing it,
+// rejecting the row with the reason in its fields when the error is about
+// the row. Other errors are returned.
+func rowOutcome(row *importRow, outcome importOutcome, err error, strategy string) (importOutcome, error) {
+	switch {
+	case err == nil:
+		return outcome, nil
+	case errors.Is(err, repository.ErrDuplicate) && strategy == ImportSkip:
+		return importSkipped, nil
+	case errors.Is(err, repository.ErrDuplicate):
+		row.fields.add("isbn", "unique", "was taken during the import")
+	case errors.Is(err, repository.ErrUnknownAuthor) && len(row.input.Authors) > 0:
+		row.fields.add("authors", "exists", "unknown author")
+	case errors.Is(err, repository.ErrUnknownAuthor):
+		row.fields.add("author", "exists", "unknown author")
+	case errors.Is(err, repository.ErrVersionConflict), errors.Is(err, repository.ErrNotFound):
+		row.fields.add("", "version", "the book was changed during the import")
+	default:
+		return importRejected, err
+	}
+	return importRejected, nil
+}
+
+// csvRows reads the rows of a CSV file. columns holds the BookInput field
+// each column fills, or "" for ignored columns.
+type csvRows struct {
+	r       *csv.Reader
+	columns []string
+}
+
+// newCSVRows reads the header of a CSV file and maps its columns, returning
+// the names of those that map to no field.
+func newCSVRows(r io.Reader, mapping []string) (*csvRows, []string, error) {
+	mapped := map[string]string{}
+	for _, entry := range mapping {
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return nil, nil, fmt.Errorf("%w: column mapping %q is not Header=field", ErrInvalidImport, entry)
+		}
+		field, ok := importFields[normalizeColumn(entry[i+1:])]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: column mapping %q names an unknown field", ErrInvalidImport, entry)
+		}
+		mapped[strings.TrimSpace(entry[:i])] = field
+	}
+
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("%w: the file has no header row", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: reading the header: %v", ErrInvalidImport, err)
+	}
+	rows := &csvRows{r: cr, columns: make([]string, len(header))}
+	taken := map[string]string{}
+	var ignored []string
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		field, ok := mapped[name]
+		if ok {
+			delete(mapped, name)
+		} else if field, ok = importFields[normalizeColumn(name)]; !ok {
+			ignored = append(ignored, name)
+			continue
+		}
+		if other, dup := taken[field]; dup {
+			return nil, nil, fmt.Errorf("%w: columns %q and %q both map to %s", ErrInvalidImport, other, name, field)
+		}
+		taken[field] = name
+		rows.columns[i] = field
+	}
+	if len(mapped) > 0 {
+		missing := make([]string, 0, len(mapped))
+		for name := range mapped {
+			missing = append(missing, strconv.Quote(name))
+		}
+		sort.Strings(missing)
+		return nil, nil, fmt.Errorf("%w: mapped columns %s are not in the header", ErrInvalidImport, strings.Join(missing, ", "))
+	}
+	if _, ok := taken["title"]; !ok {
+		return nil, nil, fmt.Errorf("%w: no column maps to title", ErrInvalidImport)
+	}
+	return rows, ignored, nil
+}
+
+func (c *csvRows) next() (importRow, error) {
+	record, err := c.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return importRow{
+			line:   parseErr.StartLine,
+			record: csvRecord(record),
+			fields: fieldErrors{"": {Rule: "csv", Message: parseErr.Err.Error()}},
+		}, nil
+	}
+	if err != nil {
+		return importRow{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	row := importRow{line: line, record: csvRecord(record), fields: fieldErrors{}}
+	in := &row.input
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		switch c.columns[i] {
+		case "title":
+			in.Title = value
+		case "author":
+			in.Author = value
+		case "authors":
+			for _, name := range splitList(value) {
+				in.Authors = append(in.Authors, models.AuthorRef{Name: name})
+			}
+		case "year":
+			in.Year = parseCell(value, "year", row.fields)
+		case "isbn":
+			in.ISBN = value
+		case "publisher":
+			in.Publisher = value
+		case "language":
+			in.Language = value
+		case "pageCount":
+			in.PageCount = parseCell(value, "pageCount", row.fields)
+		case "description":
+			in.Description = value
+		case "genres":
+			in.Genres = splitList(value)
+		}
+	}
+	if err := binding.Validator.ValidateStruct(in); err != nil {
+		for field, fe := range inputFieldErrors(err, *in, "") {
+			if _, ok := row.fields[field]; !ok {
+				row.fields[field] = fe
+			}
+		}
+	}
+	return row, nil
+}
+
+// ndjsonRows reads the rows of a JSON Lines file, skipping blank lines.
+type ndjsonRows struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONRows(r io.Reader) *ndjsonRows {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxImportLine)
+	return &ndjsonRows{s: s}
+}
+
+func (n *ndjsonRows) next() (importRow, error) {
+	for n.s.Scan() {
+		n.line++
+		text := bytes.TrimSpace(bytes.TrimPrefix(n.s.Bytes(), []byte("\ufeff")))
+		if len(text) == 0 {
+			continue
+		}
+		row := importRow{line: n.line, record: string(text), fields: fieldErrors{}}
+		if err := binding.JSON.BindBody(text, &row.input); err != nil {
+			row.fields = inputFieldErrors(err, row.input, "")
+		}
+		return row, nil
+	}
+	if err := n.s.Err(); errors.Is(err, bufio.ErrTooLong) {
+		return importRow{}, fmt.Errorf("%w: line %d is longer than %d bytes", ErrInvalidImport, n.line+1, maxImportLine)
+	} else if err != nil {
+		return importRow{}, err
+	}
+	return importRow{}, io.EOF
+}
+
+// ImportReport writes the problems found by Import as CSV, one per line
+// under a header of line, field, error and record.
+type ImportReport struct {
+	w *csv.Writer
+	// file is the temporary file ImportBooks writes the report to.
+	file *os.File
+}
+
+// NewImportReport returns a report writing to w.
+func NewImportReport(w io.Writer) *ImportReport {
+	return &ImportReport{w: newReportWriter(w)}
+}
+
+func newReportWriter(w io.Writer) *csv.Writer {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"line", "field", "error", "record"})
+	return cw
+}
+
+// Add writes a problem to the report.
+func (r *ImportReport) Add(e models.ImportError) {
+	_ = r.w.Write([]string{strconv.Itoa(e.Line), e.Field, e.Error, e.Record})
+}
+
+// Flush writes any buffered problems and returns the first error writing
+// the report.
+func (r *ImportReport) Flush() error {
+	r.w.Flush()
+	return r.w.Error()
+}
+
+// rewind flushes a report written to its file and rewinds the file for
+// reading, returning its size.
+func (r *ImportReport) rewind() (int64, error) {
+	if err := r.Flush(); err != nil {
+		return 0, err
+	}
+	size, err := r.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	_, err = r.file.Seek(0, io.SeekStart)
+	return size, err
+}
+
+// normalizeColumn returns the name a CSV column is matched to a field by.
+func normalizeColumn(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.TrimSpace(name)))
+}
+
+// csvRecord formats a CSV record as a line of the file, without the line
+// break.
+func csvRecord(record []string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	_ = w.Write(record)
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// splitList splits a semicolon separated cell, dropping blank entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseCell parses the integer in a cell, which may be empty, recording a
+// problem with field in fields if it is not an integer.
+func parseCell(value, field string, fields fieldErrors) int {
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fields.add(field, "integer", "must be an integer")
+	}
+	return n
+}
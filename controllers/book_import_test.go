@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+const importCSV = `Book Title,Author,Year,ISBN,Genres,Shelf
+Emma,Jane Austen,1815,,classic; romance,A1
+Dune (2nd ed.),Frank Herbert,1965,978-0-441-17271-9,,B2
+No Year,Someone,soon,,,C3
+,Nobody,2000,,,D4
+"Persuasion",Jane Austen,1817,0-306-40615-2,,"E5"
+`
+
+func TestImportBooks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		target        string
+		contentType   string
+		body          string
+		expectStatus  int
+		expectError   string
+		expectSummary models.ImportResponse
+		expectTitles  []string
+	}{
+		{
+			name:         "csv skipping duplicates",
+			target:       "/api/books/import?map=Book+Title%3Dtitle",
+			contentType:  "text/csv",
+			body:         importCSV,
+			expectStatus: http.StatusOK,
+			expectSummary: models.ImportResponse{
+				Rows: 5, Created: 2, Skipped: 1, Rejected: 2, IgnoredColumns: []string{"Shelf"},
+				Errors: []models.ImportError{
+					{Line: 4, Field: "year", Error: "must be an integer", Record: "No Year,Someone,soon,,,C3"},
+					{Line: 5, Field: "title", Error: "is required", Record: ",Nobody,2000,,,D4"},
+				},
+			},
+			expectTitles: []string{"Dune", "The Hobbit", "Emma", "Persuasion"},
+		},
+		{
+			name:         "csv upserting by isbn",
+			target:       "/api/books/import?strategy=upsert&map=Book+Title%3Dtitle",
+			contentType:  "text/csv; charset=utf-8",
+			body:         importCSV,
+			expectStatus: http.StatusOK,
+			expectSummary: models.ImportResponse{
+				Rows: 5, Created: 2, Updated: 1, Rejected: 2, IgnoredColumns: []string{"Shelf"},
+			},
+			expectTitles: []string{"Dune (2nd ed.)", "The Hobbit", "Emma", "Persuasion"},
+		},
+		{
+			name:         "dry run",
+			target:       "/api/books/import?format=csv&dryRun=true&map=Book+Title%3Dtitle",
+			contentType:  "application/octet-stream",
+			body:         importCSV,
+			expectStatus: http.StatusOK,
+			expectSummary: models.ImportResponse{
+				DryRun: true, Rows: 5, Created: 2, Skipped: 1, Rejected: 2, IgnoredColumns: []string{"Shelf"},
+			},
+			expectTitles: []string{"Dune", "The Hobbit"},
+		},
+		{
+			name:        "ndjson",
+			target:      "/api/books/import",
+			contentType: "application/x-ndjson",
+			body: `{"title":"Emma","authors":[{"name":"Jane Austen"}],"year":1815}
+
+{"title":"Persuasion","author":"Jane Austen","year":"1817"}
+{"title":"Good Omens","authors":["Terry Pratchett","Neil Gaiman"],"genres":[""]}
+not json
+`,
+			expectStatus: http.StatusOK,
+			expectSummary: models.ImportResponse{
+				Rows: 4, Created: 1, Rejected: 3,
+				Errors: []models.ImportError{
+					{Line: 3, Field: "year", Error: "must be int", Record: `{"title":"Persuasion","author":"Jane Austen","year":"1817"}`},
+					{Line: 4, Field: "genres[0]", Error: "is required", Record: `{"title":"Good Omens","authors":["Terry Pratchett","Neil Gaiman"],"genres":[""]}`},
+					{Line: 5, Error: "invalid character 'o' in literal null (expecting 'u')", Record: "not json"},
+				},
+			},
+			expectTitles: []string{"Dune", "The Hobbit", "Emma"},
+		},
+		{
+			name:         "no title column",
+			target:       "/api/books/import",
+			contentType:  "text/csv",
+			body:         "Name,Author\nEmma,Jane Austen\n",
+			expectStatus: http.StatusBadRequest,
+			expectError:  "no column maps to title",
+			expectTitles: []string{"Dune", "The Hobbit"},
+		},
+		{
+			name:         "unknown mapped field",
+			target:       "/api/books/import?map=Name%3Dname",
+			contentType:  "text/csv",
+			body:         "Name,Author\nEmma,Jane Austen\n",
+			expectStatus: http.StatusBadRequest,
+			expectError:  "names an unknown field",
+			expectTitles: []string{"Dune", "The Hobbit"},
+		},
+		{
+			name:         "invalid parameters",
+			target:       "/api/books/import?format=xlsx&strategy=merge&dryRun=maybe",
+			contentType:  "text/csv",
+			expectStatus: http.StatusBadRequest,
+			expectError:  "Invalid query parameters",
+			expectTitles: []string{"Dune", "The Hobbit"},
+		},
+		{
+			name:         "unsupported media type",
+			target:       "/api/books/import",
+			contentType:  "application/json",
+			body:         `[{"title":"Emma"}]`,
+			expectStatus: http.StatusUnsupportedMediaType,
+			expectError:  "Content-Type must be text/csv or application/x-ndjson",
+			expectTitles: []string{"Dune", "The Hobbit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			isbn := "9780441172719"
+			repo := repository.NewMemoryBookRepository(
+				models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965, ISBN: &isbn},
+				models.Book{Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937},
+			)
+			bc := NewBookController(repo, repo.Authors(), BookOptions{})
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			bc.ImportBooks(c)
+
+			assert.Equal(t, tt.expectStatus, w.Code, w.Body.String())
+			if tt.expectError != "" {
+				assert.Contains(t, w.Body.String(), tt.expectError)
+			} else {
+				var summary models.ImportResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+				if tt.expectSummary.Errors == nil {
+					summary.Errors = nil
+				}
+				assert.Equal(t, tt.expectSummary, summary)
+			}
+
+			books, err := repo.List(context.Background(), repository.ListOptions{Sort: []repository.SortField{{Field: "id"}}})
+			require.NoError(t, err)
+			var titles []string
+			for _, b := range books {
+				titles = append(titles, b.Title)
+			}
+			assert.Equal(t, tt.expectTitles, titles)
+		})
+	}
+}
+
+func TestImportBooksReport(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository()
+	bc := NewBookController(repo, repo.Authors(), BookOptions{})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/books/import?map=Book+Title%3Dtitle", strings.NewReader(importCSV))
+	c.Request.Header.Set("Content-Type", "text/csv")
+	c.Request.Header.Set("Accept", "text/csv")
+	bc.ImportBooks(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.Equal(t, "3", w.Header().Get("X-Import-Created"))
+	assert.Equal(t, "2", w.Header().Get("X-Import-Rejected"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"line", "field", "error", "record"},
+		{"4", "year", "must be an integer", "No Year,Someone,soon,,,C3"},
+		{"5", "title", "is required", ",Nobody,2000,,,D4"},
+	}, records)
+}
+
+func TestImportDryRunMatchesImport(t *testing.T) {
+	t.Parallel()
+
+	const body = `{"title":"Emma","author":"Jane Austen","isbn":"978-0-306-40615-7"}
+{"title":"Emma (reissue)","author":"Jane Austen","isbn":"9780306406157"}
+{"title":"Dune (2nd ed.)","author":"Frank Herbert","isbn":"9780441172719"}
+{"title":"Crime and Punishment","author":"Fyodor Dostoevsky","isbn":"9780140449136"}
+{"title":"Good Omens","authors":[{"id":999}]}
+`
+	newRepo := func(t *testing.T) *repository.MemoryBookRepository {
+		dune, crime := "9780441172719", "9780140449136"
+		repo := repository.NewMemoryBookRepository(
+			models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965, ISBN: &dune},
+			models.Book{Title: "Crime and Punishment", Author: "Fyodor Dostoevsky", Year: 1866, ISBN: &crime},
+		)
+		require.NoError(t, repo.Delete(context.Background(), 2, 0))
+		return repo
+	}
+	run := func(t *testing.T, repo *repository.MemoryBookRepository, opts ImportOptions) (models.ImportResponse, []models.ImportError) {
+		var problems []models.ImportError
+		summary, err := NewBookController(repo, repo.Authors(), BookOptions{}).Import(context.Background(),
+			strings.NewReader(body), opts, func(e models.ImportError) { problems = append(problems, e) })
+		require.NoError(t, err)
+		return summary, problems
+	}
+
+	for _, strategy := range []string{ImportSkip, ImportUpsert} {
+		t.Run(strategy, func(t *testing.T) {
+			t.Parallel()
+			dryRepo := newRepo(t)
+			dry, dryProblems := run(t, dryRepo, ImportOptions{Format: ImportNDJSON, Strategy: strategy, DryRun: true})
+			stored, storedProblems := run(t, newRepo(t), ImportOptions{Format: ImportNDJSON, Strategy: strategy})
+
+			assert.True(t, dry.DryRun)
+			dry.DryRun = false
+			assert.Equal(t, stored, dry)
+			assert.Equal(t, storedProblems, dryProblems)
+			books, err := dryRepo.List(context.Background(), repository.ListOptions{Sort: []repository.SortField{{Field: "id"}}})
+			require.NoError(t, err)
+			require.Len(t, books, 1, "a dry run stores nothing")
+			assert.Equal(t, "Dune", books[0].Title)
+		})
+	}
+}
+
+func TestImportRowsMatchingTrashedBooks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		strategy      string
+		expectSummary models.ImportResponse
+		expectTrashed bool
+		expectTitle   string
+	}{
+		{strategy: ImportSkip, expectSummary: models.ImportResponse{Rows: 1, Skipped: 1}, expectTrashed: true, expectTitle: "Crime and Punishment"},
+		{strategy: ImportUpsert, expectSummary: models.ImportResponse{Rows: 1, Updated: 1}, expectTitle: "Crime and Punishment (new translation)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			t.Parallel()
+			isbn := "9780140449136"
+			repo := repository.NewMemoryBookRepository(
+				models.Book{Title: "Crime and Punishment", Author: "Fyodor Dostoevsky", Year: 1866, ISBN: &isbn},
+			)
+			ctx := context.Background()
+			require.NoError(t, repo.Delete(ctx, 1, 0))
+
+			summary, err := NewBookController(repo, repo.Authors(), BookOptions{}).Import(ctx,
+				strings.NewReader(`{"title":"Crime and Punishment (new translation)","author":"Fyodor Dostoevsky","year":1866,"isbn":"9780140449136"}`),
+				ImportOptions{Format: ImportNDJSON, Strategy: tt.strategy}, func(e models.ImportError) { t.Error(e) })
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectSummary, summary)
+
+			books, err := repo.List(ctx, repository.ListOptions{
+				Filter: repository.BookFilter{Trashed: tt.expectTrashed},
+				Sort:   []repository.SortField{{Field: "id"}},
+			})
+			require.NoError(t, err)
+			require.Len(t, books, 1)
+			assert.Equal(t, tt.expectTitle, books[0].Title)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// The isbn validation replaces the validator's own, which rejects hyphens
+// and spaces, and iso639_1 has no built-in equivalent.
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		_ = v.RegisterValidation("isbn", func(fl validator.FieldLevel) bool {
+			_, ok := normalizeISBN(fl.Field().String())
+			return ok
+		})
+		_ = v.RegisterValidation("iso639_1", func(fl validator.FieldLevel) bool {
+			return languages[strings.ToLower(fl.Field().String())]
+		})
+	}
+}
+
+// applyInput copies the validated input onto book in its stored form.
+func applyInput(book *models.Book, input models.BookInput) {
+	book.Title = input.Title
+	book.Author = input.Author
+	book.Authors = input.Authors
+	if len(input.Authors) == 0 {
+		book.Authors = []models.AuthorRef{{Name: input.Author}}
+	}
+	book.Year = input.Year
+	book.ISBN = nil
+	if isbn, ok := normalizeISBN(input.ISBN); ok {
+		book.ISBN = &isbn
+	}
+	book.Publisher = strings.TrimSpace(input.Publisher)
+	book.Language = strings.ToLower(input.Language)
+	book.PageCount = input.PageCount
+	book.Description = strings.TrimSpace(input.Description)
+	book.Genres = normalizeGenres(input.Genres)
+}
+
+// normalizeISBN checks the checksum of an ISBN-10 or ISBN-13, ignoring
+// hyphens and spaces, and returns it as a compact ISBN-13. Converting
+// ISBN-10s means the same book cannot be stored twice under both forms.
+func normalizeISBN(raw string) (string, bool) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(raw))
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, r := range isbn {
+			d := int(r - '0')
+			if r == 'X' && i == 9 {
+				d = 10
+			} else if d < 0 || d > 9 {
+				return "", false
+			}
+			sum += (10 - i) * d
+		}
+		if sum%11 != 0 {
+			return "", false
+		}
+		isbn = "978" + isbn[:9]
+		return isbn + isbn13CheckDigit(isbn), true
+	case 13:
+		for _, r := range isbn {
+			if r < '0' || r > '9' {
+				return "", false
+			}
+		}
+		if isbn13CheckDigit(isbn[:12]) != isbn[12:] {
+			return "", false
+		}
+		return isbn, true
+	default:
+		return "", false
+	}
+}
+
+// isbn13CheckDigit returns the check digit of the first 12 digits of an
+// ISBN-13.
+func isbn13CheckDigit(digits string) string {
+	sum := 0
+	for i, r := range digits[:12] {
+		d := int(r - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return string(rune('0' + (10-sum%10)%10))
+}
+
+// normalizeGenres trims and lower-cases genre names and returns them sorted
+// without duplicates.
+func normalizeGenres(names []string) []models.Genre {
+	seen := map[string]bool{}
+	var genres []models.Genre
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		genres = append(genres, models.Genre{Name: name})
+	}
+	sort.Slice(genres, func(i, j int) bool { return genres[i].Name < genres[j].Name })
+	return genres
+}
+
+// languages holds the ISO 639-1 language codes.
+var languages = func() map[string]bool {
+	codes := strings.Fields(`
+		aa ab ae af ak am an ar as av ay az ba be bg bh bi bm bn bo br bs ca ce
+		ch co cr cs cu cv cy da de dv dz ee el en eo es et eu fa ff fi fj fo fr
+		fy ga gd gl gn gu gv ha he hi ho hr ht hu hy hz ia id ie ig ii ik io is
+		it iu ja jv ka kg ki kj kk kl km kn ko kr ks ku kv kw ky la lb lg li ln
+		lo lt lu lv mg mh mi mk ml mn mr ms mt my na nb nd ne ng nl nn no nr nv
+		ny oc oj om or os pa pi pl ps pt qu rm rn ro ru rw sa sc sd se sg si sk
+		sl sm sn so sq sr ss st su sv sw ta te tg th ti tk tl tn to tr ts tt tw
+		ty ug uk ur uz ve vi vo wa wo xh yi yo za zh zu`)
+	set := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		set[c] = true
+	}
+	return set
+}()
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw        string
+		expectISBN string
+		expectOK   bool
+	}{
+		{raw: "9780261103344", expectISBN: "9780261103344", expectOK: true},
+		{raw: "978-0-261-10334-4", expectISBN: "9780261103344", expectOK: true},
+		{raw: "0261103342", expectISBN: "9780261103344", expectOK: true},
+		{raw: "0 261 10334 2", expectISBN: "9780261103344", expectOK: true},
+		{raw: "080442957x", expectISBN: "9780804429573", expectOK: true},
+		{raw: "9780261103345"},
+		{raw: "0261103343"},
+		{raw: "02611033X2"},
+		{raw: "978026110334"},
+		{raw: "97802611033a4"},
+		{raw: ""},
+	}
+
+	for _, tt := range tests {
+		isbn, ok := normalizeISBN(tt.raw)
+		assert.Equal(t, tt.expectOK, ok, tt.raw)
+		assert.Equal(t, tt.expectISBN, isbn, tt.raw)
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"slices"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// Media types of the patch documents accepted by PatchBook. Plain JSON is
+// treated as a merge patch.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+var (
+	// errUnsupportedPatch is returned for patch documents of an unknown
+	// media type.
+	errUnsupportedPatch = errors.New("unsupported patch media type")
+	// errMalformedPatch is returned for patch documents that are not valid
+	// JSON or, for JSON Patch, not a list of objects.
+	errMalformedPatch = errors.New("malformed patch document")
+	// errUnprocessablePatch is returned for well-formed patches that cannot
+	// be applied to the book or that would make it invalid.
+	errUnprocessablePatch = errors.New("patch cannot be applied")
+)
+
+// patchedBook is the book document that patches are applied to.
+type patchedBook struct {
+	ID        uint      `json:"id"`
+	Version   uint      `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	models.BookInput
+}
+
+// applyBookPatch applies the RFC 7396 JSON Merge Patch or RFC 6902 JSON
+// Patch in body, as selected by contentType, to book. The result must pass
+// the same validation as models.BookInput and keep the book's ID, version and
+// timestamps.
+func applyBookPatch(book models.Book, contentType string, body []byte) (models.Book, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return book, fmt.Errorf("%w: %q", errUnsupportedPatch, contentType)
+	}
+
+	doc, err := json.Marshal(book)
+	if err != nil {
+		return book, err
+	}
+	switch mediaType {
+	case mergePatchType, "application/json":
+		if !json.Valid(body) {
+			return book, fmt.Errorf("%w: body is not valid JSON", errMalformedPatch)
+		}
+		doc, err = jsonpatch.MergePatch(doc, body)
+	case jsonPatchType:
+		// A list of JSON objects is well-formed; invalid operations in it
+		// are reported as unprocessable like any other failing operation.
+		var ops []map[string]json.RawMessage
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return book, fmt.Errorf("%w: expected a list of operations: %v", errMalformedPatch, err)
+		}
+		var patch jsonpatch.Patch
+		if patch, err = jsonpatch.DecodePatch(body); err == nil {
+			doc, err = patch.Apply(doc)
+		}
+	default:
+		return book, fmt.Errorf("%w: %q", errUnsupportedPatch, mediaType)
+	}
+	if err != nil {
+		return book, fmt.Errorf("%w: %v", errUnprocessablePatch, err)
+	}
+
+	var patched patchedBook
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return book, fmt.Errorf("%w: %v", errUnprocessablePatch, err)
+	}
+	if patched.ID != book.ID {
+		return book, fmt.Errorf("%w: id cannot be changed", errUnprocessablePatch)
+	}
+	if patched.Version != book.Version {
+		return book, fmt.Errorf("%w: version cannot be changed", errUnprocessablePatch)
+	}
+	if !patched.CreatedAt.Equal(book.CreatedAt) || !patched.UpdatedAt.Equal(book.UpdatedAt) {
+		return book, fmt.Errorf("%w: timestamps cannot be changed", errUnprocessablePatch)
+	}
+	// The document carries the authors both as a list and joined in author;
+	// whichever of the two was changed is the one that counts.
+	input := patched.BookInput
+	authorChanged := input.Author != book.Author
+	authorsChanged := !slices.Equal(input.Authors, book.Authors)
+	switch {
+	case authorChanged && authorsChanged:
+		return book, fmt.Errorf("%w: author and authors cannot both be changed", errUnprocessablePatch)
+	case authorChanged:
+		input.Authors = nil
+	default:
+		input.Author = ""
+	}
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		return book, fmt.Errorf("%w: %w", errUnprocessablePatch, err)
+	}
+
+	applyInput(&book, input)
+	return book, nil
+}
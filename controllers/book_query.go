@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/repository"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	minYear         = 0
+	maxYear         = 2100
+)
+
+// maxOffset bounds the number of rows a page may skip, keeping offsets
+// within the integer range of every database and clear of overflow.
+const maxOffset = math.MaxInt32
+
+// bookListQuery holds the parsed paging, sorting and filtering parameters of
+// a book listing request.
+type bookListQuery struct {
+	Page     int
+	PageSize int
+	Offset   int
+	Sort     []repository.SortField
+	Filter   repository.BookFilter
+	// Cursor is set when the listing is paged by cursor rather than offset.
+	Cursor     *bookCursor
+	CursorArgs []interface{}
+}
+
+// parseBookListQuery reads the listing parameters from the request, adding
+// its filters to scope. Invalid parameters are reported in the returned
+// errors keyed by parameter name.
+func parseBookListQuery(c *gin.Context, cursors cursorSigner, scope repository.BookFilter) (bookListQuery, fieldErrors) {
+	q := bookListQuery{Page: 1, PageSize: defaultPageSize, Filter: scope}
+	errs := fieldErrors{}
+
+	_, hasPage := c.GetQuery("page")
+	_, hasPageSize := c.GetQuery("pageSize")
+	_, hasLimit := c.GetQuery("limit")
+	_, hasOffset := c.GetQuery("offset")
+	rawCursor, hasCursor := c.GetQuery("cursor")
+
+	if hasCursor && (hasPage || hasLimit || hasOffset) {
+		errs.add("cursor", "excluded_with", "cursor cannot be combined with page, limit or offset")
+	} else if (hasPage || hasPageSize) && (hasLimit || hasOffset) {
+		errs.add("page", "excluded_with", "page/pageSize cannot be combined with limit/offset")
+	} else if hasCursor {
+		if n, ok := parseIntParam(c, "pageSize", 1, maxPageSize, errs); ok {
+			q.PageSize = n
+		}
+		q.Page = 0
+		cur, err := cursors.decode(rawCursor)
+		if err != nil {
+			errs.add("cursor", "cursor", err.Error())
+		} else {
+			q.Cursor = &cur
+		}
+	} else if hasLimit || hasOffset {
+		if n, ok := parseIntParam(c, "limit", 1, maxPageSize, errs); ok {
+			q.PageSize = n
+		}
+		if n, ok := parseIntParam(c, "offset", 0, maxOffset, errs); ok {
+			q.Offset = n
+		}
+		q.Page = q.Offset/q.PageSize + 1
+	} else {
+		if n, ok := parseIntParam(c, "page", 1, -1, errs); ok {
+			q.Page = n
+		}
+		if n, ok := parseIntParam(c, "pageSize", 1, maxPageSize, errs); ok {
+			q.PageSize = n
+		}
+		q.Offset = pageOffset(q.Page, q.PageSize, errs)
+	}
+
+	sort, err := parseSort(c.Query("sort"))
+	if err != nil {
+		errs.add("sort", "sort", err.Error())
+	}
+	q.Sort = sort
+
+	q.Filter.Author = strings.TrimSpace(c.Query("author"))
+	q.Filter.Title = strings.TrimSpace(c.Query("title"))
+
+	if n, ok := parseIntParam(c, "yearFrom", minYear, maxYear, errs); ok {
+		q.Filter.YearFrom = &n
+	}
+	if n, ok := parseIntParam(c, "yearTo", minYear, maxYear, errs); ok {
+		q.Filter.YearTo = &n
+	}
+	if q.Filter.YearFrom != nil && q.Filter.YearTo != nil && *q.Filter.YearFrom > *q.Filter.YearTo {
+		errs.add("yearTo", "gtefield", "must be greater than or equal to yearFrom")
+	}
+
+	if q.Cursor != nil && len(errs) == 0 {
+		args, err := q.cursorArgs(*q.Cursor)
+		if err != nil {
+			errs.add("cursor", "cursor", err.Error())
+		}
+		q.CursorArgs = args
+	}
+
+	return q, errs
+}
+
+// listOptions returns the repository options fetching one row more than a
+// page, so that paginate can tell whether another page follows.
+func (q bookListQuery) listOptions() repository.ListOptions {
+	opts := repository.ListOptions{
+		Filter: q.Filter,
+		Sort:   q.Sort,
+		Limit:  q.PageSize + 1,
+		Offset: q.Offset,
+	}
+	if q.Cursor != nil {
+		opts.After = q.CursorArgs
+		opts.Backwards = q.Cursor.Prev
+	}
+	return opts
+}
+
+// parseIntParam parses an optional integer query parameter within [lo, hi].
+// A negative hi means the value has no upper bound. It reports false when
+// the parameter is absent or invalid.
+func parseIntParam(c *gin.Context, name string, lo, hi int, errs fieldErrors) (int, bool) {
+	raw, ok := c.GetQuery(name)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		errs.add(name, "integer", "must be an integer")
+		return 0, false
+	}
+	if n < lo {
+		errs.add(name, "gte", fmt.Sprintf("must be greater than or equal to %d", lo))
+		return 0, false
+	}
+	if hi >= 0 && n > hi {
+		errs.add(name, "lte", fmt.Sprintf("must be less than or equal to %d", hi))
+		return 0, false
+	}
+	return n, true
+}
+
+// pageOffset returns the number of rows before page, reporting pages that
+// would skip more than maxOffset rows in errs.
+func pageOffset(page, pageSize int, errs fieldErrors) int {
+	if page-1 > maxOffset/pageSize {
+		errs.add("page", "lte", fmt.Sprintf("must be less than or equal to %d", maxOffset/pageSize+1))
+		return 0
+	}
+	return (page - 1) * pageSize
+}
+
+// parseSort parses a comma separated list of fields, each optionally prefixed
+// with "-" for descending order. The ID is always appended as a tiebreaker so
+// that ordering is deterministic, and fields after an explicit ID are dropped
+// since they can never break a tie.
+func parseSort(raw string) ([]repository.SortField, error) {
+	var fields []repository.SortField
+	seen := map[string]bool{}
+	if raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			part = strings.TrimSpace(part)
+			desc := strings.HasPrefix(part, "-")
+			name := strings.TrimPrefix(part, "-")
+			if !slices.Contains(repository.SortableFields, name) {
+				return nil, fmt.Errorf("unsupported sort field %q", name)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("duplicate sort field %q", name)
+			}
+			if !seen["id"] {
+				fields = append(fields, repository.SortField{Field: name, Desc: desc})
+			}
+			seen[name] = true
+		}
+	}
+	if !seen["id"] {
+		fields = append(fields, repository.SortField{Field: "id"})
+	}
+	return fields, nil
+}
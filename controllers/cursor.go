@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorSigner signs pagination cursors with an HMAC key so clients cannot
+// forge or tamper with them.
+type cursorSigner []byte
+
+// newCursorSigner returns a signer using secret, or a random per-process key
+// when secret is empty. Cursors signed with a random key do not survive a
+// restart.
+func newCursorSigner(secret []byte) cursorSigner {
+	if len(secret) > 0 {
+		return cursorSigner(secret)
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate cursor secret: %v", err))
+	}
+	return cursorSigner(b)
+}
+
+// bookCursor marks a position in a sorted book listing. Keys holds the values
+// of the sort fields (ending with the ID) of the last book seen, Prev tells
+// whether the cursor pages backwards from that book, and Query fingerprints
+// the sort and filters the cursor was issued for.
+type bookCursor struct {
+	Query string        `json:"q"`
+	Keys  []interface{} `json:"k"`
+	Prev  bool          `json:"p,omitempty"`
+}
+
+func (s cursorSigner) encode(cur bookCursor) string {
+	payload, _ := json.Marshal(cur)
+	mac := hmac.New(sha256.New, s)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s cursorSigner) decode(raw string) (bookCursor, error) {
+	var cur bookCursor
+	payloadPart, sigPart, ok := strings.Cut(raw, ".")
+	if !ok {
+		return cur, errInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return cur, errInvalidCursor
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil {
+		return cur, errInvalidCursor
+	}
+	mac := hmac.New(sha256.New, s)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return cur, errInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&cur); err != nil {
+		return cur, errInvalidCursor
+	}
+	return cur, nil
+}
+
+// fingerprint identifies the sort order and filters of the query so that a
+// cursor cannot be replayed against a different listing.
+func (q bookListQuery) fingerprint() string {
+	var b strings.Builder
+	for _, f := range q.Sort {
+		if f.Desc {
+			b.WriteByte('-')
+		}
+		b.WriteString(f.Field)
+		b.WriteByte(',')
+	}
+	fmt.Fprintf(&b, "|%s|%s|", models.AuthorKey(q.Filter.Author), strings.ToLower(q.Filter.Title))
+	if q.Filter.YearFrom != nil {
+		fmt.Fprintf(&b, "%d", *q.Filter.YearFrom)
+	}
+	b.WriteByte('|')
+	if q.Filter.YearTo != nil {
+		fmt.Fprintf(&b, "%d", *q.Filter.YearTo)
+	}
+	if q.Filter.Trashed {
+		b.WriteString("|trash")
+	}
+	if q.Filter.AuthorID != 0 {
+		fmt.Fprintf(&b, "|author=%d", q.Filter.AuthorID)
+	}
+	return b.String()
+}
+
+// cursorFor builds a cursor positioned at book.
+func (q bookListQuery) cursorFor(s cursorSigner, book models.Book, prev bool) string {
+	keys := make([]interface{}, len(q.Sort))
+	for i, f := range q.Sort {
+		keys[i] = repository.SortValue(book, f.Field)
+	}
+	return s.encode(bookCursor{Query: q.fingerprint(), Keys: keys, Prev: prev})
+}
+
+// cursorArgs converts the decoded cursor keys back to typed values for the
+// query, validating them against the current sort order.
+func (q bookListQuery) cursorArgs(cur bookCursor) ([]interface{}, error) {
+	if cur.Query != q.fingerprint() || len(cur.Keys) != len(q.Sort) {
+		return nil, errors.New("cursor does not match the requested sort and filters")
+	}
+	args := make([]interface{}, len(q.Sort))
+	for i, f := range q.Sort {
+		textual := f.Field == "title" || f.Field == "author"
+		switch v := cur.Keys[i].(type) {
+		case string:
+			if !textual {
+				return nil, errInvalidCursor
+			}
+			args[i] = v
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil || textual {
+				return nil, errInvalidCursor
+			}
+			args[i] = n
+		default:
+			return nil, errInvalidCursor
+		}
+	}
+	return args, nil
+}
+
+// paginate trims the page+1 rows fetched for the query down to one page and
+// computes the cursors leading to the neighbouring pages.
+func (q bookListQuery) paginate(s cursorSigner, rows []models.Book) (items []models.Book, next, prev string) {
+	hasMore := len(rows) > q.PageSize
+	if hasMore {
+		rows = rows[:q.PageSize]
+	}
+	backwards := q.Cursor != nil && q.Cursor.Prev
+	if backwards {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	if len(rows) == 0 {
+		// Nothing beyond the cursor: hand back a cursor that resumes from
+		// the same position in the opposite direction.
+		if q.Cursor != nil {
+			turned := *q.Cursor
+			turned.Prev = !turned.Prev
+			if backwards {
+				next = s.encode(turned)
+			} else {
+				prev = s.encode(turned)
+			}
+		}
+		return rows, next, prev
+	}
+
+	first, last := rows[0], rows[len(rows)-1]
+	switch {
+	case backwards:
+		next = q.cursorFor(s, last, false)
+		if hasMore {
+			prev = q.cursorFor(s, first, true)
+		}
+	case q.Cursor != nil:
+		prev = q.cursorFor(s, first, true)
+		if hasMore {
+			next = q.cursorFor(s, last, false)
+		}
+	default:
+		if q.Offset > 0 {
+			prev = q.cursorFor(s, first, true)
+		}
+		if hasMore {
+			next = q.cursorFor(s, last, false)
+		}
+	}
+	return rows, next, prev
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// bookETag returns the strong entity tag of book, its quoted version.
+func bookETag(book models.Book) string {
+	return `"` + strconv.FormatUint(uint64(book.Version), 10) + `"`
+}
+
+// bodyETag returns a weak entity tag for a response body.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether header, a comma separated list of entity tags
+// or "*", matches etag. If-Match uses the strong comparison, under which weak
+// tags never match; If-None-Match uses the weak comparison (RFC 9110, 8.8.3.2).
+func etagMatches(header, etag string, weak bool) bool {
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified answers a read with 304 Not Modified if its If-None-Match
+// header matches etag, and reports whether it did.
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// checkIfMatch enforces the If-Match precondition of a write to book and
+// reports whether the write may go ahead. Otherwise it has already answered
+// with 428 Precondition Required, when the header is missing in strict mode,
+// or 412 Precondition Failed.
+func (bc *BookController) checkIfMatch(c *gin.Context, book models.Book) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if bc.requireIfMatch.Load() {
+			AbortWithProblem(c, http.StatusPreconditionRequired, "If-Match header is required")
+			return false
+		}
+		return true
+	}
+	if !etagMatches(header, bookETag(book), false) {
+		c.Header("ETag", bookETag(book))
+		preconditionFailed(c)
+		return false
+	}
+	return true
+}
+
+// preconditionFailed answers a write based on an outdated version of a book.
+func preconditionFailed(c *gin.Context) {
+	AbortWithProblem(c, http.StatusPreconditionFailed, "Book has been modified")
+}
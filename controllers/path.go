@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInvalidID is returned by parseID for malformed IDs.
+var errInvalidID = errors.New("invalid ID")
+
+// bindPathParam parses the path parameter name with parse. When parse
+// fails it answers 400 with a validation problem saying that the parameter
+// broke rule, explained by message, and returns false.
+func bindPathParam[T any](c *gin.Context, name, rule, message string, parse func(string) (T, error)) (T, bool) {
+	raw := c.Param(name)
+	v, err := parse(raw)
+	if err != nil {
+		slog.Info("Invalid path parameter", "name", name, "value", raw, "error", err)
+		errs := fieldErrors{}
+		errs.add(name, rule, message)
+		invalidRequest(c, "Invalid path parameters", errs)
+		return v, false
+	}
+	return v, true
+}
+
+// bindID reads the ID of the book or author the request is about from the
+// id path parameter, answering 400 when it is malformed.
+func bindID(c *gin.Context) (uint, bool) {
+	return bindPathParam(c, "id", "id", "must be a positive integer up to "+strconv.Itoa(math.MaxInt)+" without leading zeros", parseID)
+}
+
+// parseID parses an ID: a positive decimal integer without sign or leading
+// zeros that fits in the signed keys of the databases.
+func parseID(raw string) (uint, error) {
+	if raw == "" || raw[0] == '0' {
+		return 0, errInvalidID
+	}
+	n, err := strconv.ParseUint(raw, 10, strconv.IntSize-1)
+	if err != nil {
+		return 0, errors.Join(errInvalidID, err)
+	}
+	return uint(n), nil
+}
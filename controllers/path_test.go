@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+func TestParseID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw      string
+		expectID uint
+		expectOK bool
+	}{
+		{raw: "1", expectID: 1, expectOK: true},
+		{raw: "42", expectID: 42, expectOK: true},
+		{raw: "9223372036854775807", expectID: 9223372036854775807, expectOK: true},
+		{raw: "9223372036854775808"},
+		{raw: "18446744073709551616"},
+		{raw: "99999999999999999999999999"},
+		{raw: "0"},
+		{raw: "007"},
+		{raw: "-1"},
+		{raw: "+1"},
+		{raw: "0x1F"},
+		{raw: "1e3"},
+		{raw: "1.0"},
+		{raw: " 1"},
+		{raw: "1 "},
+		{raw: "１"},
+		{raw: ""},
+		{raw: "abc"},
+		{raw: "1 OR 1=1"},
+		{raw: "1; DROP TABLE books"},
+		{raw: "1' --"},
+		{raw: "1/**/OR/**/1=1"},
+	}
+
+	for _, tt := range tests {
+		id, err := parseID(tt.raw)
+		if tt.expectOK {
+			assert.NoError(t, err, tt.raw)
+			assert.Equal(t, tt.expectID, id, tt.raw)
+		} else {
+			assert.ErrorIs(t, err, errInvalidID, tt.raw)
+		}
+	}
+}
+
+func TestMalformedPathIDs(t *testing.T) {
+	t.Parallel()
+
+	// A repository that fails every call shows that malformed IDs never
+	// reach it.
+	repo := failingRepository{err: errDatabaseClosed}
+	bc := NewBookController(repo, nil, BookOptions{})
+	ac := NewAuthorController(repository.NewMemoryBookRepository().Authors(), bc)
+
+	handlers := []struct {
+		name    string
+		handler gin.HandlerFunc
+		method  string
+		body    string
+	}{
+		{"GetBook", bc.GetBook, http.MethodGet, ""},
+		{"UpdateBook", bc.UpdateBook, http.MethodPut, `{"title":"T","author":"A"}`},
+		{"PatchBook", bc.PatchBook, http.MethodPatch, `{"year":2000}`},
+		{"DeleteBook", bc.DeleteBook, http.MethodDelete, ""},
+		{"RestoreBook", bc.RestoreBook, http.MethodPost, ""},
+		{"GetAuthor", ac.GetAuthor, http.MethodGet, ""},
+		{"GetAuthorBooks", ac.GetAuthorBooks, http.MethodGet, ""},
+		{"UpdateAuthor", ac.UpdateAuthor, http.MethodPut, `{"name":"A"}`},
+		{"DeleteAuthor", ac.DeleteAuthor, http.MethodDelete, ""},
+	}
+	ids := []string{"abc", "-1", "0", "9223372036854775808", "1 OR 1=1", "1; DROP TABLE books"}
+
+	for _, h := range handlers {
+		for _, id := range ids {
+			w := sendJSON(h.handler, h.method, "/api/resource", id, h.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, "%s %q", h.name, id)
+			var problem models.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, "Invalid path parameters", problem.Detail, "%s %q", h.name, id)
+			require.Len(t, problem.Errors, 1)
+			assert.Equal(t, "id", problem.Errors[0].Field)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// ProblemValidation is the type of the problems rejecting fields of a
+// request. They list the fields in errors.
+const ProblemValidation = "urn:byfood:problem:validation"
+
+// problemContentType is the media type of problem responses.
+const problemContentType = "application/problem+json"
+
+// fieldErrors collects the rejected fields of a request by name. The
+// field "" stands for the request as a whole.
+type fieldErrors map[string]models.FieldError
+
+// add records that field broke rule, for the reason given by message.
+func (e fieldErrors) add(field, rule, message string) {
+	e[field] = models.FieldError{Field: field, Rule: rule, Message: message}
+}
+
+// list returns the errors ordered by field.
+func (e fieldErrors) list() []models.FieldError {
+	list := make([]models.FieldError, 0, len(e))
+	for _, fe := range e {
+		list = append(list, fe)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Field < list[j].Field })
+	return list
+}
+
+// LogValue logs the errors as the message of each field.
+func (e fieldErrors) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(e))
+	for _, fe := range e.list() {
+		attrs = append(attrs, slog.String(fe.Field, fe.Message))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// AbortWithProblem answers the request with a problem of type about:blank
+// for status, whose detail is the given message, and stops the handlers
+// that follow.
+func AbortWithProblem(c *gin.Context, status int, detail string) {
+	writeProblem(c, models.Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail})
+}
+
+// invalidRequest answers 400 with a validation problem listing errs.
+func invalidRequest(c *gin.Context, detail string, errs fieldErrors) {
+	validationFailed(c, http.StatusBadRequest, detail, errs)
+}
+
+// validationFailed answers status with a validation problem listing errs.
+func validationFailed(c *gin.Context, status int, detail string, errs fieldErrors) {
+	writeProblem(c, models.Problem{
+		Type:   ProblemValidation,
+		Title:  "Validation failed",
+		Status: status,
+		Detail: detail,
+		Errors: errs.list(),
+	})
+}
+
+// invalidBody answers a request whose JSON body could not be bound to
+// input. The rejected fields are listed unless the body is malformed.
+func invalidBody(c *gin.Context, err error, input any) {
+	errs := inputFieldErrors(err, input, "")
+	if fe, ok := errs[""]; ok {
+		AbortWithProblem(c, http.StatusBadRequest, "Invalid request body: "+fe.Message)
+		return
+	}
+	invalidRequest(c, "Invalid request body", errs)
+}
+
+// writeProblem answers the request with p, naming the request in its
+// instance and request ID. The ID is read from the X-Request-ID response
+// header set by middleware.RequestID.
+func writeProblem(c *gin.Context, p models.Problem) {
+	p.Instance = c.Request.URL.Path
+	p.RequestID = c.Writer.Header().Get("X-Request-ID")
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// NotFound answers requests that match no route.
+func NotFound(c *gin.Context) {
+	AbortWithProblem(c, http.StatusNotFound, "No endpoint matches "+c.Request.Method+" "+c.Request.URL.Path)
+}
+
+// Recover answers a request whose handler panicked, for use with
+// gin.CustomRecovery, unless the response has already been started.
+func Recover(c *gin.Context, _ any) {
+	if c.Writer.Written() {
+		c.Abort()
+		return
+	}
+	AbortWithProblem(c, http.StatusInternalServerError, "The server failed to handle the request")
+}
+
+// inputFieldErrors maps the fields of a rejected input, such as "title",
+// to the rule they broke, after adding prefix to their names. input is
+// the value the request was bound to. Errors not about a single field are
+// given for prefix without its trailing period.
+func inputFieldErrors(err error, input any, prefix string) fieldErrors {
+	errs := fieldErrors{}
+	var invalid validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &invalid):
+		for _, fe := range invalid {
+			errs.add(prefix+jsonPath(reflect.TypeOf(input), fe.Namespace()), fe.Tag(), validationReason(fe))
+		}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		errs.add(prefix+typeErr.Field, "type", "must be "+typeErr.Type.String())
+	default:
+		errs.add(strings.TrimSuffix(prefix, "."), "json", err.Error())
+	}
+	return errs
+}
+
+// jsonPath turns the namespace of a validation error in a value of type t,
+// such as BookInput.Authors[0].Name, into its JSON path, authors[0].name.
+func jsonPath(t reflect.Type, namespace string) string {
+	segments := strings.Split(namespace, ".")[1:]
+	path := make([]string, len(segments))
+	for i, segment := range segments {
+		name, index, indexed := strings.Cut(segment, "[")
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			if f, ok := t.FieldByName(name); ok {
+				if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag != "" {
+					name = tag
+				}
+				t = f.Type
+			}
+		}
+		if indexed {
+			name += "[" + index
+		}
+		path[i] = name
+	}
+	return strings.Join(path, ".")
+}
+
+// validationReason describes the rule a field broke.
+func validationReason(fe validator.FieldError) string {
+	items := "characters"
+	if fe.Kind() == reflect.Slice {
+		items = "items"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "is required unless " + strings.ToLower(fe.Param()) + " is given"
+	case "excluded_with":
+		return "must be omitted when " + strings.ToLower(fe.Param()) + " is given"
+	case "min":
+		return fmt.Sprintf("must have at least %s %s", fe.Param(), items)
+	case "max":
+		return fmt.Sprintf("must have at most %s %s", fe.Param(), items)
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "isbn":
+		return "must be a valid ISBN-10 or ISBN-13"
+	case "iso639_1":
+		return "must be an ISO 639-1 language code"
+	default:
+		return "failed the " + fe.Tag() + " rule"
+	}
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+func TestProblemResponses(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965})
+	bc := NewBookController(repo, repo.Authors(), BookOptions{})
+
+	tests := []struct {
+		name          string
+		handler       gin.HandlerFunc
+		method        string
+		target        string
+		id            string
+		body          string
+		expectProblem models.Problem
+	}{
+		{
+			name:    "invalid book",
+			handler: bc.CreateBook,
+			method:  http.MethodPost,
+			target:  "/api/books",
+			body:    `{"author":"Someone","year":3000,"genres":["ok",""]}`,
+			expectProblem: models.Problem{
+				Type:     ProblemValidation,
+				Title:    "Validation failed",
+				Status:   http.StatusBadRequest,
+				Detail:   "Invalid request body",
+				Instance: "/api/books",
+				Errors: []models.FieldError{
+					{Field: "genres[1]", Rule: "required", Message: "is required"},
+					{Field: "title", Rule: "required", Message: "is required"},
+					{Field: "year", Rule: "lte", Message: "must be at most 2100"},
+				},
+			},
+		},
+		{
+			name:    "wrong type",
+			handler: bc.UpdateBook,
+			method:  http.MethodPut,
+			target:  "/api/books/1",
+			id:      "1",
+			body:    `{"title":"Dune","author":"Frank Herbert","year":"1965"}`,
+			expectProblem: models.Problem{
+				Type:     ProblemValidation,
+				Title:    "Validation failed",
+				Status:   http.StatusBadRequest,
+				Detail:   "Invalid request body",
+				Instance: "/api/books/1",
+				Errors:   []models.FieldError{{Field: "year", Rule: "type", Message: "must be int"}},
+			},
+		},
+		{
+			name:    "malformed body",
+			handler: bc.CreateBook,
+			method:  http.MethodPost,
+			target:  "/api/books",
+			body:    `{"title":`,
+			expectProblem: models.Problem{
+				Type:     "about:blank",
+				Title:    "Bad Request",
+				Status:   http.StatusBadRequest,
+				Detail:   "Invalid request body: unexpected EOF",
+				Instance: "/api/books",
+			},
+		},
+		{
+			name:    "patched book invalid",
+			handler: bc.PatchBook,
+			method:  http.MethodPatch,
+			target:  "/api/books/1",
+			id:      "1",
+			body:    `{"title":null}`,
+			expectProblem: models.Problem{
+				Type:     ProblemValidation,
+				Title:    "Validation failed",
+				Status:   http.StatusUnprocessableEntity,
+				Detail:   "The patched book is invalid",
+				Instance: "/api/books/1",
+				Errors:   []models.FieldError{{Field: "title", Rule: "required", Message: "is required"}},
+			},
+		},
+		{
+			name:    "not found",
+			handler: bc.GetBook,
+			method:  http.MethodGet,
+			target:  "/api/books/9",
+			id:      "9",
+			expectProblem: models.Problem{
+				Type:     "about:blank",
+				Title:    "Not Found",
+				Status:   http.StatusNotFound,
+				Detail:   "Book not found",
+				Instance: "/api/books/9",
+			},
+		},
+		{
+			name:    "no route",
+			handler: NotFound,
+			method:  http.MethodGet,
+			target:  "/api/shelves",
+			expectProblem: models.Problem{
+				Type:     "about:blank",
+				Title:    "Not Found",
+				Status:   http.StatusNotFound,
+				Detail:   "No endpoint matches GET /api/shelves",
+				Instance: "/api/shelves",
+			},
+		},
+		{
+			name:    "panic",
+			handler: func(c *gin.Context) { Recover(c, "boom") },
+			method:  http.MethodGet,
+			target:  "/api/books",
+			expectProblem: models.Problem{
+				Type:     "about:blank",
+				Title:    "Internal Server Error",
+				Status:   http.StatusInternalServerError,
+				Detail:   "The server failed to handle the request",
+				Instance: "/api/books",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.id != "" {
+				c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			}
+			c.Request, _ = http.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Header("X-Request-ID", "req-1")
+			tt.handler(c)
+
+			assert.Equal(t, tt.expectProblem.Status, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.True(t, c.IsAborted())
+			var problem models.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			tt.expectProblem.RequestID = "req-1"
+			assert.Equal(t, tt.expectProblem, problem)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/controllers"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+const exportUsage = "usage: byfood [flags] export [--format csv|ndjson|json] [--author NAME] [--title TEXT] [--year-from N] [--year-to N] [--output FILE|-]"
+
+// runExport implements the export subcommand. A file is written under a
+// temporary name and renamed once the export is complete, so a failed
+// export never leaves a truncated file behind.
+func runExport(ctx context.Context, cfg models.AppConfig, db *gorm.DB, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(w)
+	var opts controllers.ExportOptions
+	fs.StringVar(&opts.Format, "format", "", "file format, csv, ndjson or json; taken from the output file extension by default")
+	fs.StringVar(&opts.Filter.Author, "author", "", "only export books by this author")
+	fs.StringVar(&opts.Filter.Title, "title", "", "only export books whose title contains this text")
+	yearFrom := fs.Int("year-from", 0, "only export books published in or after this year")
+	yearTo := fs.Int("year-to", 0, "only export books published in or before this year")
+	path := fs.String("output", "-", "file to write, or - for standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New(exportUsage)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "year-from":
+			opts.Filter.YearFrom = yearFrom
+		case "year-to":
+			opts.Filter.YearTo = yearTo
+		}
+	})
+	if opts.Format == "" {
+		switch strings.ToLower(filepath.Ext(*path)) {
+		case ".csv":
+			opts.Format = controllers.ExportCSV
+		case ".ndjson", ".jsonl":
+			opts.Format = controllers.ExportNDJSON
+		default:
+			opts.Format = controllers.ExportJSON
+		}
+	}
+	if opts.Format != controllers.ExportCSV && opts.Format != controllers.ExportNDJSON && opts.Format != controllers.ExportJSON {
+		return fmt.Errorf("unknown format %q, use csv, ndjson or json", opts.Format)
+	}
+	if err := checkSchemaReadOnly(db); err != nil {
+		return err
+	}
+
+	repo := repository.NewGormBookRepository(db)
+	books := controllers.NewBookController(repo, repo.Authors(),
+		controllers.BookOptions{})
+	if *path == "-" {
+		out := bufio.NewWriter(w)
+		if _, err := books.Export(ctx, out, opts); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(*path), "."+filepath.Base(*path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	out := bufio.NewWriter(f)
+	n, err := books.Export(ctx, out, opts)
+	if err == nil {
+		err = out.Flush()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), *path); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "Exported %d books to %s\n", n, *path)
+	return nil
+}
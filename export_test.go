@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/config"
+)
+
+func TestRunCommandExport(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Defaults()
+	cfg.LogLevel = "error"
+	cfg.AutoMigrate = true
+	cfg.Database.DSN = filepath.Join(dir, "books.db")
+
+	books := filepath.Join(dir, "books.csv")
+	require.NoError(t, os.WriteFile(books, []byte("title,authors,year\n"+
+		"Emma,Jane Austen,1815\n"+
+		"Good Omens,Terry Pratchett; Neil Gaiman,1990\n"), 0o600))
+	var out bytes.Buffer
+	require.Equal(t, exitOK, runCommand(cfg, []string{"import", books}, &out), out.String())
+
+	exported := filepath.Join(dir, "export.ndjson")
+	steps := []struct {
+		args         []string
+		expectCode   int
+		expectOutput []string
+	}{
+		{
+			args:         []string{"export", "--output", exported},
+			expectCode:   exitOK,
+			expectOutput: []string{"Exported 2 books to " + exported},
+		},
+		{
+			args:         []string{"export", "--format", "csv", "--year-from", "1900"},
+			expectCode:   exitOK,
+			expectOutput: []string{"id,title,authors,year", "Good Omens,Terry Pratchett; Neil Gaiman,1990"},
+		},
+		{
+			args:         []string{"export", "--format", "xlsx"},
+			expectCode:   exitError,
+			expectOutput: []string{`unknown format "xlsx"`},
+		},
+		{
+			args:         []string{"export", books},
+			expectCode:   exitError,
+			expectOutput: []string{exportUsage},
+		},
+	}
+
+	for _, step := range steps {
+		var out bytes.Buffer
+		code := runCommand(cfg, step.args, &out)
+		assert.Equal(t, step.expectCode, code, step.args)
+		for _, s := range step.expectOutput {
+			assert.Contains(t, out.String(), s, step.args)
+		}
+	}
+
+	written, err := os.ReadFile(exported)
+	require.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(written, []byte("\n")))
+	assert.Contains(t, string(written), `"title":"Emma"`)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "temporary export files are removed")
+}
+
+func TestRunCommandExportRefusesOutdatedSchema(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.LogLevel = "error"
+	cfg.AutoMigrate = true
+	cfg.Database.DSN = filepath.Join(t.TempDir(), "books.db")
+	var out bytes.Buffer
+	require.Equal(t, exitOK, runCommand(cfg, []string{"migrate", "to", "4"}, &out), out.String())
+
+	out.Reset()
+	assert.Equal(t, exitError, runCommand(cfg, []string{"export", "--format", "csv"}, &out))
+	assert.Contains(t, out.String(), "run `byfood migrate up` first")
+
+	out.Reset()
+	require.Equal(t, exitOK, runCommand(cfg, []string{"migrate", "status"}, &out), out.String())
+	assert.Contains(t, out.String(), "0005_create_authors  pending", "the export does not migrate")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/controllers"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+const importUsage = "usage: byfood [flags] import [--format csv|ndjson] [--strategy skip|upsert] [--dry-run] [--map Header=field]... [--report FILE] FILE|-"
+
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// runImport implements the import subcommand. Rejected rows are listed on w,
+// or written to the --report file, and make the command fail once the rest
+// of the file has been imported.
+func runImport(ctx context.Context, cfg models.AppConfig, db *gorm.DB, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(w)
+	var opts controllers.ImportOptions
+	fs.StringVar(&opts.Format, "format", "", "file format, csv or ndjson; taken from the file extension by default")
+	fs.StringVar(&opts.Strategy, "strategy", controllers.ImportSkip, "what to do with rows whose ISBN is taken: skip or upsert")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "check the file without storing anything")
+	fs.Var((*stringList)(&opts.Columns), "map", "map a CSV column to a book field, as Header=field; may be repeated")
+	reportPath := fs.String("report", "", "write the rejected rows to this CSV file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+	path := fs.Arg(0)
+	if opts.Format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			opts.Format = controllers.ImportCSV
+		case ".ndjson", ".jsonl":
+			opts.Format = controllers.ImportNDJSON
+		default:
+			return fmt.Errorf("cannot tell the format of %s, use --format", path)
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+	if err := checkSchema(db, cfg.AutoMigrate); err != nil {
+		return err
+	}
+
+	var report *controllers.ImportReport
+	if *reportPath != "" {
+		out, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = out.Close() }()
+		report = controllers.NewImportReport(out)
+	}
+	repo := repository.NewGormBookRepository(db)
+	books := controllers.NewBookController(repo, repo.Authors(),
+		controllers.BookOptions{KnownAuthorsOnly: cfg.KnownAuthorsOnly})
+	summary, err := books.Import(ctx, in, opts, func(e models.ImportError) {
+		switch {
+		case report != nil:
+			report.Add(e)
+		case e.Field != "":
+			_, _ = fmt.Fprintf(w, "line %d: %s %s\n", e.Line, e.Field, e.Error)
+		default:
+			_, _ = fmt.Fprintf(w, "line %d: %s\n", e.Line, e.Error)
+		}
+	})
+	if report != nil {
+		if flushErr := report.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if summary.DryRun {
+		verb = "Checked"
+	}
+	_, _ = fmt.Fprintf(w, "%s %d rows: %d created, %d updated, %d skipped, %d rejected\n",
+		verb, summary.Rows, summary.Created, summary.Updated, summary.Skipped, summary.Rejected)
+	if len(summary.IgnoredColumns) > 0 {
+		_, _ = fmt.Fprintf(w, "Ignored columns: %s\n", strings.Join(summary.IgnoredColumns, ", "))
+	}
+	if summary.DryRun {
+		_, _ = fmt.Fprintln(w, "Dry run, nothing was stored")
+	}
+	if summary.Rejected > 0 {
+		return fmt.Errorf("%d rows were rejected", summary.Rejected)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/config"
+)
+
+func TestRunCommandImport(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Defaults()
+	cfg.LogLevel = "error"
+	cfg.AutoMigrate = true
+	cfg.Database.DSN = filepath.Join(dir, "books.db")
+
+	books := filepath.Join(dir, "books.csv")
+	require.NoError(t, os.WriteFile(books, []byte("Name,Author,Year,ISBN\n"+
+		"Emma,Jane Austen,1815,0-306-40615-2\n"+
+		"Persuasion,Jane Austen,18017,\n"), 0o600))
+	updates := filepath.Join(dir, "updates.txt")
+	require.NoError(t, os.WriteFile(updates, []byte(`{"title":"Emma (1816)","author":"Jane Austen","isbn":"9780306406157"}`+"\n"), 0o600))
+	report := filepath.Join(dir, "errors.csv")
+
+	steps := []struct {
+		args         []string
+		expectCode   int
+		expectOutput []string
+	}{
+		{
+			args:         []string{"import", "--dry-run", "--map", "Name=title", books},
+			expectCode:   exitError,
+			expectOutput: []string{"line 3: year must be at most 2100", "Checked 2 rows: 1 created, 0 updated, 0 skipped, 1 rejected", "Dry run, nothing was stored", "1 rows were rejected"},
+		},
+		{
+			args:         []string{"import", "--map", "Name=title", "--report", report, books},
+			expectCode:   exitError,
+			expectOutput: []string{"Imported 2 rows: 1 created, 0 updated, 0 skipped, 1 rejected"},
+		},
+		{
+			args:         []string{"import", "--map", "Name=title", books},
+			expectCode:   exitError,
+			expectOutput: []string{"Imported 2 rows: 0 created, 0 updated, 1 skipped, 1 rejected"},
+		},
+		{
+			args:         []string{"import", "--format", "ndjson", "--strategy", "upsert", updates},
+			expectCode:   exitOK,
+			expectOutput: []string{"Imported 1 rows: 0 created, 1 updated, 0 skipped, 0 rejected"},
+		},
+		{
+			args:         []string{"import", updates},
+			expectCode:   exitError,
+			expectOutput: []string{"cannot tell the format of"},
+		},
+		{
+			args:         []string{"import", books},
+			expectCode:   exitError,
+			expectOutput: []string{"no column maps to title"},
+		},
+		{
+			args:         []string{"import"},
+			expectCode:   exitError,
+			expectOutput: []string{importUsage},
+		},
+	}
+
+	for _, step := range steps {
+		var out bytes.Buffer
+		code := runCommand(cfg, step.args, &out)
+		assert.Equal(t, step.expectCode, code, step.args)
+		for _, s := range step.expectOutput {
+			assert.Contains(t, out.String(), s, step.args)
+		}
+	}
+
+	written, err := os.ReadFile(report)
+	require.NoError(t, err)
+	assert.Equal(t, "line,field,error,record\n3,year,must be at most 2100,\"Persuasion,Jane Austen,18017,\"\n", string(written))
+}
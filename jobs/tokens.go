@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// PurgeRefreshTokens deletes the refresh tokens that have expired, once on
+// start and then every interval, until ctx is done. Failures are logged and
+// retried on the next run.
+func PurgeRefreshTokens(ctx context.Context, users repository.UserRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purgeRefreshTokens(ctx, users)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeRefreshTokens(ctx context.Context, users repository.UserRepository) {
+	n, err := users.PurgeRefreshTokens(ctx, time.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to purge refresh tokens", "error", err)
+		}
+		return
+	}
+	if n > 0 {
+		slog.Info("Purged expired refresh tokens", "purged", n)
+	}
+}
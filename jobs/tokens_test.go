@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+func TestPurgeRefreshTokens(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	users := repository.NewMemoryUserRepository(models.User{Email: "ada@example.com", PasswordHash: "x"})
+	expired := strings.Repeat("a", 64)
+	live := strings.Repeat("b", 64)
+	require.NoError(t, users.CreateRefreshToken(ctx, &models.RefreshToken{UserID: 1, Hash: expired, ExpiresAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, users.CreateRefreshToken(ctx, &models.RefreshToken{UserID: 1, Hash: live, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	done := make(chan struct{})
+	go func() {
+		PurgeRefreshTokens(ctx, users, 10*time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, err := users.UseRefreshToken(ctx, expired)
+		return errors.Is(err, repository.ErrNotFound)
+	}, time.Second, 5*time.Millisecond)
+	_, err := users.UseRefreshToken(ctx, live)
+	assert.NoError(t, err, "tokens that have not expired are kept")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("PurgeRefreshTokens did not stop after cancellation")
+	}
+}
@@ -0,0 +1,40 @@
+// Package jobs holds the background work the server runs next to the API.
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/burhangltekin/byfood/repository"
+)
+
+// PurgeTrash permanently deletes the books that have been in the trash for
+// longer than retention, once on start and then every interval, until ctx is
+// done. Failures are logged and retried on the next run.
+func PurgeTrash(ctx context.Context, books repository.BookRepository, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purgeTrash(ctx, books, retention)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeTrash(ctx context.Context, books repository.BookRepository, retention time.Duration) {
+	before := time.Now().Add(-retention)
+	n, err := books.PurgeTrash(ctx, before)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to purge trash", "error", err)
+		}
+		return
+	}
+	if n > 0 {
+		slog.Info("Purged trash", "purged", n, "before", before)
+	}
+}
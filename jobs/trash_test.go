@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	books := repository.NewMemoryBookRepository(
+		models.Book{Title: "Old", Author: "A"},
+		models.Book{Title: "Live", Author: "A"},
+	)
+	require.NoError(t, books.Delete(ctx, 1, 0))
+
+	done := make(chan struct{})
+	go func() {
+		PurgeTrash(ctx, books, 0, 10*time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		n, err := books.Count(ctx, repository.BookFilter{Trashed: true})
+		return err == nil && n == 0
+	}, time.Second, 5*time.Millisecond)
+	n, err := books.Count(ctx, repository.BookFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("PurgeTrash did not stop after cancellation")
+	}
+}
+
+func TestPurgeTrashKeepsRecentBooks(t *testing.T) {
+	ctx := context.Background()
+	books := repository.NewMemoryBookRepository(models.Book{Title: "Recent", Author: "A"})
+	require.NoError(t, books.Delete(ctx, 1, 0))
+
+	purgeTrash(ctx, books, time.Hour)
+
+	n, err := books.Count(ctx, repository.BookFilter{Trashed: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
@@ -1,24 +1,41 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
 
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/controllers"
+	"github.com/burhangltekin/byfood/jobs"
+	"github.com/burhangltekin/byfood/middleware"
+	"github.com/burhangltekin/byfood/migrations"
 	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/ratelimit"
+	"github.com/burhangltekin/byfood/repository"
 	"github.com/burhangltekin/byfood/routes"
 	"github.com/burhangltekin/byfood/utils"
 )
 
 // @title           ByFood API
 // @version         1.0
-// @description     API for managing books in ByFood.
+// @description     API for managing books in ByFood. Errors are answered with RFC 7807 Problem Details, the default response of every operation. Operations need an API key or a bearer token unless they list no security, and answer 401 without one and 403 when its role is not allowed. Clients over their rate limit get 429.
 // @termsOfService  TBD
 
 // @contact.name   API Support
@@ -29,31 +46,258 @@ import (
 // @license.url   https://opensource.org/licenses/MIT
 
 // @host      localhost:8080
-// @BasePath  /api
+// @BasePath  /api/v1
+
+// @securityDefinitions.apikey  ApiKeyAuth
+// @in                          header
+// @name                        X-API-Key
+// @description                 API key created with `byfood apikey create NAME ROLE`.
+
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+// @description                 JWT bearer token, such as the access token from /auth/login, sent as "Bearer TOKEN".
+
+// @security  ApiKeyAuth
+// @security  BearerAuth
 
 func main() {
-	config, err := loadConfig("config.yaml")
+	cfg, opts, err := config.Resolve(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if opts.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("Failed to print config: %v", err)
+		}
+	}
+	if err := config.Validate(cfg); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if opts.PrintConfig {
+		return
+	}
+	store := config.NewStore(cfg)
+	setupLogging(store)
+	slog.Debug("Loaded config", "path", opts.ConfigPath)
 
-	if err := setupApp(config); err != nil {
-		log.Fatalf("Failed to set up app: %v", err)
+	if len(opts.Args) > 0 {
+		os.Exit(runCommand(cfg, opts.Args, os.Stdout))
 	}
 
-	r := gin.Default()
-	r.Use(gin.Logger())
+	db, err := setupApp(cfg)
+	if err != nil {
+		slog.Error("Failed to set up app", "error", err)
+		os.Exit(exitError)
+	}
+	books := repository.NewGormBookRepository(db)
+	authors := books.Authors()
+	bookCtrl := controllers.NewBookController(books, authors, controllers.BookOptions{
+		CursorSecret:     []byte(cfg.CursorSecret),
+		RequireIfMatch:   cfg.RequireIfMatch,
+		KnownAuthorsOnly: cfg.KnownAuthorsOnly,
+	})
+	store.OnChange(func(cfg models.AppConfig) {
+		bookCtrl.Reconfigure(controllers.BookOptions{RequireIfMatch: cfg.RequireIfMatch, KnownAuthorsOnly: cfg.KnownAuthorsOnly})
+	})
+	users := repository.NewGormUserRepository(db)
+	ctrls := routes.Controllers{
+		Books:    bookCtrl,
+		Authors:  controllers.NewAuthorController(authors, bookCtrl),
+		Admin:    controllers.NewAdminController(store, books),
+		Accounts: setupAccounts(cfg.Auth, users),
+	}
+	security, err := setupSecurity(cfg.Auth, repository.NewGormAPIKeyRepository(db))
+	if err != nil {
+		failStartup(db, "Failed to set up authentication", err)
+	}
+	security.Limiter = ratelimit.NewMemoryStore()
+	security.Config = store
 
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	router, err := setupRouter(store, ctrls, security)
+	if err != nil {
+		failStartup(db, "Failed to set up router", err)
+	}
+	srv := &http.Server{Handler: router}
+	ln, err := listen(cfg)
+	if err != nil {
+		failStartup(db, "Server failed to start", err)
+	}
 
-	routes.SetupRoutes(r)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go config.Watch(ctx, store, opts.ConfigPath, configPollInterval, func() (models.AppConfig, error) {
+		next, _, err := config.Resolve(os.Args[1:], os.LookupEnv)
+		return next, err
+	})
+	if cfg.TrashRetention > 0 {
+		go jobs.PurgeTrash(ctx, books, time.Duration(cfg.TrashRetention)*24*time.Hour, trashPurgeInterval)
+	}
+	if cfg.Auth.Users.Enabled {
+		go jobs.PurgeRefreshTokens(ctx, users, tokenPurgeInterval)
+	}
+
+	slog.Info("Starting server", "addr", ln.Addr().String(), "tls", cfg.TLS.Enabled, "apiVersion", cfg.APIVersion)
+	code := serve(ctx, srv, ln, db, time.Duration(cfg.ShutdownTimeout)*time.Second)
+	stop()
+	os.Exit(code)
+}
+
+// failStartup logs err under msg, closes db and exits with exitError. It
+// stands in for log.Fatalf once the database is open, which would exit
+// without closing it.
+func failStartup(db *gorm.DB, msg string, err error) {
+	slog.Error(msg, "error", err)
+	if err := utils.CloseDB(db); err != nil {
+		slog.Error("Failed to close database", "error", err)
+	}
+	os.Exit(exitError)
+}
+
+// listen opens the configured listen address, wrapped in TLS when enabled.
+func listen(cfg models.AppConfig) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	ln, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// Exit codes returned by serve.
+const (
+	exitOK              = 0
+	exitError           = 1
+	exitShutdownTimeout = 2
+)
+
+// serve runs srv on ln until ctx is cancelled, then stops accepting new
+// connections and waits up to timeout for in-flight requests before closing
+// the database. It returns exitShutdownTimeout if requests were still running
+// when the timeout expired.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, db *gorm.DB, timeout time.Duration) int {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	code := exitOK
+	select {
+	case err := <-errCh:
+		slog.Error("Server stopped unexpectedly", "error", err)
+		code = exitError
+	case <-ctx.Done():
+		slog.Info("Shutting down", "timeout", timeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Graceful shutdown did not complete, closing remaining connections", "error", err)
+			_ = srv.Close()
+			code = exitShutdownTimeout
+		}
+	}
+
+	if db != nil {
+		if err := utils.CloseDB(db); err != nil {
+			slog.Error("Failed to close database", "error", err)
+			if code == exitOK {
+				code = exitError
+			}
+		}
+	}
+	slog.Info("Server stopped", "exitCode", code)
+	return code
+}
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = 2 * time.Second
+
+// trashPurgeInterval is how often books past the trash retention are purged.
+const trashPurgeInterval = time.Hour
+
+// tokenPurgeInterval is how often expired refresh tokens are purged.
+const tokenPurgeInterval = time.Hour
+
+// setupLogging applies the configured log level to the application logger
+// and follows later changes to it. Gin runs in debug mode only when debug
+// logging is configured at startup.
+func setupLogging(store *config.Store) {
+	var level slog.LevelVar
+	apply := func(cfg models.AppConfig) {
+		l, _ := config.ParseLogLevel(cfg.LogLevel)
+		level.Set(l)
+	}
+	apply(store.Config())
+	store.OnChange(apply)
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &level})))
+	if level.Level() == slog.LevelDebug {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+}
+
+// setupSecurity builds the protection of the routes selected by cfg, with
+// API keys looked up in keys as well as in cfg.
+func setupSecurity(cfg models.AuthConfig, keys auth.KeyStore) (routes.Security, error) {
+	if !cfg.Enabled {
+		slog.Warn("Authentication is disabled; anyone who can reach the server can change the catalogue")
+		return routes.Security{}, nil
+	}
+	a, err := auth.New(cfg, keys)
+	if err != nil {
+		return routes.Security{}, err
+	}
+	return routes.Security{Authenticator: a}, nil
+}
+
+// setupAccounts returns the controller of the user account endpoints
+// selected by cfg, keeping accounts in users, or nil when user accounts are
+// disabled.
+func setupAccounts(cfg models.AuthConfig, users repository.UserRepository) *controllers.AccountController {
+	if !cfg.Users.Enabled {
+		return nil
+	}
+	if !cfg.Enabled {
+		slog.Warn("User accounts are enabled but authentication is not; access tokens are issued but never required")
+	}
+	u := cfg.Users
+	tokens := auth.NewTokenIssuer(cfg.JWT, time.Duration(u.AccessTokenTTL)*time.Second)
+	return controllers.NewAccountController(users, tokens, controllers.AccountOptions{
+		Registration:    u.Registration,
+		RefreshTokenTTL: time.Duration(u.RefreshTokenTTL) * 24 * time.Hour,
+		MaxFailedLogins: u.MaxFailedLogins,
+		LockoutDuration: time.Duration(u.LockoutDuration) * time.Second,
+	})
+}
+
+// setupRouter builds the Gin engine with the middleware and routes selected
+// by the live configuration. Only the configured trusted proxies may tell
+// the address of the client in X-Forwarded-For or X-Real-IP.
+func setupRouter(store *config.Store, ctrls routes.Controllers, security routes.Security) (*gin.Engine, error) {
+	r := gin.New()
+	if err := r.SetTrustedProxies(store.Config().TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trustedProxies: %w", err)
+	}
+	r.Use(middleware.RequestID())
+	r.Use(gin.CustomRecovery(controllers.Recover))
+	r.Use(middleware.RequestLogging(store))
+	r.Use(middleware.CORS(store))
+
+	routes.SetupRoutes(r, store.Config().APIVersion, ctrls, security)
 
 	r.GET("/swagger/*any", func(c *gin.Context) {
 		if c.Request.URL.Path == "/swagger/doc.json" {
@@ -62,36 +306,53 @@ func main() {
 		}
 		ginSwagger.WrapHandler(swaggerFiles.Handler)(c)
 	})
+	return r, nil
+}
 
-	log.Println("Starting server on :8080")
-	if err := r.Run(":8080"); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+// setupApp connects to the database and makes sure its schema is current,
+// applying pending migrations when autoMigrate is set. It fails if the
+// database is unreachable or the schema is not usable, so that the server
+// never starts without a working database.
+func setupApp(cfg models.AppConfig) (*gorm.DB, error) {
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s database is unreachable: %w", cfg.Database.Driver, err)
+	}
+	if err := checkSchema(db, cfg.AutoMigrate); err != nil {
+		_ = utils.CloseDB(db)
+		return nil, err
 	}
+	return db, nil
 }
 
-func setupApp(config models.AppConfig) error {
-	if config.AutoMigrate {
-		if err := utils.InitDB(); err != nil {
-			log.Fatalf("Database initialization failed: %v", err)
-		}
-	}
-	return nil
+func checkSchema(db *gorm.DB, autoMigrate bool) error {
+	return ensureSchema(db, autoMigrate, "run `byfood migrate up` or enable autoMigrate")
+}
+
+// checkSchemaReadOnly is checkSchema for commands that only read the
+// database, which refuse to run on an outdated schema rather than migrate it.
+func checkSchemaReadOnly(db *gorm.DB) error {
+	return ensureSchema(db, false, "run `byfood migrate up` first")
 }
 
-func loadConfig(path string) (models.AppConfig, error) {
-	var config models.AppConfig
-	f, err := os.Open(path)
+func ensureSchema(db *gorm.DB, autoMigrate bool, hint string) error {
+	migrator, err := migrations.New(db)
 	if err != nil {
-		return config, err
+		return err
 	}
-	defer func() {
-		if cerr := f.Close(); cerr != nil {
-			log.Printf("Warning: failed to close config file: %v", cerr)
-		}
-	}()
-	decoder := yaml.NewDecoder(f)
-	if err := decoder.Decode(&config); err != nil {
-		return config, err
+	applied, err := migrator.Ensure(context.Background(), autoMigrate)
+	if errors.Is(err, migrations.ErrSchemaBehind) {
+		return fmt.Errorf("%w; %s", err, hint)
 	}
-	return config, nil
+	if err != nil {
+		return err
+	}
+	for _, m := range applied {
+		slog.Info("Applied migration", "migration", m.String())
+	}
+	if !db.Migrator().HasTable(&models.Book{}) {
+		return errors.New("database schema has no books table; it may have been dropped by hand, " +
+			"run `byfood migrate to 0` and `byfood migrate up` to recreate it")
+	}
+	return nil
 }
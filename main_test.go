@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/controllers"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+	"github.com/burhangltekin/byfood/routes"
+	"github.com/burhangltekin/byfood/utils"
+)
+
+func testConfig() models.AppConfig {
+	return models.AppConfig{
+		LogLevel:        "error",
+		CORSOrigins:     []string{"http://allowed.example"},
+		APIVersion:      "v2",
+		ShutdownTimeout: 1,
+	}
+}
+
+func TestSetupRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	books := controllers.NewBookController(repository.NewMemoryBookRepository(), nil, controllers.BookOptions{})
+
+	tests := []struct {
+		name         string
+		origins      []string
+		path         string
+		origin       string
+		expectStatus int
+		expectOrigin string
+		expectCreds  string
+	}{
+		{
+			name:         "routes mounted under api version",
+			origins:      []string{"http://allowed.example"},
+			path:         "/api/v2/books",
+			origin:       "http://allowed.example",
+			expectStatus: http.StatusOK,
+			expectOrigin: "http://allowed.example",
+			expectCreds:  "true",
+		},
+		{
+			name:         "unversioned path is not served",
+			origins:      []string{"http://allowed.example"},
+			path:         "/api/books",
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "other api version is not served",
+			origins:      []string{"http://allowed.example"},
+			path:         "/api/v1/books",
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "disallowed origin",
+			origins:      []string{"http://allowed.example"},
+			path:         "/api/v2/books",
+			origin:       "http://evil.example",
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "wildcard origin without credentials",
+			origins:      []string{"*"},
+			path:         "/api/v2/books",
+			origin:       "http://anywhere.example",
+			expectStatus: http.StatusOK,
+			expectOrigin: "*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CORSOrigins = tt.origins
+			r, err := setupRouter(config.NewStore(cfg), routes.Controllers{Books: books}, routes.Security{})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectStatus, w.Code)
+			assert.Equal(t, tt.expectOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.expectCreds, w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+		})
+	}
+}
+
+func TestSetupRouterTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := testConfig()
+	cfg.TrustedProxies = []string{"10.0.0.1"}
+	r, err := setupRouter(config.NewStore(cfg), routes.Controllers{}, routes.Security{})
+	require.NoError(t, err)
+	r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+	for remoteAddr, expectIP := range map[string]string{
+		"10.0.0.1:1234":  "192.0.2.1",
+		"192.0.2.9:1234": "192.0.2.9",
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "192.0.2.1")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, expectIP, w.Body.String(), remoteAddr)
+	}
+
+	cfg.TrustedProxies = []string{"not-an-ip"}
+	_, err = setupRouter(config.NewStore(cfg), routes.Controllers{}, routes.Security{})
+	assert.ErrorContains(t, err, "trustedProxies")
+}
+
+func TestSetupSecurity(t *testing.T) {
+	security, err := setupSecurity(models.AuthConfig{AnonymousReads: true}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, security.Authenticator, "disabled authentication lets every request through")
+
+	security, err = setupSecurity(models.AuthConfig{Enabled: true, AnonymousReads: true}, repository.NewMemoryAPIKeyRepository())
+	require.NoError(t, err)
+	assert.NotNil(t, security.Authenticator)
+
+	_, err = setupSecurity(models.AuthConfig{Enabled: true, JWT: models.JWTConfig{JWKSFile: "missing.json"}}, nil)
+	assert.ErrorContains(t, err, "failed to read JWKS")
+}
+
+func TestSetupAccounts(t *testing.T) {
+	cfg := config.Defaults().Auth
+	assert.Nil(t, setupAccounts(cfg, repository.NewMemoryUserRepository()), "user accounts are disabled by default")
+
+	cfg.Enabled = true
+	cfg.Users.Enabled = true
+	cfg.JWT.HMACSecret = strings.Repeat("s", 32)
+	assert.NotNil(t, setupAccounts(cfg, repository.NewMemoryUserRepository()))
+}
+
+func TestServeShutdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		handlerDelay time.Duration
+		timeout      time.Duration
+		expectCode   int
+		expectBody   bool
+	}{
+		{
+			name:         "drains in-flight request",
+			handlerDelay: 100 * time.Millisecond,
+			timeout:      5 * time.Second,
+			expectCode:   exitOK,
+			expectBody:   true,
+		},
+		{
+			name:         "deadline exceeded",
+			handlerDelay: 2 * time.Second,
+			timeout:      50 * time.Millisecond,
+			expectCode:   exitShutdownTimeout,
+			expectBody:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+			require.NoError(t, err)
+
+			started := make(chan struct{})
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				select {
+				case <-time.After(tt.handlerDelay):
+					_, _ = io.WriteString(w, "done")
+				case <-r.Context().Done():
+				}
+			})}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			codeCh := make(chan int, 1)
+			go func() {
+				codeCh <- serve(ctx, srv, ln, db, tt.timeout)
+			}()
+
+			bodyCh := make(chan string, 1)
+			go func() {
+				resp, err := http.Get("http://" + ln.Addr().String())
+				if err != nil {
+					bodyCh <- ""
+					return
+				}
+				defer resp.Body.Close()
+				b, _ := io.ReadAll(resp.Body)
+				bodyCh <- string(b)
+			}()
+
+			<-started
+			cancel()
+
+			assert.Equal(t, tt.expectCode, <-codeCh)
+			if tt.expectBody {
+				assert.Equal(t, "done", <-bodyCh)
+			} else {
+				assert.Empty(t, <-bodyCh)
+			}
+
+			// New connections are refused and the database is closed.
+			_, err = http.Get("http://" + ln.Addr().String())
+			assert.Error(t, err)
+			sqlDB, _ := db.DB()
+			assert.Error(t, sqlDB.Ping())
+		})
+	}
+}
+
+func TestSetupApp(t *testing.T) {
+	tests := []struct {
+		name        string
+		autoMigrate bool
+		prepare     func(t *testing.T, cfg models.AppConfig)
+		expectError string
+	}{
+		{
+			name:        "auto-migrate creates the schema",
+			autoMigrate: true,
+		},
+		{
+			name: "migrated database without auto-migrate",
+			prepare: func(t *testing.T, cfg models.AppConfig) {
+				var out bytes.Buffer
+				require.Equal(t, exitOK, runCommand(cfg, []string{"migrate", "up"}, &out), out.String())
+			},
+		},
+		{
+			name:        "empty database without auto-migrate",
+			expectError: "database schema is behind: at version 0,",
+		},
+		{
+			name:        "unreachable database",
+			autoMigrate: true,
+			prepare: func(t *testing.T, cfg models.AppConfig) {
+				require.NoError(t, os.Mkdir(cfg.Database.DSN, 0o700))
+			},
+			expectError: "sqlite database is unreachable",
+		},
+		{
+			name: "books table dropped by hand",
+			prepare: func(t *testing.T, cfg models.AppConfig) {
+				var out bytes.Buffer
+				require.Equal(t, exitOK, runCommand(cfg, []string{"migrate", "up"}, &out), out.String())
+				db, err := utils.OpenDB(cfg)
+				require.NoError(t, err)
+				require.NoError(t, db.Migrator().DropTable("books"))
+				require.NoError(t, utils.CloseDB(db))
+			},
+			expectError: "database schema has no books table",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Defaults()
+			cfg.LogLevel = "error"
+			cfg.AutoMigrate = tt.autoMigrate
+			cfg.Database.DSN = filepath.Join(t.TempDir(), "books.db")
+			if tt.prepare != nil {
+				tt.prepare(t, cfg)
+			}
+
+			db, err := setupApp(cfg)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				assert.Nil(t, db)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, db)
+			defer func() { _ = utils.CloseDB(db) }()
+
+			books := repository.NewGormBookRepository(db)
+			book := models.Book{Title: "Dune", Author: "Frank Herbert", Year: 1965}
+			require.NoError(t, books.Create(context.Background(), &book))
+			got, err := books.Get(context.Background(), book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, book, got)
+		})
+	}
+}
+
+// TestMigratedAuthorsMatchAPI checks that authors created from the books of
+// an older schema are found by the names the API is given.
+func TestMigratedAuthorsMatchAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Defaults()
+	cfg.LogLevel = "error"
+	cfg.AutoMigrate = true
+	cfg.Database.DSN = filepath.Join(t.TempDir(), "books.db")
+	var out bytes.Buffer
+	require.Equal(t, exitOK, runCommand(cfg, []string{"migrate", "to", "4"}, &out), out.String())
+	db, err := utils.OpenDB(cfg)
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`INSERT INTO books (title, author, year, version) VALUES ('Germinal', 'Émile  Zola', 1885, 1)`).Error)
+	require.NoError(t, utils.CloseDB(db))
+
+	db, err = setupApp(cfg)
+	require.NoError(t, err)
+	defer func() { _ = utils.CloseDB(db) }()
+	books := repository.NewGormBookRepository(db)
+	authors := books.Authors()
+	bookCtrl := controllers.NewBookController(books, authors, controllers.BookOptions{})
+	r, err := setupRouter(config.NewStore(cfg), routes.Controllers{
+		Books:   bookCtrl,
+		Authors: controllers.NewAuthorController(authors, bookCtrl),
+	}, routes.Security{})
+	require.NoError(t, err)
+
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/v1/authors", `{"name":"Émile Zola"}`)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	w = send(http.MethodPost, "/api/v1/books", `{"title":"Nana","author":"émile zola","year":1880}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var book models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	assert.Equal(t, "Émile Zola", book.Author)
+
+	w = send(http.MethodGet, "/api/v1/authors", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list models.AuthorListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, int64(1), list.Total)
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/controllers"
+)
+
+// authRealm names the protection space in authentication challenges.
+const authRealm = "byfood"
+
+// rejectedCredentialsKey is set in the gin context of requests whose
+// credentials Authenticate rejected, for LimitAuthFailures.
+const rejectedCredentialsKey = "byfood.rejectedCredentials"
+
+// challengeQuoting keeps reasons from breaking out of the quoted
+// error_description of a challenge.
+var challengeQuoting = strings.NewReplacer(`"`, "'", `\`, "")
+
+// Authenticate lets requests through whose credentials a accepts, storing
+// their principal in the request context (see auth.FromContext). Requests
+// without credentials are let through as anonymous when allowAnonymous is
+// set; requests with credentials that are not accepted never are. Rejected
+// requests get 401 with a WWW-Authenticate challenge for each accepted
+// scheme.
+func Authenticate(a *auth.Authenticator, allowAnonymous bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := a.Authenticate(c.Request)
+		switch {
+		case err == nil:
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), p))
+			c.Next()
+		case errors.Is(err, auth.ErrNoCredentials) && allowAnonymous:
+			c.Next()
+		case errors.Is(err, auth.ErrNoCredentials):
+			challenge(c, nil)
+			controllers.AbortWithProblem(c, http.StatusUnauthorized,
+				"Authentication required: send an API key in "+auth.APIKeyHeader+" or a bearer token")
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			slog.Info("Rejected credentials", "path", c.Request.URL.Path, "error", err)
+			c.Set(rejectedCredentialsKey, true)
+			challenge(c, err)
+			controllers.AbortWithProblem(c, http.StatusUnauthorized, "Authentication failed: "+err.Error())
+		default:
+			slog.Error("Failed to check credentials", "error", err)
+			controllers.AbortWithProblem(c, http.StatusInternalServerError, "Failed to check credentials")
+		}
+	}
+}
+
+// Authorize lets requests through whose principal has permission p and
+// answers 403 naming the permission otherwise. Anonymous requests, which
+// Authenticate only lets through on routes open to them, are not checked.
+func Authorize(p auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auth.Allowed(c.Request.Context(), p) {
+			c.Next()
+			return
+		}
+		pr, _ := PrincipalOf(c)
+		slog.Info("Permission denied", "subject", pr.Subject, "roles", pr.Roles, "permission", p)
+		controllers.AbortWithProblem(c, http.StatusForbidden, auth.MissingPermission(p))
+	}
+}
+
+// PrincipalOf returns who the request was made by, unless it was anonymous.
+func PrincipalOf(c *gin.Context) (auth.Principal, bool) {
+	return auth.FromContext(c.Request.Context())
+}
+
+// challenge adds the WWW-Authenticate challenges of the accepted schemes.
+// A rejected bearer token is reported as RFC 6750 describes.
+func challenge(c *gin.Context, err error) {
+	bearer := `Bearer realm="` + authRealm + `"`
+	if errors.Is(err, auth.ErrInvalidToken) {
+		bearer += `, error="invalid_token", error_description="` + challengeQuoting.Replace(err.Error()) + `"`
+	}
+	c.Writer.Header().Add("WWW-Authenticate", bearer)
+	c.Writer.Header().Add("WWW-Authenticate", `ApiKey realm="`+authRealm+`", header="`+auth.APIKeyHeader+`"`)
+}
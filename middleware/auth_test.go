@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	secret := strings.Repeat("s", 32)
+	a, err := auth.New(models.AuthConfig{
+		APIKeys: []models.APIKeyConfig{{Name: "ci", Hash: auth.HashAPIKey("key")}},
+		JWT:     models.JWTConfig{HMACSecret: secret},
+	}, nil)
+	require.NoError(t, err)
+	token, err := auth.SignHS256(auth.Claims{Subject: "alice", ExpiresAt: auth.NewNumericDate(time.Now().Add(time.Hour))}, []byte(secret))
+	require.NoError(t, err)
+	expired, err := auth.SignHS256(auth.Claims{Subject: "alice", ExpiresAt: auth.NewNumericDate(time.Now().Add(-time.Hour))}, []byte(secret))
+	require.NoError(t, err)
+
+	whoami := func(c *gin.Context) {
+		p, _ := PrincipalOf(c)
+		c.String(http.StatusOK, p.Subject)
+	}
+	r := gin.New()
+	r.GET("/open", Authenticate(a, true), whoami)
+	r.GET("/closed", Authenticate(a, false), whoami)
+
+	tests := []struct {
+		name            string
+		path            string
+		headers         map[string]string
+		expectCode      int
+		expectBody      string
+		expectChallenge string
+	}{
+		{name: "api key", path: "/closed", headers: map[string]string{"X-API-Key": "key"}, expectCode: http.StatusOK, expectBody: "ci"},
+		{name: "bearer token", path: "/closed", headers: map[string]string{"Authorization": "Bearer " + token}, expectCode: http.StatusOK, expectBody: "alice"},
+		{name: "anonymous allowed", path: "/open", expectCode: http.StatusOK, expectBody: ""},
+		{name: "anonymous", path: "/closed", expectCode: http.StatusUnauthorized, expectBody: "Authentication required", expectChallenge: `Bearer realm="byfood"`},
+		{name: "wrong key on open route", path: "/open", headers: map[string]string{"X-API-Key": "guess"}, expectCode: http.StatusUnauthorized, expectBody: "unknown API key", expectChallenge: `Bearer realm="byfood"`},
+		{
+			name: "expired token", path: "/closed", headers: map[string]string{"Authorization": "Bearer " + expired},
+			expectCode: http.StatusUnauthorized, expectBody: "token has expired",
+			expectChallenge: `Bearer realm="byfood", error="invalid_token", error_description="invalid credentials: invalid bearer token: token has expired"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectCode, w.Code)
+			if tt.expectChallenge == "" {
+				assert.Equal(t, tt.expectBody, w.Body.String())
+				assert.Empty(t, w.Header().Values("WWW-Authenticate"))
+				return
+			}
+			var problem models.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Contains(t, problem.Detail, tt.expectBody)
+			assert.Equal(t, []string{tt.expectChallenge, `ApiKey realm="byfood", header="X-API-Key"`}, w.Header().Values("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a, err := auth.New(models.AuthConfig{APIKeys: []models.APIKeyConfig{
+		{Name: "reader", Hash: auth.HashAPIKey("reader-key"), Role: models.RoleReader},
+		{Name: "admin", Hash: auth.HashAPIKey("admin-key"), Role: models.RoleAdmin},
+	}}, nil)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.DELETE("/books", Authenticate(a, false), Authorize(auth.BooksDelete), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	r.GET("/books", Authenticate(a, true), Authorize(auth.BooksRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name         string
+		method       string
+		key          string
+		expectCode   int
+		expectDetail string
+	}{
+		{name: "granted", method: http.MethodDelete, key: "admin-key", expectCode: http.StatusNoContent},
+		{name: "denied", method: http.MethodDelete, key: "reader-key", expectCode: http.StatusForbidden, expectDetail: "Missing permission books:delete, which requires the admin role"},
+		{name: "anonymous on open route", method: http.MethodGet, expectCode: http.StatusOK},
+		{name: "lower role on open route", method: http.MethodGet, key: "reader-key", expectCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/books", nil)
+			if tt.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.key)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectCode, w.Code)
+			if tt.expectDetail != "" {
+				var problem models.Problem
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+				assert.Equal(t, tt.expectDetail, problem.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/models"
+)
+
+// CORS applies the CORS origins of the live configuration, rebuilding the
+// underlying handler whenever the configuration is reloaded.
+func CORS(store *config.Store) gin.HandlerFunc {
+	var handler atomic.Pointer[gin.HandlerFunc]
+	build := func(cfg models.AppConfig) {
+		h := cors.New(CORSConfig(cfg.CORSOrigins))
+		handler.Store(&h)
+	}
+	build(store.Config())
+	store.OnChange(build)
+	return func(c *gin.Context) {
+		(*handler.Load())(c)
+	}
+}
+
+// CORSConfig allows the given origins. Credentials are only allowed for an
+// explicit origin list, since browsers reject them for a wildcard origin.
+func CORSConfig(origins []string) cors.Config {
+	c := cors.Config{
+		AllowMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"},
+		AllowHeaders:  []string{"Origin", "Content-Length", "Content-Type", "If-Match", "If-None-Match", "Authorization", auth.APIKeyHeader, RequestIDHeader},
+		ExposeHeaders: []string{"Content-Length", "ETag", "WWW-Authenticate", "Retry-After", RequestIDHeader, RateLimitLimitHeader, RateLimitRemainingHeader, RateLimitResetHeader},
+		MaxAge:        12 * time.Hour,
+	}
+	if len(origins) == 1 && origins[0] == "*" {
+		c.AllowAllOrigins = true
+	} else {
+		c.AllowOrigins = origins
+		c.AllowCredentials = true
+	}
+	return c
+}
+
+// RequestLogging logs requests while enableReqLogging is set in the live
+// configuration.
+func RequestLogging(store *config.Store) gin.HandlerFunc {
+	logger := gin.Logger()
+	return func(c *gin.Context) {
+		if store.Config().EnableReqLogging {
+			logger(c)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/config"
+)
+
+func TestCORSFollowsReload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Defaults()
+	cfg.CORSOrigins = []string{"http://old.example"}
+	store := config.NewStore(cfg)
+
+	r := gin.New()
+	r.Use(CORS(store))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("http://old.example").Code)
+	assert.Equal(t, http.StatusForbidden, request("http://new.example").Code)
+
+	cfg.CORSOrigins = []string{"http://new.example"}
+	_, _, err := store.Apply(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusForbidden, request("http://old.example").Code)
+	w := request("http://new.example")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "http://new.example", w.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/controllers"
+	"github.com/burhangltekin/byfood/ratelimit"
+)
+
+// Headers reporting the rate limit of a client, as drafted by the IETF
+// HTTPAPI working group. Reset is in seconds.
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+)
+
+// RateLimit lets each client make the requests limit allows to the routes
+// of group, telling clients apart by the principal Authenticate stored or by
+// IP address. Requests over the limit get 429 with Retry-After. limit is
+// called for every request, so that it follows configuration reloads, and
+// requests are let through when store fails.
+func RateLimit(store ratelimit.Store, group string, limit func() ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := limit()
+		if limit.Rate <= 0 {
+			c.Next()
+			return
+		}
+		res, err := store.Take(c.Request.Context(), group+":"+clientKey(c), limit)
+		if err != nil {
+			slog.Error("Failed to check rate limit", "group", group, "error", err)
+			c.Next()
+			return
+		}
+		h := c.Writer.Header()
+		h.Set(RateLimitLimitHeader, strconv.Itoa(limit.Burst))
+		h.Set(RateLimitRemainingHeader, strconv.Itoa(res.Remaining))
+		h.Set(RateLimitResetHeader, strconv.Itoa(ceilSeconds(res.Reset)))
+		if res.Allowed {
+			c.Next()
+			return
+		}
+		tooManyRequests(c, res.RetryAfter)
+	}
+}
+
+// LimitAuthFailures guards Authenticate, which must run next, against
+// credential guessing: once the requests from an IP address have been
+// rejected as often as limit allows, its requests get 429 before their
+// credentials are checked.
+func LimitAuthFailures(store ratelimit.Store, limit func() ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := limit()
+		if limit.Rate <= 0 {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		key := "auth-failures:ip:" + c.ClientIP()
+		res, err := store.Peek(ctx, key, limit)
+		if err != nil {
+			slog.Error("Failed to check authentication failures", "error", err)
+			c.Next()
+			return
+		}
+		if !res.Allowed {
+			slog.Info("Refusing credentials after repeated failures", "ip", c.ClientIP())
+			tooManyRequests(c, res.RetryAfter)
+			return
+		}
+		c.Next()
+		if c.GetBool(rejectedCredentialsKey) {
+			if _, err := store.Take(ctx, key, limit); err != nil {
+				slog.Error("Failed to count authentication failure", "error", err)
+			}
+		}
+	}
+}
+
+// tooManyRequests answers 429, telling the client to retry after wait.
+func tooManyRequests(c *gin.Context, wait time.Duration) {
+	retry := ceilSeconds(wait)
+	c.Writer.Header().Set("Retry-After", strconv.Itoa(retry))
+	controllers.AbortWithProblem(c, http.StatusTooManyRequests,
+		"Rate limit exceeded, retry in "+strconv.Itoa(retry)+" seconds")
+}
+
+// clientKey identifies who made the request. Clients behind a proxy are only
+// told apart when the engine trusts the proxy (see gin.Engine.SetTrustedProxies);
+// otherwise they share the address of the proxy.
+func clientKey(c *gin.Context) string {
+	if p, ok := PrincipalOf(c); ok {
+		return p.Method + ":" + p.Subject
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds rounds d up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
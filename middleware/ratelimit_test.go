@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/ratelimit"
+)
+
+// failingStore is a Store that is unreachable.
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func (failingStore) Peek(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+// fixed returns a limit that never changes.
+func fixed(limit ratelimit.Limit) func() ratelimit.Limit {
+	return func() ratelimit.Limit { return limit }
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Requests with an X-Subject header stand in for authenticated ones.
+	principal := func(c *gin.Context) {
+		if s := c.GetHeader("X-Subject"); s != "" {
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), auth.Principal{Subject: s, Method: auth.MethodAPIKey}))
+		}
+	}
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies([]string{"10.0.0.1"}))
+	store := ratelimit.NewMemoryStore()
+	r.GET("/books", principal, RateLimit(store, "read", fixed(ratelimit.PerMinute(60, 2))), ok)
+	r.GET("/authors", principal, RateLimit(store, "read", fixed(ratelimit.PerMinute(60, 2))), ok)
+	r.POST("/books", principal, RateLimit(store, "write", fixed(ratelimit.PerMinute(60, 2))), ok)
+	r.GET("/broken", RateLimit(failingStore{}, "read", fixed(ratelimit.PerMinute(60, 2))), ok)
+	r.GET("/unlimited", RateLimit(store, "read", fixed(ratelimit.Limit{})), ok)
+
+	send := func(method, path, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodGet, "/books", "192.0.2.1:1234", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(RateLimitLimitHeader))
+	assert.Equal(t, "1", w.Header().Get(RateLimitRemainingHeader))
+	assert.Equal(t, "1", w.Header().Get(RateLimitResetHeader))
+
+	// The routes of a group share the bucket of a client.
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/authors", "192.0.2.1:1234", nil).Code)
+	w = send(http.MethodGet, "/books", "192.0.2.1:5678", nil)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get(RateLimitRemainingHeader))
+	var problem models.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "Rate limit exceeded, retry in 1 seconds", problem.Detail)
+
+	tests := []struct {
+		name       string
+		method     string
+		remoteAddr string
+		headers    map[string]string
+		expectCode int
+	}{
+		{name: "other group", method: http.MethodPost, remoteAddr: "192.0.2.1:1234", expectCode: http.StatusOK},
+		{name: "other address", method: http.MethodGet, remoteAddr: "192.0.2.2:1234", expectCode: http.StatusOK},
+		{name: "principal rather than address", method: http.MethodGet, remoteAddr: "192.0.2.1:1234", headers: map[string]string{"X-Subject": "ci"}, expectCode: http.StatusOK},
+		{name: "forwarded by trusted proxy", method: http.MethodGet, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "192.0.2.3"}, expectCode: http.StatusOK},
+		{name: "forwarded for limited client", method: http.MethodGet, remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "192.0.2.1"}, expectCode: http.StatusTooManyRequests},
+		{name: "forwarding header from untrusted client", method: http.MethodGet, remoteAddr: "192.0.2.1:1234", headers: map[string]string{"X-Forwarded-For": "192.0.2.4"}, expectCode: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectCode, send(tt.method, "/books", tt.remoteAddr, tt.headers).Code)
+		})
+	}
+
+	w = send(http.MethodGet, "/broken", "192.0.2.1:1234", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "requests are let through when the store fails")
+	assert.Empty(t, w.Header().Get(RateLimitLimitHeader))
+
+	w = send(http.MethodGet, "/unlimited", "192.0.2.1:1234", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(RateLimitLimitHeader), "a zero limit is not checked")
+}
+
+func TestLimitAuthFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a, err := auth.New(models.AuthConfig{APIKeys: []models.APIKeyConfig{
+		{Name: "ci", Hash: auth.HashAPIKey("ci-key"), Role: models.RoleReader},
+	}}, nil)
+	require.NoError(t, err)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r := gin.New()
+	r.GET("/books", LimitAuthFailures(ratelimit.NewMemoryStore(), fixed(ratelimit.PerMinute(1, 2))), Authenticate(a, false), ok)
+	r.GET("/broken", LimitAuthFailures(failingStore{}, fixed(ratelimit.PerMinute(1, 2))), Authenticate(a, false), ok)
+
+	send := func(path, remoteAddr, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set(auth.APIKeyHeader, key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for range 3 {
+		assert.Equal(t, http.StatusOK, send("/books", "192.0.2.1:1234", "ci-key").Code, "accepted credentials do not count")
+		assert.Equal(t, http.StatusUnauthorized, send("/books", "192.0.2.1:1234", "").Code, "missing credentials do not count")
+	}
+	assert.Equal(t, http.StatusUnauthorized, send("/books", "192.0.2.1:1234", "guess-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("/books", "192.0.2.1:1234", "guess-2").Code)
+
+	w := send("/books", "192.0.2.1:1234", "ci-key")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "credentials are not checked once the limit is reached")
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, send("/books", "192.0.2.2:1234", "ci-key").Code, "other addresses are not limited")
+
+	for range 3 {
+		assert.Equal(t, http.StatusUnauthorized, send("/broken", "192.0.2.3:1234", "guess").Code,
+			"requests are let through when the store fails")
+	}
+}
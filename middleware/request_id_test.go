@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name     string
+		header   string
+		expectID string
+	}{
+		{name: "client id", header: "abc-123", expectID: "abc-123"},
+		{name: "missing"},
+		{name: "control characters", header: "abc\x01"},
+		{name: "too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set(RequestIDHeader, tt.header)
+		}
+		r.ServeHTTP(w, req)
+
+		id := w.Header().Get(RequestIDHeader)
+		if tt.expectID != "" {
+			assert.Equal(t, tt.expectID, id, tt.name)
+		} else {
+			assert.Len(t, id, 32, tt.name)
+		}
+		assert.False(t, seen[id], "%s: request IDs are unique", tt.name)
+		seen[id] = true
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/migrations"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/utils"
+)
+
+const migrateUsage = "usage: byfood [flags] migrate up|down|status|to N"
+
+// runCommand runs the command given after the flags and returns the process
+// exit code.
+func runCommand(cfg models.AppConfig, args []string, w io.Writer) int {
+	var run func(ctx context.Context, db *gorm.DB, args []string, w io.Writer) error
+	switch args[0] {
+	case "migrate":
+		run = runMigrate
+	case "import":
+		run = func(ctx context.Context, db *gorm.DB, args []string, w io.Writer) error {
+			return runImport(ctx, cfg, db, args, w)
+		}
+	case "export":
+		run = func(ctx context.Context, db *gorm.DB, args []string, w io.Writer) error {
+			return runExport(ctx, cfg, db, args, w)
+		}
+	case "apikey":
+		run = func(ctx context.Context, db *gorm.DB, args []string, w io.Writer) error {
+			return runAPIKey(ctx, cfg, db, args, w)
+		}
+	case "user":
+		run = func(ctx context.Context, db *gorm.DB, args []string, w io.Writer) error {
+			return runUser(ctx, cfg, db, args, os.Stdin, w)
+		}
+	default:
+		_, _ = fmt.Fprintf(w, "unknown command %q\n%s\n%s\n%s\n%s\n%s\n", args[0], migrateUsage, importUsage, exportUsage, apiKeyUsage, userUsage)
+		return exitError
+	}
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		_, _ = fmt.Fprintln(w, err)
+		return exitError
+	}
+	defer func() { _ = utils.CloseDB(db) }()
+	if err := run(context.Background(), db, args[1:], w); err != nil {
+		_, _ = fmt.Fprintln(w, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(ctx context.Context, db *gorm.DB, args []string, w io.Writer) error {
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	var run []migrations.Migration
+	verb := "Applied"
+	switch {
+	case len(args) == 1 && args[0] == "up":
+		run, err = m.Up(ctx)
+	case len(args) == 1 && args[0] == "down":
+		verb = "Reverted"
+		run, err = m.Down(ctx)
+	case len(args) == 1 && args[0] == "status":
+		return printStatus(ctx, m, w)
+	case len(args) == 2 && args[0] == "to":
+		target, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("migrate to: %q is not a version number", args[1])
+		}
+		current, curErr := m.Current(ctx)
+		if curErr != nil {
+			return curErr
+		}
+		if target < current {
+			verb = "Reverted"
+		}
+		run, err = m.To(ctx, target)
+	default:
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	for _, mig := range run {
+		_, _ = fmt.Fprintf(w, "%s %s\n", verb, mig)
+	}
+	if err != nil {
+		return err
+	}
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "Schema is at version %d of %d\n", current, m.Latest())
+	return nil
+}
+
+func printStatus(ctx context.Context, m *migrations.Migrator, w io.Writer) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if s.Applied {
+			_, _ = fmt.Fprintf(w, "%s  applied %s\n", s.Migration, s.AppliedAt.Format("2006-01-02 15:04:05Z07:00"))
+		} else {
+			_, _ = fmt.Fprintf(w, "%s  pending\n", s.Migration)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestRunCommandMigrate(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.LogLevel = "error"
+	cfg.Database.DSN = filepath.Join(t.TempDir(), "books.db")
+	latest := len(migrationNames(t))
+
+	steps := []struct {
+		args         []string
+		expectCode   int
+		expectOutput []string
+	}{
+		{
+			args:         []string{"migrate", "status"},
+			expectCode:   exitOK,
+			expectOutput: []string{"0001_create_books  pending"},
+		},
+		{
+			args:         []string{"migrate", "up"},
+			expectCode:   exitOK,
+			expectOutput: []string{"Applied 0001_create_books", fmt.Sprintf("Schema is at version %d of %d", latest, latest)},
+		},
+		{
+			args:         []string{"migrate", "status"},
+			expectCode:   exitOK,
+			expectOutput: []string{"0001_create_books  applied "},
+		},
+		{
+			args:         []string{"migrate", "to", "0"},
+			expectCode:   exitOK,
+			expectOutput: []string{"Reverted 0001_create_books", fmt.Sprintf("Schema is at version 0 of %d", latest)},
+		},
+		{
+			args:         []string{"migrate", "down"},
+			expectCode:   exitOK,
+			expectOutput: []string{fmt.Sprintf("Schema is at version 0 of %d", latest)},
+		},
+		{
+			args:         []string{"migrate", "to", "latest"},
+			expectCode:   exitError,
+			expectOutput: []string{`"latest" is not a version number`},
+		},
+		{
+			args:         []string{"migrate", "to", "999"},
+			expectCode:   exitError,
+			expectOutput: []string{"unknown schema version 999"},
+		},
+		{
+			args:         []string{"migrate", "sideways"},
+			expectCode:   exitError,
+			expectOutput: []string{migrateUsage},
+		},
+		{
+			args:         []string{"serve"},
+			expectCode:   exitError,
+			expectOutput: []string{`unknown command "serve"`},
+		},
+	}
+
+	for _, step := range steps {
+		var out bytes.Buffer
+		code := runCommand(cfg, step.args, &out)
+		assert.Equal(t, step.expectCode, code, step.args)
+		for _, s := range step.expectOutput {
+			assert.Contains(t, out.String(), s, step.args)
+		}
+	}
+}
+
+func TestRunCommandUnreachableDatabase(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Database = models.DatabaseConfig{Driver: "mysql", DSN: "not a dsn"}
+	var out bytes.Buffer
+	assert.Equal(t, exitError, runCommand(cfg, []string{"migrate", "up"}, &out))
+	assert.Contains(t, out.String(), "invalid MySQL DSN")
+}
+
+// migrationNames returns the names of the SQLite migrations, in order.
+func migrationNames(t *testing.T) []string {
+	entries, err := os.ReadDir("migrations/sqlite")
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".up.sql"); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// goSteps holds the Go steps of up migrations by version.
+var goSteps = map[int]func(tx *gorm.DB) error{
+	5: rekeyAuthors,
+}
+
+// rekeyAuthors gives the authors created by migration 5 the names and keys
+// the repository gives authors. SQL only trims names and lowers the case of
+// ASCII letters on SQLite, so names differing in other letters, or in runs
+// of spaces, became separate authors with keys no lookup finds. Authors
+// sharing a key are merged into the first, and the books of renamed or
+// merged authors get the name of their author.
+func rekeyAuthors(tx *gorm.DB) error {
+	var authors []models.Author
+	if err := tx.Order("id").Find(&authors).Error; err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	byKey := map[string]*models.Author{}
+	var kept []*models.Author
+	for i := range authors {
+		a := &authors[i]
+		key := models.AuthorKey(a.Name)
+		first, ok := byKey[key]
+		if !ok {
+			byKey[key] = a
+			kept = append(kept, a)
+			continue
+		}
+		// Books credited to both keep one link, to the first author.
+		err := tx.Exec("DELETE FROM book_authors WHERE author_id = ? AND book_id IN "+
+			"(SELECT book_id FROM (SELECT book_id FROM book_authors WHERE author_id = ?) AS linked)", a.ID, first.ID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE book_authors SET author_id = ? WHERE author_id = ?", first.ID, a.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM authors WHERE id = ?", a.ID).Error; err != nil {
+			return err
+		}
+	}
+	for _, a := range kept {
+		name, key := models.NormalizeAuthorName(a.Name), models.AuthorKey(a.Name)
+		if name != a.Name || key != a.NameKey {
+			err := tx.Exec("UPDATE authors SET name = ?, name_key = ?, updated_at = ? WHERE id = ?", name, key, now, a.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Exec("UPDATE books SET author = ?, version = version + 1, updated_at = ? "+
+			"WHERE author <> ? AND id IN (SELECT book_id FROM book_authors WHERE author_id = ?)", name, now, name, a.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Package migrations versions the database schema. Each supported driver has
+// a directory of numbered SQL files, NNNN_name.up.sql and NNNN_name.down.sql,
+// embedded in the binary. Changes SQL cannot make alike on every driver are
+// made in Go after the SQL of an up migration (see goSteps). Applied versions
+// are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sqlite postgres mysql
+var files embed.FS
+
+var filePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrSchemaBehind is returned by Ensure when migrations are pending and may
+// not be applied.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// Migration is one step of the schema history.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Go, when set, runs in the transaction of the up migration after Up.
+	Go func(tx *gorm.DB) error
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status reports whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// appliedMigration is a row of the schema_migrations table.
+type appliedMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (appliedMigration) TableName() string { return "schema_migrations" }
+
+// Migrator moves a database between schema versions.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New returns a Migrator for db using the migrations of its driver.
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := load(files, db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// load reads the migrations in directory dir of fsys. Versions must start at
+// 1 and have no gaps, and every version needs both an up and a down file.
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q: %w", dir, err)
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		match := filePattern.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s/%s: name must look like 0001_name.up.sql", dir, e.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %s/%s: version %d is also named %q", dir, e.Name(), version, m.Name)
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		m.Go = goSteps[m.Version]
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations in %s: expected version %d, found %s", dir, i+1, m)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s/%s needs both an up and a down file", dir, m)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest returns the version the schema has after every migration.
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Current returns the version of the schema, 0 for an empty database.
+func (m *Migrator) Current(ctx context.Context) (int, error) {
+	if err := m.init(ctx); err != nil {
+		return 0, err
+	}
+	var version *int
+	err := m.db.WithContext(ctx).Model(&appliedMigration{}).Select("MAX(version)").Scan(&version).Error
+	if err != nil || version == nil {
+		return 0, err
+	}
+	return *version, nil
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+	var applied []appliedMigration
+	if err := m.db.WithContext(ctx).Find(&applied).Error; err != nil {
+		return nil, err
+	}
+	at := map[int]time.Time{}
+	for _, a := range applied {
+		at[a.Version] = a.AppliedAt
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		t, ok := at[mig.Version]
+		statuses[i] = Status{Migration: mig, Applied: ok, AppliedAt: t}
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) ([]Migration, error) {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current == 0 {
+		return nil, nil
+	}
+	return m.To(ctx, current-1)
+}
+
+// To applies or reverts migrations until the schema is at version target and
+// returns the migrations that were run, in order. Each migration runs in its
+// own transaction; on failure the schema is left at the last version that
+// succeeded. MySQL commits DDL statements implicitly, so a migration that
+// fails halfway there must be repaired by hand.
+func (m *Migrator) To(ctx context.Context, target int) ([]Migration, error) {
+	if target < 0 || target > m.Latest() {
+		return nil, fmt.Errorf("unknown schema version %d (latest is %d)", target, m.Latest())
+	}
+	current, err := m.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current > m.Latest() {
+		return nil, fmt.Errorf("database schema version %d is newer than this binary knows (%d)", current, m.Latest())
+	}
+
+	var run []Migration
+	for current < target {
+		mig := m.migrations[current]
+		if err := m.apply(ctx, mig, true); err != nil {
+			return run, err
+		}
+		run = append(run, mig)
+		current++
+	}
+	for current > target {
+		mig := m.migrations[current-1]
+		if err := m.apply(ctx, mig, false); err != nil {
+			return run, err
+		}
+		run = append(run, mig)
+		current--
+	}
+	return run, nil
+}
+
+// Ensure brings the schema up to date when apply is set, and otherwise
+// returns an error wrapping ErrSchemaBehind if migrations are pending.
+func (m *Migrator) Ensure(ctx context.Context, apply bool) ([]Migration, error) {
+	if apply {
+		return m.Up(ctx)
+	}
+	current, err := m.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current < m.Latest() {
+		return nil, fmt.Errorf("%w: at version %d, need %d", ErrSchemaBehind, current, m.Latest())
+	}
+	return nil, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, mig Migration, up bool) error {
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if !up {
+			if err := tx.Exec(mig.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&appliedMigration{}, mig.Version).Error
+		}
+		if err := tx.Exec(mig.Up).Error; err != nil {
+			return err
+		}
+		if mig.Go != nil {
+			if err := mig.Go(tx); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&appliedMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now().UTC()}).Error
+	})
+	if err != nil {
+		direction := "up"
+		if !up {
+			direction = "down"
+		}
+		return fmt.Errorf("migration %s %s failed: %w", mig, direction, err)
+	}
+	return nil
+}
+
+// init creates the schema_migrations table if needed.
+func (m *Migrator) init(ctx context.Context) error {
+	db := m.db.WithContext(ctx)
+	if db.Migrator().HasTable(&appliedMigration{}) {
+		return nil
+	}
+	if err := db.Migrator().CreateTable(&appliedMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	return db
+}
+
+// testMigrator returns a migrator over a fixed history of three migrations.
+func testMigrator(t *testing.T) (*Migrator, *gorm.DB) {
+	db := openDB(t)
+	fsys := fstest.MapFS{
+		"sqlite/0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"sqlite/0001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"sqlite/0002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);\nCREATE INDEX b_id ON b (id);")},
+		"sqlite/0002_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"sqlite/0003_broken.up.sql":     {Data: []byte("CREATE TABLE c (id INTEGER);\nNOT SQL;")},
+		"sqlite/0003_broken.down.sql":   {Data: []byte("DROP TABLE c;")},
+	}
+	migrations, err := load(fsys, "sqlite")
+	require.NoError(t, err)
+	return &Migrator{db: db, migrations: migrations}, db
+}
+
+func TestLoadRejectsMalformedHistories(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		dir         string
+		expectError string
+	}{
+		{
+			name:        "bad file name",
+			files:       []string{"d/0001_a.up.sql", "d/0001_a.down.sql", "d/notes.txt"},
+			expectError: "name must look like",
+		},
+		{
+			name:        "missing down file",
+			files:       []string{"d/0001_a.up.sql"},
+			expectError: "needs both an up and a down file",
+		},
+		{
+			name:        "gap in versions",
+			files:       []string{"d/0001_a.up.sql", "d/0001_a.down.sql", "d/0003_c.up.sql", "d/0003_c.down.sql"},
+			expectError: "expected version 2, found 0003_c",
+		},
+		{
+			name:        "conflicting names",
+			files:       []string{"d/0001_a.up.sql", "d/0001_b.down.sql"},
+			expectError: `version 1 is also named "a"`,
+		},
+		{
+			name:        "unknown driver",
+			files:       []string{"d/0001_a.up.sql", "d/0001_a.down.sql"},
+			dir:         "other",
+			expectError: `no migrations for driver "other"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, f := range tt.files {
+				fsys[f] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+			}
+			dir := tt.dir
+			if dir == "" {
+				dir = "d"
+			}
+			_, err := load(fsys, dir)
+			assert.ErrorContains(t, err, tt.expectError)
+		})
+	}
+}
+
+// TestDriversShareHistory makes sure a migration is never added for one
+// driver only.
+func TestDriversShareHistory(t *testing.T) {
+	sqliteMigrations, err := load(files, "sqlite")
+	require.NoError(t, err)
+	for _, driver := range []string{"postgres", "mysql"} {
+		migrations, err := load(files, driver)
+		require.NoError(t, err)
+		require.Len(t, migrations, len(sqliteMigrations), driver)
+		for i, m := range migrations {
+			assert.Equal(t, sqliteMigrations[i].String(), m.String(), driver)
+		}
+	}
+}
+
+func TestMigratorUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	m, db := testMigrator(t)
+
+	current, err := m.Current(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, current)
+
+	run, err := m.To(ctx, 2)
+	require.NoError(t, err)
+	assert.Len(t, run, 2)
+	assert.True(t, db.Migrator().HasTable("a"))
+	assert.True(t, db.Migrator().HasIndex("b", "b_id"))
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[0].AppliedAt.IsZero())
+	assert.True(t, statuses[1].Applied)
+	assert.False(t, statuses[2].Applied)
+
+	run, err = m.Down(ctx)
+	require.NoError(t, err)
+	require.Len(t, run, 1)
+	assert.Equal(t, "0002_create_b", run[0].String())
+	assert.False(t, db.Migrator().HasTable("b"))
+	current, err = m.Current(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, current)
+
+	run, err = m.To(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, run, 1)
+	assert.False(t, db.Migrator().HasTable("a"))
+
+	_, err = m.To(ctx, 4)
+	assert.ErrorContains(t, err, "unknown schema version 4")
+}
+
+func TestMigratorFailedMigrationIsRolledBack(t *testing.T) {
+	ctx := context.Background()
+	m, db := testMigrator(t)
+
+	run, err := m.Up(ctx)
+	assert.ErrorContains(t, err, "migration 0003_broken up failed")
+	assert.Len(t, run, 2)
+	assert.False(t, db.Migrator().HasTable("c"))
+
+	current, err := m.Current(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, current)
+}
+
+func TestEnsure(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(openDB(t))
+	require.NoError(t, err)
+
+	_, err = m.Ensure(ctx, false)
+	assert.ErrorIs(t, err, ErrSchemaBehind)
+
+	applied, err := m.Ensure(ctx, true)
+	require.NoError(t, err)
+	assert.Len(t, applied, m.Latest())
+
+	applied, err = m.Ensure(ctx, false)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+// TestAdoptsAutoMigratedDatabase checks that databases created before
+// versioned migrations, by GORM's AutoMigrate, can be migrated.
+func TestAdoptsAutoMigratedDatabase(t *testing.T) {
+	db := openDB(t)
+	require.NoError(t, db.Exec("CREATE TABLE `books` (`id` integer PRIMARY KEY AUTOINCREMENT,`title` text,`author` text,`year` integer)").Error)
+	require.NoError(t, db.Exec("INSERT INTO books (title, author, year) VALUES ('Dune', 'Frank Herbert', 1965)").Error)
+
+	m, err := New(db)
+	require.NoError(t, err)
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, db.Table("books").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+// TestAuthorsAreDeduplicated checks that the migration creating the authors
+// table merges author names that differ only in case, spaces and periods.
+func TestAuthorsAreDeduplicated(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m, err := New(db)
+	require.NoError(t, err)
+	_, err = m.To(ctx, 4)
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`INSERT INTO books (title, author, year, version) VALUES
+		('The Hobbit', 'J. R. R. Tolkien', 1937, 4),
+		('The Silmarillion', 'j.r.r. tolkien', 1977, 4),
+		('Dune', 'Frank Herbert', 1965, 4),
+		('Untitled', '', 2000, 4)`).Error)
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	var authors []string
+	require.NoError(t, db.Table("authors").Order("name").Pluck("name", &authors).Error)
+	assert.Equal(t, []string{"Frank Herbert", "J. R. R. Tolkien"}, authors)
+
+	var books []struct {
+		Title   string
+		Author  string
+		Version int
+		Links   int
+	}
+	require.NoError(t, db.Raw(`SELECT title, author, version,
+		(SELECT COUNT(*) FROM book_authors WHERE book_id = books.id) AS links
+		FROM books ORDER BY id`).Scan(&books).Error)
+	assert.Equal(t, []struct {
+		Title   string
+		Author  string
+		Version int
+		Links   int
+	}{
+		{"The Hobbit", "J. R. R. Tolkien", 4, 1},
+		{"The Silmarillion", "J. R. R. Tolkien", 5, 1},
+		{"Dune", "Frank Herbert", 4, 1},
+		{"Untitled", "", 4, 0},
+	}, books)
+}
+
+// TestAuthorsAreRekeyed checks that the authors created by the migration
+// get the names and keys the repository gives authors, which SQL alone does
+// not compute for letters outside ASCII and runs of spaces.
+func TestAuthorsAreRekeyed(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m, err := New(db)
+	require.NoError(t, err)
+	_, err = m.To(ctx, 4)
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`INSERT INTO books (title, author, year, version) VALUES
+		('Germinal', 'Émile  Zola', 1885, 1),
+		('Nana', 'émile zola', 1880, 1),
+		('Dune', 'Frank Herbert', 1965, 1)`).Error)
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	var authors []models.Author
+	require.NoError(t, db.Order("name").Find(&authors).Error)
+	require.Len(t, authors, 2)
+	assert.Equal(t, "Frank Herbert", authors[0].Name)
+	assert.Equal(t, "Émile Zola", authors[1].Name)
+	assert.Equal(t, models.AuthorKey("Émile Zola"), authors[1].NameKey)
+
+	var books []struct {
+		Title    string
+		Author   string
+		Version  int
+		AuthorID uint
+	}
+	require.NoError(t, db.Raw(`SELECT title, author, version, author_id FROM books
+		JOIN book_authors ON book_authors.book_id = books.id ORDER BY books.id`).Scan(&books).Error)
+	require.Len(t, books, 3)
+	for _, b := range books[:2] {
+		assert.Equal(t, "Émile Zola", b.Author, b.Title)
+		assert.Equal(t, 2, b.Version, b.Title)
+		assert.Equal(t, authors[1].ID, b.AuthorID, b.Title)
+	}
+	assert.Equal(t, 1, books[2].Version, "unchanged books keep their version")
+}
+
+func TestExistingAPIKeysBecomeAdmins(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m, err := New(db)
+	require.NoError(t, err)
+	_, err = m.To(ctx, 7)
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`INSERT INTO api_keys (name, hash) VALUES ('ci', 'abc')`).Error)
+
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	var roles []string
+	require.NoError(t, db.Table("api_keys").Pluck("role", &roles).Error)
+	assert.Equal(t, []string{"admin"}, roles)
+}
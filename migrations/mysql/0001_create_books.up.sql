@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS books (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    title LONGTEXT,
+    author LONGTEXT,
+    `year` BIGINT
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1 @@
+ALTER TABLE books ADD COLUMN version BIGINT UNSIGNED NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+DROP INDEX idx_books_deleted_at ON books;
+ALTER TABLE books DROP COLUMN deleted_at;
@@ -0,0 +1,24 @@
+ALTER TABLE books
+    ADD COLUMN isbn VARCHAR(13) NULL,
+    ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN language VARCHAR(2) NOT NULL DEFAULT '',
+    ADD COLUMN page_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN description VARCHAR(2000) NOT NULL DEFAULT '',
+    ADD COLUMN created_at DATETIME(3) NULL,
+    ADD COLUMN updated_at DATETIME(3) NULL;
+UPDATE books SET created_at = CURRENT_TIMESTAMP(3), updated_at = CURRENT_TIMESTAMP(3);
+CREATE UNIQUE INDEX idx_books_isbn ON books (isbn);
+
+CREATE TABLE genres (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+CREATE UNIQUE INDEX idx_genres_name ON genres (name);
+
+CREATE TABLE book_genres (
+    book_id BIGINT UNSIGNED NOT NULL,
+    genre_id BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (book_id, genre_id),
+    CONSTRAINT fk_book_genres_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_book_genres_genre FOREIGN KEY (genre_id) REFERENCES genres (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
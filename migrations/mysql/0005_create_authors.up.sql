@@ -0,0 +1,40 @@
+CREATE TABLE authors (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    name_key VARCHAR(255) NOT NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+CREATE UNIQUE INDEX idx_authors_name_key ON authors (name_key);
+
+CREATE TABLE book_authors (
+    book_id BIGINT UNSIGNED NOT NULL,
+    author_id BIGINT UNSIGNED NOT NULL,
+    ordinal INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id),
+    INDEX idx_book_authors_author_id (author_id),
+    CONSTRAINT fk_book_authors_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_book_authors_author FOREIGN KEY (author_id) REFERENCES authors (id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- One author per distinct name, ignoring case, spaces and periods. LOWER
+-- and TRIM only approximate models.AuthorKey, so the migration rekeys the
+-- authors in Go afterwards (see migrations/authors.go).
+INSERT INTO authors (name, name_key, created_at, updated_at)
+SELECT MIN(TRIM(author)), LOWER(REPLACE(REPLACE(TRIM(author), ' ', ''), '.', '')), CURRENT_TIMESTAMP(3), CURRENT_TIMESTAMP(3)
+FROM books
+WHERE author IS NOT NULL AND TRIM(author) <> ''
+GROUP BY LOWER(REPLACE(REPLACE(TRIM(author), ' ', ''), '.', ''));
+
+INSERT INTO book_authors (book_id, author_id, ordinal)
+SELECT books.id, authors.id, 0
+FROM books
+JOIN authors ON authors.name_key = LOWER(REPLACE(REPLACE(TRIM(books.author), ' ', ''), '.', ''));
+
+UPDATE books
+JOIN book_authors ON book_authors.book_id = books.id
+JOIN authors ON authors.id = book_authors.author_id
+SET books.author = authors.name,
+    books.version = books.version + 1,
+    books.updated_at = CURRENT_TIMESTAMP(3)
+WHERE BINARY authors.name <> BINARY books.author;
@@ -0,0 +1 @@
+DROP INDEX idx_books_search ON books;
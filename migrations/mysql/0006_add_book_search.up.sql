@@ -0,0 +1 @@
+CREATE FULLTEXT INDEX idx_books_search ON books (title, author, description);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS books (
+    id BIGSERIAL PRIMARY KEY,
+    title TEXT,
+    author TEXT,
+    year BIGINT
+);
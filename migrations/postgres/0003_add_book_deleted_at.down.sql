@@ -0,0 +1,2 @@
+DROP INDEX idx_books_deleted_at;
+ALTER TABLE books DROP COLUMN deleted_at;
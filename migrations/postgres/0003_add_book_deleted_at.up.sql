@@ -0,0 +1,2 @@
+ALTER TABLE books ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX idx_books_deleted_at ON books (deleted_at);
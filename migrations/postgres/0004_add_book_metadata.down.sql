@@ -0,0 +1,11 @@
+DROP TABLE book_genres;
+DROP TABLE genres;
+DROP INDEX idx_books_isbn;
+ALTER TABLE books
+    DROP COLUMN updated_at,
+    DROP COLUMN created_at,
+    DROP COLUMN description,
+    DROP COLUMN page_count,
+    DROP COLUMN language,
+    DROP COLUMN publisher,
+    DROP COLUMN isbn;
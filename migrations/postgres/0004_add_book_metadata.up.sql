@@ -0,0 +1,22 @@
+ALTER TABLE books
+    ADD COLUMN isbn VARCHAR(13),
+    ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN language VARCHAR(2) NOT NULL DEFAULT '',
+    ADD COLUMN page_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN description VARCHAR(2000) NOT NULL DEFAULT '',
+    ADD COLUMN created_at TIMESTAMPTZ,
+    ADD COLUMN updated_at TIMESTAMPTZ;
+UPDATE books SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
+CREATE UNIQUE INDEX idx_books_isbn ON books (isbn);
+
+CREATE TABLE genres (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL
+);
+CREATE UNIQUE INDEX idx_genres_name ON genres (name);
+
+CREATE TABLE book_genres (
+    book_id BIGINT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    genre_id BIGINT NOT NULL REFERENCES genres (id) ON DELETE CASCADE,
+    PRIMARY KEY (book_id, genre_id)
+);
@@ -0,0 +1,38 @@
+CREATE TABLE authors (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    name_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_authors_name_key ON authors (name_key);
+
+CREATE TABLE book_authors (
+    book_id BIGINT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    author_id BIGINT NOT NULL REFERENCES authors (id),
+    ordinal INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id)
+);
+CREATE INDEX idx_book_authors_author_id ON book_authors (author_id);
+
+-- One author per distinct name, ignoring case, spaces and periods. LOWER
+-- and TRIM only approximate models.AuthorKey, so the migration rekeys the
+-- authors in Go afterwards (see migrations/authors.go).
+INSERT INTO authors (name, name_key, created_at, updated_at)
+SELECT MIN(TRIM(author)), LOWER(REPLACE(REPLACE(TRIM(author), ' ', ''), '.', '')), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM books
+WHERE author IS NOT NULL AND TRIM(author) <> ''
+GROUP BY LOWER(REPLACE(REPLACE(TRIM(author), ' ', ''), '.', ''));
+
+INSERT INTO book_authors (book_id, author_id, ordinal)
+SELECT books.id, authors.id, 0
+FROM books
+JOIN authors ON authors.name_key = LOWER(REPLACE(REPLACE(TRIM(books.author), ' ', ''), '.', ''));
+
+UPDATE books
+SET author = authors.name,
+    version = books.version + 1,
+    updated_at = CURRENT_TIMESTAMP
+FROM book_authors
+JOIN authors ON authors.id = book_authors.author_id
+WHERE book_authors.book_id = books.id AND authors.name <> books.author;
@@ -0,0 +1,2 @@
+DROP INDEX idx_books_search;
+ALTER TABLE books DROP COLUMN search;
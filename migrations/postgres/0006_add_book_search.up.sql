@@ -0,0 +1,10 @@
+-- The simple configuration neither stems nor drops stop words, like the
+-- tokenizer of the SQLite index. Titles, authors and descriptions are
+-- weighted like the ranking of the repository, so that ts_rank orders the
+-- candidates of a search alike.
+ALTER TABLE books ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(author, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(description, '')), 'C')
+) STORED;
+CREATE INDEX idx_books_search ON books USING GIN (search);
@@ -0,0 +1,8 @@
+CREATE TABLE api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    hash CHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_api_keys_name ON api_keys (name);
+CREATE UNIQUE INDEX idx_api_keys_hash ON api_keys (hash);
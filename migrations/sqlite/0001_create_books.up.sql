@@ -0,0 +1,8 @@
+-- IF NOT EXISTS adopts databases created by GORM's AutoMigrate, whose books
+-- table has the same columns.
+CREATE TABLE IF NOT EXISTS books (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT,
+    author TEXT,
+    year INTEGER
+);
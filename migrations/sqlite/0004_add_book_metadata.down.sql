@@ -0,0 +1,10 @@
+DROP TABLE book_genres;
+DROP TABLE genres;
+DROP INDEX idx_books_isbn;
+ALTER TABLE books DROP COLUMN updated_at;
+ALTER TABLE books DROP COLUMN created_at;
+ALTER TABLE books DROP COLUMN description;
+ALTER TABLE books DROP COLUMN page_count;
+ALTER TABLE books DROP COLUMN language;
+ALTER TABLE books DROP COLUMN publisher;
+ALTER TABLE books DROP COLUMN isbn;
@@ -0,0 +1,5 @@
+DROP TRIGGER books_fts_delete;
+DROP TRIGGER books_fts_update;
+DROP TRIGGER books_fts_insert;
+DROP TABLE books_fts_terms;
+DROP TABLE books_fts;
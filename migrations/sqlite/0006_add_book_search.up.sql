@@ -0,0 +1,22 @@
+-- The index is keyed by book ID and kept in sync by triggers. Its rank
+-- function, bm25, orders the candidates of a search.
+CREATE VIRTUAL TABLE books_fts USING fts5 (title, author, description, tokenize = "unicode61 remove_diacritics 0");
+CREATE VIRTUAL TABLE books_fts_terms USING fts5vocab (books_fts, 'row');
+
+INSERT INTO books_fts (rowid, title, author, description)
+SELECT id, title, author, description FROM books;
+
+CREATE TRIGGER books_fts_insert AFTER INSERT ON books BEGIN
+    INSERT INTO books_fts (rowid, title, author, description)
+    VALUES (new.id, new.title, new.author, new.description);
+END;
+
+CREATE TRIGGER books_fts_update AFTER UPDATE OF title, author, description ON books BEGIN
+    DELETE FROM books_fts WHERE rowid = old.id;
+    INSERT INTO books_fts (rowid, title, author, description)
+    VALUES (new.id, new.title, new.author, new.description);
+END;
+
+CREATE TRIGGER books_fts_delete AFTER DELETE ON books BEGIN
+    DELETE FROM books_fts WHERE rowid = old.id;
+END;
@@ -0,0 +1,8 @@
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    created_at DATETIME
+);
+CREATE UNIQUE INDEX idx_api_keys_name ON api_keys (name);
+CREATE UNIQUE INDEX idx_api_keys_hash ON api_keys (hash);
@@ -0,0 +1,3 @@
+-- Keys created before roles existed could do anything, so they keep doing
+-- so as admins.
+ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT 'admin';
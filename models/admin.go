@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ConfigStatus describes the configuration currently in effect. Config has
+// its secrets redacted.
+type ConfigStatus struct {
+	Version  uint64    `json:"version"`
+	Hash     string    `json:"hash"`
+	LoadedAt time.Time `json:"loadedAt"`
+	Config   AppConfig `json:"config"`
+}
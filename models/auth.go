@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// APIKey is an API key stored in the database. Like keys in the config
+// file, it is stored as the hex-encoded SHA-256 digest of the key. Requests
+// made with the key have Role.
+type APIKey struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"uniqueIndex"`
+	Hash      string    `json:"-" gorm:"uniqueIndex"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Roles of the principals making requests. Each role is granted the
+// permissions of the roles before it.
+const (
+	RoleReader = "reader"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Roles lists the roles from the least to the most privileged.
+var Roles = []string{RoleReader, RoleEditor, RoleAdmin}
+
+// User is an account that signs in with an email address and a password.
+// PasswordHash is the argon2id hash of the password. After repeated failed
+// logins the account is locked until LockedUntil.
+type User struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Email        string     `json:"email" gorm:"uniqueIndex"`
+	PasswordHash string     `json:"-"`
+	Role         string     `json:"role"`
+	FailedLogins int        `json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// RefreshToken is a refresh token issued to a user, stored by the
+// hex-encoded SHA-256 digest of the token. Each token is used once: using
+// it revokes it in exchange for a new one.
+type RefreshToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	Hash      string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Credentials are the body of the register and login endpoints.
+type Credentials struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,min=12,max=256"`
+}
+
+// RefreshRequest is the body of the refresh endpoint.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// LogoutRequest is the body of the logout endpoint. All revokes every
+// refresh token of the user rather than only this one, ending all of their
+// sessions.
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+	All          bool   `json:"all"`
+}
+
+// TokenResponse carries the tokens issued on login and refresh. The access
+// token is a bearer token valid for ExpiresIn seconds; the refresh token
+// obtains the next one.
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Author is a person credited on books. NameKey is the name without case,
+// spaces and periods; it is unique, so "J.R.R. Tolkien" and
+// "J. R. R. Tolkien" are the same author.
+type Author struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name"`
+	NameKey   string    `json:"-" gorm:"uniqueIndex"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// NormalizeAuthorName trims name and collapses runs of spaces in it.
+func NormalizeAuthorName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// AuthorKey returns the NameKey of an author named name: the name in lower
+// case without spaces and periods. The migration creating the authors table
+// uses it too, since SQL cannot lower the case of every letter alike.
+func AuthorKey(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", ".", "").Replace(NormalizeAuthorName(name)))
+}
+
+// AuthorInput is the request body for creating or renaming an author.
+type AuthorInput struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+// AuthorListResponse is the envelope returned by the author listing endpoint.
+type AuthorListResponse struct {
+	Items    []Author `json:"items"`
+	Total    int64    `json:"total"`
+	Page     int      `json:"page"`
+	PageSize int      `json:"pageSize"`
+}
+
+// AuthorRef refers to an author of a book by ID or, in book writes, by
+// name. In requests it may be written as the author's ID, their name or an
+// object with either.
+type AuthorRef struct {
+	ID   uint   `json:"id,omitempty"`
+	Name string `json:"name,omitempty" binding:"max=255"`
+}
+
+var errEmptyAuthorRef = errors.New("an author must be given by id or name")
+
+func (a *AuthorRef) UnmarshalJSON(b []byte) error {
+	var ref struct {
+		ID   uint   `json:"id"`
+		Name string `json:"name"`
+	}
+	switch {
+	case json.Unmarshal(b, &ref.ID) == nil:
+	case json.Unmarshal(b, &ref.Name) == nil:
+	default:
+		if err := json.Unmarshal(b, &ref); err != nil {
+			return err
+		}
+	}
+	if ref.ID == 0 && strings.TrimSpace(ref.Name) == "" {
+		return errEmptyAuthorRef
+	}
+	*a = AuthorRef(ref)
+	return nil
+}
@@ -1,23 +1,270 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// Book is a stored book. Authors lists its authors in credit order, and
+// Author holds their names joined by ", " for display, sorting and
+// filtering. Version starts at 1 and is incremented by every update; it is
+// the book's ETag. ISBN is stored as a compact ISBN-13 and is
+// unique among all books, including those in the trash. DeletedAt is set
+// while the book is in the trash.
 type Book struct {
-	ID     uint   `json:"id" gorm:"primaryKey"`
-	Title  string `json:"title" binding:"required"`
-	Author string `json:"author" binding:"required"`
-	Year   int    `json:"year" binding:"gte=0,lte=2100"`
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	Title       string      `json:"title" binding:"required"`
+	Author      string      `json:"author"`
+	Authors     []AuthorRef `json:"authors" gorm:"-"`
+	Year        int         `json:"year" binding:"gte=0,lte=2100"`
+	ISBN        *string     `json:"isbn,omitempty" gorm:"uniqueIndex"`
+	Publisher   string      `json:"publisher,omitempty"`
+	Language    string      `json:"language,omitempty"`
+	PageCount   int         `json:"pageCount,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Genres      []Genre     `json:"genres,omitempty" gorm:"many2many:book_genres" swaggertype:"array,string"`
+	Version     uint        `json:"version" gorm:"not null;default:1"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+	DeletedAt   *time.Time  `json:"deletedAt,omitempty" gorm:"index"`
+}
+
+// Genre is a genre or tag books are filed under. Names are lower case and
+// unique; in JSON a genre is just its name.
+type Genre struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:50;uniqueIndex;not null"`
 }
 
+func (g Genre) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.Name)
+}
+
+func (g *Genre) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &g.Name)
+}
+
+// BookInput is the body of book writes. The authors are given either as
+// Authors or, for a single author, by name as Author. ISBN accepts ISBN-10
+// and ISBN-13, with or without hyphens and spaces; Language is an ISO 639-1
+// code.
 type BookInput struct {
-	Title  string `json:"title" binding:"required"`
-	Author string `json:"author" binding:"required"`
-	Year   int    `json:"year" binding:"gte=0,lte=2100"`
+	Title       string      `json:"title" binding:"required"`
+	Author      string      `json:"author" binding:"required_without=Authors,excluded_with=Authors"`
+	Authors     []AuthorRef `json:"authors" binding:"required_without=Author,omitempty,min=1,max=20,dive"`
+	Year        int         `json:"year" binding:"gte=0,lte=2100"`
+	ISBN        string      `json:"isbn" binding:"omitempty,isbn"`
+	Publisher   string      `json:"publisher" binding:"max=255"`
+	Language    string      `json:"language" binding:"omitempty,iso639_1"`
+	PageCount   int         `json:"pageCount" binding:"gte=0,lte=100000"`
+	Description string      `json:"description" binding:"max=2000"`
+	Genres      []string    `json:"genres" binding:"max=20,dive,required,max=50"`
+}
+
+// BookListResponse is the envelope returned by the book listing endpoint.
+// Page is omitted when the listing is paged by cursor.
+type BookListResponse struct {
+	Items      []Book `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"pageSize"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+// SearchHit is a book matching a full-text search. Highlights maps the
+// fields the search matched in (title, author, description) to their text
+// as HTML, escaped and with the matches enclosed in <mark> tags;
+// descriptions are cut to an excerpt.
+type SearchHit struct {
+	Book
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchResponse is the envelope returned by the search endpoint, ordered
+// by decreasing score. Windowed is set when more books match than are
+// ranked by relevance; hits past the first 1000 then follow the order of the
+// database's full-text index.
+type SearchResponse struct {
+	Items    []SearchHit `json:"items"`
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+	Windowed bool        `json:"windowed,omitempty"`
+}
+
+// BulkRequest is the body of the bulk endpoint. When Atomic is set the
+// operations are applied in a single transaction and either all of them or
+// none take effect; otherwise each is applied on its own.
+type BulkRequest struct {
+	Atomic     bool            `json:"atomic"`
+	Operations []BulkOperation `json:"operations" binding:"required,min=1,max=1000"`
+}
+
+// BulkOperation is one write of a bulk request. Op is create, update or
+// delete. Update and delete name the book by ID and, like If-Match, may give
+// the Version they are based on. Book is the BookInput of a create or update.
+type BulkOperation struct {
+	Op      string          `json:"op" enums:"create,update,delete"`
+	ID      uint            `json:"id,omitempty"`
+	Version uint            `json:"version,omitempty"`
+	Book    json.RawMessage `json:"book,omitempty" swaggertype:"object"`
+}
+
+// BulkResult reports the outcome of the operation at Index with the status
+// the single-book endpoint would have answered. Failures carry an Error, and
+// Errors lists the rejected fields of the operation, such as "book.title".
+type BulkResult struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	Status int          `json:"status"`
+	Book   *Book        `json:"book,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// BulkResponse lists the results of a bulk request in the order of its
+// operations. Error is set when an atomic request was rolled back.
+type BulkResponse struct {
+	Atomic    bool         `json:"atomic"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// ImportError is a problem with a row of an import. Line is the line of the
+// file the row starts on, Field the rejected field, if any, and Record the
+// row as it appeared in the file.
+type ImportError struct {
+	Line   int    `json:"line"`
+	Field  string `json:"field,omitempty"`
+	Error  string `json:"error"`
+	Record string `json:"record"`
+}
+
+// ImportResponse summarises an import: how many rows were read and what
+// became of them. IgnoredColumns lists the CSV columns that map to no book
+// field. Errors holds the first problems found; ErrorsTruncated is set when
+// there were more.
+type ImportResponse struct {
+	DryRun          bool          `json:"dryRun"`
+	Rows            int           `json:"rows"`
+	Created         int           `json:"created"`
+	Updated         int           `json:"updated"`
+	Skipped         int           `json:"skipped"`
+	Rejected        int           `json:"rejected"`
+	IgnoredColumns  []string      `json:"ignoredColumns,omitempty"`
+	Errors          []ImportError `json:"errors"`
+	ErrorsTruncated bool          `json:"errorsTruncated,omitempty"`
+}
+
+// PurgeResponse reports how many books were permanently deleted.
+type PurgeResponse struct {
+	Purged int64 `json:"purged"`
 }
 
 type AppConfig struct {
-	LogLevel         string   `yaml:"logLevel"`
-	EnableReqLogging bool     `yaml:"enableReqLogging"`
-	AutoMigrate      bool     `yaml:"autoMigrate"`
-	CORSOrigins      []string `yaml:"corsOrigins"`
-	APIVersion       string   `yaml:"apiVersion"`
-	ShutdownTimeout  int      `yaml:"shutdownTimeout"`
+	LogLevel         string          `json:"logLevel" yaml:"logLevel"`
+	EnableReqLogging bool            `json:"enableReqLogging" yaml:"enableReqLogging"`
+	AutoMigrate      bool            `json:"autoMigrate" yaml:"autoMigrate"`
+	CORSOrigins      []string        `json:"corsOrigins" yaml:"corsOrigins"`
+	APIVersion       string          `json:"apiVersion" yaml:"apiVersion"`
+	ShutdownTimeout  int             `json:"shutdownTimeout" yaml:"shutdownTimeout"`
+	CursorSecret     string          `json:"cursorSecret,omitempty" yaml:"cursorSecret"`
+	RequireIfMatch   bool            `json:"requireIfMatch" yaml:"requireIfMatch"`
+	TrashRetention   int             `json:"trashRetentionDays" yaml:"trashRetentionDays"`
+	KnownAuthorsOnly bool            `json:"knownAuthorsOnly" yaml:"knownAuthorsOnly"`
+	ListenAddr       string          `json:"listenAddr" yaml:"listenAddr"`
+	TrustedProxies   []string        `json:"trustedProxies" yaml:"trustedProxies"`
+	Database         DatabaseConfig  `json:"database" yaml:"database"`
+	TLS              TLSConfig       `json:"tls" yaml:"tls"`
+	Auth             AuthConfig      `json:"auth" yaml:"auth"`
+	RateLimit        RateLimitConfig `json:"rateLimit" yaml:"rateLimit"`
+}
+
+// DatabaseConfig selects the database and tunes its connection pool.
+// ConnMaxLifetime is in seconds; zero pool values leave the driver defaults.
+type DatabaseConfig struct {
+	Driver          string `json:"driver" yaml:"driver"`
+	DSN             string `json:"dsn" yaml:"dsn"`
+	MaxOpenConns    int    `json:"maxOpenConns" yaml:"maxOpenConns"`
+	MaxIdleConns    int    `json:"maxIdleConns" yaml:"maxIdleConns"`
+	ConnMaxLifetime int    `json:"connMaxLifetime" yaml:"connMaxLifetime"`
+}
+
+type TLSConfig struct {
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+}
+
+// AuthConfig controls how requests are authenticated. When Enabled, every
+// request needs an API key or a bearer token, except reads of the catalogue
+// while AnonymousReads is set. API keys are also looked up in the database.
+type AuthConfig struct {
+	Enabled        bool           `json:"enabled" yaml:"enabled"`
+	AnonymousReads bool           `json:"anonymousReads" yaml:"anonymousReads"`
+	APIKeys        []APIKeyConfig `json:"apiKeys" yaml:"apiKeys"`
+	JWT            JWTConfig      `json:"jwt" yaml:"jwt"`
+	Users          UsersConfig    `json:"users" yaml:"users"`
+}
+
+// APIKeyConfig is an API key accepted from the config file. Hash is the
+// hex-encoded SHA-256 digest of the key, so that the key itself is never
+// stored. Requests made with the key have Role.
+type APIKeyConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Hash string `json:"hash" yaml:"hash"`
+	Role string `json:"role" yaml:"role"`
+}
+
+// JWTConfig selects the bearer tokens that are accepted. Tokens signed with
+// HS256 are checked against HMACSecret and tokens signed with RS256 against
+// the keys of the JSON Web Key Set in JWKSFile. Issuer and Audience, when
+// set, must match the iss and aud claims. The roles of a token are read from
+// its RolesClaim claim, a string or an array of strings.
+type JWTConfig struct {
+	HMACSecret string `json:"hmacSecret,omitempty" yaml:"hmacSecret"`
+	JWKSFile   string `json:"jwksFile" yaml:"jwksFile"`
+	Issuer     string `json:"issuer" yaml:"issuer"`
+	Audience   string `json:"audience" yaml:"audience"`
+	RolesClaim string `json:"rolesClaim" yaml:"rolesClaim"`
+}
+
+// UsersConfig controls user accounts. When Enabled, users log in for access
+// tokens signed with the HS256 secret of JWTConfig, valid for AccessTokenTTL
+// seconds, and refresh tokens valid for RefreshTokenTTL days. Registration
+// lets anyone create an account with the reader role. After MaxFailedLogins
+// failed logins in a row an account is locked for LockoutDuration seconds;
+// zero disables lockout.
+type UsersConfig struct {
+	Enabled         bool `json:"enabled" yaml:"enabled"`
+	Registration    bool `json:"registration" yaml:"registration"`
+	AccessTokenTTL  int  `json:"accessTokenTTL" yaml:"accessTokenTTL"`
+	RefreshTokenTTL int  `json:"refreshTokenTTLDays" yaml:"refreshTokenTTLDays"`
+	MaxFailedLogins int  `json:"maxFailedLogins" yaml:"maxFailedLogins"`
+	LockoutDuration int  `json:"lockoutDuration" yaml:"lockoutDuration"`
+}
+
+// RateLimitConfig limits the requests of each client when Enabled. Clients
+// are told apart by API key or user, and by IP address for requests without
+// credentials. Each group of routes has its own limit: Read for reading the
+// catalogue, Write for changing it, Admin for the admin endpoints and Auth
+// for the user account endpoints and for rejected credentials, which are
+// counted by IP address.
+type RateLimitConfig struct {
+	Enabled bool      `json:"enabled" yaml:"enabled"`
+	Read    RateLimit `json:"read" yaml:"read"`
+	Write   RateLimit `json:"write" yaml:"write"`
+	Admin   RateLimit `json:"admin" yaml:"admin"`
+	Auth    RateLimit `json:"auth" yaml:"auth"`
+}
+
+// RateLimit lets a client make Burst requests at once and RequestsPerMinute
+// on average. Zero RequestsPerMinute lifts the limit.
+type RateLimit struct {
+	RequestsPerMinute int `json:"requestsPerMinute" yaml:"requestsPerMinute"`
+	Burst             int `json:"burst" yaml:"burst"`
 }
@@ -0,0 +1,25 @@
+package models
+
+// Problem is an RFC 7807 problem details object, the body of every error
+// response. Problems of type about:blank mean no more than their status;
+// their title is the status text and detail says what went wrong.
+type Problem struct {
+	Type     string `json:"type" example:"about:blank"`
+	Title    string `json:"title" example:"Not Found"`
+	Status   int    `json:"status" example:"404"`
+	Detail   string `json:"detail,omitempty" example:"Book not found"`
+	Instance string `json:"instance,omitempty" example:"/api/v1/books/42"`
+	// RequestID is the X-Request-ID of the request, for finding it in the
+	// server logs.
+	RequestID string `json:"requestId,omitempty" example:"5f0c7a3e9b1d4c28a6e4f1b2c3d4e5f6"`
+	// Errors lists the rejected fields of a validation problem.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError names a request field, by its JSON path or query parameter,
+// the rule it broke and why.
+type FieldError struct {
+	Field   string `json:"field" example:"title"`
+	Rule    string `json:"rule" example:"required"`
+	Message string `json:"message" example:"is required"`
+}
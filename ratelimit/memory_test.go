@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Unix(1_700_000_000, 0)
+	s.now = func() time.Time { return now }
+	limit := PerMinute(60, 3)
+
+	// A new bucket is full.
+	for remaining := 2; remaining >= 0; remaining-- {
+		res, err := s.Take(ctx, "ci", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, remaining, res.Remaining)
+		assert.Equal(t, time.Duration(3-remaining)*time.Second, res.Reset)
+	}
+	res, err := s.Take(ctx, "ci", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	res, err = s.Take(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "every key has its own bucket")
+
+	// Tokens refill at the rate of the limit.
+	now = now.Add(1500 * time.Millisecond)
+	res, err = s.Take(ctx, "ci", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	res, err = s.Take(ctx, "ci", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	// Peeking does not take a token.
+	res, err = s.Peek(ctx, "ci", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	now = now.Add(500 * time.Millisecond)
+	for range 2 {
+		res, err = s.Peek(ctx, "ci", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 1, res.Remaining)
+	}
+	res, err = s.Peek(ctx, "new", limit)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 3}, res, "new buckets are full")
+
+	// Buckets that are full again are forgotten.
+	now = now.Add(time.Hour)
+	res, err = s.Take(ctx, "ci", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining, "refills up to the burst")
+	assert.Len(t, s.buckets, 1)
+}
@@ -0,0 +1,47 @@
+// Package ratelimit limits how often clients may call the API with token
+// buckets. Each client has a bucket per key holding up to Burst tokens that
+// refill at a steady rate; every request takes a token and is refused when
+// none is left.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is the size of a bucket and how fast it refills.
+type Limit struct {
+	// Rate is the number of tokens added per second.
+	Rate float64
+	// Burst is the number of tokens of a full bucket, which is how many
+	// requests a client that has been idle may make at once.
+	Burst int
+}
+
+// PerMinute returns the limit allowing requests per minute on average and
+// burst at once.
+func PerMinute(requests, burst int) Limit {
+	return Limit{Rate: float64(requests) / 60, Burst: burst}
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	// Allowed reports whether a token was left.
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token, when none was left.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Take takes a token from the bucket of key, which
+// is created full, and Peek reports the bucket as Take would without taking
+// one. Stores must be safe for concurrent use. The in-process MemoryStore
+// serves a single instance; instances sharing their limits need a Store
+// backed by a shared database such as Redis.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	Peek(ctx context.Context, key string, limit Limit) (Result, error)
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// APIKeyRepository stores the API keys accepted in addition to those of the
+// config file. Keys are stored by the digest of the key, never the key
+// itself.
+//
+// Names and hashes are unique: Create fails with ErrDuplicate for a taken
+// one. FindByHash and Delete fail with ErrNotFound for an unknown key. List
+// returns the keys ordered by name.
+type APIKeyRepository interface {
+	List(ctx context.Context) ([]models.APIKey, error)
+	FindByHash(ctx context.Context, hash string) (models.APIKey, error)
+	Create(ctx context.Context, key *models.APIKey) error
+	Delete(ctx context.Context, name string) error
+}
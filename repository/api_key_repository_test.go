@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestAPIKeyRepository(t *testing.T) {
+	implementations := map[string]APIKeyRepository{
+		"gorm":   NewGormAPIKeyRepository(testDB(t)),
+		"memory": NewMemoryAPIKeyRepository(),
+	}
+	for name, repo := range implementations {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			ci := models.APIKey{Name: "ci", Hash: strings.Repeat("a", 64)}
+			require.NoError(t, repo.Create(ctx, &ci))
+			assert.NotZero(t, ci.ID)
+			assert.False(t, ci.CreatedAt.IsZero())
+			require.NoError(t, repo.Create(ctx, &models.APIKey{Name: "backup", Hash: strings.Repeat("b", 64)}))
+
+			assert.ErrorIs(t, repo.Create(ctx, &models.APIKey{Name: "ci", Hash: strings.Repeat("c", 64)}), ErrDuplicate)
+			assert.ErrorIs(t, repo.Create(ctx, &models.APIKey{Name: "other", Hash: ci.Hash}), ErrDuplicate)
+
+			got, err := repo.FindByHash(ctx, ci.Hash)
+			require.NoError(t, err)
+			assert.Equal(t, "ci", got.Name)
+			_, err = repo.FindByHash(ctx, strings.Repeat("d", 64))
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			keys, err := repo.List(ctx)
+			require.NoError(t, err)
+			require.Len(t, keys, 2)
+			assert.Equal(t, "backup", keys[0].Name)
+			assert.Equal(t, "ci", keys[1].Name)
+
+			require.NoError(t, repo.Delete(ctx, "ci"))
+			assert.ErrorIs(t, repo.Delete(ctx, "ci"), ErrNotFound)
+			_, err = repo.FindByHash(ctx, ci.Hash)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
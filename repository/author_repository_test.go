@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// authorImplementations returns fresh book repositories together with the
+// repository of their authors.
+func authorImplementations(t *testing.T) map[string]struct {
+	books   BookRepository
+	authors AuthorRepository
+} {
+	gorm := NewGormBookRepository(testDB(t))
+	memory := NewMemoryBookRepository()
+	return map[string]struct {
+		books   BookRepository
+		authors AuthorRepository
+	}{
+		"gorm":   {gorm, gorm.Authors()},
+		"memory": {memory, memory.Authors()},
+	}
+}
+
+func authorNamesOf(book models.Book) []string {
+	out := []string{}
+	for _, a := range book.Authors {
+		out = append(out, a.Name)
+	}
+	return out
+}
+
+func TestAuthorRepositoryCRUD(t *testing.T) {
+	for name, repos := range authorImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			author := models.Author{Name: "  Ursula   K. Le Guin "}
+			require.NoError(t, repos.authors.Create(ctx, &author))
+			assert.NotZero(t, author.ID)
+			assert.Equal(t, "Ursula K. Le Guin", author.Name)
+
+			got, err := repos.authors.Get(ctx, author.ID)
+			require.NoError(t, err)
+			assert.Equal(t, author.Name, got.Name)
+
+			got, err = repos.authors.FindByName(ctx, "ursula k le guin")
+			require.NoError(t, err)
+			assert.Equal(t, author.ID, got.ID)
+
+			_, err = repos.authors.FindByName(ctx, "Nobody")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repos.authors.Create(ctx, &models.Author{Name: "URSULA K. LE GUIN"}), ErrDuplicate)
+
+			other := models.Author{Name: "Frank Herbert"}
+			require.NoError(t, repos.authors.Create(ctx, &other))
+			other.Name = "Ursula K Le Guin"
+			assert.ErrorIs(t, repos.authors.Update(ctx, &other), ErrDuplicate)
+			assert.ErrorIs(t, repos.authors.Update(ctx, &models.Author{ID: 999, Name: "X"}), ErrNotFound)
+
+			list, err := repos.authors.List(ctx, AuthorListOptions{Name: "GUIN"})
+			require.NoError(t, err)
+			require.Len(t, list, 1)
+			assert.Equal(t, author.ID, list[0].ID)
+			total, err := repos.authors.Count(ctx, "")
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), total)
+
+			require.NoError(t, repos.authors.Delete(ctx, author.ID))
+			_, err = repos.authors.Get(ctx, author.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repos.authors.Delete(ctx, author.ID), ErrNotFound)
+		})
+	}
+}
+
+func TestBookRepositoryAuthors(t *testing.T) {
+	for name, repos := range authorImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			pratchett := models.Author{Name: "Terry Pratchett"}
+			require.NoError(t, repos.authors.Create(ctx, &pratchett))
+
+			book := models.Book{
+				Title: "Good Omens",
+				Year:  1990,
+				Authors: []models.AuthorRef{
+					{ID: pratchett.ID},
+					{Name: "Neil  Gaiman"},
+					{Name: "terry pratchett"},
+				},
+			}
+			require.NoError(t, repos.books.Create(ctx, &book))
+			assert.Equal(t, []string{"Terry Pratchett", "Neil Gaiman"}, authorNamesOf(book))
+			assert.Equal(t, "Terry Pratchett, Neil Gaiman", book.Author)
+
+			got, err := repos.books.Get(ctx, book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, book.Authors, got.Authors)
+
+			gaiman, err := repos.authors.FindByName(ctx, "Neil Gaiman")
+			require.NoError(t, err)
+			solo := models.Book{Title: "Coraline", Author: "Neil Gaiman", Year: 2002}
+			require.NoError(t, repos.books.Create(ctx, &solo))
+			assert.Equal(t, []models.AuthorRef{{ID: gaiman.ID, Name: "Neil Gaiman"}}, solo.Authors)
+
+			listed, err := repos.books.List(ctx, ListOptions{Sort: []SortField{{Field: "id"}}, Filter: BookFilter{AuthorID: gaiman.ID}})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"Good Omens", "Coraline"}, titles(listed))
+			listed, err = repos.books.List(ctx, ListOptions{Filter: BookFilter{Author: "TERRY PRATCHETT"}})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"Good Omens"}, titles(listed))
+
+			assert.ErrorIs(t, repos.authors.Delete(ctx, gaiman.ID), ErrAuthorInUse)
+
+			gaiman.Name = "Neil Richard Gaiman"
+			require.NoError(t, repos.authors.Update(ctx, &gaiman))
+			got, err = repos.books.Get(ctx, book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Terry Pratchett, Neil Richard Gaiman", got.Author)
+			assert.Equal(t, book.Version+1, got.Version)
+
+			got.Authors = []models.AuthorRef{{ID: pratchett.ID}}
+			require.NoError(t, repos.books.Update(ctx, &got))
+			assert.Equal(t, "Terry Pratchett", got.Author)
+
+			unknown := models.Book{Title: "Unknown", Year: 2000, Authors: []models.AuthorRef{{ID: 999}}}
+			assert.ErrorIs(t, repos.books.Create(ctx, &unknown), ErrUnknownAuthor)
+		})
+	}
+}
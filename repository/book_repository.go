@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// ErrNotFound is returned when the requested book does not exist.
+var ErrNotFound = errors.New("book not found")
+
+// ErrDuplicate is returned when a write would violate a uniqueness constraint.
+var ErrDuplicate = errors.New("book already exists")
+
+// ErrVersionConflict is returned when a book was changed after the version
+// an update or delete was based on.
+var ErrVersionConflict = errors.New("book was modified by another request")
+
+// ErrUnknownAuthor is returned when a book refers to an author ID that does
+// not exist.
+var ErrUnknownAuthor = errors.New("unknown author")
+
+// ErrAuthorInUse is returned when deleting an author who is still credited
+// on books, including books in the trash.
+var ErrAuthorInUse = errors.New("author still has books")
+
+// SortableFields lists the book fields that listings can be ordered by.
+var SortableFields = []string{"id", "title", "author", "year"}
+
+// SortField orders a listing by Field, descending when Desc is set.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// BookFilter restricts a listing. Author matches books with an author of
+// that name, compared like author names are; AuthorID matches books with that
+// author. Title matches a case-insensitive substring and the year bounds are
+// inclusive. ISBN matches the book with that compact ISBN-13. Trashed lists
+// the books in the trash instead of the live ones.
+type BookFilter struct {
+	Author   string
+	AuthorID uint
+	Title    string
+	ISBN     string
+	YearFrom *int
+	YearTo   *int
+	Trashed  bool
+}
+
+// ListOptions describes a page of a book listing.
+//
+// Sort must end with the "id" field so that the order is total. When After
+// is set it holds the values of the Sort fields of a book, and the listing
+// starts strictly after that book (or strictly before it when Backwards is
+// set, in which case results are returned in reverse order). Offset is
+// ignored when After is set.
+type ListOptions struct {
+	Filter    BookFilter
+	Sort      []SortField
+	Limit     int
+	Offset    int
+	After     []interface{}
+	Backwards bool
+}
+
+// BookRepository stores books.
+//
+// Create stores a book at version 1. Update only succeeds if the stored book
+// is still at book.Version, and increments the version of both. Delete only
+// succeeds if the stored book is at version, unless version is 0. Both fail
+// with ErrVersionConflict otherwise.
+//
+// Create and Update set the book's timestamps and store its genres, which
+// are returned sorted by name and never nil. Both fail with ErrDuplicate if
+// the book's ISBN is already taken.
+//
+// The authors of a book are given by ID or by name; unknown names become new
+// authors, and unknown IDs fail with ErrUnknownAuthor. A book without Authors
+// has a single author named Author. Create and Update replace the authors of
+// book with the stored ones and set Author to their names.
+//
+// Delete moves a book to the trash, where Get, Update and Delete no longer
+// see it. Restore takes it back out; both increment its version. PurgeTrash
+// permanently removes the books trashed before a time.
+//
+// Search returns a page of the books within opts.Filter matching a
+// full-text query, ranked by relevance, and the number of matching books;
+// implementations may rank only the best matches, see SearchResult. Words of at least four letters that are not in the index also match the
+// indexed words a typo away.
+//
+// Transaction calls fn with a repository whose writes are committed together
+// if fn returns nil and discarded if it returns an error, which Transaction
+// then returns. fn must only use the repository it is given.
+type BookRepository interface {
+	List(ctx context.Context, opts ListOptions) ([]models.Book, error)
+	Count(ctx context.Context, filter BookFilter) (int64, error)
+	Get(ctx context.Context, id uint) (models.Book, error)
+	Create(ctx context.Context, book *models.Book) error
+	Update(ctx context.Context, book *models.Book) error
+	Delete(ctx context.Context, id uint, version uint) error
+	Restore(ctx context.Context, id uint) (models.Book, error)
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	Search(ctx context.Context, opts SearchOptions) (SearchResult, error)
+	Transaction(ctx context.Context, fn func(BookRepository) error) error
+}
+
+// now returns the current time as stored: in UTC, at the millisecond
+// precision every supported database keeps.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// SortValue returns the value of the named sort field of book.
+func SortValue(book models.Book, field string) interface{} {
+	switch field {
+	case "title":
+		return book.Title
+	case "author":
+		return book.Author
+	case "year":
+		return book.Year
+	default:
+		return book.ID
+	}
+}
+
+// AuthorListOptions describes a page of the author listing, ordered by name.
+// Name matches a case-insensitive substring.
+type AuthorListOptions struct {
+	Name   string
+	Limit  int
+	Offset int
+}
+
+// AuthorRepository stores the authors credited on books.
+//
+// Author names are stored with surrounding and repeated spaces removed, and
+// are unique by models.AuthorKey: Create and Update fail with ErrDuplicate for a
+// name that is taken. Renaming an author updates the Author of their books
+// and increments the books' versions. Delete fails with ErrAuthorInUse while
+// the author has books.
+type AuthorRepository interface {
+	List(ctx context.Context, opts AuthorListOptions) ([]models.Author, error)
+	Count(ctx context.Context, name string) (int64, error)
+	Get(ctx context.Context, id uint) (models.Author, error)
+	FindByName(ctx context.Context, name string) (models.Author, error)
+	Create(ctx context.Context, author *models.Author) error
+	Update(ctx context.Context, author *models.Author) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// authorsOf returns the authors book is to be stored with. References
+// without an ID or a name are skipped.
+func authorsOf(book models.Book) []models.AuthorRef {
+	refs := book.Authors
+	if len(refs) == 0 {
+		refs = []models.AuthorRef{{Name: book.Author}}
+	}
+	out := make([]models.AuthorRef, 0, len(refs))
+	for _, ref := range refs {
+		if ref.ID != 0 || models.NormalizeAuthorName(ref.Name) != "" {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// authorNames joins the names of authors for Book.Author.
+func authorNames(authors []models.AuthorRef) string {
+	names := make([]string, len(authors))
+	for i, a := range authors {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/migrations"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/utils"
+)
+
+// testDB returns an empty database for the GORM repository. It is an
+// in-memory SQLite database unless BYFOOD_TEST_DB_DRIVER and
+// BYFOOD_TEST_DB_DSN select another one, e.g.
+//
+//	BYFOOD_TEST_DB_DRIVER=postgres BYFOOD_TEST_DB_DSN=postgres://... go test ./repository
+//
+// Tables in that database are dropped and recreated by every test.
+func testDB(t *testing.T) *gorm.DB {
+	driver := os.Getenv("BYFOOD_TEST_DB_DRIVER")
+	if driver == "" {
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		require.NoError(t, err)
+		migrate(t, db)
+		return db
+	}
+
+	cfg := config.Defaults()
+	cfg.Database.Driver = driver
+	cfg.Database.DSN = os.Getenv("BYFOOD_TEST_DB_DSN")
+	cfg.LogLevel = "error"
+	db, err := utils.OpenDB(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = utils.CloseDB(db) })
+	require.NoError(t, db.Migrator().DropTable("book_genres", "book_authors", "books_fts_terms", "books_fts", &models.Genre{}, &models.Author{}, &models.Book{}, "schema_migrations"))
+	migrate(t, db)
+	return db
+}
+
+func migrate(t *testing.T, db *gorm.DB) {
+	m, err := migrations.New(db)
+	require.NoError(t, err)
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+}
+
+// implementations returns a fresh, empty instance of every BookRepository so
+// that each test runs against all of them.
+func implementations(t *testing.T) map[string]BookRepository {
+	return map[string]BookRepository{
+		"gorm":   NewGormBookRepository(testDB(t)),
+		"memory": NewMemoryBookRepository(),
+	}
+}
+
+func seed(t *testing.T, repo BookRepository) {
+	for _, b := range []models.Book{
+		{Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937},
+		{Title: "The Silmarillion", Author: "J. R. R. Tolkien", Year: 1977},
+		{Title: "Dune", Author: "Frank Herbert", Year: 1965},
+		{Title: "Children of Dune", Author: "Frank Herbert", Year: 1976},
+		{Title: "100% Coverage", Author: "Anon", Year: 2020},
+		{Title: "Dune Messiah", Author: "Frank Herbert", Year: 1969},
+	} {
+		require.NoError(t, repo.Create(context.Background(), &b))
+	}
+}
+
+func titles(books []models.Book) []string {
+	out := []string{}
+	for _, b := range books {
+		out = append(out, b.Title)
+	}
+	return out
+}
+
+func intPtr(n int) *int { return &n }
+
+func TestBookRepositoryCRUD(t *testing.T) {
+	for name, repo := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			book := models.Book{Title: "Title", Author: "Author", Year: 2000}
+			require.NoError(t, repo.Create(ctx, &book))
+			assert.NotZero(t, book.ID)
+			assert.Equal(t, uint(1), book.Version)
+
+			got, err := repo.Get(ctx, book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, book, got)
+
+			book.Title = "Updated"
+			require.NoError(t, repo.Update(ctx, &book))
+			got, err = repo.Get(ctx, book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Updated", got.Title)
+			assert.Equal(t, uint(2), got.Version)
+			assert.Equal(t, got, book)
+
+			require.NoError(t, repo.Delete(ctx, book.ID, book.Version))
+			_, err = repo.Get(ctx, book.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			assert.ErrorIs(t, repo.Delete(ctx, book.ID, 0), ErrNotFound)
+			assert.ErrorIs(t, repo.Update(ctx, &book), ErrNotFound)
+
+			other := models.Book{Title: "Other", Author: "Author", Year: 2001}
+			require.NoError(t, repo.Create(ctx, &other))
+			duplicate := models.Book{ID: other.ID, Title: "Duplicate", Author: "Author", Year: 2002}
+			assert.ErrorIs(t, repo.Create(ctx, &duplicate), ErrDuplicate)
+		})
+	}
+}
+
+func TestBookRepositoryMetadata(t *testing.T) {
+	for name, repo := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			isbn := "9780261103344"
+
+			book := models.Book{
+				Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937,
+				ISBN: &isbn, Publisher: "Allen & Unwin", Language: "en", PageCount: 310, Description: "There and back again.",
+				Genres: []models.Genre{{Name: "fantasy"}, {Name: "classic"}},
+			}
+			require.NoError(t, repo.Create(ctx, &book))
+			assert.Equal(t, []string{"classic", "fantasy"}, genreNames(book))
+			assert.WithinDuration(t, time.Now(), book.CreatedAt, time.Minute)
+			assert.Equal(t, book.CreatedAt, book.UpdatedAt)
+
+			got, err := repo.Get(ctx, book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, book, got)
+
+			other := models.Book{Title: "Other", Author: "A", Genres: []models.Genre{{Name: "fantasy"}, {Name: "epic"}}}
+			require.NoError(t, repo.Create(ctx, &other))
+			other.ISBN = &isbn
+			assert.ErrorIs(t, repo.Update(ctx, &other), ErrDuplicate)
+			duplicate := models.Book{Title: "Copy", Author: "A", ISBN: &isbn}
+			assert.ErrorIs(t, repo.Create(ctx, &duplicate), ErrDuplicate)
+			byISBN, err := repo.List(ctx, ListOptions{Filter: BookFilter{ISBN: isbn}})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"The Hobbit"}, titles(byISBN))
+
+			createdAt := book.CreatedAt
+			book.Genres = []models.Genre{{Name: "epic"}, {Name: "children"}}
+			book.PageCount = 320
+			time.Sleep(2 * time.Millisecond)
+			require.NoError(t, repo.Update(ctx, &book))
+			assert.Equal(t, createdAt, book.CreatedAt)
+			assert.True(t, book.UpdatedAt.After(createdAt))
+			got, err = repo.Get(ctx, book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, book, got)
+			assert.Equal(t, []string{"children", "epic"}, genreNames(got))
+
+			// A trashed book keeps its ISBN.
+			require.NoError(t, repo.Delete(ctx, book.ID, 0))
+			assert.ErrorIs(t, repo.Create(ctx, &duplicate), ErrDuplicate)
+			purged, err := repo.PurgeTrash(ctx, time.Now().Add(time.Second))
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), purged)
+			require.NoError(t, repo.Create(ctx, &duplicate))
+
+			got, err = repo.Get(ctx, other.ID)
+			require.NoError(t, err)
+			assert.Nil(t, got.ISBN)
+			assert.Equal(t, []string{"epic", "fantasy"}, genreNames(got))
+		})
+	}
+}
+
+func genreNames(book models.Book) []string {
+	names := []string{}
+	for _, g := range book.Genres {
+		names = append(names, g.Name)
+	}
+	return names
+}
+
+func TestBookRepositoryVersionConflicts(t *testing.T) {
+	for name, repo := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			book := models.Book{Title: "Title", Author: "Author", Year: 2000}
+			require.NoError(t, repo.Create(ctx, &book))
+			first, second := book, book
+
+			first.Title = "First"
+			require.NoError(t, repo.Update(ctx, &first))
+			second.Title = "Second"
+			assert.ErrorIs(t, repo.Update(ctx, &second), ErrVersionConflict)
+			assert.Equal(t, uint(1), second.Version)
+			assert.ErrorIs(t, repo.Delete(ctx, book.ID, book.Version), ErrVersionConflict)
+
+			got, err := repo.Get(ctx, book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, first, got)
+
+			require.NoError(t, repo.Delete(ctx, book.ID, 0))
+		})
+	}
+}
+
+func TestBookRepositoryTrash(t *testing.T) {
+	for name, repo := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seed(t, repo)
+
+			require.NoError(t, repo.Delete(ctx, 1, 1))
+			require.NoError(t, repo.Delete(ctx, 3, 0))
+
+			_, err := repo.Get(ctx, 1)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Delete(ctx, 1, 0), ErrNotFound)
+			assert.ErrorIs(t, repo.Update(ctx, &models.Book{ID: 1, Title: "T", Author: "A", Version: 2}), ErrNotFound)
+
+			live, err := repo.List(ctx, ListOptions{Sort: []SortField{{Field: "id"}}})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"The Silmarillion", "Children of Dune", "100% Coverage", "Dune Messiah"}, titles(live))
+
+			trash, err := repo.List(ctx, ListOptions{Sort: []SortField{{Field: "id"}}, Filter: BookFilter{Trashed: true}})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"The Hobbit", "Dune"}, titles(trash))
+			for _, b := range trash {
+				require.NotNil(t, b.DeletedAt)
+				assert.WithinDuration(t, time.Now(), *b.DeletedAt, time.Minute)
+				assert.Equal(t, uint(2), b.Version)
+			}
+			n, err := repo.Count(ctx, BookFilter{Trashed: true, Author: "frank herbert"})
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+
+			restored, err := repo.Restore(ctx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, "The Hobbit", restored.Title)
+			assert.Nil(t, restored.DeletedAt)
+			assert.Equal(t, uint(3), restored.Version)
+			got, err := repo.Get(ctx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, restored, got)
+			_, err = repo.Restore(ctx, 1)
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = repo.Restore(ctx, 999)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			purged, err := repo.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Zero(t, purged)
+			purged, err = repo.PurgeTrash(ctx, time.Now().Add(time.Second))
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), purged)
+			_, err = repo.Restore(ctx, 3)
+			assert.ErrorIs(t, err, ErrNotFound)
+			total, err := repo.Count(ctx, BookFilter{})
+			require.NoError(t, err)
+			assert.Equal(t, int64(5), total)
+		})
+	}
+}
+
+func TestBookRepositoryTransaction(t *testing.T) {
+	for name, repo := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			seed(t, repo)
+			errAbort := errors.New("abort")
+
+			err := repo.Transaction(ctx, func(tx BookRepository) error {
+				require.NoError(t, tx.Delete(ctx, 1, 0))
+				require.NoError(t, tx.Create(ctx, &models.Book{Title: "Emma", Author: "Jane Austen", Year: 1815}))
+				return errAbort
+			})
+			assert.ErrorIs(t, err, errAbort)
+			all, err := repo.List(ctx, ListOptions{Sort: []SortField{{Field: "id"}}})
+			require.NoError(t, err)
+			assert.Len(t, all, 6)
+			assert.Equal(t, "The Hobbit", all[0].Title)
+			n, err := repo.Count(ctx, BookFilter{Author: "Jane Austen"})
+			require.NoError(t, err)
+			assert.Zero(t, n)
+
+			var created models.Book
+			err = repo.Transaction(ctx, func(tx BookRepository) error {
+				if err := tx.Delete(ctx, 1, 0); err != nil {
+					return err
+				}
+				created = models.Book{Title: "Emma", Author: "Jane Austen", Year: 1815}
+				return tx.Create(ctx, &created)
+			})
+			require.NoError(t, err)
+			got, err := repo.Get(ctx, created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Jane Austen", got.Author)
+			_, err = repo.Get(ctx, 1)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestBookRepositoryList(t *testing.T) {
+	byID := []SortField{{Field: "id"}}
+	tests := []struct {
+		name   string
+		opts   ListOptions
+		expect []string
+		total  int64
+	}{
+		{
+			name:   "offset and limit",
+			opts:   ListOptions{Sort: byID, Limit: 2, Offset: 1},
+			expect: []string{"The Silmarillion", "Dune"},
+			total:  6,
+		},
+		{
+			name:   "offset past the end",
+			opts:   ListOptions{Sort: byID, Offset: 10},
+			expect: []string{},
+			total:  6,
+		},
+		{
+			name:   "mixed sort directions",
+			opts:   ListOptions{Sort: []SortField{{Field: "author", Desc: true}, {Field: "year"}, {Field: "id"}}},
+			expect: []string{"The Hobbit", "The Silmarillion", "Dune", "Dune Messiah", "Children of Dune", "100% Coverage"},
+			total:  6,
+		},
+		{
+			name:   "author filter",
+			opts:   ListOptions{Sort: byID, Filter: BookFilter{Author: "FRANK HERBERT"}},
+			expect: []string{"Dune", "Children of Dune", "Dune Messiah"},
+			total:  3,
+		},
+		{
+			name:   "title filter with wildcard characters",
+			opts:   ListOptions{Sort: byID, Filter: BookFilter{Title: "0%"}},
+			expect: []string{"100% Coverage"},
+			total:  1,
+		},
+		{
+			name:   "title filter with the escape character",
+			opts:   ListOptions{Sort: byID, Filter: BookFilter{Title: "!"}},
+			expect: []string{},
+			total:  0,
+		},
+		{
+			name:   "title filter ignores case",
+			opts:   ListOptions{Sort: byID, Filter: BookFilter{Title: "dUnE"}},
+			expect: []string{"Dune", "Children of Dune", "Dune Messiah"},
+			total:  3,
+		},
+		{
+			name:   "year range",
+			opts:   ListOptions{Sort: byID, Filter: BookFilter{YearFrom: intPtr(1965), YearTo: intPtr(1970)}},
+			expect: []string{"Dune", "Dune Messiah"},
+			total:  2,
+		},
+		{
+			name: "seek forwards",
+			opts: ListOptions{
+				Sort:  []SortField{{Field: "author"}, {Field: "year", Desc: true}, {Field: "id"}},
+				After: []interface{}{"Frank Herbert", int64(1969), int64(6)},
+				Limit: 3,
+			},
+			expect: []string{"Dune", "The Silmarillion", "The Hobbit"},
+			total:  6,
+		},
+		{
+			name: "seek backwards",
+			opts: ListOptions{
+				Sort:      []SortField{{Field: "author"}, {Field: "year", Desc: true}, {Field: "id"}},
+				After:     []interface{}{"Frank Herbert", int64(1969), int64(6)},
+				Backwards: true,
+			},
+			expect: []string{"Children of Dune", "100% Coverage"},
+			total:  6,
+		},
+	}
+
+	for name, repo := range implementations(t) {
+		seed(t, repo)
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				books, err := repo.List(ctx, tt.opts)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expect, titles(books))
+
+				total, err := repo.Count(ctx, tt.opts.Filter)
+				require.NoError(t, err)
+				assert.Equal(t, tt.total, total)
+			})
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// The SQL built by GormBookRepository must run unchanged on SQLite,
+// PostgreSQL and MySQL. Everything that differs between them is handled here.
+
+// likeEscape is the LIKE escape character. A backslash would be simpler, but
+// MySQL also treats it as an escape inside string literals, so '\' would be
+// an unterminated literal there.
+const likeEscape = "!"
+
+var likeEscaper = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+
+// containsFold returns a condition, and the value to bind to it, matching
+// rows whose column contains substr ignoring case. MySQL's default
+// collations already ignore case but PostgreSQL and SQLite compare bytes, so
+// both sides are lowered.
+func containsFold(column, substr string) (string, string) {
+	return "LOWER(" + column + ") LIKE ? ESCAPE '" + likeEscape + "'",
+		"%" + likeEscaper.Replace(strings.ToLower(substr)) + "%"
+}
+
+// translateError maps driver specific errors to the repository's errors.
+// Each GORM dialector knows its own driver's error codes, so translation is
+// delegated to it whatever the gorm.Config says.
+func translateError(db *gorm.DB, err error) error {
+	if err == nil {
+		return nil
+	}
+	if t, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = t.Translate(err)
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// fullTextCandidates narrows db, a query on books, to the candidates for a
+// search found by the driver's full-text index: the books_fts table on
+// SQLite, the search column on PostgreSQL and the FULLTEXT index on MySQL.
+// Candidates come best first by the index's own ranking (bm25, ts_rank and
+// the MATCH score), which weighs titles above authors above descriptions
+// like the repository does. They are ranked, and checked, by the repository
+// itself, so the index only needs to find a superset of the matches.
+func fullTextCandidates(db *gorm.DB, p searchPlan) *gorm.DB {
+	query := fullTextQuery(db.Dialector.Name(), p)
+	switch db.Dialector.Name() {
+	case "postgres":
+		return db.Where("search @@ to_tsquery('simple', ?)", query).
+			Order(clause.OrderBy{Expression: clause.Expr{SQL: "ts_rank(search, to_tsquery('simple', ?)) DESC", Vars: []interface{}{query}}})
+	case "mysql":
+		match := "MATCH (title, author, description) AGAINST (? IN BOOLEAN MODE)"
+		return db.Where(match, query).
+			Order(clause.OrderBy{Expression: clause.Expr{SQL: match + " DESC", Vars: []interface{}{query}}})
+	default:
+		return db.Joins("JOIN (SELECT rowid AS book_id, bm25(books_fts, 3, 2, 1) AS search_rank "+
+			"FROM books_fts WHERE books_fts MATCH ?) AS fts ON fts.book_id = books.id", query).
+			Order("fts.search_rank")
+	}
+}
+
+// fullTextQuery returns the query selecting the candidates for p in the
+// full-text query syntax of driver. SQLite words are quoted so that none is
+// taken for an operator.
+func fullTextQuery(driver string, p searchPlan) string {
+	var parts []string
+	for i, t := range p.terms {
+		words := p.variants[i]
+		if words == nil {
+			words = t.Words[:1]
+		}
+		switch driver {
+		case "postgres":
+			switch {
+			case len(t.Words) > 1:
+				parts = append(parts, "("+strings.Join(t.Words, " <-> ")+")")
+			case t.Prefix:
+				parts = append(parts, t.Words[0]+":*")
+			default:
+				parts = append(parts, "("+strings.Join(words, " | ")+")")
+			}
+		case "mysql":
+			switch {
+			case len(t.Words) > 1:
+				parts = append(parts, `+"`+strings.Join(t.Words, " ")+`"`)
+			case t.Prefix:
+				parts = append(parts, "+"+t.Words[0]+"*")
+			default:
+				parts = append(parts, "+("+strings.Join(words, " ")+")")
+			}
+		default:
+			switch {
+			case len(t.Words) > 1:
+				parts = append(parts, `"`+strings.Join(t.Words, " ")+`"`)
+			case t.Prefix:
+				parts = append(parts, `"`+t.Words[0]+`"*`)
+			default:
+				parts = append(parts, `("`+strings.Join(words, `" OR "`)+`")`)
+			}
+		}
+	}
+	switch driver {
+	case "postgres":
+		return strings.Join(parts, " & ")
+	case "mysql":
+		return strings.Join(parts, " ")
+	default:
+		return strings.Join(parts, " AND ")
+	}
+}
+
+// vocabularyBatch is the number of books read at a time to collect the
+// words of MySQL's index.
+const vocabularyBatch = 500
+
+// indexedWords returns the words in the full-text index, which typos are
+// corrected to, cached in v. MySQL does not expose the words of its index,
+// so they are collected from the books there, and only from those updated
+// since the cache was last filled.
+func indexedWords(db *gorm.DB, v *vocabulary) ([]string, error) {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return v.get(func() ([]string, error) {
+			var words []string
+			err := db.Raw("SELECT word FROM ts_stat('SELECT search FROM books')").Scan(&words).Error
+			return words, err
+		})
+	case "mysql":
+		return v.extend(func(since time.Time) ([]string, time.Time, error) {
+			return wordsSince(db, since)
+		})
+	default:
+		return v.get(func() ([]string, error) {
+			var words []string
+			err := db.Raw("SELECT term FROM books_fts_terms").Scan(&words).Error
+			return words, err
+		})
+	}
+}
+
+// wordsSince returns the words of the books updated since the given time,
+// or of every book when it is zero, and the newest update time among them.
+// Books are read in batches so that only their words are held at once.
+func wordsSince(db *gorm.DB, since time.Time) ([]string, time.Time, error) {
+	var words []string
+	newest := since
+	query := db.Model(&models.Book{}).Select("id", "title", "author", "description", "updated_at")
+	if !since.IsZero() {
+		query = query.Where("updated_at >= ?", since)
+	}
+	var batch []models.Book
+	err := query.FindInBatches(&batch, vocabularyBatch, func(*gorm.DB, int) error {
+		words = append(words, vocabularyOf(batch)...)
+		for _, b := range batch {
+			if b.UpdatedAt.After(newest) {
+				newest = b.UpdatedAt
+			}
+		}
+		return nil
+	}).Error
+	return words, newest, err
+}
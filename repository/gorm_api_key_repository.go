@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// GormAPIKeyRepository is an APIKeyRepository backed by a GORM database.
+type GormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAPIKeyRepository returns a repository using db.
+func NewGormAPIKeyRepository(db *gorm.DB) *GormAPIKeyRepository {
+	return &GormAPIKeyRepository{db: db.Session(&gorm.Session{NowFunc: now})}
+}
+
+func (r *GormAPIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	if err := r.db.WithContext(ctx).Order("name").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *GormAPIKeyRepository) FindByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return key, ErrNotFound
+	}
+	return key, err
+}
+
+func (r *GormAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return translateError(r.db, r.db.WithContext(ctx).Create(key).Error)
+}
+
+func (r *GormAPIKeyRepository) Delete(ctx context.Context, name string) error {
+	result := r.db.WithContext(ctx).Where("name = ?", name).Delete(&models.APIKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// GormAuthorRepository is an AuthorRepository backed by a GORM database.
+type GormAuthorRepository struct {
+	db    *gorm.DB
+	words *vocabulary
+}
+
+// NewGormAuthorRepository returns a repository using db. Searches correct
+// typos to the new names of renamed authors at once only when they are
+// renamed through GormBookRepository.Authors.
+func NewGormAuthorRepository(db *gorm.DB) *GormAuthorRepository {
+	return &GormAuthorRepository{db: db.Session(&gorm.Session{NowFunc: now}), words: &vocabulary{}}
+}
+
+func (r *GormAuthorRepository) List(ctx context.Context, opts AuthorListOptions) ([]models.Author, error) {
+	db := filterAuthors(r.db.WithContext(ctx), opts.Name).Order("name").Order("id").Offset(opts.Offset)
+	if opts.Limit > 0 {
+		db = db.Limit(opts.Limit)
+	}
+	authors := []models.Author{}
+	if err := db.Find(&authors).Error; err != nil {
+		return nil, err
+	}
+	return authors, nil
+}
+
+func (r *GormAuthorRepository) Count(ctx context.Context, name string) (int64, error) {
+	var total int64
+	err := filterAuthors(r.db.WithContext(ctx).Model(&models.Author{}), name).Count(&total).Error
+	return total, err
+}
+
+func filterAuthors(db *gorm.DB, name string) *gorm.DB {
+	if name == "" {
+		return db
+	}
+	cond, pattern := containsFold("name", name)
+	return db.Where(cond, pattern)
+}
+
+func (r *GormAuthorRepository) Get(ctx context.Context, id uint) (models.Author, error) {
+	return r.first(r.db.WithContext(ctx).Where("id = ?", id))
+}
+
+func (r *GormAuthorRepository) FindByName(ctx context.Context, name string) (models.Author, error) {
+	return r.first(r.db.WithContext(ctx).Where("name_key = ?", models.AuthorKey(name)))
+}
+
+func (r *GormAuthorRepository) first(db *gorm.DB) (models.Author, error) {
+	var author models.Author
+	err := db.First(&author).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return author, ErrNotFound
+	}
+	return author, err
+}
+
+func (r *GormAuthorRepository) Create(ctx context.Context, author *models.Author) error {
+	author.Name = models.NormalizeAuthorName(author.Name)
+	author.NameKey = models.AuthorKey(author.Name)
+	return translateError(r.db, r.db.WithContext(ctx).Create(author).Error)
+}
+
+// Update renames the author and rewrites the Author of their books in the
+// same transaction.
+func (r *GormAuthorRepository) Update(ctx context.Context, author *models.Author) error {
+	next := *author
+	next.Name = models.NormalizeAuthorName(author.Name)
+	next.NameKey = models.AuthorKey(next.Name)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&next).Select("name", "name_key", "updated_at").Updates(&next)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := tx.First(&next, next.ID).Error; err != nil {
+			return err
+		}
+		var bookIDs []uint
+		if err := tx.Model(&bookAuthor{}).Where("author_id = ?", next.ID).Pluck("book_id", &bookIDs).Error; err != nil {
+			return err
+		}
+		books := make([]models.Book, len(bookIDs))
+		for i, id := range bookIDs {
+			books[i].ID = id
+		}
+		if err := loadAuthors(tx, books); err != nil {
+			return err
+		}
+		for _, b := range books {
+			err := tx.Model(&models.Book{}).Where("id = ?", b.ID).Updates(map[string]interface{}{
+				"author":  authorNames(b.Authors),
+				"version": gorm.Expr("version + 1"),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return translateError(r.db, err)
+	}
+	r.words.invalidate()
+	*author = next
+	return nil
+}
+
+func (r *GormAuthorRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&bookAuthor{}).Where("author_id = ?", id).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrAuthorInUse
+		}
+		result := tx.Delete(&models.Author{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,520 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// Conditions selecting live and trashed books.
+const (
+	live    = "deleted_at IS NULL"
+	trashed = "deleted_at IS NOT NULL"
+)
+
+// GormBookRepository is a BookRepository backed by a GORM database.
+type GormBookRepository struct {
+	db    *gorm.DB
+	words *vocabulary
+	// window is the number of best candidates a search ranks by relevance.
+	window int
+}
+
+// bookGenre is a row of the table linking books to their genres.
+type bookGenre struct {
+	BookID  uint
+	GenreID uint
+}
+
+func (bookGenre) TableName() string { return "book_genres" }
+
+// bookAuthor is a row of the table linking books to their authors. Ordinal
+// is the position of the author in the book's credits.
+type bookAuthor struct {
+	BookID   uint
+	AuthorID uint
+	Ordinal  int
+}
+
+func (bookAuthor) TableName() string { return "book_authors" }
+
+// NewGormBookRepository returns a repository using db.
+func NewGormBookRepository(db *gorm.DB) *GormBookRepository {
+	return &GormBookRepository{db: db.Session(&gorm.Session{NowFunc: now}), words: &vocabulary{}, window: maxSearchCandidates}
+}
+
+// Authors returns the repository of the authors credited on r's books.
+// Renaming an author through it rewrites the books' author text, so their
+// search vocabulary is refreshed.
+func (r *GormBookRepository) Authors() *GormAuthorRepository {
+	return &GormAuthorRepository{db: r.db, words: r.words}
+}
+
+func (r *GormBookRepository) List(ctx context.Context, opts ListOptions) ([]models.Book, error) {
+	db := applyFilter(r.db.WithContext(ctx), opts.Filter)
+	if opts.After != nil {
+		db = applySeek(db, opts.Sort, opts.After, opts.Backwards)
+	} else {
+		db = applyOrder(db, opts.Sort, false).Offset(opts.Offset)
+	}
+	if opts.Limit > 0 {
+		db = db.Limit(opts.Limit)
+	}
+	books := []models.Book{}
+	if err := preloadGenres(db).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	if err := loadAuthors(r.db.WithContext(ctx), books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (r *GormBookRepository) Count(ctx context.Context, filter BookFilter) (int64, error) {
+	var total int64
+	err := applyFilter(r.db.WithContext(ctx).Model(&models.Book{}), filter).Count(&total).Error
+	return total, err
+}
+
+func (r *GormBookRepository) Get(ctx context.Context, id uint) (models.Book, error) {
+	var book models.Book
+	db := r.db.WithContext(ctx)
+	err := preloadGenres(db).Where(live).First(&book, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return book, ErrNotFound
+	}
+	if err != nil {
+		return book, err
+	}
+	return book, loadAuthor(db, &book)
+}
+
+func (r *GormBookRepository) Create(ctx context.Context, book *models.Book) error {
+	book.Version = 1
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := resolveAuthors(tx, book); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(book).Error; err != nil {
+			return err
+		}
+		if err := linkAuthors(tx, book); err != nil {
+			return err
+		}
+		return setGenres(tx, book)
+	})
+	if err != nil {
+		return translateError(r.db, err)
+	}
+	r.words.invalidate()
+	return nil
+}
+
+func (r *GormBookRepository) Update(ctx context.Context, book *models.Book) error {
+	next := *book
+	next.Version++
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := resolveAuthors(tx, &next); err != nil {
+			return err
+		}
+		result := tx.Model(&next).Where(live).Where("version = ?", book.Version).
+			Select("*").Omit(clause.Associations, "created_at").Updates(&next)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return missingOrConflict(tx, book.ID)
+		}
+		if err := tx.Where("book_id = ?", book.ID).Delete(&bookAuthor{}).Error; err != nil {
+			return err
+		}
+		if err := linkAuthors(tx, &next); err != nil {
+			return err
+		}
+		if err := tx.Where("book_id = ?", book.ID).Delete(&bookGenre{}).Error; err != nil {
+			return err
+		}
+		return setGenres(tx, &next)
+	})
+	if err != nil {
+		return translateError(r.db, err)
+	}
+	r.words.invalidate()
+	*book = next
+	return nil
+}
+
+func (r *GormBookRepository) Delete(ctx context.Context, id uint, version uint) error {
+	db := r.db.WithContext(ctx).Model(&models.Book{}).Where("id = ?", id).Where(live)
+	if version != 0 {
+		db = db.Where("version = ?", version)
+	}
+	result := db.Updates(map[string]interface{}{
+		"deleted_at": now(),
+		"version":    gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return missingOrConflict(r.db.WithContext(ctx), id)
+	}
+	return nil
+}
+
+func (r *GormBookRepository) Restore(ctx context.Context, id uint) (models.Book, error) {
+	var book models.Book
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Book{}).Where("id = ?", id).Where(trashed).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := preloadGenres(tx).First(&book, id).Error; err != nil {
+			return err
+		}
+		return loadAuthor(tx, &book)
+	})
+	if err != nil {
+		return book, err
+	}
+	r.words.invalidate()
+	return book, nil
+}
+
+func (r *GormBookRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&models.Book{}).Select("id").Where(trashed).Where("deleted_at < ?", before.UTC())
+		if err := tx.Where("book_id IN (?)", expired).Delete(&bookGenre{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("book_id IN (?)", expired).Delete(&bookAuthor{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where(trashed).Where("deleted_at < ?", before.UTC()).Delete(&models.Book{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.words.invalidate()
+	return purged, nil
+}
+
+// Transaction runs fn in a database transaction. The writes fn makes use
+// savepoints within it.
+func (r *GormBookRepository) Transaction(ctx context.Context, fn func(BookRepository) error) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormBookRepository{db: tx, words: r.words, window: r.window})
+	})
+	if err != nil {
+		return err
+	}
+	// Searches during fn may have cached the words before the commit.
+	r.words.invalidate()
+	return nil
+}
+
+// Search ranks the candidates found by the full-text index in Go, like
+// MemoryBookRepository does, so results are the same on every driver. Only
+// the r.window best candidates by the index's ranking are ranked; pages past
+// them are read in the index's order. Only the page of hits is loaded in
+// full.
+func (r *GormBookRepository) Search(ctx context.Context, opts SearchOptions) (SearchResult, error) {
+	db := r.db.WithContext(ctx)
+	p, err := plan(opts.Query, func() ([]string, error) {
+		return indexedWords(db, r.words)
+	})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	candidates := func() *gorm.DB {
+		return applyFilter(fullTextCandidates(db.Model(&models.Book{}), p), opts.Filter)
+	}
+	var matched int64
+	if err := candidates().Count(&matched).Error; err != nil {
+		return SearchResult{}, err
+	}
+	var window []models.Book
+	err = candidates().Order("books.id").Select("id", "title", "author", "description").
+		Limit(r.window).Find(&window).Error
+	if err != nil {
+		return SearchResult{}, err
+	}
+	docs := p.rank(window)
+	hits := p.page(docs, opts)
+	result := SearchResult{Total: int64(len(docs))}
+	if matched > int64(r.window) {
+		// The index's count may include the odd book the repository does not
+		// match, which is left out of the pages past the window.
+		result.Total, result.Windowed = matched, true
+		if opts.Limit <= 0 || len(hits) < opts.Limit {
+			tail := candidates().Order("books.id").Select("id", "title", "author", "description").
+				Offset(r.window + max(0, opts.Offset-len(docs)))
+			if opts.Limit > 0 {
+				tail = tail.Limit(opts.Limit - len(hits))
+			}
+			var rest []models.Book
+			if err := tail.Find(&rest).Error; err != nil {
+				return SearchResult{}, err
+			}
+			for _, d := range p.score(rest) {
+				hits = append(hits, p.hit(d))
+			}
+		}
+	}
+	if len(hits) == 0 {
+		result.Hits = hits
+		return result, nil
+	}
+
+	ids := make([]uint, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	var books []models.Book
+	if err := preloadGenres(db).Where("id IN ?", ids).Find(&books).Error; err != nil {
+		return SearchResult{}, err
+	}
+	if err := loadAuthors(db, books); err != nil {
+		return SearchResult{}, err
+	}
+	byID := make(map[uint]models.Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+	// Books deleted since the candidates were read are left out.
+	loaded := hits[:0]
+	for _, h := range hits {
+		if b, ok := byID[h.ID]; ok {
+			h.Book = b
+			loaded = append(loaded, h)
+		}
+	}
+	result.Hits = loaded
+	return result, nil
+}
+
+// resolveAuthors replaces the authors of book with stored ones, creating the
+// authors given by a name that is not taken yet, and sets book.Author.
+// Authors named more than once are only kept at their first position.
+func resolveAuthors(tx *gorm.DB, book *models.Book) error {
+	refs := authorsOf(*book)
+	authors := make([]models.AuthorRef, 0, len(refs))
+	seen := map[uint]bool{}
+	for _, ref := range refs {
+		var author models.Author
+		if ref.ID != 0 {
+			err := tx.First(&author, ref.ID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %d", ErrUnknownAuthor, ref.ID)
+			}
+			if err != nil {
+				return err
+			}
+		} else {
+			name := models.NormalizeAuthorName(ref.Name)
+			author = models.Author{Name: name, NameKey: models.AuthorKey(name)}
+			// Another writer may create the same author concurrently.
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&author).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("name_key = ?", author.NameKey).First(&author).Error; err != nil {
+				return err
+			}
+		}
+		if !seen[author.ID] {
+			seen[author.ID] = true
+			authors = append(authors, models.AuthorRef{ID: author.ID, Name: author.Name})
+		}
+	}
+	book.Authors = authors
+	book.Author = authorNames(authors)
+	return nil
+}
+
+// linkAuthors stores the links between book and its resolved authors.
+func linkAuthors(tx *gorm.DB, book *models.Book) error {
+	if len(book.Authors) == 0 {
+		return nil
+	}
+	links := make([]bookAuthor, len(book.Authors))
+	for i, a := range book.Authors {
+		links[i] = bookAuthor{BookID: book.ID, AuthorID: a.ID, Ordinal: i}
+	}
+	return tx.Create(&links).Error
+}
+
+// loadAuthors sets the authors of books, in credit order.
+func loadAuthors(db *gorm.DB, books []models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+	index := make(map[uint]int, len(books))
+	ids := make([]uint, len(books))
+	for i := range books {
+		books[i].Authors = []models.AuthorRef{}
+		index[books[i].ID] = i
+		ids[i] = books[i].ID
+	}
+	var rows []struct {
+		BookID uint
+		ID     uint
+		Name   string
+	}
+	err := db.Table("book_authors").
+		Select("book_authors.book_id, authors.id, authors.name").
+		Joins("JOIN authors ON authors.id = book_authors.author_id").
+		Where("book_authors.book_id IN ?", ids).
+		Order("book_authors.book_id, book_authors.ordinal").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		b := &books[index[row.BookID]]
+		b.Authors = append(b.Authors, models.AuthorRef{ID: row.ID, Name: row.Name})
+	}
+	return nil
+}
+
+// loadAuthor sets the authors of book.
+func loadAuthor(db *gorm.DB, book *models.Book) error {
+	books := []models.Book{*book}
+	if err := loadAuthors(db, books); err != nil {
+		return err
+	}
+	*book = books[0]
+	return nil
+}
+
+// setGenres links book to its genres, creating the genres that do not exist
+// yet. The genres of book are replaced by the stored ones.
+func setGenres(tx *gorm.DB, book *models.Book) error {
+	if len(book.Genres) == 0 {
+		book.Genres = []models.Genre{}
+		return nil
+	}
+	names := make([]string, len(book.Genres))
+	missing := make([]models.Genre, len(book.Genres))
+	for i, g := range book.Genres {
+		names[i] = g.Name
+		missing[i] = models.Genre{Name: g.Name}
+	}
+	// Another writer may create the same genre concurrently.
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+		return err
+	}
+	var genres []models.Genre
+	if err := tx.Where("name IN ?", names).Order("name").Find(&genres).Error; err != nil {
+		return err
+	}
+	links := make([]bookGenre, len(genres))
+	for i, g := range genres {
+		links[i] = bookGenre{BookID: book.ID, GenreID: g.ID}
+	}
+	if err := tx.Create(&links).Error; err != nil {
+		return err
+	}
+	book.Genres = genres
+	return nil
+}
+
+// preloadGenres loads the genres of the queried books, sorted by name.
+func preloadGenres(db *gorm.DB) *gorm.DB {
+	return db.Preload("Genres", func(db *gorm.DB) *gorm.DB { return db.Order("genres.name") })
+}
+
+// missingOrConflict explains why a conditional write to book id matched no
+// rows.
+func missingOrConflict(db *gorm.DB, id uint) error {
+	var n int64
+	if err := db.Model(&models.Book{}).Where("id = ?", id).Where(live).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+func applyFilter(db *gorm.DB, f BookFilter) *gorm.DB {
+	if f.Trashed {
+		db = db.Where(trashed)
+	} else {
+		db = db.Where(live)
+	}
+	if f.Author != "" {
+		db = db.Where("id IN (?)", db.Session(&gorm.Session{NewDB: true}).Table("book_authors").
+			Select("book_authors.book_id").
+			Joins("JOIN authors ON authors.id = book_authors.author_id").
+			Where("authors.name_key = ?", models.AuthorKey(f.Author)))
+	}
+	if f.AuthorID != 0 {
+		db = db.Where("id IN (?)", db.Session(&gorm.Session{NewDB: true}).Table("book_authors").
+			Select("book_id").Where("author_id = ?", f.AuthorID))
+	}
+	if f.Title != "" {
+		cond, pattern := containsFold("title", f.Title)
+		db = db.Where(cond, pattern)
+	}
+	if f.ISBN != "" {
+		db = db.Where("isbn = ?", f.ISBN)
+	}
+	if f.YearFrom != nil {
+		db = db.Where("year >= ?", *f.YearFrom)
+	}
+	if f.YearTo != nil {
+		db = db.Where("year <= ?", *f.YearTo)
+	}
+	return db
+}
+
+// applyOrder orders db by sort, reversing every direction when backwards.
+func applyOrder(db *gorm.DB, sort []SortField, backwards bool) *gorm.DB {
+	for _, f := range sort {
+		if f.Desc != backwards {
+			db = db.Order(f.Field + " DESC")
+		} else {
+			db = db.Order(f.Field + " ASC")
+		}
+	}
+	return db
+}
+
+// applySeek restricts db to the rows strictly after the keyset position
+// after in the direction of travel, using the expanded row comparison
+// (a > x) OR (a = x AND b > y) OR ... so mixed sort directions work.
+func applySeek(db *gorm.DB, sort []SortField, after []interface{}, backwards bool) *gorm.DB {
+	var clauses []string
+	var values []interface{}
+	for i, f := range sort {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, sort[j].Field+" = ?")
+			values = append(values, after[j])
+		}
+		op := ">"
+		if f.Desc != backwards {
+			op = "<"
+		}
+		parts = append(parts, f.Field+" "+op+" ?")
+		values = append(values, after[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return applyOrder(db.Where(strings.Join(clauses, " OR "), values...), sort, backwards)
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// GormUserRepository is a UserRepository backed by a GORM database.
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+// NewGormUserRepository returns a repository using db.
+func NewGormUserRepository(db *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{db: db.Session(&gorm.Session{NowFunc: now})}
+}
+
+func (r *GormUserRepository) List(ctx context.Context) ([]models.User, error) {
+	users := []models.User{}
+	if err := r.db.WithContext(ctx).Order("email").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *GormUserRepository) Get(ctx context.Context, id uint) (models.User, error) {
+	return r.first(r.db.WithContext(ctx).Where("id = ?", id))
+}
+
+func (r *GormUserRepository) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.first(r.db.WithContext(ctx).Where("email = ?", email))
+}
+
+func (r *GormUserRepository) first(db *gorm.DB) (models.User, error) {
+	var user models.User
+	err := db.First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *GormUserRepository) Create(ctx context.Context, user *models.User) error {
+	return translateError(r.db, r.db.WithContext(ctx).Create(user).Error)
+}
+
+func (r *GormUserRepository) RecordFailedLogin(ctx context.Context, id uint) (int, error) {
+	var failed int
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).Where("id = ?", id).
+			UpdateColumn("failed_logins", gorm.Expr("failed_logins + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Model(&models.User{}).Where("id = ?", id).Pluck("failed_logins", &failed).Error
+	})
+	return failed, err
+}
+
+func (r *GormUserRepository) Lock(ctx context.Context, id uint, until time.Time) error {
+	return r.setLock(ctx, id, &until)
+}
+
+func (r *GormUserRepository) Unlock(ctx context.Context, id uint) error {
+	return r.setLock(ctx, id, nil)
+}
+
+func (r *GormUserRepository) setLock(ctx context.Context, id uint, until *time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).
+		UpdateColumns(map[string]any{"failed_logins": 0, "locked_until": until})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *GormUserRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return translateError(r.db, r.db.WithContext(ctx).Create(token).Error)
+}
+
+func (r *GormUserRepository) UseRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return token, ErrNotFound
+	}
+	if err != nil || token.RevokedAt != nil {
+		return token, err
+	}
+	revokedAt := now()
+	result := r.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", token.ID).UpdateColumn("revoked_at", revokedAt)
+	if result.Error != nil {
+		return token, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Another request used the token in the meantime.
+		token.RevokedAt = &revokedAt
+	}
+	return token, nil
+}
+
+func (r *GormUserRepository) RevokeRefreshTokens(ctx context.Context, userID uint) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).UpdateColumn("revoked_at", now())
+	return result.RowsAffected, result.Error
+}
+
+func (r *GormUserRepository) PurgeRefreshTokens(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// MemoryAPIKeyRepository is an APIKeyRepository that keeps keys in memory.
+// It is safe for concurrent use and intended for tests.
+type MemoryAPIKeyRepository struct {
+	mu     sync.RWMutex
+	keys   map[uint]models.APIKey
+	nextID uint
+}
+
+// NewMemoryAPIKeyRepository returns a repository holding a copy of keys.
+func NewMemoryAPIKeyRepository(keys ...models.APIKey) *MemoryAPIKeyRepository {
+	r := &MemoryAPIKeyRepository{keys: map[uint]models.APIKey{}, nextID: 1}
+	for _, k := range keys {
+		_ = r.Create(context.Background(), &k)
+	}
+	return r
+}
+
+func (r *MemoryAPIKeyRepository) List(_ context.Context) ([]models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) FindByHash(_ context.Context, hash string) (models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return models.APIKey{}, ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) Create(_ context.Context, key *models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Name == key.Name || k.Hash == key.Hash {
+			return ErrDuplicate
+		}
+	}
+	key.ID = r.nextID
+	key.CreatedAt = now()
+	r.nextID++
+	r.keys[key.ID] = *key
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) Delete(_ context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, k := range r.keys {
+		if k.Name == name {
+			delete(r.keys, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
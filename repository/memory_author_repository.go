@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// MemoryAuthorRepository is an AuthorRepository over the authors of a
+// MemoryBookRepository.
+type MemoryAuthorRepository struct {
+	r *MemoryBookRepository
+}
+
+// Authors returns the repository of the authors credited on r's books.
+func (r *MemoryBookRepository) Authors() *MemoryAuthorRepository {
+	return &MemoryAuthorRepository{r: r}
+}
+
+func (m *MemoryAuthorRepository) List(_ context.Context, opts AuthorListOptions) ([]models.Author, error) {
+	m.r.mu.RLock()
+	defer m.r.mu.RUnlock()
+
+	authors := m.matching(opts.Name)
+	sort.Slice(authors, func(i, j int) bool {
+		if authors[i].Name != authors[j].Name {
+			return authors[i].Name < authors[j].Name
+		}
+		return authors[i].ID < authors[j].ID
+	})
+	if opts.Offset < len(authors) {
+		authors = authors[opts.Offset:]
+	} else {
+		authors = authors[:0]
+	}
+	if opts.Limit > 0 && len(authors) > opts.Limit {
+		authors = authors[:opts.Limit]
+	}
+	return authors, nil
+}
+
+func (m *MemoryAuthorRepository) Count(_ context.Context, name string) (int64, error) {
+	m.r.mu.RLock()
+	defer m.r.mu.RUnlock()
+
+	return int64(len(m.matching(name))), nil
+}
+
+func (m *MemoryAuthorRepository) matching(name string) []models.Author {
+	authors := []models.Author{}
+	for _, a := range m.r.authors {
+		if strings.Contains(strings.ToLower(a.Name), strings.ToLower(name)) {
+			authors = append(authors, a)
+		}
+	}
+	return authors
+}
+
+func (m *MemoryAuthorRepository) Get(_ context.Context, id uint) (models.Author, error) {
+	m.r.mu.RLock()
+	defer m.r.mu.RUnlock()
+
+	a, ok := m.r.authors[id]
+	if !ok {
+		return models.Author{}, ErrNotFound
+	}
+	return a, nil
+}
+
+func (m *MemoryAuthorRepository) FindByName(_ context.Context, name string) (models.Author, error) {
+	m.r.mu.RLock()
+	defer m.r.mu.RUnlock()
+
+	a, ok := m.r.authorByKey(models.AuthorKey(name))
+	if !ok {
+		return models.Author{}, ErrNotFound
+	}
+	return a, nil
+}
+
+func (m *MemoryAuthorRepository) Create(_ context.Context, author *models.Author) error {
+	m.r.mu.Lock()
+	defer m.r.mu.Unlock()
+
+	author.Name = models.NormalizeAuthorName(author.Name)
+	author.NameKey = models.AuthorKey(author.Name)
+	if _, ok := m.r.authorByKey(author.NameKey); ok {
+		return ErrDuplicate
+	}
+	author.ID = m.r.nextAuthorID
+	author.CreatedAt = now()
+	author.UpdatedAt = author.CreatedAt
+	m.r.nextAuthorID++
+	m.r.authors[author.ID] = *author
+	return nil
+}
+
+func (m *MemoryAuthorRepository) Update(_ context.Context, author *models.Author) error {
+	m.r.mu.Lock()
+	defer m.r.mu.Unlock()
+
+	stored, ok := m.r.authors[author.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	author.Name = models.NormalizeAuthorName(author.Name)
+	author.NameKey = models.AuthorKey(author.Name)
+	if other, ok := m.r.authorByKey(author.NameKey); ok && other.ID != author.ID {
+		return ErrDuplicate
+	}
+	author.CreatedAt = stored.CreatedAt
+	author.UpdatedAt = now()
+	m.r.authors[author.ID] = *author
+
+	for id, b := range m.r.books {
+		if !hasAuthor(b, func(a models.AuthorRef) bool { return a.ID == author.ID }) {
+			continue
+		}
+		b = withGenres(b)
+		for i := range b.Authors {
+			if b.Authors[i].ID == author.ID {
+				b.Authors[i].Name = author.Name
+			}
+		}
+		b.Author = authorNames(b.Authors)
+		b.Version++
+		b.UpdatedAt = author.UpdatedAt
+		m.r.books[id] = b
+	}
+	return nil
+}
+
+func (m *MemoryAuthorRepository) Delete(_ context.Context, id uint) error {
+	m.r.mu.Lock()
+	defer m.r.mu.Unlock()
+
+	if _, ok := m.r.authors[id]; !ok {
+		return ErrNotFound
+	}
+	for _, b := range m.r.books {
+		if hasAuthor(b, func(a models.AuthorRef) bool { return a.ID == id }) {
+			return ErrAuthorInUse
+		}
+	}
+	delete(m.r.authors, id)
+	return nil
+}
@@ -0,0 +1,417 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// MemoryBookRepository is a BookRepository that keeps books in memory. It is
+// safe for concurrent use and intended for tests and local experiments.
+type MemoryBookRepository struct {
+	mu     sync.RWMutex
+	books  map[uint]models.Book
+	nextID uint
+	// genres maps genre names to their IDs.
+	genres map[string]uint
+	// authors is shared with the repository returned by Authors.
+	authors      map[uint]models.Author
+	nextAuthorID uint
+}
+
+// NewMemoryBookRepository returns a repository holding a copy of books.
+// Books without an ID are assigned one.
+func NewMemoryBookRepository(books ...models.Book) *MemoryBookRepository {
+	r := &MemoryBookRepository{
+		books:        map[uint]models.Book{},
+		nextID:       1,
+		genres:       map[string]uint{},
+		authors:      map[uint]models.Author{},
+		nextAuthorID: 1,
+	}
+	for _, b := range books {
+		_ = r.Create(context.Background(), &b)
+	}
+	return r
+}
+
+func (r *MemoryBookRepository) List(_ context.Context, opts ListOptions) ([]models.Book, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	books := []models.Book{}
+	for _, b := range r.books {
+		if matches(b, opts.Filter) {
+			books = append(books, withGenres(b))
+		}
+	}
+	sort.Slice(books, func(i, j int) bool {
+		c := compareBooks(books[i], books[j], opts.Sort)
+		if opts.Backwards {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if opts.After != nil {
+		start := len(books)
+		for i, b := range books {
+			c := compareKeys(b, opts.After, opts.Sort)
+			if (!opts.Backwards && c > 0) || (opts.Backwards && c < 0) {
+				start = i
+				break
+			}
+		}
+		books = books[start:]
+	} else if opts.Offset < len(books) {
+		books = books[opts.Offset:]
+	} else {
+		books = books[:0]
+	}
+	if opts.Limit > 0 && len(books) > opts.Limit {
+		books = books[:opts.Limit]
+	}
+	return books, nil
+}
+
+func (r *MemoryBookRepository) Count(_ context.Context, filter BookFilter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var total int64
+	for _, b := range r.books {
+		if matches(b, filter) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (r *MemoryBookRepository) Get(_ context.Context, id uint) (models.Book, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	b, ok := r.books[id]
+	if !ok || b.DeletedAt != nil {
+		return models.Book{}, ErrNotFound
+	}
+	return withGenres(b), nil
+}
+
+func (r *MemoryBookRepository) Create(_ context.Context, book *models.Book) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if book.ID == 0 {
+		book.ID = r.nextID
+	} else if _, ok := r.books[book.ID]; ok {
+		return ErrDuplicate
+	}
+	if r.isbnTaken(*book) {
+		return ErrDuplicate
+	}
+	if err := r.resolveAuthors(book); err != nil {
+		return err
+	}
+	book.Version = 1
+	book.CreatedAt = now()
+	book.UpdatedAt = book.CreatedAt
+	if book.ID >= r.nextID {
+		r.nextID = book.ID + 1
+	}
+	r.store(book)
+	return nil
+}
+
+func (r *MemoryBookRepository) Update(_ context.Context, book *models.Book) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.books[book.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if stored.Version != book.Version {
+		return ErrVersionConflict
+	}
+	if r.isbnTaken(*book) {
+		return ErrDuplicate
+	}
+	if err := r.resolveAuthors(book); err != nil {
+		return err
+	}
+	book.Version++
+	book.CreatedAt = stored.CreatedAt
+	book.UpdatedAt = now()
+	r.store(book)
+	return nil
+}
+
+func (r *MemoryBookRepository) Delete(_ context.Context, id uint, version uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.books[id]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if version != 0 && stored.Version != version {
+		return ErrVersionConflict
+	}
+	deletedAt := now()
+	stored.DeletedAt = &deletedAt
+	stored.UpdatedAt = deletedAt
+	stored.Version++
+	r.books[id] = stored
+	return nil
+}
+
+func (r *MemoryBookRepository) Restore(_ context.Context, id uint) (models.Book, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.books[id]
+	if !ok || stored.DeletedAt == nil {
+		return models.Book{}, ErrNotFound
+	}
+	stored.DeletedAt = nil
+	stored.UpdatedAt = now()
+	stored.Version++
+	r.books[id] = stored
+	return withGenres(stored), nil
+}
+
+func (r *MemoryBookRepository) PurgeTrash(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for id, b := range r.books {
+		if b.DeletedAt != nil && b.DeletedAt.Before(before) {
+			delete(r.books, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Transaction runs fn against a copy of the repository, which replaces the
+// contents of r if fn succeeds. Other calls wait until fn returns.
+func (r *MemoryBookRepository) Transaction(_ context.Context, fn func(BookRepository) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := &MemoryBookRepository{
+		books:        make(map[uint]models.Book, len(r.books)),
+		nextID:       r.nextID,
+		genres:       make(map[string]uint, len(r.genres)),
+		authors:      make(map[uint]models.Author, len(r.authors)),
+		nextAuthorID: r.nextAuthorID,
+	}
+	for id, b := range r.books {
+		tx.books[id] = withGenres(b)
+	}
+	for name, id := range r.genres {
+		tx.genres[name] = id
+	}
+	for id, a := range r.authors {
+		tx.authors[id] = a
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	r.books, r.nextID = tx.books, tx.nextID
+	r.genres = tx.genres
+	r.authors, r.nextAuthorID = tx.authors, tx.nextAuthorID
+	return nil
+}
+
+// store saves a copy of book, giving its genres their IDs and sorting them
+// by name.
+func (r *MemoryBookRepository) store(book *models.Book) {
+	genres := []models.Genre{}
+	for _, g := range book.Genres {
+		id, ok := r.genres[g.Name]
+		if !ok {
+			id = uint(len(r.genres) + 1)
+			r.genres[g.Name] = id
+		}
+		genres = append(genres, models.Genre{ID: id, Name: g.Name})
+	}
+	sort.Slice(genres, func(i, j int) bool { return genres[i].Name < genres[j].Name })
+	book.Genres = genres
+	r.books[book.ID] = withGenres(*book)
+}
+
+// resolveAuthors replaces the authors of book with stored ones, creating the
+// authors given by a name that is not taken yet, and sets book.Author.
+func (r *MemoryBookRepository) resolveAuthors(book *models.Book) error {
+	refs := authorsOf(*book)
+	for _, ref := range refs {
+		if _, ok := r.authors[ref.ID]; ref.ID != 0 && !ok {
+			return fmt.Errorf("%w: %d", ErrUnknownAuthor, ref.ID)
+		}
+	}
+	authors := make([]models.AuthorRef, 0, len(refs))
+	seen := map[uint]bool{}
+	for _, ref := range refs {
+		author, ok := r.authors[ref.ID]
+		if !ok {
+			name := models.NormalizeAuthorName(ref.Name)
+			if author, ok = r.authorByKey(models.AuthorKey(name)); !ok {
+				author = models.Author{ID: r.nextAuthorID, Name: name, NameKey: models.AuthorKey(name), CreatedAt: now()}
+				author.UpdatedAt = author.CreatedAt
+				r.authors[author.ID] = author
+				r.nextAuthorID++
+			}
+		}
+		if !seen[author.ID] {
+			seen[author.ID] = true
+			authors = append(authors, models.AuthorRef{ID: author.ID, Name: author.Name})
+		}
+	}
+	book.Authors = authors
+	book.Author = authorNames(authors)
+	return nil
+}
+
+func (r *MemoryBookRepository) authorByKey(key string) (models.Author, bool) {
+	for _, a := range r.authors {
+		if a.NameKey == key {
+			return a, true
+		}
+	}
+	return models.Author{}, false
+}
+
+// isbnTaken reports whether another book, live or trashed, has the ISBN of
+// book.
+func (r *MemoryBookRepository) isbnTaken(book models.Book) bool {
+	if book.ISBN == nil {
+		return false
+	}
+	for id, b := range r.books {
+		if id != book.ID && b.ISBN != nil && *b.ISBN == *book.ISBN {
+			return true
+		}
+	}
+	return false
+}
+
+// withGenres returns b with its own copy of its genres and authors, so that
+// callers cannot change stored books.
+func withGenres(b models.Book) models.Book {
+	b.Genres = append([]models.Genre{}, b.Genres...)
+	b.Authors = append([]models.AuthorRef{}, b.Authors...)
+	return b
+}
+
+func matches(b models.Book, f BookFilter) bool {
+	if (b.DeletedAt != nil) != f.Trashed {
+		return false
+	}
+	if f.Author != "" && !hasAuthor(b, func(a models.AuthorRef) bool { return models.AuthorKey(a.Name) == models.AuthorKey(f.Author) }) {
+		return false
+	}
+	if f.AuthorID != 0 && !hasAuthor(b, func(a models.AuthorRef) bool { return a.ID == f.AuthorID }) {
+		return false
+	}
+	if f.Title != "" && !strings.Contains(strings.ToLower(b.Title), strings.ToLower(f.Title)) {
+		return false
+	}
+	if f.ISBN != "" && (b.ISBN == nil || *b.ISBN != f.ISBN) {
+		return false
+	}
+	if f.YearFrom != nil && b.Year < *f.YearFrom {
+		return false
+	}
+	if f.YearTo != nil && b.Year > *f.YearTo {
+		return false
+	}
+	return true
+}
+
+func hasAuthor(b models.Book, match func(models.AuthorRef) bool) bool {
+	for _, a := range b.Authors {
+		if match(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareBooks compares a and b in the order given by sort.
+func compareBooks(a, b models.Book, sort []SortField) int {
+	keys := make([]interface{}, len(sort))
+	for i, f := range sort {
+		keys[i] = SortValue(b, f.Field)
+	}
+	return compareKeys(a, keys, sort)
+}
+
+// compareKeys compares book with the keyset position keys in the order given
+// by sort.
+func compareKeys(book models.Book, keys []interface{}, sort []SortField) int {
+	for i, f := range sort {
+		c := compareValues(SortValue(book, f.Field), keys[i])
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b interface{}) int {
+	if as, ok := a.(string); ok {
+		return strings.Compare(as, b.(string))
+	}
+	ai, bi := toInt64(a), toInt64(b)
+	switch {
+	case ai < bi:
+		return -1
+	case ai > bi:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int64:
+		return n
+	case uint:
+		return int64(n)
+	default:
+		return 0
+	}
+}
+
+func (r *MemoryBookRepository) Search(_ context.Context, opts SearchOptions) (SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var books, indexed []models.Book
+	for _, b := range r.books {
+		if matches(b, opts.Filter) {
+			books = append(books, withGenres(b))
+		}
+		indexed = append(indexed, b)
+	}
+	p, err := plan(opts.Query, func() ([]string, error) { return vocabularyOf(indexed), nil })
+	if err != nil {
+		return SearchResult{}, err
+	}
+	docs := p.rank(books)
+	return SearchResult{Hits: p.page(docs, opts), Total: int64(len(docs))}, nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// MemoryUserRepository is a UserRepository that keeps users and their
+// refresh tokens in memory. It is safe for concurrent use and intended for
+// tests.
+type MemoryUserRepository struct {
+	mu          sync.RWMutex
+	users       map[uint]models.User
+	tokens      map[string]models.RefreshToken
+	nextID      uint
+	nextTokenID uint
+}
+
+// NewMemoryUserRepository returns a repository holding a copy of users.
+func NewMemoryUserRepository(users ...models.User) *MemoryUserRepository {
+	r := &MemoryUserRepository{
+		users:       map[uint]models.User{},
+		tokens:      map[string]models.RefreshToken{},
+		nextID:      1,
+		nextTokenID: 1,
+	}
+	for _, u := range users {
+		_ = r.Create(context.Background(), &u)
+	}
+	return r
+}
+
+func (r *MemoryUserRepository) List(_ context.Context) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users, nil
+}
+
+func (r *MemoryUserRepository) Get(_ context.Context, id uint) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(_ context.Context, email string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *MemoryUserRepository) Create(_ context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == user.Email {
+			return ErrDuplicate
+		}
+	}
+	user.ID = r.nextID
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+	r.nextID++
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) RecordFailedLogin(_ context.Context, id uint) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	u.FailedLogins++
+	r.users[id] = u
+	return u.FailedLogins, nil
+}
+
+func (r *MemoryUserRepository) Lock(_ context.Context, id uint, until time.Time) error {
+	return r.setLock(id, &until)
+}
+
+func (r *MemoryUserRepository) Unlock(_ context.Context, id uint) error {
+	return r.setLock(id, nil)
+}
+
+func (r *MemoryUserRepository) setLock(id uint, until *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.FailedLogins = 0
+	u.LockedUntil = until
+	r.users[id] = u
+	return nil
+}
+
+func (r *MemoryUserRepository) CreateRefreshToken(_ context.Context, token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[token.Hash]; ok {
+		return ErrDuplicate
+	}
+	token.ID = r.nextTokenID
+	token.CreatedAt = now()
+	r.nextTokenID++
+	r.tokens[token.Hash] = *token
+	return nil
+}
+
+func (r *MemoryUserRepository) UseRefreshToken(_ context.Context, hash string) (models.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[hash]
+	if !ok {
+		return token, ErrNotFound
+	}
+	if token.RevokedAt == nil {
+		revoked := token
+		revokedAt := now()
+		revoked.RevokedAt = &revokedAt
+		r.tokens[hash] = revoked
+	}
+	return token, nil
+}
+
+func (r *MemoryUserRepository) RevokeRefreshTokens(_ context.Context, userID uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	revokedAt := now()
+	for hash, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+			r.tokens[hash] = token
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryUserRepository) PurgeRefreshTokens(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for hash, token := range r.tokens {
+		if token.ExpiresAt.Before(before) {
+			delete(r.tokens, hash)
+			n++
+		}
+	}
+	return n, nil
+}
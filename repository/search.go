@@ -0,0 +1,481 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+const (
+	// maxSearchTerms bounds the size of the index queries a search runs.
+	maxSearchTerms = 10
+	// maxSearchCandidates bounds the books a search ranks by relevance. When
+	// more books match, the best candidates by the full-text index's own
+	// ranking are ranked and the others follow in the index's order.
+	maxSearchCandidates = 1000
+	// maxVariants bounds the indexed words a misspelt word is expanded to.
+	maxVariants = 20
+	// snippetWords is the length of the description excerpt in highlights.
+	snippetWords = 24
+	// HighlightStart and HighlightEnd enclose the matched words in the
+	// highlights of search hits.
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// searchFields are the indexed fields of a book and the weight of matches
+// in them.
+var searchFields = []struct {
+	name   string
+	weight float64
+	value  func(models.Book) string
+}{
+	{"title", 3, func(b models.Book) string { return b.Title }},
+	{"author", 2, func(b models.Book) string { return b.Author }},
+	{"description", 1, func(b models.Book) string { return b.Description }},
+}
+
+// SearchTerm is a term of a full-text query: a word, a word prefix or, with
+// more than one word, a phrase. All words are lower case.
+type SearchTerm struct {
+	Words  []string
+	Prefix bool
+}
+
+// SearchQuery is a parsed full-text query. Books match when they match
+// every term in their title, author or description.
+type SearchQuery struct {
+	Terms []SearchTerm
+}
+
+// SearchOptions describes a page of search results within Filter.
+type SearchOptions struct {
+	Query  SearchQuery
+	Filter BookFilter
+	Limit  int
+	Offset int
+}
+
+// SearchResult is a page of search hits. Total counts every match. Windowed
+// is set when more books matched than a search ranks by relevance; the hits
+// past the ranked ones then follow the order of the full-text index.
+type SearchResult struct {
+	Hits     []models.SearchHit
+	Total    int64
+	Windowed bool
+}
+
+// ParseSearchQuery parses a full-text query. Words are separated by spaces,
+// "double quotes" make a phrase and a trailing * matches words starting
+// with the given prefix. Words are runs of letters and digits, so
+// punctuation separates words like spaces do, and "J.R.R." is the phrase
+// "j r r".
+func ParseSearchQuery(raw string) (SearchQuery, error) {
+	var q SearchQuery
+	for rest := strings.TrimSpace(raw); rest != ""; rest = strings.TrimSpace(rest) {
+		var term SearchTerm
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			term.Words = tokenWords(rest[1 : end+1])
+			rest = strings.TrimLeft(rest[min(end+2, len(rest)):], "*")
+		} else {
+			end := strings.IndexAny(rest, " \t\n\"")
+			if end < 0 {
+				end = len(rest)
+			}
+			chunk := rest[:end]
+			rest = rest[end:]
+			term.Words = tokenWords(chunk)
+			term.Prefix = strings.HasSuffix(chunk, "*") && len(term.Words) == 1
+		}
+		if len(term.Words) > 0 {
+			q.Terms = append(q.Terms, term)
+		}
+	}
+	if len(q.Terms) == 0 {
+		return q, errors.New("must contain a word")
+	}
+	if len(q.Terms) > maxSearchTerms {
+		return q, fmt.Errorf("must have at most %d terms", maxSearchTerms)
+	}
+	return q, nil
+}
+
+// fuzzy reports whether the term may match words differing from it by a
+// typo. Words shorter than four letters have too many neighbours.
+func (t SearchTerm) fuzzy() bool {
+	return len(t.Words) == 1 && !t.Prefix && maxTypos(t.Words[0]) > 0
+}
+
+// maxTypos returns the edit distance tolerated for word.
+func maxTypos(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// token is a word of a text and its byte offsets in the text.
+type token struct {
+	word       string
+	start, end int
+}
+
+// tokenize splits text into lower case words, which are runs of letters and
+// digits like those of the unicode61 tokenizer of SQLite's full-text index.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+func tokenWords(text string) []string {
+	var words []string
+	for _, t := range tokenize(text) {
+		words = append(words, t.word)
+	}
+	return words
+}
+
+// searchPlan is a query whose misspelt words have been resolved against the
+// words of the index.
+type searchPlan struct {
+	terms []SearchTerm
+	// variants holds, for each fuzzy term not found in the index, the indexed
+	// words within its typo distance. It is nil for the other terms.
+	variants [][]string
+}
+
+// plan resolves the fuzzy terms of q that are not in the index to the
+// similar words in it, calling vocabulary at most once.
+func plan(q SearchQuery, vocabulary func() ([]string, error)) (searchPlan, error) {
+	p := searchPlan{terms: q.Terms, variants: make([][]string, len(q.Terms))}
+	var words []string
+	loaded := false
+	for i, t := range q.Terms {
+		if !t.fuzzy() {
+			continue
+		}
+		if !loaded {
+			var err error
+			if words, err = vocabulary(); err != nil {
+				return p, err
+			}
+			loaded = true
+		}
+		p.variants[i] = similarWords(t.Words[0], words)
+	}
+	return p, nil
+}
+
+// similarWords returns the words within the typo distance of word, closest
+// first, or nil when word itself is among them.
+func similarWords(word string, words []string) []string {
+	type candidate struct {
+		word     string
+		distance int
+	}
+	limit := maxTypos(word)
+	var found []candidate
+	for _, w := range words {
+		if w == word {
+			return nil
+		}
+		if d := editDistance(word, w, limit); d <= limit {
+			found = append(found, candidate{w, d})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].word < found[j].word
+	})
+	variants := []string{word}
+	for _, c := range found[:min(len(found), maxVariants)] {
+		variants = append(variants, c.word)
+	}
+	return variants
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b, counting insertions, deletions, substitutions and transpositions of
+// adjacent letters. Distances above limit are reported as limit+1.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			best = min(best, cur[j])
+		}
+		if best > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(rb)], limit+1)
+}
+
+// vocabularyOf returns the distinct words of the indexed fields of books.
+func vocabularyOf(books []models.Book) []string {
+	seen := map[string]bool{}
+	var words []string
+	for _, b := range books {
+		for _, f := range searchFields {
+			for _, t := range tokenize(f.value(b)) {
+				if !seen[t.word] {
+					seen[t.word] = true
+					words = append(words, t.word)
+				}
+			}
+		}
+	}
+	return words
+}
+
+// fieldMatch holds the positions of the tokens of a field that matched a
+// term and the weighted number of matches; matches of misspelt words count
+// half.
+type fieldMatch struct {
+	marked []bool
+	hits   float64
+}
+
+// matchTerm finds the occurrences of term i of p in tokens.
+func (p searchPlan) matchTerm(i int, tokens []token, m *fieldMatch) {
+	t := p.terms[i]
+	for pos := 0; pos+len(t.Words) <= len(tokens); pos++ {
+		weight := 0.0
+		switch w := tokens[pos].word; {
+		case len(t.Words) > 1:
+			weight = 1
+			for k, word := range t.Words {
+				if tokens[pos+k].word != word {
+					weight = 0
+					break
+				}
+			}
+		case t.Prefix && strings.HasPrefix(w, t.Words[0]), w == t.Words[0]:
+			weight = 1
+		case p.variants[i] != nil && contains(p.variants[i], w):
+			weight = 0.5
+		}
+		if weight > 0 {
+			m.hits += weight
+			for k := range t.Words {
+				m.marked[pos+k] = true
+			}
+		}
+	}
+}
+
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// searchDoc is a book being ranked, with the tokens of its indexed fields.
+type searchDoc struct {
+	book   models.Book
+	tokens [][]token
+	score  float64
+}
+
+// rank returns the books matching p ordered by relevance, then by ID.
+func (p searchPlan) rank(books []models.Book) []searchDoc {
+	docs := p.score(books)
+	sort.SliceStable(docs, func(i, j int) bool {
+		if docs[i].score != docs[j].score {
+			return docs[i].score > docs[j].score
+		}
+		return docs[i].book.ID < docs[j].book.ID
+	})
+	return docs
+}
+
+// score returns the books matching p in their order, with their scores.
+// Scores follow BM25 per field, with the field lengths averaged over the
+// matching books.
+func (p searchPlan) score(books []models.Book) []searchDoc {
+	const k1, b = 1.2, 0.75
+	var docs []searchDoc
+	var matches [][][]fieldMatch
+	totalLen := make([]float64, len(searchFields))
+	for _, book := range books {
+		doc := searchDoc{book: book, tokens: make([][]token, len(searchFields))}
+		for f, field := range searchFields {
+			doc.tokens[f] = tokenize(field.value(book))
+		}
+		termMatches, ok := p.match(doc.tokens)
+		if !ok {
+			continue
+		}
+		for f := range searchFields {
+			totalLen[f] += float64(len(doc.tokens[f]))
+		}
+		docs = append(docs, doc)
+		matches = append(matches, termMatches)
+	}
+	for d := range docs {
+		for _, termMatches := range matches[d] {
+			for f, field := range searchFields {
+				tf := termMatches[f].hits
+				if tf == 0 {
+					continue
+				}
+				avg := math.Max(totalLen[f]/float64(len(docs)), 1)
+				norm := 1 - b + b*float64(len(docs[d].tokens[f]))/avg
+				docs[d].score += field.weight * tf * (k1 + 1) / (tf + k1*norm)
+			}
+		}
+		docs[d].score = math.Round(docs[d].score*1e4) / 1e4
+	}
+	return docs
+}
+
+// match returns the matches of every term of p in each field of a book, and
+// whether every term matched somewhere.
+func (p searchPlan) match(fields [][]token) ([][]fieldMatch, bool) {
+	out := make([][]fieldMatch, len(p.terms))
+	for i := range p.terms {
+		out[i] = make([]fieldMatch, len(fields))
+		found := false
+		for f, tokens := range fields {
+			out[i][f].marked = make([]bool, len(tokens))
+			p.matchTerm(i, tokens, &out[i][f])
+			found = found || out[i][f].hits > 0
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// hit returns the search hit for doc with its matches highlighted. Titles
+// and authors are highlighted whole, descriptions as an excerpt around the
+// first match.
+func (p searchPlan) hit(doc searchDoc) models.SearchHit {
+	hit := models.SearchHit{Book: doc.book, Score: doc.score, Highlights: map[string]string{}}
+	termMatches, _ := p.match(doc.tokens)
+	for f, field := range searchFields {
+		tokens := doc.tokens[f]
+		marked := make([]bool, len(tokens))
+		first := -1
+		for _, m := range termMatches {
+			for pos, ok := range m[f].marked {
+				if ok {
+					marked[pos] = true
+					if first < 0 || pos < first {
+						first = pos
+					}
+				}
+			}
+		}
+		if first < 0 {
+			continue
+		}
+		from, to := 0, len(tokens)
+		if field.name == "description" && len(tokens) > snippetWords {
+			from = max(0, min(first-snippetWords/3, len(tokens)-snippetWords))
+			to = from + snippetWords
+		}
+		hit.Highlights[field.name] = highlight(field.value(doc.book), tokens, marked, from, to)
+	}
+	return hit
+}
+
+// highlight returns text from token from up to token to as HTML, marking the
+// marked tokens and adding an ellipsis where text was cut. The text is
+// escaped so that markup in books is shown rather than rendered.
+func highlight(text string, tokens []token, marked []bool, from, to int) string {
+	var b strings.Builder
+	start, end := 0, len(text)
+	if from > 0 {
+		b.WriteString("…")
+		start = tokens[from].start
+	}
+	if to < len(tokens) {
+		end = tokens[to-1].end
+	}
+	pos := start
+	for i := from; i < to; i++ {
+		if !marked[i] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:tokens[i].start]))
+		b.WriteString(HighlightStart)
+		b.WriteString(html.EscapeString(text[tokens[i].start:tokens[i].end]))
+		b.WriteString(HighlightEnd)
+		pos = tokens[i].end
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if to < len(tokens) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// page returns the hits for the ranked docs that opts selects.
+func (p searchPlan) page(docs []searchDoc, opts SearchOptions) []models.SearchHit {
+	hits := []models.SearchHit{}
+	if opts.Offset >= len(docs) {
+		return hits
+	}
+	docs = docs[opts.Offset:]
+	if opts.Limit > 0 && len(docs) > opts.Limit {
+		docs = docs[:opts.Limit]
+	}
+	for _, d := range docs {
+		hits = append(hits, p.hit(d))
+	}
+	return hits
+}
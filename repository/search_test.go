@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query       string
+		expect      []SearchTerm
+		expectError string
+	}{
+		{query: "Dune", expect: []SearchTerm{{Words: []string{"dune"}}}},
+		{query: ` "the  Lord of" tolk* `, expect: []SearchTerm{{Words: []string{"the", "lord", "of"}}, {Words: []string{"tolk"}, Prefix: true}}},
+		{query: "J.R.R. Tolkien", expect: []SearchTerm{{Words: []string{"j", "r", "r"}}, {Words: []string{"tolkien"}}}},
+		{query: `"unterminated phrase`, expect: []SearchTerm{{Words: []string{"unterminated", "phrase"}}}},
+		{query: `"x"* y`, expect: []SearchTerm{{Words: []string{"x"}}, {Words: []string{"y"}}}},
+		{query: " * !? ", expectError: "must contain a word"},
+		{query: "a b c d e f g h i j k", expectError: "at most 10 terms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseSearchQuery(tt.query)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, q.Terms)
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{"tolkien", "tolkien", 0},
+		{"tolkein", "tolkien", 1},
+		{"herbet", "herbert", 1},
+		{"silmarilion", "silmarillion", 1},
+		{"dune", "dunes", 1},
+		{"dune", "tune", 1},
+		{"dune", "done", 1},
+		{"dune", "nude", 2},
+		{"foundation", "fundations", 2},
+		{"a", "abcdef", 3},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expect, editDistance(tt.a, tt.b, 2), tt.a+"/"+tt.b)
+	}
+}
+
+func TestBookRepositorySearch(t *testing.T) {
+	books := []models.Book{
+		{Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937,
+			Description: "Bilbo Baggins, a hobbit who enjoys a comfortable life, is swept into a quest to reclaim the dwarven kingdom of Erebor from the dragon Smaug."},
+		{Title: "The Lord of the Rings", Author: "J. R. R. Tolkien", Year: 1954,
+			Description: "Frodo carries the One Ring to Mordor; the hobbit and his companions face the dark lord Sauron."},
+		{Title: "Dune", Author: "Frank Herbert", Year: 1965,
+			Description: "On the desert planet Arrakis, Paul Atreides is caught up in a struggle for the spice and the rule of the Fremen."},
+		{Title: "Dragon Rider", Author: "Cornelia Funke", Year: 1997, Description: "A young silver dragon searches for the Rim of Heaven."},
+		{Title: "Trashed Dragon", Author: "Anon", Year: 2000},
+	}
+	tests := []struct {
+		name        string
+		query       string
+		filter      BookFilter
+		limit       int
+		offset      int
+		expect      []string
+		total       int64
+		highlights  map[string]string
+		description string
+	}{
+		{
+			name:   "ranks title matches first",
+			query:  "hobbit",
+			expect: []string{"The Hobbit", "The Lord of the Rings"},
+			total:  2,
+			highlights: map[string]string{
+				"title":       "The <mark>Hobbit</mark>",
+				"description": "Bilbo Baggins, a <mark>hobbit</mark> who enjoys a comfortable life, is swept into a quest to reclaim the dwarven kingdom of Erebor from the dragon…",
+			},
+		},
+		{
+			name:   "all terms must match",
+			query:  "tolkien dragon",
+			expect: []string{"The Hobbit"},
+			total:  1,
+		},
+		{
+			name:   "phrase",
+			query:  `"dark lord"`,
+			expect: []string{"The Lord of the Rings"},
+			total:  1,
+			highlights: map[string]string{
+				"description": "Frodo carries the One Ring to Mordor; the hobbit and his companions face the <mark>dark</mark> <mark>lord</mark> Sauron.",
+			},
+		},
+		{
+			name:   "phrase in wrong order",
+			query:  `"lord dark"`,
+			expect: []string{},
+		},
+		{
+			name:   "prefix",
+			query:  "drag*",
+			expect: []string{"Dragon Rider", "The Hobbit"},
+			total:  2,
+		},
+		{
+			name:   "typo",
+			query:  "Tolkein",
+			expect: []string{"The Hobbit", "The Lord of the Rings"},
+			total:  2,
+			highlights: map[string]string{
+				"author": "J. R. R. <mark>Tolkien</mark>",
+			},
+		},
+		{
+			name:   "two typos in a long word",
+			query:  "Atriedes arakis",
+			expect: []string{"Dune"},
+			total:  1,
+		},
+		{
+			name:   "short words are not corrected",
+			query:  "dun",
+			expect: []string{},
+		},
+		{
+			name:   "author initials",
+			query:  "J.R.R.",
+			expect: []string{"The Hobbit", "The Lord of the Rings"},
+			total:  2,
+		},
+		{
+			name:   "filter",
+			query:  "dragon",
+			filter: BookFilter{YearFrom: intPtr(1990)},
+			expect: []string{"Dragon Rider"},
+			total:  1,
+		},
+		{
+			name:   "paging",
+			query:  "the",
+			limit:  2,
+			offset: 1,
+			expect: []string{"The Hobbit", "Dune"},
+			total:  4,
+		},
+	}
+
+	for name, repo := range implementations(t) {
+		ctx := context.Background()
+		for _, b := range books {
+			require.NoError(t, repo.Create(ctx, &b))
+		}
+		require.NoError(t, repo.Delete(ctx, 5, 0))
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				q, err := ParseSearchQuery(tt.query)
+				require.NoError(t, err)
+				result, err := repo.Search(ctx, SearchOptions{Query: q, Filter: tt.filter, Limit: tt.limit, Offset: tt.offset})
+				require.NoError(t, err)
+				hits := result.Hits
+				var got []string
+				for _, h := range hits {
+					got = append(got, h.Title)
+					assert.Positive(t, h.Score)
+				}
+				if len(tt.expect) == 0 {
+					assert.Empty(t, got)
+				} else {
+					assert.Equal(t, tt.expect, got)
+				}
+				assert.Equal(t, tt.total, result.Total)
+				assert.False(t, result.Windowed)
+				if tt.highlights != nil {
+					assert.Equal(t, tt.highlights, hits[0].Highlights)
+				}
+			})
+		}
+	}
+}
+
+// TestGormBookRepositorySearchWindow checks that books past the ranked
+// window are still counted and paged.
+func TestGormBookRepositorySearchWindow(t *testing.T) {
+	ctx := context.Background()
+	repo := NewGormBookRepository(testDB(t))
+	repo.window = 2
+	for _, b := range []models.Book{
+		{Title: "Dune", Author: "Frank Herbert", Year: 1965, Description: "A dragon on a desert planet."},
+		{Title: "Dragon Rider", Author: "Cornelia Funke", Year: 1997},
+		{Title: "The Hobbit", Author: "J. R. R. Tolkien", Year: 1937, Description: "The dragon Smaug guards a treasure."},
+		{Title: "Eragon", Author: "Christopher Paolini", Year: 2002, Description: "A farm boy finds a dragon egg."},
+	} {
+		require.NoError(t, repo.Create(ctx, &b))
+	}
+	q, err := ParseSearchQuery("dragon")
+	require.NoError(t, err)
+
+	all, err := repo.Search(ctx, SearchOptions{Query: q, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), all.Total)
+	assert.True(t, all.Windowed)
+	require.Len(t, all.Hits, 4)
+	assert.Equal(t, "Dragon Rider", all.Hits[0].Title)
+	var titles []string
+	for _, h := range all.Hits {
+		titles = append(titles, h.Title)
+	}
+	assert.ElementsMatch(t, []string{"Dune", "Dragon Rider", "The Hobbit", "Eragon"}, titles)
+
+	for offset := range all.Hits {
+		page, err := repo.Search(ctx, SearchOptions{Query: q, Limit: 1, Offset: offset})
+		require.NoError(t, err)
+		require.Len(t, page.Hits, 1)
+		assert.Equal(t, all.Hits[offset].Title, page.Hits[0].Title)
+		assert.Equal(t, int64(4), page.Total)
+	}
+}
+
+// TestBookRepositorySearchEscapesHighlights checks that markup in books is
+// escaped in highlights, which clients render as HTML.
+func TestBookRepositorySearchEscapesHighlights(t *testing.T) {
+	for name, repo := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			book := models.Book{Title: `<img src=x onerror="alert(1)"> Dragon`, Author: "Tom & Jerry", Year: 2000,
+				Description: "A <script>dragon</script> story"}
+			require.NoError(t, repo.Create(ctx, &book))
+			q, err := ParseSearchQuery("dragon")
+			require.NoError(t, err)
+			result, err := repo.Search(ctx, SearchOptions{Query: q})
+			require.NoError(t, err)
+			hits := result.Hits
+			require.Len(t, hits, 1)
+			assert.Equal(t, map[string]string{
+				"title":       "&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>Dragon</mark>",
+				"description": "A &lt;script&gt;<mark>dragon</mark>&lt;/script&gt; story",
+			}, hits[0].Highlights)
+			assert.Equal(t, book.Title, hits[0].Title, "the book itself is not escaped")
+		})
+	}
+}
+
+// TestBookRepositorySearchFollowsWrites checks that the search index is kept
+// in sync with the books.
+func TestBookRepositorySearchFollowsWrites(t *testing.T) {
+	search := func(t *testing.T, repo BookRepository, query string) []string {
+		q, err := ParseSearchQuery(query)
+		require.NoError(t, err)
+		result, err := repo.Search(context.Background(), SearchOptions{Query: q})
+		require.NoError(t, err)
+		titles := []string{}
+		for _, h := range result.Hits {
+			titles = append(titles, h.Title)
+		}
+		return titles
+	}
+
+	for name, repo := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			book := models.Book{Title: "Foundation", Author: "Isaac Asimov", Year: 1951}
+			require.NoError(t, repo.Create(ctx, &book))
+			assert.Equal(t, []string{"Foundation"}, search(t, repo, "foundation"))
+			assert.Equal(t, []string{"Foundation"}, search(t, repo, "fundation"))
+
+			book.Title = "Foundation and Empire"
+			require.NoError(t, repo.Update(ctx, &book))
+			assert.Equal(t, []string{"Foundation and Empire"}, search(t, repo, "empire"))
+			assert.Equal(t, []string{"Foundation and Empire"}, search(t, repo, "empyre"),
+				"typos are corrected to the words of updated books")
+
+			require.NoError(t, repo.Delete(ctx, book.ID, 0))
+			assert.Empty(t, search(t, repo, "empire"))
+			_, err := repo.Restore(ctx, book.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"Foundation and Empire"}, search(t, repo, "asimov"))
+		})
+	}
+}
+
+// TestBookRepositorySearchFollowsAuthorRenames checks that books are found
+// by the new name of their author, typos included.
+func TestBookRepositorySearchFollowsAuthorRenames(t *testing.T) {
+	for name, repos := range authorImplementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			book := models.Book{Title: "The Left Hand of Darkness", Author: "Ursula Le Guin", Year: 1969}
+			require.NoError(t, repos.books.Create(ctx, &book))
+			search := func(query string) []string {
+				q, err := ParseSearchQuery(query)
+				require.NoError(t, err)
+				result, err := repos.books.Search(ctx, SearchOptions{Query: q})
+				require.NoError(t, err)
+				titles := []string{}
+				for _, h := range result.Hits {
+					titles = append(titles, h.Title)
+				}
+				return titles
+			}
+			assert.Equal(t, []string{book.Title}, search("ursula"), "the words are cached")
+
+			author, err := repos.authors.FindByName(ctx, "Ursula Le Guin")
+			require.NoError(t, err)
+			author.Name = "Ursula Kroeber Le Guin"
+			require.NoError(t, repos.authors.Update(ctx, &author))
+			assert.Equal(t, []string{book.Title}, search("kroeber"))
+			assert.Equal(t, []string{book.Title}, search("kreober"),
+				"typos are corrected to the words of renamed authors")
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+// UserRepository stores user accounts and the refresh tokens issued to
+// them. Tokens are stored by the digest of the token, never the token
+// itself.
+//
+// Emails are unique: Create fails with ErrDuplicate for a taken one. The
+// lookups fail with ErrNotFound for unknown users and tokens. List returns
+// the users ordered by email.
+//
+// RecordFailedLogin counts a failed login of the user and returns the
+// number of failures in a row. Lock locks the account until the given time
+// and Unlock unlocks it; both reset the count.
+//
+// UseRefreshToken revokes the token with the given hash and returns it as
+// it was before, so that a token found already revoked has been used
+// before. Of concurrent uses of a token only one finds it unrevoked.
+// RevokeRefreshTokens revokes every token of a user and returns how many
+// were still active. PurgeRefreshTokens deletes the tokens that expired
+// before the given time, used or not, and returns how many it deleted; used
+// tokens are kept until then so that their reuse is noticed.
+type UserRepository interface {
+	List(ctx context.Context) ([]models.User, error)
+	Get(ctx context.Context, id uint) (models.User, error)
+	FindByEmail(ctx context.Context, email string) (models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	RecordFailedLogin(ctx context.Context, id uint) (int, error)
+	Lock(ctx context.Context, id uint, until time.Time) error
+	Unlock(ctx context.Context, id uint) error
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	UseRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error)
+	RevokeRefreshTokens(ctx context.Context, userID uint) (int64, error)
+	PurgeRefreshTokens(ctx context.Context, before time.Time) (int64, error)
+}
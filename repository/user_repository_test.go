@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestUserRepository(t *testing.T) {
+	implementations := map[string]UserRepository{
+		"gorm":   NewGormUserRepository(testDB(t)),
+		"memory": NewMemoryUserRepository(),
+	}
+	for name, repo := range implementations {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			ada := models.User{Email: "ada@example.com", PasswordHash: "x", Role: models.RoleAdmin}
+			require.NoError(t, repo.Create(ctx, &ada))
+			assert.NotZero(t, ada.ID)
+			assert.False(t, ada.CreatedAt.IsZero())
+			require.NoError(t, repo.Create(ctx, &models.User{Email: "alan@example.com", PasswordHash: "x", Role: models.RoleReader}))
+			assert.ErrorIs(t, repo.Create(ctx, &models.User{Email: "ada@example.com", PasswordHash: "y"}), ErrDuplicate)
+
+			got, err := repo.FindByEmail(ctx, "ada@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, ada.ID, got.ID)
+			assert.Equal(t, "x", got.PasswordHash)
+			_, err = repo.FindByEmail(ctx, "grace@example.com")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = repo.Get(ctx, 99)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			users, err := repo.List(ctx)
+			require.NoError(t, err)
+			require.Len(t, users, 2)
+			assert.Equal(t, "ada@example.com", users[0].Email)
+			assert.Equal(t, "alan@example.com", users[1].Email)
+
+			for want := 1; want <= 3; want++ {
+				n, err := repo.RecordFailedLogin(ctx, ada.ID)
+				require.NoError(t, err)
+				assert.Equal(t, want, n)
+			}
+			_, err = repo.RecordFailedLogin(ctx, 99)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			until := now().Add(time.Hour)
+			require.NoError(t, repo.Lock(ctx, ada.ID, until))
+			got, err = repo.Get(ctx, ada.ID)
+			require.NoError(t, err)
+			assert.Zero(t, got.FailedLogins)
+			require.NotNil(t, got.LockedUntil)
+			assert.True(t, until.Equal(*got.LockedUntil))
+			require.NoError(t, repo.Unlock(ctx, ada.ID))
+			got, err = repo.Get(ctx, ada.ID)
+			require.NoError(t, err)
+			assert.Nil(t, got.LockedUntil)
+			assert.ErrorIs(t, repo.Unlock(ctx, 99), ErrNotFound)
+		})
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	implementations := map[string]UserRepository{
+		"gorm":   NewGormUserRepository(testDB(t)),
+		"memory": NewMemoryUserRepository(),
+	}
+	for name, repo := range implementations {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user := models.User{Email: "ada@example.com", PasswordHash: "x", Role: models.RoleAdmin}
+			require.NoError(t, repo.Create(ctx, &user))
+
+			expires := now().Add(time.Hour)
+			first := models.RefreshToken{UserID: user.ID, Hash: strings.Repeat("a", 64), ExpiresAt: expires}
+			require.NoError(t, repo.CreateRefreshToken(ctx, &first))
+			assert.NotZero(t, first.ID)
+			require.NoError(t, repo.CreateRefreshToken(ctx, &models.RefreshToken{UserID: user.ID, Hash: strings.Repeat("b", 64), ExpiresAt: expires}))
+			assert.ErrorIs(t, repo.CreateRefreshToken(ctx, &models.RefreshToken{UserID: user.ID, Hash: first.Hash, ExpiresAt: expires}), ErrDuplicate)
+
+			used, err := repo.UseRefreshToken(ctx, first.Hash)
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, used.UserID)
+			assert.True(t, expires.Equal(used.ExpiresAt))
+			assert.Nil(t, used.RevokedAt, "first use")
+
+			used, err = repo.UseRefreshToken(ctx, first.Hash)
+			require.NoError(t, err)
+			assert.NotNil(t, used.RevokedAt, "second use")
+
+			_, err = repo.UseRefreshToken(ctx, strings.Repeat("c", 64))
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			n, err := repo.RevokeRefreshTokens(ctx, user.ID)
+			require.NoError(t, err)
+			assert.EqualValues(t, 1, n)
+			used, err = repo.UseRefreshToken(ctx, strings.Repeat("b", 64))
+			require.NoError(t, err)
+			assert.NotNil(t, used.RevokedAt)
+
+			// Tokens are purged once expired, used or not.
+			require.NoError(t, repo.CreateRefreshToken(ctx, &models.RefreshToken{UserID: user.ID, Hash: strings.Repeat("d", 64), ExpiresAt: now().Add(-time.Minute)}))
+			n, err = repo.PurgeRefreshTokens(ctx, expires)
+			require.NoError(t, err)
+			assert.EqualValues(t, 1, n, "used tokens are kept until they expire")
+			_, err = repo.UseRefreshToken(ctx, strings.Repeat("d", 64))
+			assert.ErrorIs(t, err, ErrNotFound)
+			n, err = repo.PurgeRefreshTokens(ctx, expires.Add(time.Second))
+			require.NoError(t, err)
+			assert.EqualValues(t, 2, n)
+			_, err = repo.UseRefreshToken(ctx, first.Hash)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
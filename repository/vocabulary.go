@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// vocabularyTTL is how long the words of the full-text index are reused.
+// Typos are only corrected to words that other processes added once it has
+// passed.
+const vocabularyTTL = time.Minute
+
+// vocabulary caches the words of the full-text index, so that correcting a
+// typo does not read the whole index every time. Writes through the
+// repositories sharing it mark the cache stale.
+type vocabulary struct {
+	mu       sync.Mutex
+	words    []string
+	known    map[string]bool
+	loadedAt time.Time
+	loaded   bool
+	// through is the newest update time among the books read by extend.
+	through time.Time
+}
+
+func (v *vocabulary) fresh() bool {
+	return v.loaded && time.Since(v.loadedAt) < vocabularyTTL
+}
+
+// get returns the cached words, replacing them with those returned by load
+// when they are stale. Concurrent callers wait for a single load.
+func (v *vocabulary) get(load func() ([]string, error)) ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.fresh() {
+		return v.words, nil
+	}
+	words, err := load()
+	if err != nil {
+		return nil, err
+	}
+	v.words, v.known = words, nil
+	v.loadedAt, v.loaded = time.Now(), true
+	return words, nil
+}
+
+// extend returns the cached words, adding those returned by load when they
+// are stale. load is given the newest update time it returned so far, zero
+// at first, and returns the words of the books updated since then along
+// with their newest update time. The words of books removed since stay,
+// which at worst expands a typo to a word no book has.
+func (v *vocabulary) extend(load func(since time.Time) ([]string, time.Time, error)) ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.fresh() {
+		return v.words, nil
+	}
+	words, through, err := load(v.through)
+	if err != nil {
+		return nil, err
+	}
+	if v.known == nil {
+		v.known = make(map[string]bool, len(v.words)+len(words))
+		for _, w := range v.words {
+			v.known[w] = true
+		}
+	}
+	for _, w := range words {
+		if !v.known[w] {
+			v.known[w] = true
+			v.words = append(v.words, w)
+		}
+	}
+	if through.After(v.through) {
+		v.through = through
+	}
+	v.loadedAt, v.loaded = time.Now(), true
+	return v.words, nil
+}
+
+// invalidate marks the cached words stale.
+func (v *vocabulary) invalidate() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.loaded = false
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVocabulary(t *testing.T) {
+	var v vocabulary
+	loads := 0
+	load := func() ([]string, error) {
+		loads++
+		return []string{"dragon"}, nil
+	}
+
+	words, err := v.get(load)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dragon"}, words)
+	_, err = v.get(load)
+	require.NoError(t, err)
+	assert.Equal(t, 1, loads, "words are cached")
+
+	v.invalidate()
+	_, err = v.get(load)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loads, "invalidated words are loaded again")
+
+	v.invalidate()
+	_, err = v.get(func() ([]string, error) { return nil, errors.New("boom") })
+	assert.Error(t, err)
+	_, err = v.get(load)
+	require.NoError(t, err)
+	assert.Equal(t, 3, loads, "failed loads are not cached")
+}
+
+func TestVocabularyExtend(t *testing.T) {
+	var v vocabulary
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var sinces []time.Time
+	load := func(words ...string) func(time.Time) ([]string, time.Time, error) {
+		return func(since time.Time) ([]string, time.Time, error) {
+			sinces = append(sinces, since)
+			return words, t0.Add(time.Duration(len(sinces)) * time.Second), nil
+		}
+	}
+
+	words, err := v.extend(load("dune", "dragon"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dune", "dragon"}, words)
+	_, err = v.extend(load("unused"))
+	require.NoError(t, err)
+	assert.Len(t, sinces, 1, "words are cached")
+
+	v.invalidate()
+	words, err = v.extend(load("dragon", "hobbit"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dune", "dragon", "hobbit"}, words, "new words are added once")
+	assert.Equal(t, []time.Time{{}, t0.Add(time.Second)}, sinces, "only books updated since the last load are read")
+
+	v.invalidate()
+	_, err = v.extend(func(time.Time) ([]string, time.Time, error) { return nil, time.Time{}, errors.New("boom") })
+	assert.Error(t, err)
+	words, err = v.extend(load())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dune", "dragon", "hobbit"}, words, "failed loads keep the words")
+	assert.Equal(t, t0.Add(2*time.Second), sinces[2], "failed loads keep the last update time")
+}
@@ -1,17 +1,182 @@
 package routes
 
 import (
-	"github.com/burhangltekin/byfood/controllers"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/controllers"
+	"github.com/burhangltekin/byfood/middleware"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/ratelimit"
 )
 
-func SetupRoutes(r *gin.Engine) {
-	api := r.Group("/api")
-	{
-		api.GET("/books", controllers.GetBooks)
-		api.GET("/books/:id", controllers.GetBook)
-		api.POST("/books", controllers.CreateBook)
-		api.PUT("/books/:id", controllers.UpdateBook)
-		api.DELETE("/books/:id", controllers.DeleteBook)
+// Controllers are the handlers served by the API. Nil controllers are not
+// mounted.
+type Controllers struct {
+	Books    *controllers.BookController
+	Authors  *controllers.AuthorController
+	Admin    *controllers.AdminController
+	Accounts *controllers.AccountController
+}
+
+// Security selects how the routes are protected. Without an Authenticator
+// every request is let through. With a Limiter, clients are held to the
+// rate limits of Config. Whether requests without credentials may use the
+// routes open to readers (auth.anonymousReads) and the rate limits are read
+// from Config for every request, so that they follow reloads; without a
+// Config neither is allowed.
+type Security struct {
+	Authenticator *auth.Authenticator
+	Limiter       ratelimit.Store
+	Config        *config.Store
+}
+
+// config returns the live configuration.
+func (s Security) config() models.AppConfig {
+	if s.Config == nil {
+		return models.AppConfig{}
+	}
+	return s.Config.Config()
+}
+
+// limit returns the live limit of a group of routes, picked by group from
+// the rate limits. Groups of disabled or lifted limits get a zero Limit.
+func (s Security) limit(group func(models.RateLimitConfig) models.RateLimit) func() ratelimit.Limit {
+	return func() ratelimit.Limit {
+		limits := s.config().RateLimit
+		l := group(limits)
+		if !limits.Enabled || l.RequestsPerMinute <= 0 {
+			return ratelimit.Limit{}
+		}
+		return ratelimit.PerMinute(l.RequestsPerMinute, l.Burst)
+	}
+}
+
+// route is an endpoint of the API and the permission it requires. Routes
+// without a permission are open to everyone.
+type route struct {
+	method     string
+	path       string
+	permission auth.Permission
+	handler    gin.HandlerFunc
+}
+
+// policy lists the routes of the mounted controllers with the permission
+// each requires.
+func policy(c Controllers) []route {
+	var routes []route
+	if books := c.Books; books != nil {
+		routes = append(routes,
+			route{http.MethodGet, "/books", auth.BooksRead, books.GetBooks},
+			route{http.MethodGet, "/books/search", auth.BooksRead, books.SearchBooks},
+			route{http.MethodGet, "/books/export", auth.BooksRead, books.ExportBooks},
+			route{http.MethodGet, "/books/:id", auth.BooksRead, books.GetBook},
+			route{http.MethodGet, "/books/trash", auth.BooksWrite, books.GetTrash},
+			route{http.MethodPost, "/books", auth.BooksWrite, books.CreateBook},
+			route{http.MethodPost, "/books/bulk", auth.BooksWrite, books.BulkBooks},
+			route{http.MethodPost, "/books/import", auth.BooksWrite, books.ImportBooks},
+			route{http.MethodPut, "/books/:id", auth.BooksWrite, books.UpdateBook},
+			route{http.MethodPatch, "/books/:id", auth.BooksWrite, books.PatchBook},
+			route{http.MethodPost, "/books/:id/restore", auth.BooksWrite, books.RestoreBook},
+			route{http.MethodDelete, "/books/:id", auth.BooksDelete, books.DeleteBook},
+		)
+	}
+	if authors := c.Authors; authors != nil {
+		routes = append(routes,
+			route{http.MethodGet, "/authors", auth.AuthorsRead, authors.GetAuthors},
+			route{http.MethodGet, "/authors/:id", auth.AuthorsRead, authors.GetAuthor},
+			route{http.MethodGet, "/authors/:id/books", auth.AuthorsRead, authors.GetAuthorBooks},
+			route{http.MethodPost, "/authors", auth.AuthorsWrite, authors.CreateAuthor},
+			route{http.MethodPut, "/authors/:id", auth.AuthorsWrite, authors.UpdateAuthor},
+			route{http.MethodDelete, "/authors/:id", auth.AuthorsDelete, authors.DeleteAuthor},
+		)
+	}
+	if admin := c.Admin; admin != nil {
+		routes = append(routes,
+			route{http.MethodGet, "/admin/config", auth.ConfigRead, admin.GetConfig},
+			route{http.MethodDelete, "/admin/trash", auth.TrashPurge, admin.PurgeTrash},
+		)
+	}
+	if accounts := c.Accounts; accounts != nil {
+		routes = append(routes,
+			route{http.MethodPost, "/auth/register", "", accounts.Register},
+			route{http.MethodPost, "/auth/login", "", accounts.Login},
+			route{http.MethodPost, "/auth/refresh", "", accounts.Refresh},
+			route{http.MethodPost, "/auth/logout", "", accounts.Logout},
+		)
+	}
+	return routes
+}
+
+// rateLimitGroup returns the rate limit group of the routes requiring
+// permission p and how to pick its limit.
+func rateLimitGroup(p auth.Permission) (string, func(models.RateLimitConfig) models.RateLimit) {
+	switch p {
+	case "":
+		return "auth", authLimit
+	case auth.BooksRead, auth.AuthorsRead:
+		return "read", func(l models.RateLimitConfig) models.RateLimit { return l.Read }
+	case auth.ConfigRead, auth.TrashPurge:
+		return "admin", func(l models.RateLimitConfig) models.RateLimit { return l.Admin }
+	default:
+		return "write", func(l models.RateLimitConfig) models.RateLimit { return l.Write }
+	}
+}
+
+// authLimit picks the limit of the auth group, which also holds rejected
+// credentials.
+func authLimit(l models.RateLimitConfig) models.RateLimit { return l.Auth }
+
+// SetupRoutes mounts the API under /api/{apiVersion}, in one group per
+// permission that authenticates requests, limits their rate and checks that
+// they have the permission. Rejected credentials count against the auth
+// limit of the client's address, so that they cannot be guessed faster.
+// Requests matching no route get a 404 problem response.
+func SetupRoutes(r *gin.Engine, apiVersion string, c Controllers, s Security) {
+	r.NoRoute(controllers.NotFound)
+	api := r.Group("/api/" + apiVersion)
+	groups := map[auth.Permission]*gin.RouterGroup{}
+	for _, rt := range policy(c) {
+		group, ok := groups[rt.permission]
+		if !ok {
+			group = api.Group("")
+			protected := s.Authenticator != nil && rt.permission != ""
+			if protected && s.Limiter != nil {
+				group.Use(middleware.LimitAuthFailures(s.Limiter, s.limit(authLimit)))
+			}
+			if protected {
+				group.Use(s.authenticate(auth.Grants(models.RoleReader, rt.permission)))
+			}
+			if s.Limiter != nil {
+				name, limit := rateLimitGroup(rt.permission)
+				group.Use(middleware.RateLimit(s.Limiter, name, s.limit(limit)))
+			}
+			if protected {
+				group.Use(middleware.Authorize(rt.permission))
+			}
+			groups[rt.permission] = group
+		}
+		group.Handle(rt.method, rt.path, rt.handler)
+	}
+}
+
+// authenticate authenticates the requests to routes, letting those without
+// credentials through while anonymous reads are allowed when the routes are
+// open to readers.
+func (s Security) authenticate(readable bool) gin.HandlerFunc {
+	strict := middleware.Authenticate(s.Authenticator, false)
+	if !readable {
+		return strict
+	}
+	lenient := middleware.Authenticate(s.Authenticator, true)
+	return func(c *gin.Context) {
+		if s.config().Auth.AnonymousReads {
+			lenient(c)
+		} else {
+			strict(c)
+		}
 	}
 }
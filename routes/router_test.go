@@ -1,18 +1,23 @@
 package routes
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
+	"github.com/stretchr/testify/require"
 
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/controllers"
 	"github.com/burhangltekin/byfood/models"
-	"github.com/burhangltekin/byfood/utils"
+	"github.com/burhangltekin/byfood/ratelimit"
+	"github.com/burhangltekin/byfood/repository"
 )
 
 func mockHandler(status int, body string) gin.HandlerFunc {
@@ -35,16 +40,11 @@ func SetupRoutesMock(r *gin.Engine) {
 func TestSetupRoutes(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("failed to connect to in-memory db: %v", err)
-	}
-	if err := db.AutoMigrate(&models.Book{}); err != nil {
-		t.Fatalf("failed to migrate: %v", err)
-	}
-	utils.DB = db
 	testBook := models.Book{Title: "Route Book", Author: "Route Author", Year: 2024}
-	db.Create(&testBook)
+	repo := repository.NewMemoryBookRepository(testBook)
+	books := controllers.NewBookController(repo, repo.Authors(), controllers.BookOptions{})
+	authors := controllers.NewAuthorController(repo.Authors(), books)
+	admin := controllers.NewAdminController(config.NewStore(config.Defaults()), repo)
 
 	tests := []struct {
 		name       string
@@ -55,27 +55,45 @@ func TestSetupRoutes(t *testing.T) {
 		checkBody  func(t *testing.T, body string)
 	}{
 		{
-			name:       "GET /api/books",
+			name:       "GET /api/v1/books",
+			method:     http.MethodGet,
+			url:        "/api/v1/books",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "Route Book")
+			},
+		},
+		{
+			name:       "GET /api/v1/books/export",
 			method:     http.MethodGet,
-			url:        "/api/books",
+			url:        "/api/v1/books/export?format=csv",
 			expectCode: 200,
 			checkBody: func(t *testing.T, body string) {
 				assert.Contains(t, body, "Route Book")
 			},
 		},
 		{
-			name:       "GET /api/books/:id",
+			name:       "GET /api/v1/books/:id",
 			method:     http.MethodGet,
-			url:        "/api/books/1",
+			url:        "/api/v1/books/1",
 			expectCode: 200,
 			checkBody: func(t *testing.T, body string) {
 				assert.Contains(t, body, "Route Book")
 			},
 		},
 		{
-			name:       "POST /api/books",
+			name:       "GET /api/v1/books/search",
+			method:     http.MethodGet,
+			url:        "/api/v1/books/search?q=route",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "Route Book")
+			},
+		},
+		{
+			name:       "POST /api/v1/books",
 			method:     http.MethodPost,
-			url:        "/api/books",
+			url:        "/api/v1/books",
 			body:       `{"title":"T","author":"A","year":2024}`,
 			expectCode: 201,
 			checkBody: func(t *testing.T, body string) {
@@ -83,9 +101,29 @@ func TestSetupRoutes(t *testing.T) {
 			},
 		},
 		{
-			name:       "PUT /api/books/:id",
+			name:       "POST /api/v1/books/bulk",
+			method:     http.MethodPost,
+			url:        "/api/v1/books/bulk",
+			body:       `{"operations":[{"op":"create","book":{"title":"Bulk Book","author":"A"}}]}`,
+			expectCode: 207,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "Bulk Book")
+			},
+		},
+		{
+			name:       "POST /api/v1/books/import",
+			method:     http.MethodPost,
+			url:        "/api/v1/books/import?format=ndjson",
+			body:       `{"title":"Imported Book","author":"A"}`,
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, `"created":1`)
+			},
+		},
+		{
+			name:       "PUT /api/v1/books/:id",
 			method:     http.MethodPut,
-			url:        "/api/books/1",
+			url:        "/api/v1/books/1",
 			body:       `{"title":"Updated","author":"A","year":2024}`,
 			expectCode: 200,
 			checkBody: func(t *testing.T, body string) {
@@ -93,9 +131,19 @@ func TestSetupRoutes(t *testing.T) {
 			},
 		},
 		{
-			name:       "DELETE /api/books/:id",
+			name:       "PATCH /api/v1/books/:id",
+			method:     http.MethodPatch,
+			url:        "/api/v1/books/1",
+			body:       `{"year":1999}`,
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, `"year":1999`)
+			},
+		},
+		{
+			name:       "DELETE /api/v1/books/:id",
 			method:     http.MethodDelete,
-			url:        "/api/books/1",
+			url:        "/api/v1/books/1",
 			expectCode: 200,
 			checkBody: func(t *testing.T, body string) {
 				if len(strings.TrimSpace(body)) > 0 {
@@ -103,10 +151,111 @@ func TestSetupRoutes(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:       "GET /api/v1/books/trash",
+			method:     http.MethodGet,
+			url:        "/api/v1/books/trash",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "deletedAt")
+			},
+		},
+		{
+			name:       "POST /api/v1/books/:id/restore",
+			method:     http.MethodPost,
+			url:        "/api/v1/books/1/restore",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.NotContains(t, body, "deletedAt")
+			},
+		},
+		{
+			name:       "GET /api/v1/authors",
+			method:     http.MethodGet,
+			url:        "/api/v1/authors",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "Route Author")
+			},
+		},
+		{
+			name:       "GET /api/v1/authors/:id",
+			method:     http.MethodGet,
+			url:        "/api/v1/authors/1",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "Route Author")
+			},
+		},
+		{
+			name:       "GET /api/v1/authors/:id/books",
+			method:     http.MethodGet,
+			url:        "/api/v1/authors/1/books",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, `"total":0`)
+			},
+		},
+		{
+			name:       "POST /api/v1/authors",
+			method:     http.MethodPost,
+			url:        "/api/v1/authors",
+			body:       `{"name":"New Author"}`,
+			expectCode: 201,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "New Author")
+			},
+		},
+		{
+			name:       "PUT /api/v1/authors/:id",
+			method:     http.MethodPut,
+			url:        "/api/v1/authors/3",
+			body:       `{"name":"Renamed Author"}`,
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "Renamed Author")
+			},
+		},
+		{
+			name:       "DELETE /api/v1/authors/:id",
+			method:     http.MethodDelete,
+			url:        "/api/v1/authors/3",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "message")
+			},
+		},
+		{
+			name:       "DELETE /api/v1/admin/trash",
+			method:     http.MethodDelete,
+			url:        "/api/v1/admin/trash",
+			expectCode: 200,
+			checkBody: func(t *testing.T, body string) {
+				assert.JSONEq(t, `{"purged":0}`, body)
+			},
+		},
+		{
+			name:       "GET /api/v1/books/:id with malformed id",
+			method:     http.MethodGet,
+			url:        "/api/v1/books/1%20OR%201=1",
+			expectCode: 400,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, `"field":"id"`)
+			},
+		},
+		{
+			name:       "GET unknown route",
+			method:     http.MethodGet,
+			url:        "/api/v1/shelves",
+			expectCode: 404,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, `"detail":"No endpoint matches GET /api/v1/shelves"`)
+			},
+		},
 	}
 
 	r := gin.New()
-	SetupRoutes(r)
+	SetupRoutes(r, "v1", Controllers{Books: books, Authors: authors, Admin: admin}, Security{})
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -126,3 +275,215 @@ func TestSetupRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestSetupRoutesSecurity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "Route Book", Author: "Route Author", Year: 2024})
+	books := controllers.NewBookController(repo, repo.Authors(), controllers.BookOptions{})
+	ctrls := Controllers{
+		Books:   books,
+		Authors: controllers.NewAuthorController(repo.Authors(), books),
+		Admin:   controllers.NewAdminController(config.NewStore(config.Defaults()), repo),
+	}
+	a, err := auth.New(models.AuthConfig{APIKeys: []models.APIKeyConfig{
+		{Name: "reader", Hash: auth.HashAPIKey("reader-key"), Role: models.RoleReader},
+		{Name: "editor", Hash: auth.HashAPIKey("editor-key"), Role: models.RoleEditor},
+		{Name: "admin", Hash: auth.HashAPIKey("admin-key"), Role: models.RoleAdmin},
+	}}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		anonymousReads bool
+		method         string
+		url            string
+		body           string
+		key            string
+		expectCode     int
+		expectDetail   string
+	}{
+		{name: "anonymous read", anonymousReads: true, method: http.MethodGet, url: "/api/v1/books", expectCode: 200},
+		{name: "anonymous author read", anonymousReads: true, method: http.MethodGet, url: "/api/v1/authors/1", expectCode: 200},
+		{name: "anonymous trash read", anonymousReads: true, method: http.MethodGet, url: "/api/v1/books/trash", expectCode: 401},
+		{name: "anonymous write", anonymousReads: true, method: http.MethodDelete, url: "/api/v1/books/1", expectCode: 401},
+		{name: "anonymous admin read", anonymousReads: true, method: http.MethodGet, url: "/api/v1/admin/config", expectCode: 401},
+		{name: "anonymous read not allowed", method: http.MethodGet, url: "/api/v1/books", expectCode: 401},
+		{name: "wrong key", method: http.MethodGet, url: "/api/v1/books", key: "guess", expectCode: 401},
+		{name: "reader reads", method: http.MethodGet, url: "/api/v1/books", key: "reader-key", expectCode: 200},
+		{
+			name: "reader creates", method: http.MethodPost, url: "/api/v1/books", body: `{"title":"T","author":"A","year":2000}`, key: "reader-key",
+			expectCode: 403, expectDetail: "Missing permission books:write, which requires the editor role",
+		},
+		{name: "editor creates", method: http.MethodPost, url: "/api/v1/books", body: `{"title":"T","author":"A","year":2000}`, key: "editor-key", expectCode: 201},
+		{name: "editor renames author", method: http.MethodPut, url: "/api/v1/authors/1", body: `{"name":"Route Writer"}`, key: "editor-key", expectCode: 200},
+		{
+			name: "editor deletes", method: http.MethodDelete, url: "/api/v1/books/1", key: "editor-key",
+			expectCode: 403, expectDetail: "Missing permission books:delete, which requires the admin role",
+		},
+		{
+			name: "editor purges", method: http.MethodDelete, url: "/api/v1/admin/trash", key: "editor-key",
+			expectCode: 403, expectDetail: "Missing permission trash:purge, which requires the admin role",
+		},
+		{name: "editor reads config", method: http.MethodGet, url: "/api/v1/admin/config", key: "editor-key", expectCode: 403},
+		{name: "admin reads config", method: http.MethodGet, url: "/api/v1/admin/config", key: "admin-key", expectCode: 200},
+		{name: "admin deletes", method: http.MethodDelete, url: "/api/v1/books/1", key: "admin-key", expectCode: 200},
+		{name: "admin purges", method: http.MethodDelete, url: "/api/v1/admin/trash", key: "admin-key", expectCode: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			cfg := config.Defaults()
+			cfg.Auth.AnonymousReads = tt.anonymousReads
+			SetupRoutes(r, "v1", ctrls, Security{Authenticator: a, Config: config.NewStore(cfg)})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.key)
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectCode, w.Code, w.Body.String())
+			if tt.expectDetail != "" {
+				assert.Contains(t, w.Body.String(), `"detail":"`+tt.expectDetail+`"`)
+			}
+		})
+	}
+}
+
+func TestSetupRoutesAccounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "Route Book", Author: "Route Author", Year: 2024})
+	cfg := models.AuthConfig{JWT: models.JWTConfig{HMACSecret: strings.Repeat("s", 32), RolesClaim: "roles"}}
+	ctrls := Controllers{
+		Books: controllers.NewBookController(repo, repo.Authors(), controllers.BookOptions{}),
+		Accounts: controllers.NewAccountController(repository.NewMemoryUserRepository(), auth.NewTokenIssuer(cfg.JWT, time.Minute),
+			controllers.AccountOptions{Registration: true, RefreshTokenTTL: time.Hour}),
+	}
+	a, err := auth.New(cfg, nil)
+	require.NoError(t, err)
+	r := gin.New()
+	SetupRoutes(r, "v1", ctrls, Security{Authenticator: a})
+
+	send := func(method, url, body, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// The account endpoints need no credentials, and the access tokens they
+	// issue carry the role of the user.
+	credentials := `{"email":"ada@example.com","password":"correct horse battery"}`
+	require.Equal(t, http.StatusCreated, send(http.MethodPost, "/api/v1/auth/register", credentials, "").Code)
+	w := send(http.MethodPost, "/api/v1/auth/login", credentials, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tokens models.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/v1/books", "", "").Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/books", "", tokens.AccessToken).Code)
+	w = send(http.MethodPost, "/api/v1/books", `{"title":"T","author":"A","year":2000}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPost, "/api/v1/auth/logout", `{"refreshToken":"`+tokens.RefreshToken+`"}`, "").Code)
+}
+
+func TestSetupRoutesRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "Route Book", Author: "Route Author", Year: 2024})
+	books := controllers.NewBookController(repo, repo.Authors(), controllers.BookOptions{})
+	ctrls := Controllers{Books: books, Authors: controllers.NewAuthorController(repo.Authors(), books)}
+	a, err := auth.New(models.AuthConfig{APIKeys: []models.APIKeyConfig{
+		{Name: "reader", Hash: auth.HashAPIKey("reader-key"), Role: models.RoleReader},
+		{Name: "other", Hash: auth.HashAPIKey("other-key"), Role: models.RoleReader},
+	}}, nil)
+	require.NoError(t, err)
+	cfg := config.Defaults()
+	cfg.Auth.AnonymousReads = true
+	cfg.RateLimit = models.RateLimitConfig{
+		Enabled: true,
+		Read:    models.RateLimit{RequestsPerMinute: 1, Burst: 2},
+		Auth:    models.RateLimit{RequestsPerMinute: 1, Burst: 2},
+	}
+	store := config.NewStore(cfg)
+	r := gin.New()
+	SetupRoutes(r, "v1", ctrls, Security{Authenticator: a, Limiter: ratelimit.NewMemoryStore(), Config: store})
+
+	send := func(method, url, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(`{"title":"T","author":"A","year":2000}`))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(auth.APIKeyHeader, key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Books and authors are both read routes and share the limit.
+	w := send(http.MethodGet, "/api/v1/books", "reader-key")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/authors", "reader-key").Code)
+	w = send(http.MethodGet, "/api/v1/books", "reader-key")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/books", "other-key").Code, "each key has its own limit")
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/books", "").Code, "anonymous requests are limited by address")
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/v1/books", "guess").Code, "credentials are checked first")
+
+	// Groups without a limit are not limited.
+	w = send(http.MethodPost, "/api/v1/books", "reader-key")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+
+	// Rejected credentials count against the address, whatever the route.
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "/api/v1/books", "guess").Code)
+	w = send(http.MethodGet, "/api/v1/authors", "other-key")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "credentials are not checked after repeated failures")
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Reloaded limits apply to the requests that follow.
+	cfg.RateLimit.Enabled = false
+	_, _, err = store.Apply(cfg)
+	require.NoError(t, err)
+	w = send(http.MethodGet, "/api/v1/books", "reader-key")
+	assert.Equal(t, http.StatusOK, w.Code, "disabled limits are not checked")
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/authors", "other-key").Code)
+}
+
+// TestSetupRoutesReloadsAnonymousReads checks that anonymous reads follow
+// configuration reloads.
+func TestSetupRoutesReloadsAnonymousReads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewMemoryBookRepository(models.Book{Title: "Route Book", Author: "Route Author", Year: 2024})
+	books := controllers.NewBookController(repo, repo.Authors(), controllers.BookOptions{})
+	a, err := auth.New(models.AuthConfig{}, nil)
+	require.NoError(t, err)
+	cfg := config.Defaults()
+	store := config.NewStore(cfg)
+	r := gin.New()
+	SetupRoutes(r, "v1", Controllers{Books: books}, Security{Authenticator: a, Config: store})
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/books", nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, get())
+	cfg.Auth.AnonymousReads = true
+	_, _, err = store.Apply(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get())
+}
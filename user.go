@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/controllers"
+	"github.com/burhangltekin/byfood/models"
+	"github.com/burhangltekin/byfood/repository"
+)
+
+const userUsage = "usage: byfood [flags] user create EMAIL ROLE|list|unlock EMAIL"
+
+// userPasswordEnv holds the password of the user created by user create.
+const userPasswordEnv = "BYFOOD_USER_PASSWORD"
+
+// Password lengths accepted by user create, as by the register endpoint.
+const (
+	minPasswordLength = 12
+	maxPasswordLength = 256
+)
+
+// runUser implements the user subcommand, which manages user accounts, for
+// instance to create the first admin. The password of a new user is read
+// from BYFOOD_USER_PASSWORD or, when it is unset, from the first line of
+// in. unlock lets a user locked out by failed logins log in again.
+func runUser(ctx context.Context, cfg models.AppConfig, db *gorm.DB, args []string, in io.Reader, w io.Writer) error {
+	var password string
+	switch {
+	case len(args) == 3 && args[0] == "create":
+		if addr, err := mail.ParseAddress(args[1]); err != nil || addr.Address != args[1] {
+			return fmt.Errorf("email %q is not valid", args[1])
+		}
+		if !slices.Contains(models.Roles, args[2]) {
+			return fmt.Errorf("role %q must be one of %s", args[2], strings.Join(models.Roles, ", "))
+		}
+		var err error
+		if password, err = readPassword(in); err != nil {
+			return err
+		}
+	case len(args) == 2 && args[0] == "unlock", len(args) == 1 && args[0] == "list":
+	default:
+		return errors.New(userUsage)
+	}
+	if err := checkSchema(db, cfg.AutoMigrate); err != nil {
+		return err
+	}
+	users := repository.NewGormUserRepository(db)
+
+	switch args[0] {
+	case "create":
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user := models.User{Email: controllers.NormalizeEmail(args[1]), PasswordHash: hash, Role: args[2]}
+		err = users.Create(ctx, &user)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return fmt.Errorf("a user with email %q already exists", user.Email)
+		}
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "Created %s user %s\n", user.Role, user.Email)
+	case "unlock":
+		user, err := users.FindByEmail(ctx, controllers.NormalizeEmail(args[1]))
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("no user has email %q", args[1])
+		}
+		if err != nil {
+			return err
+		}
+		if err := users.Unlock(ctx, user.ID); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "Unlocked user %s\n", user.Email)
+	case "list":
+		list, err := users.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, u := range list {
+			locked := ""
+			if u.LockedUntil != nil {
+				locked = "  locked until " + u.LockedUntil.Format("2006-01-02 15:04:05Z07:00")
+			}
+			_, _ = fmt.Fprintf(w, "%s  %s  created %s%s\n", u.Email, u.Role, u.CreatedAt.Format("2006-01-02 15:04:05Z07:00"), locked)
+		}
+	}
+	return nil
+}
+
+// readPassword returns the password of a new user from BYFOOD_USER_PASSWORD
+// or the first line of in.
+func readPassword(in io.Reader) (string, error) {
+	password, ok := os.LookupEnv(userPasswordEnv)
+	if !ok {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if n := utf8.RuneCountInString(password); n < minPasswordLength || n > maxPasswordLength {
+		return "", fmt.Errorf("the password must have %d to %d characters; set %s or pass it on standard input",
+			minPasswordLength, maxPasswordLength, userPasswordEnv)
+	}
+	return password, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/burhangltekin/byfood/auth"
+	"github.com/burhangltekin/byfood/config"
+	"github.com/burhangltekin/byfood/repository"
+	"github.com/burhangltekin/byfood/utils"
+)
+
+func TestRunCommandUser(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.LogLevel = "error"
+	cfg.AutoMigrate = true
+	cfg.Database.DSN = filepath.Join(t.TempDir(), "books.db")
+	t.Setenv(userPasswordEnv, "correct horse battery")
+
+	var out bytes.Buffer
+	require.Equal(t, exitOK, runCommand(cfg, []string{"user", "create", "Ada@Example.com", "admin"}, &out), out.String())
+	assert.Equal(t, "Created admin user ada@example.com\n", out.String())
+
+	db, err := utils.OpenDB(cfg)
+	require.NoError(t, err)
+	users := repository.NewGormUserRepository(db)
+	user, err := users.FindByEmail(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	ok, err := auth.CheckPassword(user.PasswordHash, "correct horse battery")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, users.Lock(context.Background(), user.ID, user.CreatedAt.Add(time.Hour)))
+	require.NoError(t, utils.CloseDB(db))
+
+	steps := []struct {
+		args         []string
+		expectCode   int
+		expectOutput string
+	}{
+		{args: []string{"user", "create", "ada@example.com", "editor"}, expectCode: exitError, expectOutput: `a user with email "ada@example.com" already exists`},
+		{args: []string{"user", "create", "grace", "editor"}, expectCode: exitError, expectOutput: `email "grace" is not valid`},
+		{args: []string{"user", "create", "Grace <grace@example.com>", "editor"}, expectCode: exitError, expectOutput: "is not valid"},
+		{args: []string{"user", "create", "grace@example.com", "owner"}, expectCode: exitError, expectOutput: `role "owner" must be one of reader, editor, admin`},
+		{args: []string{"user", "list"}, expectCode: exitOK, expectOutput: "ada@example.com  admin  created "},
+		{args: []string{"user", "list"}, expectCode: exitOK, expectOutput: "  locked until "},
+		{args: []string{"user", "unlock", "ADA@example.com"}, expectCode: exitOK, expectOutput: "Unlocked user ada@example.com"},
+		{args: []string{"user", "unlock", "grace@example.com"}, expectCode: exitError, expectOutput: `no user has email "grace@example.com"`},
+		{args: []string{"user", "create", "ada@example.com"}, expectCode: exitError, expectOutput: userUsage},
+	}
+	for _, step := range steps {
+		out.Reset()
+		code := runCommand(cfg, step.args, &out)
+		assert.Equal(t, step.expectCode, code, step.args)
+		assert.Contains(t, out.String(), step.expectOutput, step.args)
+	}
+
+	out.Reset()
+	assert.Equal(t, exitOK, runCommand(cfg, []string{"user", "list"}, &out))
+	assert.NotContains(t, out.String(), "locked until")
+}
+
+func TestReadPassword(t *testing.T) {
+	password, err := readPassword(bytes.NewBufferString("correct horse battery\r\nignored\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "correct horse battery", password)
+
+	_, err = readPassword(bytes.NewBufferString("short\n"))
+	assert.ErrorContains(t, err, "the password must have 12 to 256 characters")
+
+	t.Setenv(userPasswordEnv, "from the environment")
+	password, err = readPassword(bytes.NewBufferString("correct horse battery\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "from the environment", password)
+}
@@ -1,25 +1,136 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
-	"gorm.io/driver/sqlite"
+	"github.com/glebarez/sqlite"
+	gomysql "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
 	"github.com/burhangltekin/byfood/models"
 )
 
-var DB *gorm.DB
+// pingTimeout bounds how long OpenDB waits for the database to answer.
+const pingTimeout = 5 * time.Second
 
-func InitDB() error {
-	var err error
-	DB, err = gorm.Open(sqlite.Open("books.db"), &gorm.Config{})
+// sqliteBusyTimeout is how long, in milliseconds, a SQLite connection waits
+// for another one to release the database before failing.
+const sqliteBusyTimeout = 5000
+
+// OpenDB connects to the database selected by config.Database, applies its
+// connection pool settings and checks that the database answers.
+func OpenDB(config models.AppConfig) (*gorm.DB, error) {
+	dialector, err := dialectorFor(config.Database)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:               logger.Default.LogMode(gormLogLevel(config.LogLevel)),
+		DisableAutomaticPing: true,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to connect to DB: %w", err)
+		return nil, fmt.Errorf("failed to connect to DB: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(config.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(config.Database.ConnMaxLifetime) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+		return nil, fmt.Errorf("failed to connect to DB: %w", err)
+	}
+	return db, nil
+}
+
+// dialectorFor returns the GORM dialector for the configured driver.
+func dialectorFor(config models.DatabaseConfig) (gorm.Dialector, error) {
+	switch config.Driver {
+	case "sqlite":
+		return sqlite.Open(sqliteDSN(config.DSN)), nil
+	case "postgres":
+		return postgres.Open(config.DSN), nil
+	case "mysql":
+		// Times are scanned into time.Time only with parseTime set, and
+		// migration files hold several statements, so both options are
+		// forced on rather than left to every deployment's DSN.
+		dsn, err := gomysql.ParseDSN(config.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MySQL DSN: %w", err)
+		}
+		dsn.ParseTime = true
+		dsn.MultiStatements = true
+		return mysql.Open(dsn.FormatDSN()), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", config.Driver)
+	}
+}
+
+// sqliteDSN adds to dsn the settings that let the pool's connections share
+// the database, unless dsn sets them itself: the write-ahead log, so that
+// reads do not wait for writes, a busy timeout, so that writers wait for
+// each other instead of failing, and immediate transactions, so that a
+// transaction never fails upgrading its read lock to a write lock.
+func sqliteDSN(dsn string) string {
+	var params []string
+	if !strings.Contains(dsn, "journal_mode") {
+		params = append(params, "_pragma=journal_mode(WAL)")
+	}
+	if !strings.Contains(dsn, "busy_timeout") {
+		params = append(params, fmt.Sprintf("_pragma=busy_timeout(%d)", sqliteBusyTimeout))
+	}
+	if !strings.Contains(dsn, "_txlock") {
+		params = append(params, "_txlock=immediate")
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(params, "&")
+}
+
+// gormLogLevel maps the application log level to GORM's: SQL statements are
+// only logged at debug level.
+func gormLogLevel(level string) logger.LogLevel {
+	switch strings.ToLower(level) {
+	case "debug":
+		return logger.Info
+	case "error":
+		return logger.Error
+	default:
+		return logger.Warn
+	}
+}
+
+// CloseDB flushes pending SQLite writes from the write-ahead log OpenDB
+// enables into the database file and closes the connection pool. Queries already running are
+// allowed to finish first.
+func CloseDB(db *gorm.DB) error {
+	if db.Dialector.Name() == "sqlite" {
+		if err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)").Error; err != nil {
+			return fmt.Errorf("failed to checkpoint DB: %w", err)
+		}
 	}
-	err = DB.AutoMigrate(&models.Book{})
+	sqlDB, err := db.DB()
 	if err != nil {
-		return fmt.Errorf("failed to migrate DB schema: %w", err)
+		return fmt.Errorf("failed to access DB: %w", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		return fmt.Errorf("failed to close DB: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+
+	"github.com/burhangltekin/byfood/models"
+)
+
+func TestDialectorFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      models.DatabaseConfig
+		expectName  string
+		expectError string
+	}{
+		{name: "sqlite", config: models.DatabaseConfig{Driver: "sqlite", DSN: "books.db"}, expectName: "sqlite"},
+		{name: "postgres", config: models.DatabaseConfig{Driver: "postgres", DSN: "host=localhost dbname=books"}, expectName: "postgres"},
+		{name: "mysql", config: models.DatabaseConfig{Driver: "mysql", DSN: "user:pass@tcp(localhost:3306)/books"}, expectName: "mysql"},
+		{name: "malformed mysql dsn", config: models.DatabaseConfig{Driver: "mysql", DSN: "user:pass@localhost"}, expectError: "invalid MySQL DSN"},
+		{name: "unknown driver", config: models.DatabaseConfig{Driver: "oracle", DSN: "x"}, expectError: `unsupported database driver "oracle"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := dialectorFor(tt.config)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectName, d.Name())
+		})
+	}
+}
+
+func TestDialectorForForcesMySQLOptions(t *testing.T) {
+	d, err := dialectorFor(models.DatabaseConfig{Driver: "mysql", DSN: "user:pass@tcp(localhost:3306)/books?charset=utf8mb4"})
+	require.NoError(t, err)
+	dsn := d.(*mysql.Dialector).DSN
+	assert.Contains(t, dsn, "parseTime=true")
+	assert.Contains(t, dsn, "multiStatements=true")
+	assert.Contains(t, dsn, "charset=utf8mb4")
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		dsn    string
+		expect string
+	}{
+		{"books.db", "books.db?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"},
+		{"file:books.db?cache=shared", "file:books.db?cache=shared&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"},
+		{"books.db?_pragma=journal_mode(DELETE)&_txlock=deferred", "books.db?_pragma=journal_mode(DELETE)&_txlock=deferred&_pragma=busy_timeout(5000)"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expect, sqliteDSN(tt.dsn), tt.dsn)
+	}
+}
+
+func TestOpenDBSharesSQLiteBetweenConnections(t *testing.T) {
+	db, err := OpenDB(models.AppConfig{
+		LogLevel: "error",
+		Database: models.DatabaseConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "books.db"), MaxOpenConns: 2},
+	})
+	require.NoError(t, err)
+	defer func() { _ = CloseDB(db) }()
+
+	var mode string
+	var timeout int
+	require.NoError(t, db.Raw("PRAGMA journal_mode").Scan(&mode).Error)
+	require.NoError(t, db.Raw("PRAGMA busy_timeout").Scan(&timeout).Error)
+	assert.Equal(t, "wal", mode)
+	assert.Equal(t, sqliteBusyTimeout, timeout)
+}
+
+func TestOpenDBAppliesPoolSettings(t *testing.T) {
+	db, err := OpenDB(models.AppConfig{
+		LogLevel: "error",
+		Database: models.DatabaseConfig{Driver: "sqlite", DSN: ":memory:", MaxOpenConns: 3, MaxIdleConns: 2, ConnMaxLifetime: 60},
+	})
+	require.NoError(t, err)
+	defer func() { _ = CloseDB(db) }()
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	assert.Equal(t, 3, sqlDB.Stats().MaxOpenConnections)
+}